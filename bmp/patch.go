@@ -11,8 +11,15 @@ import (
 	imageExt "github.com/chai2010/image"
 )
 
+func toOptions(opt imageExt.Options) *Options {
+	if opt, ok := opt.(*Options); ok {
+		return opt
+	}
+	return nil
+}
+
 func imageExtEncode(w io.Writer, m image.Image, opt imageExt.Options) error {
-	return Encode(w, m)
+	return EncodeOptions(w, m, toOptions(opt))
 }
 
 func init() {
@@ -12,6 +12,7 @@ import (
 	"image"
 	"image/color"
 	"io"
+	"io/ioutil"
 )
 
 // ErrUnsupported means that the input BMP image uses a valid but unsupported
@@ -26,28 +27,94 @@ func readUint32(b []byte) uint32 {
 	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 }
 
-// decodePaletted reads an 8 bit-per-pixel BMP image from r.
+// Compression types of the BITMAPINFOHEADER and later headers.
+const (
+	biRGB            = 0
+	biRLE8           = 1
+	biRLE4           = 2
+	biBitFields      = 3
+	biJPEG           = 4
+	biPNG            = 5
+	biAlphaBitFields = 6
+)
+
+// Lengths of the known DIB headers.
+const (
+	fileHeaderLen    = 14
+	coreHeaderLen    = 12  // BITMAPCOREHEADER (OS/2 1.x).
+	os2ShortLen      = 16  // OS/2 2.x BITMAPINFOHEADER2 without the optional fields.
+	infoHeaderLen    = 40  // BITMAPINFOHEADER.
+	v2HeaderLen      = 52  // BITMAPV2INFOHEADER, with RGB masks.
+	v3HeaderLen      = 56  // BITMAPV3INFOHEADER, with RGBA masks.
+	os2HeaderLen     = 64  // OS/2 2.x BITMAPINFOHEADER2.
+	v4HeaderLen      = 108 // BITMAPV4HEADER.
+	v5HeaderLen      = 124 // BITMAPV5HEADER.
+	maxDIBHeaderSize = v5HeaderLen
+)
+
+// layout describes how the pixels of a BMP image are stored.
+type layout struct {
+	bpp         int
+	topDown     bool
+	compression uint32
+	// masks are the red, green, blue and alpha bit masks of a 16 or 32
+	// bit-per-pixel image.
+	masks [4]uint32
+	// hasAlpha reports whether the alpha channel of a 32 bit-per-pixel
+	// image, or the alpha mask, is used.
+	hasAlpha bool
+	// imageSize is the size of the pixel data, or 0 if unknown.
+	imageSize uint32
+}
+
+// rowLen returns the length of a row of pixels, which is 4-byte aligned.
+func (l *layout) rowLen(width int) int {
+	return ((width*l.bpp + 31) / 32) * 4
+}
+
+// growPalette returns p extended with opaque black entries so that the
+// index n is valid. Some encoders write palettes shorter than the indices
+// they use.
+func growPalette(p color.Palette, n int) color.Palette {
+	for len(p) <= n {
+		p = append(p, color.RGBA{0, 0, 0, 0xFF})
+	}
+	return p
+}
+
+// decodePaletted reads a 1, 2, 4 or 8 bit-per-pixel BMP image from r.
 // If topDown is false, the image rows will be read bottom-up.
-func decodePaletted(r io.Reader, c image.Config, topDown bool) (image.Image, error) {
-	var tmp [4]byte
+func decodePaletted(r io.Reader, c image.Config, l *layout) (image.Image, error) {
 	paletted := image.NewPaletted(image.Rect(0, 0, c.Width, c.Height), c.ColorModel.(color.Palette))
+	b := make([]byte, l.rowLen(c.Width))
 	y0, y1, yDelta := c.Height-1, -1, -1
-	if topDown {
+	if l.topDown {
 		y0, y1, yDelta = 0, c.Height, +1
 	}
+	maxIndex := 0
 	for y := y0; y != y1; y += yDelta {
-		p := paletted.Pix[y*paletted.Stride : y*paletted.Stride+c.Width]
-		if _, err := io.ReadFull(r, p); err != nil {
+		if _, err := io.ReadFull(r, b); err != nil {
 			return nil, err
 		}
-		// Each row is 4-byte aligned.
-		if c.Width%4 != 0 {
-			_, err := io.ReadFull(r, tmp[:4-c.Width%4])
-			if err != nil {
-				return nil, err
+		p := paletted.Pix[y*paletted.Stride : y*paletted.Stride+c.Width]
+		if l.bpp == 8 {
+			copy(p, b)
+		} else {
+			// Pixels are packed with the leftmost one in the high bits.
+			mask := byte(1<<uint(l.bpp) - 1)
+			perByte := 8 / l.bpp
+			for x := range p {
+				shift := uint(8 - l.bpp*(x%perByte+1))
+				p[x] = b[x/perByte] >> shift & mask
+			}
+		}
+		for _, v := range p {
+			if int(v) > maxIndex {
+				maxIndex = int(v)
 			}
 		}
 	}
+	paletted.Palette = growPalette(paletted.Palette, maxIndex)
 	return paletted, nil
 }
 
@@ -79,12 +146,15 @@ func decodeRGB(r io.Reader, c image.Config, topDown bool) (image.Image, error) {
 
 // decodeNRGBA reads a 32 bit-per-pixel BMP image from r.
 // If topDown is false, the image rows will be read bottom-up.
-func decodeNRGBA(r io.Reader, c image.Config, topDown bool) (image.Image, error) {
+// If hasAlpha is false, or if all alpha values are zero, the fourth byte
+// of each pixel is padding and the image is opaque.
+func decodeNRGBA(r io.Reader, c image.Config, topDown, hasAlpha bool) (image.Image, error) {
 	rgba := image.NewNRGBA(image.Rect(0, 0, c.Width, c.Height))
 	y0, y1, yDelta := c.Height-1, -1, -1
 	if topDown {
 		y0, y1, yDelta = 0, c.Height, +1
 	}
+	transparent := true
 	for y := y0; y != y1; y += yDelta {
 		p := rgba.Pix[y*rgba.Stride : y*rgba.Stride+c.Width*4]
 		if _, err := io.ReadFull(r, p); err != nil {
@@ -93,96 +163,262 @@ func decodeNRGBA(r io.Reader, c image.Config, topDown bool) (image.Image, error)
 		for i := 0; i < len(p); i += 4 {
 			// BMP images are stored in BGRA order rather than RGBA order.
 			p[i+0], p[i+2] = p[i+2], p[i+0]
+			if p[i+3] != 0 {
+				transparent = false
+			}
+		}
+	}
+	if !hasAlpha || transparent {
+		for i := 3; i < len(rgba.Pix); i += 4 {
+			rgba.Pix[i] = 0xFF
 		}
 	}
 	return rgba, nil
 }
 
+// bitField extracts a color channel from pixels with a bit mask and
+// scales it to 8 bits.
+type bitField struct {
+	mask  uint32
+	shift uint
+	max   uint32
+}
+
+func newBitField(mask uint32) bitField {
+	f := bitField{mask: mask}
+	if mask == 0 {
+		return f
+	}
+	for mask&1 == 0 {
+		mask >>= 1
+		f.shift++
+	}
+	f.max = mask
+	return f
+}
+
+func (f bitField) value(v uint32, missing uint8) uint8 {
+	if f.mask == 0 {
+		return missing
+	}
+	return uint8((uint64(v&f.mask>>f.shift)*0xFF + uint64(f.max)/2) / uint64(f.max))
+}
+
+// decodeBitFields reads a 16 or 32 bit-per-pixel BMP image whose channels
+// are given by bit masks from r. If topDown is false, the image rows will
+// be read bottom-up.
+func decodeBitFields(r io.Reader, c image.Config, l *layout) (image.Image, error) {
+	var fields [4]bitField
+	for i, m := range l.masks {
+		fields[i] = newBitField(m)
+	}
+	if !l.hasAlpha {
+		fields[3] = bitField{}
+	}
+
+	rgba := image.NewNRGBA(image.Rect(0, 0, c.Width, c.Height))
+	b := make([]byte, l.rowLen(c.Width))
+	y0, y1, yDelta := c.Height-1, -1, -1
+	if l.topDown {
+		y0, y1, yDelta = 0, c.Height, +1
+	}
+	for y := y0; y != y1; y += yDelta {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		p := rgba.Pix[y*rgba.Stride : y*rgba.Stride+c.Width*4]
+		for x := 0; x < c.Width; x++ {
+			var v uint32
+			if l.bpp == 16 {
+				v = uint32(readUint16(b[2*x:]))
+			} else {
+				v = readUint32(b[4*x:])
+			}
+			p[4*x+0] = fields[0].value(v, 0)
+			p[4*x+1] = fields[1].value(v, 0)
+			p[4*x+2] = fields[2].value(v, 0)
+			p[4*x+3] = fields[3].value(v, 0xFF)
+		}
+	}
+	if !l.hasAlpha {
+		return &image.RGBA{Pix: rgba.Pix, Stride: rgba.Stride, Rect: rgba.Rect}, nil
+	}
+	return rgba, nil
+}
+
 // Decode reads a BMP image from r and returns it as an image.Image.
-// Limitation: The file must be 8, 24 or 32 bits per pixel.
+//
+// Paletted images with 1, 2, 4 or 8 bits per pixel, including RLE4 and
+// RLE8 compressed ones, are returned as an *image.Paletted. Images with an
+// alpha channel are returned as an *image.NRGBA, other ones as an
+// *image.RGBA.
 func Decode(r io.Reader) (image.Image, error) {
-	c, bpp, topDown, err := decodeConfig(r)
+	c, l, err := decodeConfig(r)
 	if err != nil {
 		return nil, err
 	}
-	switch bpp {
-	case 8:
-		return decodePaletted(r, c, topDown)
+	switch l.compression {
+	case biRLE8, biRLE4:
+		return decodeRLE(r, c, &l)
+	case biBitFields, biAlphaBitFields:
+		return decodeBitFields(r, c, &l)
+	}
+	switch l.bpp {
+	case 1, 2, 4, 8:
+		return decodePaletted(r, c, &l)
+	case 16:
+		return decodeBitFields(r, c, &l)
 	case 24:
-		return decodeRGB(r, c, topDown)
+		return decodeRGB(r, c, l.topDown)
 	case 32:
-		return decodeNRGBA(r, c, topDown)
+		return decodeNRGBA(r, c, l.topDown, l.hasAlpha)
 	}
 	panic("unreachable")
 }
 
 // DecodeConfig returns the color model and dimensions of a BMP image without
 // decoding the entire image.
-// Limitation: The file must be 8, 24 or 32 bits per pixel.
 func DecodeConfig(r io.Reader) (image.Config, error) {
-	config, _, _, err := decodeConfig(r)
+	config, _, err := decodeConfig(r)
 	return config, err
 }
 
-func decodeConfig(r io.Reader) (config image.Config, bitsPerPixel int, topDown bool, err error) {
-	// We only support those BMP images that are a BITMAPFILEHEADER
-	// immediately followed by a BITMAPINFOHEADER.
-	const (
-		fileHeaderLen = 14
-		infoHeaderLen = 40
-	)
+// decodeConfig reads the headers and the palette of a BMP image, and skips
+// to the start of the pixel data.
+func decodeConfig(r io.Reader) (config image.Config, l layout, err error) {
 	var b [1024]byte
-	if _, err := io.ReadFull(r, b[:fileHeaderLen+infoHeaderLen]); err != nil {
-		return image.Config{}, 0, false, err
+	if _, err := io.ReadFull(r, b[:fileHeaderLen+4]); err != nil {
+		return image.Config{}, layout{}, err
 	}
 	if string(b[:2]) != "BM" {
-		return image.Config{}, 0, false, errors.New("bmp: invalid format")
+		return image.Config{}, layout{}, errors.New("bmp: invalid format")
 	}
 	offset := readUint32(b[10:14])
-	if readUint32(b[14:18]) != infoHeaderLen {
-		return image.Config{}, 0, false, ErrUnsupported
+	headerLen := readUint32(b[14:18])
+	switch headerLen {
+	case coreHeaderLen, os2ShortLen, infoHeaderLen, v2HeaderLen, v3HeaderLen, os2HeaderLen, v4HeaderLen, v5HeaderLen:
+	default:
+		return image.Config{}, layout{}, ErrUnsupported
+	}
+	h := b[fileHeaderLen : fileHeaderLen+headerLen]
+	if _, err := io.ReadFull(r, h[4:]); err != nil {
+		return image.Config{}, layout{}, err
+	}
+	read := fileHeaderLen + headerLen
+
+	var width, height, planes int
+	paletteEntryLen := 4
+	if headerLen == coreHeaderLen {
+		width, height = int(readUint16(h[4:6])), int(readUint16(h[6:8]))
+		planes, l.bpp = int(readUint16(h[8:10])), int(readUint16(h[10:12]))
+		paletteEntryLen = 3
+	} else {
+		width, height = int(int32(readUint32(h[4:8]))), int(int32(readUint32(h[8:12])))
+		planes, l.bpp = int(readUint16(h[12:14])), int(readUint16(h[14:16]))
 	}
-	width := int(int32(readUint32(b[18:22])))
-	height := int(int32(readUint32(b[22:26])))
 	if height < 0 {
-		height, topDown = -height, true
+		height, l.topDown = -height, true
+	}
+	if width < 0 || planes != 1 {
+		return image.Config{}, layout{}, ErrUnsupported
 	}
-	if width < 0 || height < 0 {
-		return image.Config{}, 0, false, ErrUnsupported
+
+	var colorsUsed uint32
+	if headerLen >= infoHeaderLen {
+		l.compression = readUint32(h[16:20])
+		l.imageSize = readUint32(h[20:24])
+		colorsUsed = readUint32(h[32:36])
+	}
+	if headerLen == os2ShortLen || headerLen == os2HeaderLen {
+		// OS/2 uses the values 3 and 4 for Huffman 1D and RLE24
+		// compression instead of BI_BITFIELDS and BI_JPEG.
+		if l.compression == biBitFields || l.compression == biJPEG {
+			return image.Config{}, layout{}, ErrUnsupported
+		}
 	}
-	// We only support 1 plane, 8 or 24 bits per pixel and no compression.
-	planes, bpp, compression := readUint16(b[26:28]), readUint16(b[28:30]), readUint32(b[30:34])
-	if planes != 1 || compression != 0 {
-		return image.Config{}, 0, false, ErrUnsupported
+
+	// The masks follow a BITMAPINFOHEADER, or are part of the later headers.
+	switch l.compression {
+	case biRGB:
+		switch l.bpp {
+		case 1, 2, 4, 8, 24:
+		case 16:
+			l.masks = [4]uint32{0x7C00, 0x03E0, 0x001F, 0}
+		case 32:
+			// Only the later headers have an alpha mask; with a
+			// BITMAPINFOHEADER the fourth byte may be padding.
+			l.hasAlpha = headerLen < v3HeaderLen || headerLen == os2HeaderLen || readUint32(h[52:56]) != 0
+		default:
+			return image.Config{}, layout{}, ErrUnsupported
+		}
+	case biRLE8, biRLE4:
+		if l.bpp != 8 && l.compression == biRLE8 || l.bpp != 4 && l.compression == biRLE4 || l.topDown {
+			return image.Config{}, layout{}, ErrUnsupported
+		}
+	case biBitFields, biAlphaBitFields:
+		if l.bpp != 16 && l.bpp != 32 {
+			return image.Config{}, layout{}, ErrUnsupported
+		}
+		n := uint32(12)
+		if l.compression == biAlphaBitFields {
+			n = 16
+		}
+		masks := h[40:]
+		if headerLen == infoHeaderLen {
+			masks = b[read : read+n]
+			if _, err := io.ReadFull(r, masks); err != nil {
+				return image.Config{}, layout{}, err
+			}
+			read += n
+		} else if headerLen < v2HeaderLen {
+			return image.Config{}, layout{}, ErrUnsupported
+		} else if headerLen < v3HeaderLen {
+			n = 12
+		} else {
+			// The later headers have an alpha mask for BI_BITFIELDS too.
+			n = 16
+		}
+		for i := uint32(0); i < n/4; i++ {
+			l.masks[i] = readUint32(masks[4*i:])
+		}
+		l.hasAlpha = l.masks[3] != 0
+	default:
+		return image.Config{}, layout{}, ErrUnsupported
 	}
-	switch bpp {
-	case 8:
-		if offset != fileHeaderLen+infoHeaderLen+256*4 {
-			return image.Config{}, 0, false, ErrUnsupported
+
+	// Read the palette.
+	if l.bpp <= 8 {
+		n := uint32(1) << uint(l.bpp)
+		if colorsUsed != 0 && colorsUsed < n {
+			n = colorsUsed
 		}
-		_, err = io.ReadFull(r, b[:256*4])
-		if err != nil {
-			return image.Config{}, 0, false, err
+		p := b[:n*uint32(paletteEntryLen)]
+		if _, err := io.ReadFull(r, p); err != nil {
+			return image.Config{}, layout{}, err
 		}
-		pcm := make(color.Palette, 256)
+		read += uint32(len(p))
+		pcm := make(color.Palette, n)
 		for i := range pcm {
 			// BMP images are stored in BGR order rather than RGB order.
 			// Every 4th byte is padding.
-			pcm[i] = color.RGBA{b[4*i+2], b[4*i+1], b[4*i+0], 0xFF}
+			j := i * paletteEntryLen
+			pcm[i] = color.RGBA{p[j+2], p[j+1], p[j+0], 0xFF}
 		}
-		return image.Config{ColorModel: pcm, Width: width, Height: height}, 8, topDown, nil
-	case 24:
-		if offset != fileHeaderLen+infoHeaderLen {
-			return image.Config{}, 0, false, ErrUnsupported
-		}
-		return image.Config{ColorModel: color.RGBAModel, Width: width, Height: height}, 24, topDown, nil
-	case 32:
-		if offset != fileHeaderLen+infoHeaderLen {
-			return image.Config{}, 0, false, ErrUnsupported
+		config.ColorModel = pcm
+	} else if l.hasAlpha {
+		config.ColorModel = color.NRGBAModel
+	} else {
+		config.ColorModel = color.RGBAModel
+	}
+
+	// Skip the gap between the headers and the pixel data.
+	if offset > read {
+		if _, err := io.CopyN(ioutil.Discard, r, int64(offset-read)); err != nil {
+			return image.Config{}, layout{}, err
 		}
-		return image.Config{ColorModel: color.RGBAModel, Width: width, Height: height}, 32, topDown, nil
 	}
-	return image.Config{}, 0, false, ErrUnsupported
+	config.Width, config.Height = width, height
+	return config, l, nil
 }
 
 func init() {
@@ -5,8 +5,12 @@
 package bmp
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"image"
+	"image/color"
+	"io"
 	"os"
 	"testing"
 
@@ -73,3 +77,240 @@ func TestDecode(t *testing.T) {
 		}
 	}
 }
+
+// dibHeader returns a DIB header of the given length.
+func dibHeader(length, width, height, bpp int, compression, colorsUsed uint32, masks [4]uint32) []byte {
+	h := make([]byte, length)
+	binary.LittleEndian.PutUint32(h[0:], uint32(length))
+	if length == coreHeaderLen {
+		binary.LittleEndian.PutUint16(h[4:], uint16(width))
+		binary.LittleEndian.PutUint16(h[6:], uint16(height))
+		binary.LittleEndian.PutUint16(h[8:], 1)
+		binary.LittleEndian.PutUint16(h[10:], uint16(bpp))
+		return h
+	}
+	binary.LittleEndian.PutUint32(h[4:], uint32(width))
+	binary.LittleEndian.PutUint32(h[8:], uint32(height))
+	binary.LittleEndian.PutUint16(h[12:], 1)
+	binary.LittleEndian.PutUint16(h[14:], uint16(bpp))
+	binary.LittleEndian.PutUint32(h[16:], compression)
+	binary.LittleEndian.PutUint32(h[32:], colorsUsed)
+	for i := 0; i < 4 && 40+4*i+4 <= length; i++ {
+		binary.LittleEndian.PutUint32(h[40+4*i:], masks[i])
+	}
+	return h
+}
+
+// buildBMP returns a BMP file made of a DIB header, the data between the
+// header and the pixels, such as masks or a palette, and the pixel data.
+func buildBMP(header, extra, pix []byte) []byte {
+	offset := fileHeaderLen + len(header) + len(extra)
+	f := []byte{'B', 'M', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(f[2:], uint32(offset+len(pix)))
+	binary.LittleEndian.PutUint32(f[10:], uint32(offset))
+	f = append(f, header...)
+	f = append(f, extra...)
+	return append(f, pix...)
+}
+
+func TestDecodePaletted(t *testing.T) {
+	palette := color.Palette{
+		color.RGBA{0x00, 0x00, 0x00, 0xFF},
+		color.RGBA{0xFF, 0x00, 0x00, 0xFF},
+		color.RGBA{0x00, 0xFF, 0x00, 0xFF},
+		color.RGBA{0x00, 0x00, 0xFF, 0xFF},
+		color.RGBA{0xFF, 0xFF, 0xFF, 0xFF},
+	}
+	for _, tc := range []struct {
+		headerLen int
+		bpp       int
+		colors    int
+	}{
+		{infoHeaderLen, 1, 2},
+		{infoHeaderLen, 2, 3},
+		{infoHeaderLen, 4, 5},
+		{infoHeaderLen, 8, 5},
+		{v5HeaderLen, 4, 5},
+		{coreHeaderLen, 1, 2},
+		{os2HeaderLen, 4, 16},
+	} {
+		const width, height = 13, 3
+		want := image.NewPaletted(image.Rect(0, 0, width, height), palette[:minInt(tc.colors, len(palette))])
+		for i := range want.Pix {
+			want.Pix[i] = uint8(i % len(want.Palette))
+		}
+
+		entryLen := 4
+		if tc.headerLen == coreHeaderLen {
+			entryLen = 3
+		}
+		var extra []byte
+		for i := 0; i < tc.colors; i++ {
+			c := color.RGBA{}
+			if i < len(palette) {
+				c = palette[i].(color.RGBA)
+			}
+			extra = append(extra, []byte{c.B, c.G, c.R, 0}[:entryLen]...)
+		}
+		var pix []byte
+		rowLen := ((width*tc.bpp + 31) / 32) * 4
+		for y := height - 1; y >= 0; y-- {
+			row := make([]byte, rowLen)
+			for x := 0; x < width; x++ {
+				shift := uint(8 - tc.bpp*(x%(8/tc.bpp)+1))
+				row[x*tc.bpp/8] |= want.Pix[y*want.Stride+x] << shift
+			}
+			pix = append(pix, row...)
+		}
+		colorsUsed := uint32(tc.colors)
+		if tc.colors == 1<<uint(tc.bpp) {
+			colorsUsed = 0
+		}
+		h := dibHeader(tc.headerLen, width, height, tc.bpp, biRGB, colorsUsed, [4]uint32{})
+		m, err := Decode(bytes.NewReader(buildBMP(h, extra, pix)))
+		if err != nil {
+			t.Fatalf("header %d, %d bpp: %v", tc.headerLen, tc.bpp, err)
+		}
+		if _, ok := m.(*image.Paletted); !ok {
+			t.Fatalf("header %d, %d bpp: got %T, want *image.Paletted", tc.headerLen, tc.bpp, m)
+		}
+		if err := compare(t, want, m); err != nil {
+			t.Fatalf("header %d, %d bpp: %v", tc.headerLen, tc.bpp, err)
+		}
+	}
+}
+
+func TestDecodeBitFields(t *testing.T) {
+	for _, tc := range []struct {
+		headerLen   int
+		bpp         int
+		compression uint32
+		masks       [4]uint32
+		pix         []byte
+		want        []color.NRGBA
+	}{
+		{
+			// 555 is the default for 16 bits per pixel.
+			infoHeaderLen, 16, biRGB, [4]uint32{},
+			[]byte{0x00, 0x7C, 0xE0, 0x03, 0x1F, 0x00, 0x10, 0x42},
+			[]color.NRGBA{{0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0xFF}, {0, 0, 0xFF, 0xFF}, {0x84, 0x84, 0x84, 0xFF}},
+		},
+		{
+			infoHeaderLen, 16, biBitFields, [4]uint32{0xF800, 0x07E0, 0x001F},
+			[]byte{0x00, 0xF8, 0xE0, 0x07, 0x1F, 0x00, 0x10, 0x84},
+			[]color.NRGBA{{0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0xFF}, {0, 0, 0xFF, 0xFF}, {0x84, 0x82, 0x84, 0xFF}},
+		},
+		{
+			infoHeaderLen, 32, biAlphaBitFields, [4]uint32{0xFF, 0xFF00, 0xFF0000, 0xFF000000},
+			[]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			[]color.NRGBA{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}, {13, 14, 15, 16}},
+		},
+		{
+			v5HeaderLen, 32, biBitFields, [4]uint32{0xFF0000, 0xFF00, 0xFF, 0xFF000000},
+			[]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			[]color.NRGBA{{3, 2, 1, 4}, {7, 6, 5, 8}, {11, 10, 9, 12}, {15, 14, 13, 16}},
+		},
+		{
+			// A V4 header without an alpha mask: the fourth byte is padding.
+			v4HeaderLen, 32, biRGB, [4]uint32{},
+			[]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			[]color.NRGBA{{3, 2, 1, 0xFF}, {7, 6, 5, 0xFF}, {11, 10, 9, 0xFF}, {15, 14, 13, 0xFF}},
+		},
+		{
+			// A BITMAPINFOHEADER with all alpha values zero is opaque.
+			infoHeaderLen, 32, biRGB, [4]uint32{},
+			[]byte{1, 2, 3, 0, 5, 6, 7, 0, 9, 10, 11, 0, 13, 14, 15, 0},
+			[]color.NRGBA{{3, 2, 1, 0xFF}, {7, 6, 5, 0xFF}, {11, 10, 9, 0xFF}, {15, 14, 13, 0xFF}},
+		},
+	} {
+		var extra []byte
+		if tc.headerLen == infoHeaderLen && tc.compression != biRGB {
+			n := 3
+			if tc.compression == biAlphaBitFields {
+				n = 4
+			}
+			for _, m := range tc.masks[:n] {
+				extra = append(extra, byte(m), byte(m>>8), byte(m>>16), byte(m>>24))
+			}
+		}
+		h := dibHeader(tc.headerLen, 4, -1, tc.bpp, tc.compression, 0, tc.masks)
+		m, err := Decode(bytes.NewReader(buildBMP(h, extra, tc.pix)))
+		if err != nil {
+			t.Fatalf("header %d, %d bpp: %v", tc.headerLen, tc.bpp, err)
+		}
+		for x, c := range tc.want {
+			if got := color.NRGBAModel.Convert(m.At(x, 0)); got != c {
+				t.Fatalf("header %d, %d bpp: pixel %d: got %v, want %v", tc.headerLen, tc.bpp, x, got, c)
+			}
+		}
+	}
+}
+
+func TestDecodeRLE(t *testing.T) {
+	palette := make([]byte, 16*4)
+	for _, tc := range []struct {
+		compression   uint32
+		width, height int
+		data          []byte
+		want          []uint8
+	}{
+		{
+			biRLE8, 4, 2,
+			[]byte{0x03, 0x05, 0x01, 0x07, 0x00, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03, 0x00, 0x01, 0x04, 0x00, 0x01},
+			[]uint8{1, 2, 3, 4, 5, 5, 5, 7},
+		},
+		{
+			biRLE8, 4, 2,
+			[]byte{0x00, 0x02, 0x02, 0x01, 0x02, 0x09, 0x00, 0x01},
+			[]uint8{0, 0, 9, 9, 0, 0, 0, 0},
+		},
+		{
+			biRLE4, 8, 1,
+			[]byte{0x00, 0x05, 0x12, 0x34, 0x50, 0x00, 0x03, 0x67, 0x00, 0x01},
+			[]uint8{1, 2, 3, 4, 5, 6, 7, 6},
+		},
+		{
+			// The end-of-bitmap code is missing.
+			biRLE4, 5, 1,
+			[]byte{0x05, 0x12},
+			[]uint8{1, 2, 1, 2, 1},
+		},
+	} {
+		bpp := 8
+		if tc.compression == biRLE4 {
+			bpp = 4
+		}
+		h := dibHeader(infoHeaderLen, tc.width, tc.height, bpp, tc.compression, 16, [4]uint32{})
+		m, err := Decode(bytes.NewReader(buildBMP(h, palette, tc.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, ok := m.(*image.Paletted)
+		if !ok {
+			t.Fatalf("got %T, want *image.Paletted", m)
+		}
+		if !bytes.Equal(p.Pix, tc.want) {
+			t.Fatalf("got %v, want %v", p.Pix, tc.want)
+		}
+	}
+}
+
+func TestDecodeRLEImageSize(t *testing.T) {
+	palette := make([]byte, 4)
+	for _, tc := range []struct {
+		imageSize uint32
+		err       error
+	}{
+		// The size is checked before the data is allocated.
+		{0xF0000000, errRLE},
+		{2*5*2 + 3, errRLE},
+		{6, io.ErrUnexpectedEOF},
+	} {
+		h := dibHeader(infoHeaderLen, 4, 2, 8, biRLE8, 1, [4]uint32{})
+		binary.LittleEndian.PutUint32(h[20:], tc.imageSize)
+		data := buildBMP(h, palette, []byte{0x04, 0x00})
+		if _, err := Decode(bytes.NewReader(data)); err != tc.err {
+			t.Fatalf("image size %#x: got error %v, want %v", tc.imageSize, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bmp
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+// RLE escape codes, which follow a zero count byte.
+const (
+	rleEndOfLine   = 0
+	rleEndOfBitmap = 1
+	rleDelta       = 2
+)
+
+var errRLE = errors.New("bmp: invalid RLE data")
+
+// decodeRLE reads a BI_RLE8 or BI_RLE4 compressed BMP image from r.
+// RLE images are always stored bottom-up. Pixels skipped by delta and
+// end-of-line codes have the color index 0.
+func decodeRLE(r io.Reader, c image.Config, l *layout) (image.Image, error) {
+	var data []byte
+	var err error
+	if l.imageSize != 0 {
+		// At worst, every pixel is a run of its own and every row ends
+		// with an end-of-line code.
+		if uint64(l.imageSize) > 2*(uint64(c.Width)+1)*uint64(c.Height)+2 {
+			return nil, errRLE
+		}
+		data, err = ioutil.ReadAll(io.LimitReader(r, int64(l.imageSize)))
+		if err == nil && len(data) < int(l.imageSize) {
+			err = io.ErrUnexpectedEOF
+		}
+	} else {
+		data, err = ioutil.ReadAll(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	paletted := image.NewPaletted(image.Rect(0, 0, c.Width, c.Height), c.ColorModel.(color.Palette))
+	x, y := 0, c.Height-1
+	maxIndex := 0
+	set := func(v byte) {
+		if x < c.Width && y >= 0 {
+			paletted.Pix[y*paletted.Stride+x] = v
+			if int(v) > maxIndex {
+				maxIndex = int(v)
+			}
+		}
+		x++
+	}
+	// pixel returns the i-th pixel packed in p.
+	pixel := func(p []byte, i int) byte {
+		if l.compression == biRLE8 {
+			return p[i]
+		}
+		return p[i/2] >> uint(4*(1-i%2)) & 0x0F
+	}
+
+	// Some encoders omit the end-of-bitmap code at the end of the data.
+	for i := 0; i+2 <= len(data); {
+		n, v := int(data[i]), data[i+1]
+		i += 2
+		if n != 0 {
+			// Encoded mode: a run of n pixels. In RLE4 images, the
+			// pixels alternate between the high and low nibbles of v.
+			run := []byte{v, v}
+			for k := 0; k < n; k++ {
+				set(pixel(run, k%2))
+			}
+			continue
+		}
+		switch v {
+		case rleEndOfLine:
+			x, y = 0, y-1
+		case rleEndOfBitmap:
+			i = len(data)
+		case rleDelta:
+			if i+2 > len(data) {
+				return nil, errRLE
+			}
+			x += int(data[i])
+			y -= int(data[i+1])
+			i += 2
+		default:
+			// Absolute mode: v literal pixels, padded to a 16-bit boundary.
+			n = int(v)
+			size := n
+			if l.compression == biRLE4 {
+				size = (n + 1) / 2
+			}
+			if i+size > len(data) {
+				return nil, errRLE
+			}
+			for k := 0; k < n; k++ {
+				set(pixel(data[i:], k))
+			}
+			i += (size + 1) &^ 1
+		}
+	}
+	paletted.Palette = growPalette(paletted.Palette, maxIndex)
+	return paletted, nil
+}
+
+// encodeRLE returns the color indices of m compressed with BI_RLE8 if bpp
+// is 8, or with BI_RLE4 if bpp is 4.
+//
+// Runs of at least 3 equal pixels use the encoded mode, and other pixels
+// are written in absolute mode when there are at least 3 of them.
+func encodeRLE(m *image.Paletted, bpp int) []byte {
+	var data []byte
+	// literal writes up to 255 pixels that are not part of a run.
+	literal := func(p []uint8) {
+		if len(p) < 3 {
+			// Absolute mode needs at least 3 pixels.
+			for _, v := range p {
+				if bpp == 4 {
+					v = v<<4 | v
+				}
+				data = append(data, 1, v)
+			}
+			return
+		}
+		data = append(data, 0, byte(len(p)))
+		n := len(data)
+		if bpp == 8 {
+			data = append(data, p...)
+		} else {
+			for i := 0; i < len(p); i += 2 {
+				v := p[i] << 4
+				if i+1 < len(p) {
+					v |= p[i+1]
+				}
+				data = append(data, v)
+			}
+		}
+		// Absolute mode data is padded to a 16-bit boundary.
+		if (len(data)-n)%2 != 0 {
+			data = append(data, 0)
+		}
+	}
+	// flush writes the pixels of p in absolute mode.
+	flush := func(p []uint8) {
+		for len(p) > 0 {
+			n := minInt(len(p), 255)
+			literal(p[:n])
+			p = p[n:]
+		}
+	}
+
+	d := m.Rect.Size()
+	for y := d.Y - 1; y >= 0; y-- {
+		row := m.Pix[y*m.Stride : y*m.Stride+d.X]
+		lit := 0 // Start of the pixels not written yet.
+		for x := 0; x < len(row); {
+			n := 1
+			for x+n < len(row) && n < 255 && row[x+n] == row[x] {
+				n++
+			}
+			if n < 3 {
+				x += n
+				continue
+			}
+			flush(row[lit:x])
+			v := row[x]
+			if bpp == 4 {
+				v = v<<4 | v
+			}
+			data = append(data, byte(n), v)
+			x += n
+			lit = x
+		}
+		flush(row[lit:])
+		if y > 0 {
+			data = append(data, 0, rleEndOfLine)
+		}
+	}
+	return append(data, 0, rleEndOfBitmap)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
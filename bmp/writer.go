@@ -6,8 +6,14 @@ package bmp
 
 import (
 	"encoding/binary"
+	"errors"
 	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
 	"io"
+
+	"github.com/chai2010/image/quantize"
 )
 
 type header struct {
@@ -28,131 +34,330 @@ type header struct {
 	colorImportant  uint32
 }
 
-func encodePaletted(w io.Writer, pix []uint8, dx, dy, stride, step int) error {
-	var padding []byte
-	if dx < step {
-		padding = make([]byte, step-dx)
+// v5Header holds the fields that a BITMAPV5HEADER adds to a
+// BITMAPINFOHEADER.
+type v5Header struct {
+	redMask     uint32
+	greenMask   uint32
+	blueMask    uint32
+	alphaMask   uint32
+	csType      uint32
+	endpoints   [9]uint32
+	gammaRed    uint32
+	gammaGreen  uint32
+	gammaBlue   uint32
+	intent      uint32
+	profileData uint32
+	profileSize uint32
+	reserved    uint32
+}
+
+// Values of the color space fields of a BITMAPV5HEADER.
+const (
+	lcsSRGB            = 0x73524742 // 'sRGB'
+	lcsProfileEmbedded = 0x4D424544 // 'MBED'
+	lcsGMImages        = 4          // Perceptual rendering intent.
+)
+
+// Options are the encoding parameters.
+type Options struct {
+	// BitsPerPixel is the bit depth of the written image: 1, 4, 8, 16,
+	// 24 or 32. Images with up to 8 bits per pixel have a palette, 16 bit
+	// images have 5 bits per color channel and 32 bit images have an
+	// alpha channel. If BitsPerPixel is 0, gray and paletted images are
+	// written with 8 bits per pixel, images with transparent pixels with
+	// 32 bits and other images with 24 bits.
+	BitsPerPixel int
+	// TopDown writes the rows from top to bottom instead of bottom-up.
+	// It cannot be used together with RLE.
+	TopDown bool
+	// RLE compresses images with 8 bits per pixel with BI_RLE8 and images
+	// with 4 bits per pixel with BI_RLE4. It is ignored for other depths.
+	RLE bool
+	// ICCProfile is an ICC color profile embedded in the file.
+	ICCProfile []byte
+	// Quantize, if not nil, chooses the palette of images that are written
+	// with at most 8 bits per pixel, instead of a fixed palette. Its
+	// NumColors is limited to 1<<BitsPerPixel. If BitsPerPixel is 0, such
+	// images are written with 8 bits per pixel.
+	Quantize *quantize.Options
+}
+
+func (opt *Options) Lossless() bool {
+	return true
+}
+
+func (opt *Options) Quality() float32 {
+	return 0
+}
+
+// vgaPalette is the palette of the 16 standard Windows colors.
+var vgaPalette = color.Palette{
+	color.RGBA{0x00, 0x00, 0x00, 0xFF},
+	color.RGBA{0x80, 0x00, 0x00, 0xFF},
+	color.RGBA{0x00, 0x80, 0x00, 0xFF},
+	color.RGBA{0x80, 0x80, 0x00, 0xFF},
+	color.RGBA{0x00, 0x00, 0x80, 0xFF},
+	color.RGBA{0x80, 0x00, 0x80, 0xFF},
+	color.RGBA{0x00, 0x80, 0x80, 0xFF},
+	color.RGBA{0xC0, 0xC0, 0xC0, 0xFF},
+	color.RGBA{0x80, 0x80, 0x80, 0xFF},
+	color.RGBA{0xFF, 0x00, 0x00, 0xFF},
+	color.RGBA{0x00, 0xFF, 0x00, 0xFF},
+	color.RGBA{0xFF, 0xFF, 0x00, 0xFF},
+	color.RGBA{0x00, 0x00, 0xFF, 0xFF},
+	color.RGBA{0xFF, 0x00, 0xFF, 0xFF},
+	color.RGBA{0x00, 0xFF, 0xFF, 0xFF},
+	color.RGBA{0xFF, 0xFF, 0xFF, 0xFF},
+}
+
+// grayPalette returns a palette of n evenly spaced gray levels.
+func grayPalette(n int) color.Palette {
+	p := make(color.Palette, n)
+	for i := range p {
+		p[i] = color.Gray{uint8(i * 0xFF / (n - 1))}
 	}
-	for y := dy - 1; y >= 0; y-- {
-		min := y*stride + 0
-		max := y*stride + dx
-		if _, err := w.Write(pix[min:max]); err != nil {
-			return err
+	return p
+}
+
+// toPaletted returns m as a paletted image with at most 1<<bpp colors.
+// Paletted images with a small enough palette are returned unchanged.
+// If q is not nil, other images are quantized with q. Otherwise gray images
+// are mapped to gray levels, and other images to the nearest colors of a
+// fixed palette.
+func toPaletted(m image.Image, bpp int, q *quantize.Options) *image.Paletted {
+	n := 1 << uint(bpp)
+	if p, ok := m.(*image.Paletted); ok && len(p.Palette) <= n {
+		return p
+	}
+	if q != nil {
+		opt := *q
+		if opt.NumColors < 1 || opt.NumColors > n {
+			opt.NumColors = n
 		}
-		if padding != nil {
-			if _, err := w.Write(padding); err != nil {
-				return err
+		return quantize.Paletted(m, &opt)
+	}
+	var p color.Palette
+	switch {
+	case m.ColorModel() == color.GrayModel || m.ColorModel() == color.Gray16Model:
+		p = grayPalette(n)
+	case bpp == 8:
+		p = palette.Plan9
+	case bpp == 4:
+		p = vgaPalette
+	default:
+		p = grayPalette(2)
+	}
+	b := m.Bounds()
+	dst := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), p)
+	draw.Draw(dst, dst.Rect, m, b.Min, draw.Src)
+	return dst
+}
+
+// isOpaque reports whether all pixels of m are fully opaque.
+func isOpaque(m image.Image) bool {
+	if o, ok := m.(interface {
+		Opaque() bool
+	}); ok {
+		return o.Opaque()
+	}
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := m.At(x, y).RGBA(); a != 0xFFFF {
+				return false
 			}
 		}
 	}
-	return nil
+	return true
 }
 
-func encodeRGBA(w io.Writer, pix []uint8, dx, dy, stride, step int) error {
-	buf := make([]byte, step)
-	for y := dy - 1; y >= 0; y-- {
-		min := y*stride + 0
-		max := y*stride + dx*4
-		off := 0
-		for i := min; i < max; i += 4 {
-			buf[off+2] = pix[i+0]
-			buf[off+1] = pix[i+1]
-			buf[off+0] = pix[i+2]
-			off += 3
-		}
-		if _, err := w.Write(buf); err != nil {
-			return err
-		}
+// defaultBitsPerPixel returns the bit depth used for m if the options do
+// not set one.
+func defaultBitsPerPixel(m image.Image) int {
+	switch m.(type) {
+	case *image.Gray, *image.Paletted:
+		return 8
 	}
-	return nil
+	if !isOpaque(m) {
+		return 32
+	}
+	return 24
 }
 
-func encode(w io.Writer, m image.Image, step int) error {
+// encodeRows returns the uncompressed pixel data of m, with rows of step
+// bytes. Paletted images are written with their color indices.
+func encodeRows(m image.Image, bpp, step int, topDown bool) []byte {
 	b := m.Bounds()
-	buf := make([]byte, step)
-	for y := b.Max.Y - 1; y >= b.Min.Y; y-- {
-		off := 0
-		for x := b.Min.X; x < b.Max.X; x++ {
-			r, g, b, _ := m.At(x, y).RGBA()
-			buf[off+2] = byte(r >> 8)
-			buf[off+1] = byte(g >> 8)
-			buf[off+0] = byte(b >> 8)
-			off += 3
+	d := b.Size()
+	data := make([]byte, d.Y*step)
+	for y := 0; y < d.Y; y++ {
+		row := data[(d.Y-1-y)*step:]
+		if topDown {
+			row = data[y*step:]
 		}
-		if _, err := w.Write(buf); err != nil {
-			return err
+		switch bpp {
+		case 1, 2, 4, 8:
+			p := m.(*image.Paletted)
+			pix := p.Pix[y*p.Stride:]
+			if bpp == 8 {
+				copy(row, pix[:d.X])
+				break
+			}
+			perByte := 8 / bpp
+			for x := 0; x < d.X; x++ {
+				row[x/perByte] |= pix[x] << uint(8-bpp*(x%perByte+1))
+			}
+		case 16:
+			for x := 0; x < d.X; x++ {
+				r, g, bl, _ := m.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				v := uint16(r>>11)<<10 | uint16(g>>11)<<5 | uint16(bl>>11)
+				row[2*x+0] = byte(v)
+				row[2*x+1] = byte(v >> 8)
+			}
+		case 24:
+			if rgba, ok := m.(*image.RGBA); ok {
+				pix := rgba.Pix[y*rgba.Stride:]
+				for x := 0; x < d.X; x++ {
+					// BMP images are stored in BGR order rather than RGB order.
+					row[3*x+0] = pix[4*x+2]
+					row[3*x+1] = pix[4*x+1]
+					row[3*x+2] = pix[4*x+0]
+				}
+				break
+			}
+			for x := 0; x < d.X; x++ {
+				r, g, bl, _ := m.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				row[3*x+0] = byte(bl >> 8)
+				row[3*x+1] = byte(g >> 8)
+				row[3*x+2] = byte(r >> 8)
+			}
+		case 32:
+			for x := 0; x < d.X; x++ {
+				c := color.NRGBAModel.Convert(m.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+				row[4*x+0] = c.B
+				row[4*x+1] = c.G
+				row[4*x+2] = c.R
+				row[4*x+3] = c.A
+			}
 		}
 	}
-	return nil
+	return data
 }
 
 // Encode writes the image m to w in BMP format.
 func Encode(w io.Writer, m image.Image) error {
+	return EncodeOptions(w, m, nil)
+}
+
+// EncodeOptions writes the image m to w in BMP format with the given
+// options. Default parameters are used if a nil *Options is passed.
+//
+// Images with 32 bits per pixel, or with an ICC profile, are written with
+// a BITMAPV5HEADER, and other images with a BITMAPINFOHEADER.
+func EncodeOptions(w io.Writer, m image.Image, opt *Options) error {
+	if opt == nil {
+		opt = new(Options)
+	}
+	bpp := opt.BitsPerPixel
+	if bpp == 0 {
+		bpp = defaultBitsPerPixel(m)
+		if opt.Quantize != nil {
+			bpp = 8
+		}
+	}
+	switch bpp {
+	case 1, 4, 8, 16, 24, 32:
+	default:
+		return errors.New("bmp: unsupported bits per pixel")
+	}
+	compress := opt.RLE && (bpp == 4 || bpp == 8)
+	if compress && opt.TopDown {
+		return errors.New("bmp: RLE images cannot be top-down")
+	}
+
 	d := m.Bounds().Size()
+	headerLen := infoHeaderLen
+	if bpp == 32 || opt.ICCProfile != nil {
+		headerLen = v5HeaderLen
+	}
 	h := &header{
 		sigBM:         [2]byte{'B', 'M'},
-		fileSize:      14 + 40,
-		pixOffset:     14 + 40,
-		dibHeaderSize: 40,
+		dibHeaderSize: uint32(headerLen),
 		width:         uint32(d.X),
 		height:        uint32(d.Y),
 		colorPlane:    1,
+		bpp:           uint16(bpp),
+	}
+	if opt.TopDown {
+		h.height = uint32(-d.Y)
 	}
 
-	var step int
-	var palette []byte
-	switch m := m.(type) {
-	case *image.Gray:
-		step = (d.X + 3) &^ 3
-		palette = make([]byte, 1024)
-		for i := 0; i < 256; i++ {
-			palette[i*4+0] = uint8(i)
-			palette[i*4+1] = uint8(i)
-			palette[i*4+2] = uint8(i)
-			palette[i*4+3] = 0xFF
+	var colorTable []byte
+	if bpp <= 8 {
+		p := toPaletted(m, bpp, opt.Quantize)
+		m = p
+		colorTable = make([]byte, 4*len(p.Palette))
+		for i, c := range p.Palette {
+			r, g, b, _ := c.RGBA()
+			colorTable[i*4+0] = uint8(b >> 8)
+			colorTable[i*4+1] = uint8(g >> 8)
+			colorTable[i*4+2] = uint8(r >> 8)
 		}
-		h.imageSize = uint32(d.Y * step)
-		h.fileSize += uint32(len(palette)) + h.imageSize
-		h.pixOffset += uint32(len(palette))
-		h.bpp = 8
-
-	case *image.Paletted:
-		step = (d.X + 3) &^ 3
-		palette = make([]byte, 1024)
-		for i := 0; i < len(m.Palette) && i < 256; i++ {
-			r, g, b, _ := m.Palette[i].RGBA()
-			palette[i*4+0] = uint8(b >> 8)
-			palette[i*4+1] = uint8(g >> 8)
-			palette[i*4+2] = uint8(r >> 8)
-			palette[i*4+3] = 0xFF
+		if len(p.Palette) < 1<<uint(bpp) {
+			h.colorUse = uint32(len(p.Palette))
 		}
-		h.imageSize = uint32(d.Y * step)
-		h.fileSize += uint32(len(palette)) + h.imageSize
-		h.pixOffset += uint32(len(palette))
-		h.bpp = 8
+	}
+
+	var data []byte
+	switch {
+	case compress && bpp == 8:
+		h.compression = biRLE8
+		data = encodeRLE(m.(*image.Paletted), 8)
+	case compress:
+		h.compression = biRLE4
+		data = encodeRLE(m.(*image.Paletted), 4)
 	default:
-		step = (3*d.X + 3) &^ 3
-		h.imageSize = uint32(d.Y * step)
-		h.fileSize += h.imageSize
-		h.bpp = 24
+		data = encodeRows(m, bpp, ((d.X*bpp+31)/32)*4, opt.TopDown)
 	}
 
+	var v5 *v5Header
+	if headerLen == v5HeaderLen {
+		v5 = &v5Header{
+			csType: lcsSRGB,
+			intent: lcsGMImages,
+		}
+		if bpp == 32 {
+			h.compression = biBitFields
+			v5.redMask = 0x00FF0000
+			v5.greenMask = 0x0000FF00
+			v5.blueMask = 0x000000FF
+			v5.alphaMask = 0xFF000000
+		}
+		if opt.ICCProfile != nil {
+			// The profile follows the pixel data. Its offset is
+			// relative to the start of the BITMAPV5HEADER.
+			v5.csType = lcsProfileEmbedded
+			v5.profileData = uint32(headerLen + len(colorTable) + len(data))
+			v5.profileSize = uint32(len(opt.ICCProfile))
+		}
+	}
+	h.pixOffset = uint32(fileHeaderLen + headerLen + len(colorTable))
+	h.imageSize = uint32(len(data))
+	h.fileSize = h.pixOffset + h.imageSize + uint32(len(opt.ICCProfile))
+
 	if err := binary.Write(w, binary.LittleEndian, h); err != nil {
 		return err
 	}
-	if palette != nil {
-		if err := binary.Write(w, binary.LittleEndian, palette); err != nil {
+	if v5 != nil {
+		if err := binary.Write(w, binary.LittleEndian, v5); err != nil {
 			return err
 		}
 	}
-
-	switch m := m.(type) {
-	case *image.Gray:
-		return encodePaletted(w, m.Pix, d.X, d.Y, m.Stride, step)
-	case *image.Paletted:
-		return encodePaletted(w, m.Pix, d.X, d.Y, m.Stride, step)
-	case *image.RGBA:
-		return encodeRGBA(w, m.Pix, d.X, d.Y, m.Stride, step)
+	for _, p := range [][]byte{colorTable, data, opt.ICCProfile} {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
 	}
-	return encode(w, m, step)
+	return nil
 }
@@ -7,9 +7,14 @@ package bmp
 import (
 	"bytes"
 	"image"
+	"image/color/palette"
+	"image/draw"
 	"io/ioutil"
 	"os"
 	"testing"
+
+	imageExt "github.com/chai2010/image"
+	"github.com/chai2010/image/quantize"
 )
 
 func openImage(filename string) (image.Image, error) {
@@ -41,6 +46,156 @@ func TestEncode(t *testing.T) {
 	compare(t, img0, img1)
 }
 
+func TestEncodeOptions(t *testing.T) {
+	rgba, err := openImage("video-001.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := rgba.Bounds()
+	nrgba := image.NewNRGBA(b)
+	draw.Draw(nrgba, b, rgba, b.Min, draw.Src)
+	for i := 3; i < len(nrgba.Pix); i += 4 {
+		nrgba.Pix[i] = uint8(i / 4)
+	}
+	paletted := func(n int) *image.Paletted {
+		p := image.NewPaletted(b, palette.Plan9[:n])
+		for i := range p.Pix {
+			// Runs of several lengths, for the RLE encoder.
+			p.Pix[i] = uint8(i / (i%7 + 1) % n)
+		}
+		return p
+	}
+
+	for _, tc := range []struct {
+		m   image.Image
+		opt *Options
+	}{
+		{rgba, &Options{BitsPerPixel: 24, TopDown: true}},
+		{rgba, &Options{BitsPerPixel: 32}},
+		{nrgba, nil},
+		{nrgba, &Options{TopDown: true, ICCProfile: []byte("profile")}},
+		{paletted(2), &Options{BitsPerPixel: 1}},
+		{paletted(2), &Options{BitsPerPixel: 1, TopDown: true}},
+		{paletted(13), &Options{BitsPerPixel: 4}},
+		{paletted(13), &Options{BitsPerPixel: 4, RLE: true}},
+		{paletted(200), &Options{BitsPerPixel: 8, RLE: true}},
+		{paletted(256), &Options{RLE: true, ICCProfile: []byte("profile")}},
+	} {
+		buf := new(bytes.Buffer)
+		if err := EncodeOptions(buf, tc.m, tc.opt); err != nil {
+			t.Fatal(err)
+		}
+		m, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%T, %+v: %v", tc.m, tc.opt, err)
+		}
+		if err := compare(t, tc.m, m); err != nil {
+			t.Fatalf("%T, %+v: %v", tc.m, tc.opt, err)
+		}
+	}
+}
+
+func TestEncode16(t *testing.T) {
+	img, err := openImage("video-001.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := EncodeOptions(buf, img, &Options{BitsPerPixel: 16}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r0, g0, b0, _ := img.At(x, y).RGBA()
+			r1, g1, b1, _ := m.At(x, y).RGBA()
+			for _, d := range []int{int(r0) - int(r1), int(g0) - int(g1), int(b0) - int(b1)} {
+				// 5 bits per channel.
+				if d < -0x0900 || d > 0x0900 {
+					t.Fatalf("pixel at (%d, %d): got %v, want %v", x, y, m.At(x, y), img.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeICCProfile(t *testing.T) {
+	img, err := openImage("video-001.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := []byte("ICC profile data")
+	buf := new(bytes.Buffer)
+	// The options are passed through the image package.
+	if err := imageExt.Encode("bmp", buf, img, &Options{ICCProfile: profile}); err != nil {
+		t.Fatal(err)
+	}
+	p := buf.Bytes()
+	if !bytes.HasSuffix(p, profile) {
+		t.Fatal("the profile is not at the end of the file")
+	}
+	h := p[fileHeaderLen:]
+	if got := readUint32(h[0:]); got != v5HeaderLen {
+		t.Fatalf("got header length %d, want %d", got, v5HeaderLen)
+	}
+	if got := readUint32(h[56:]); got != lcsProfileEmbedded {
+		t.Fatalf("got color space %#x, want %#x", got, lcsProfileEmbedded)
+	}
+	offset, size := readUint32(h[112:]), readUint32(h[116:])
+	if !bytes.Equal(h[offset:offset+size], profile) {
+		t.Fatalf("got profile %q, want %q", h[offset:offset+size], profile)
+	}
+}
+
+func TestEncodeQuantize(t *testing.T) {
+	img, err := openImage("video-001.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		opt     *Options
+		bpp     int
+		palette int
+	}{
+		{&Options{Quantize: &quantize.Options{}}, 8, 256},
+		{&Options{BitsPerPixel: 4, Quantize: &quantize.Options{Method: quantize.Wu, Dither: quantize.FloydSteinberg}}, 4, 16},
+		{&Options{BitsPerPixel: 8, Quantize: &quantize.Options{NumColors: 32}}, 8, 32},
+	} {
+		buf := new(bytes.Buffer)
+		if err := EncodeOptions(buf, img, tc.opt); err != nil {
+			t.Fatal(err)
+		}
+		h := buf.Bytes()[fileHeaderLen:]
+		if bpp := int(h[14]); bpp != tc.bpp {
+			t.Fatalf("%+v: got %d bits per pixel, want %d", tc.opt, bpp, tc.bpp)
+		}
+		m, err := Decode(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, ok := m.(*image.Paletted)
+		if !ok || len(p.Palette) > tc.palette {
+			t.Fatalf("%+v: got %T with %d colors", tc.opt, m, len(p.Palette))
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	for _, opt := range []*Options{
+		{BitsPerPixel: 2},
+		{BitsPerPixel: 8, RLE: true, TopDown: true},
+	} {
+		if err := EncodeOptions(ioutil.Discard, img, opt); err == nil {
+			t.Fatalf("%+v: got no error", opt)
+		}
+	}
+}
+
 // BenchmarkEncode benchmarks the encoding of an image.
 func BenchmarkEncode(b *testing.B) {
 	img, err := openImage("video-001.bmp")
@@ -12,24 +12,28 @@ import (
 var (
 	_ color.Color = (*Gray)(nil)
 	_ color.Color = (*Gray16)(nil)
+	_ color.Color = (*Gray16f)(nil)
 	_ color.Color = (*Gray32i)(nil)
 	_ color.Color = (*Gray32f)(nil)
 	_ color.Color = (*Gray64i)(nil)
 	_ color.Color = (*Gray64f)(nil)
 	_ color.Color = (*GrayA)(nil)
 	_ color.Color = (*GrayA32)(nil)
+	_ color.Color = (*GrayA32f)(nil)
 	_ color.Color = (*GrayA64i)(nil)
 	_ color.Color = (*GrayA64f)(nil)
 	_ color.Color = (*GrayA128i)(nil)
 	_ color.Color = (*GrayA128f)(nil)
 	_ color.Color = (*RGB)(nil)
 	_ color.Color = (*RGB48)(nil)
+	_ color.Color = (*RGB48f)(nil)
 	_ color.Color = (*RGB96i)(nil)
 	_ color.Color = (*RGB96f)(nil)
 	_ color.Color = (*RGB192i)(nil)
 	_ color.Color = (*RGB192f)(nil)
 	_ color.Color = (*RGBA)(nil)
 	_ color.Color = (*RGBA64)(nil)
+	_ color.Color = (*RGBA64f)(nil)
 	_ color.Color = (*RGBA128i)(nil)
 	_ color.Color = (*RGBA128f)(nil)
 	_ color.Color = (*RGBA256i)(nil)
@@ -40,24 +44,28 @@ var (
 var (
 	GrayModel      color.Model = color.ModelFunc(grayModel)
 	Gray16Model    color.Model = color.ModelFunc(gray16Model)
+	Gray16fModel   color.Model = color.ModelFunc(gray16fModel)
 	Gray32iModel   color.Model = color.ModelFunc(gray32iModel)
 	Gray32fModel   color.Model = color.ModelFunc(gray32fModel)
 	Gray64iModel   color.Model = color.ModelFunc(gray64iModel)
 	Gray64fModel   color.Model = color.ModelFunc(gray64fModel)
 	GrayAModel     color.Model = color.ModelFunc(grayAModel)
 	GrayA32Model   color.Model = color.ModelFunc(grayA32Model)
+	GrayA32fModel  color.Model = color.ModelFunc(grayA32fModel)
 	GrayA64iModel  color.Model = color.ModelFunc(grayA64iModel)
 	GrayA64fModel  color.Model = color.ModelFunc(grayA64fModel)
 	GrayA128iModel color.Model = color.ModelFunc(grayA128iModel)
 	GrayA128fModel color.Model = color.ModelFunc(grayA128fModel)
 	RGBModel       color.Model = color.ModelFunc(rgbModel)
 	RGB48Model     color.Model = color.ModelFunc(rgb48Model)
+	RGB48fModel    color.Model = color.ModelFunc(rgb48fModel)
 	RGB96iModel    color.Model = color.ModelFunc(rgb96iModel)
 	RGB96fModel    color.Model = color.ModelFunc(rgb96fModel)
 	RGB192iModel   color.Model = color.ModelFunc(rgb192iModel)
 	RGB192fModel   color.Model = color.ModelFunc(rgb192fModel)
 	RGBAModel      color.Model = color.ModelFunc(rgbaModel)
 	RGBA64Model    color.Model = color.ModelFunc(rgba64Model)
+	RGBA64fModel   color.Model = color.ModelFunc(rgba64fModel)
 	RGBA128iModel  color.Model = color.ModelFunc(rgba128iModel)
 	RGBA128fModel  color.Model = color.ModelFunc(rgba128fModel)
 	RGBA256iModel  color.Model = color.ModelFunc(rgba256iModel)
@@ -88,3 +96,14 @@ func colorRgbToGrayF64(r, g, b float64) float64 {
 	y := (299*r + 587*g + 114*b + 500) / 1000
 	return y
 }
+
+// colorUnitToUint16 scales v from 0 to 1 to 0 to 0xFFFF, clamping it.
+func colorUnitToUint16(v float32) uint32 {
+	if !(v > 0) {
+		return 0
+	}
+	if v >= 1 {
+		return 0xFFFF
+	}
+	return uint32(v*0xFFFF + 0.5)
+}
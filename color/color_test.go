@@ -5,6 +5,7 @@
 package color
 
 import (
+	"image/color"
 	"os"
 	"testing"
 )
@@ -16,3 +17,10 @@ func TestMain(m *testing.M) {
 func TestFoo(t *testing.T) {
 	//
 }
+
+func TestGrayAModel(t *testing.T) {
+	c := GrayAModel.Convert(color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x80}).(GrayA)
+	if c != (GrayA{Y: 0x80, A: 0x80}) {
+		t.Fatalf("got %v, want the alpha of the color", c)
+	}
+}
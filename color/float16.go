@@ -0,0 +1,103 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package color
+
+import (
+	"math"
+)
+
+// The tables of Float16ToFloat32, from "Fast Half Float Conversions" by
+// Jeroen van der Zijp: the float32 bits of a half-precision number are the
+// sum of the bits of its mantissa, offset by its exponent, and the bits of
+// its sign and exponent.
+var (
+	float16Mantissa [2048]uint32
+	float16Exponent [64]uint32
+	float16Offset   [64]uint16
+)
+
+func init() {
+	// The subnormal numbers are normalized.
+	for i := 1; i < 1024; i++ {
+		m, e := uint32(i)<<13, uint32(0)
+		for m&0x800000 == 0 {
+			e -= 0x800000
+			m <<= 1
+		}
+		float16Mantissa[i] = m&^0x800000 | (e + 0x38800000)
+	}
+	for i := 1024; i < 2048; i++ {
+		float16Mantissa[i] = 0x38000000 + uint32(i-1024)<<13
+	}
+	for i := 1; i < 31; i++ {
+		float16Exponent[i] = uint32(i) << 23
+		float16Exponent[32+i] = 0x80000000 | uint32(i)<<23
+	}
+	float16Exponent[31] = 0x47800000
+	float16Exponent[32] = 0x80000000
+	float16Exponent[63] = 0xc7800000
+	for i := range float16Offset {
+		if i != 0 && i != 32 {
+			float16Offset[i] = 1024
+		}
+	}
+}
+
+// Float16ToFloat32 converts the IEEE 754 half-precision number h, which
+// is exact.
+func Float16ToFloat32(h uint16) float32 {
+	e := h >> 10
+	return math.Float32frombits(float16Mantissa[float16Offset[e]+h&0x3ff] + float16Exponent[e])
+}
+
+// Float32ToFloat16 converts f to the nearest IEEE 754 half-precision
+// number, rounding ties to even. Numbers that are too large become
+// infinities, and NaNs stay NaNs.
+func Float32ToFloat16(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23) & 0xff
+	man := b & 0x7fffff
+	if exp == 0xff {
+		if man == 0 {
+			return sign | 0x7c00
+		}
+		// A NaN keeps its high payload bits, and at least one of them.
+		m := uint16(man >> 13)
+		if m == 0 {
+			m = 1
+		}
+		return sign | 0x7c00 | m
+	}
+
+	e := exp - 127 + 15
+	if e >= 0x1f {
+		return sign | 0x7c00
+	}
+	var shift uint
+	if e <= 0 {
+		// The number is subnormal, or rounds to zero.
+		if e < -10 {
+			return sign
+		}
+		man |= 0x800000
+		shift = uint(14 - e)
+		e = 0
+	} else {
+		shift = 13
+	}
+	m := man >> shift
+	rem, half := man&(1<<shift-1), uint32(1)<<(shift-1)
+	if rem > half || rem == half && m&1 != 0 {
+		m++
+	}
+	// A carry out of the mantissa increments the exponent.
+	return sign | (uint16(e)<<10 + uint16(m))
+}
+
+// roundFloat16 rounds f to the nearest half-precision number.
+func roundFloat16(f float32) float32 {
+	return Float16ToFloat32(Float32ToFloat16(f))
+}
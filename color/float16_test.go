@@ -0,0 +1,61 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package color
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloat16(t *testing.T) {
+	// All the half-precision numbers but NaNs are exact float32 numbers.
+	for i := 0; i < 1<<16; i++ {
+		h := uint16(i)
+		f := Float16ToFloat32(h)
+		if f != f {
+			if got := Float32ToFloat16(f); got&0x7c00 != 0x7c00 || got&0x3ff == 0 {
+				t.Fatalf("%#04x: got %#04x for NaN", h, got)
+			}
+			continue
+		}
+		if e, m := int(h>>10)&0x1f, float64(h&0x3ff); e != 0x1f {
+			want := math.Ldexp(m, -24)
+			if e != 0 {
+				want = math.Ldexp(1024+m, e-25)
+			}
+			if h&0x8000 != 0 {
+				want = -want
+			}
+			if float64(f) != want {
+				t.Fatalf("%#04x: got %v, want %v", h, f, want)
+			}
+		}
+		if got := Float32ToFloat16(f); got != h {
+			t.Fatalf("%#04x: got %#04x from %v", h, got, f)
+		}
+	}
+	for _, tc := range []struct {
+		f float32
+		h uint16
+	}{
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{65504, 0x7bff},
+		{65520, 0x7c00}, // Rounds to infinity.
+		{1e10, 0x7c00},
+		{float32(math.Inf(-1)), 0xfc00},
+		{1 + 1.0/2048, 0x3c00}, // A tie rounds to even.
+		{1 + 3.0/2048, 0x3c02}, // A tie rounds to even.
+		{1 + 1.0/2048 + 1e-6, 0x3c01},
+		{5.960464477539063e-08, 0x0001}, // The smallest subnormal.
+		{2.9802322387695312e-08, 0x0000},
+		{2.98024e-08, 0x0001},
+		{6.097555160522461e-05, 0x03ff}, // The largest subnormal.
+	} {
+		if got := Float32ToFloat16(tc.f); got != tc.h {
+			t.Fatalf("%v: got %#04x, want %#04x", tc.f, got, tc.h)
+		}
+	}
+}
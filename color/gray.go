@@ -44,6 +44,29 @@ func gray16Model(c color.Color) color.Color {
 	return Gray16{Y: uint16(y)}
 }
 
+// Gray16f is a gray color whose images store the sample as an IEEE 754
+// half-precision number. Unlike the samples of the other float colors, which
+// are from 0 to 0xFFFF, the sample is from 0 to 1: 0xFFFF is larger than the
+// largest half-precision number.
+type Gray16f struct {
+	Y float32
+}
+
+func (c Gray16f) RGBA() (r, g, b, a uint32) {
+	y := colorUnitToUint16(c.Y)
+	return y, y, y, 0xFFFF
+}
+
+func gray16fModel(c color.Color) color.Color {
+	if c, ok := c.(Gray16f); ok {
+		return c
+	}
+	c1 := gray32fModel(c).(Gray32f)
+	return Gray16f{
+		Y: roundFloat16(c1.Y / 0xFFFF),
+	}
+}
+
 type Gray32i struct {
 	Y int32
 }
@@ -58,6 +81,10 @@ func gray32iModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return Gray32i{
+			Y: int32(c.Y * 0xFFFF),
+		}
 	case Gray32i:
 		return Gray32i{
 			Y: int32(c.Y),
@@ -74,6 +101,10 @@ func gray32iModel(c color.Color) color.Color {
 		return Gray32i{
 			Y: int32(c.Y),
 		}
+	case GrayA32f:
+		return Gray32i{
+			Y: int32(c.Y * 0xFFFF),
+		}
 	case GrayA64i:
 		return Gray32i{
 			Y: int32(c.Y),
@@ -90,6 +121,10 @@ func gray32iModel(c color.Color) color.Color {
 		return Gray32i{
 			Y: int32(c.Y),
 		}
+	case RGB48f:
+		return Gray32i{
+			Y: colorRgbToGrayI32(int32(c.R*0xFFFF), int32(c.G*0xFFFF), int32(c.B*0xFFFF)),
+		}
 	case RGB96i:
 		return Gray32i{
 			Y: colorRgbToGrayI32(int32(c.R), int32(c.G), int32(c.B)),
@@ -106,6 +141,10 @@ func gray32iModel(c color.Color) color.Color {
 		return Gray32i{
 			Y: colorRgbToGrayI32(int32(c.R), int32(c.G), int32(c.B)),
 		}
+	case RGBA64f:
+		return Gray32i{
+			Y: colorRgbToGrayI32(int32(c.R*0xFFFF), int32(c.G*0xFFFF), int32(c.B*0xFFFF)),
+		}
 	case RGBA128i:
 		return Gray32i{
 			Y: colorRgbToGrayI32(int32(c.R), int32(c.G), int32(c.B)),
@@ -142,6 +181,10 @@ func gray32fModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return Gray32f{
+			Y: float32(c.Y * 0xFFFF),
+		}
 	case Gray32i:
 		return Gray32f{
 			Y: float32(c.Y),
@@ -158,6 +201,10 @@ func gray32fModel(c color.Color) color.Color {
 		return Gray32f{
 			Y: float32(c.Y),
 		}
+	case GrayA32f:
+		return Gray32f{
+			Y: float32(c.Y * 0xFFFF),
+		}
 	case GrayA64i:
 		return Gray32f{
 			Y: float32(c.Y),
@@ -174,6 +221,10 @@ func gray32fModel(c color.Color) color.Color {
 		return Gray32f{
 			Y: float32(c.Y),
 		}
+	case RGB48f:
+		return Gray32f{
+			Y: colorRgbToGrayF32(float32(c.R*0xFFFF), float32(c.G*0xFFFF), float32(c.B*0xFFFF)),
+		}
 	case RGB96i:
 		return Gray32f{
 			Y: colorRgbToGrayF32(float32(c.R), float32(c.G), float32(c.B)),
@@ -190,6 +241,10 @@ func gray32fModel(c color.Color) color.Color {
 		return Gray32f{
 			Y: colorRgbToGrayF32(float32(c.R), float32(c.G), float32(c.B)),
 		}
+	case RGBA64f:
+		return Gray32f{
+			Y: colorRgbToGrayF32(float32(c.R*0xFFFF), float32(c.G*0xFFFF), float32(c.B*0xFFFF)),
+		}
 	case RGBA128i:
 		return Gray32f{
 			Y: colorRgbToGrayF32(float32(c.R), float32(c.G), float32(c.B)),
@@ -228,6 +283,10 @@ func gray64iModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return Gray64i{
+			Y: int64(c.Y * 0xFFFF),
+		}
 	case Gray32i:
 		return Gray64i{
 			Y: int64(c.Y),
@@ -244,6 +303,10 @@ func gray64iModel(c color.Color) color.Color {
 		return Gray64i{
 			Y: int64(c.Y),
 		}
+	case GrayA32f:
+		return Gray64i{
+			Y: int64(c.Y * 0xFFFF),
+		}
 	case GrayA64i:
 		return Gray64i{
 			Y: int64(c.Y),
@@ -260,6 +323,10 @@ func gray64iModel(c color.Color) color.Color {
 		return Gray64i{
 			Y: int64(c.Y),
 		}
+	case RGB48f:
+		return Gray64i{
+			Y: colorRgbToGrayI64(int64(c.R*0xFFFF), int64(c.G*0xFFFF), int64(c.B*0xFFFF)),
+		}
 	case RGB96i:
 		return Gray64i{
 			Y: colorRgbToGrayI64(int64(c.R), int64(c.G), int64(c.B)),
@@ -276,6 +343,10 @@ func gray64iModel(c color.Color) color.Color {
 		return Gray64i{
 			Y: colorRgbToGrayI64(int64(c.R), int64(c.G), int64(c.B)),
 		}
+	case RGBA64f:
+		return Gray64i{
+			Y: colorRgbToGrayI64(int64(c.R*0xFFFF), int64(c.G*0xFFFF), int64(c.B*0xFFFF)),
+		}
 	case RGBA128i:
 		return Gray64i{
 			Y: colorRgbToGrayI64(int64(c.R), int64(c.G), int64(c.B)),
@@ -314,6 +385,10 @@ func gray64fModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return Gray64f{
+			Y: float64(c.Y * 0xFFFF),
+		}
 	case Gray32i:
 		return Gray64f{
 			Y: float64(c.Y),
@@ -330,6 +405,10 @@ func gray64fModel(c color.Color) color.Color {
 		return Gray64f{
 			Y: float64(c.Y),
 		}
+	case GrayA32f:
+		return Gray64f{
+			Y: float64(c.Y * 0xFFFF),
+		}
 	case GrayA64i:
 		return Gray64f{
 			Y: float64(c.Y),
@@ -346,6 +425,10 @@ func gray64fModel(c color.Color) color.Color {
 		return Gray64f{
 			Y: float64(c.Y),
 		}
+	case RGB48f:
+		return Gray64f{
+			Y: colorRgbToGrayF64(float64(c.R*0xFFFF), float64(c.G*0xFFFF), float64(c.B*0xFFFF)),
+		}
 	case RGB96i:
 		return Gray64f{
 			Y: colorRgbToGrayF64(float64(c.R), float64(c.G), float64(c.B)),
@@ -362,6 +445,10 @@ func gray64fModel(c color.Color) color.Color {
 		return Gray64f{
 			Y: colorRgbToGrayF64(float64(c.R), float64(c.G), float64(c.B)),
 		}
+	case RGBA64f:
+		return Gray64f{
+			Y: colorRgbToGrayF64(float64(c.R*0xFFFF), float64(c.G*0xFFFF), float64(c.B*0xFFFF)),
+		}
 	case RGBA128i:
 		return Gray64f{
 			Y: colorRgbToGrayF64(float64(c.R), float64(c.G), float64(c.B)),
@@ -22,11 +22,11 @@ func grayAModel(c color.Color) color.Color {
 	if c, ok := c.(GrayA); ok {
 		return c
 	}
-	r, g, b, _ := c.RGBA()
+	r, g, b, a := c.RGBA()
 	y := colorRgbToGray(r, g, b)
 	return GrayA{
 		Y: uint8(y >> 8),
-		A: 0xFF,
+		A: uint8(a >> 8),
 	}
 }
 
@@ -52,6 +52,28 @@ func grayA32Model(c color.Color) color.Color {
 	}
 }
 
+// GrayA32f is a Gray16f color with an alpha sample from 0 to 1.
+type GrayA32f struct {
+	Y, A float32
+}
+
+func (c GrayA32f) RGBA() (r, g, b, a uint32) {
+	y := colorUnitToUint16(c.Y)
+	a = colorUnitToUint16(c.A)
+	return y, y, y, a
+}
+
+func grayA32fModel(c color.Color) color.Color {
+	if c, ok := c.(GrayA32f); ok {
+		return c
+	}
+	c1 := grayA64fModel(c).(GrayA64f)
+	return GrayA32f{
+		Y: roundFloat16(c1.Y / 0xFFFF),
+		A: roundFloat16(c1.A / 0xFFFF),
+	}
+}
+
 type GrayA64i struct {
 	Y, A int32
 }
@@ -67,6 +89,11 @@ func grayA64iModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return GrayA64i{
+			Y: int32(c.Y * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case Gray32i:
 		return GrayA64i{
 			Y: int32(c.Y),
@@ -87,6 +114,11 @@ func grayA64iModel(c color.Color) color.Color {
 			Y: int32(c.Y),
 			A: 0xFFFF,
 		}
+	case GrayA32f:
+		return GrayA64i{
+			Y: int32(c.Y * 0xFFFF),
+			A: int32(c.A * 0xFFFF),
+		}
 	case GrayA64i:
 		return GrayA64i{
 			Y: int32(c.Y),
@@ -107,6 +139,11 @@ func grayA64iModel(c color.Color) color.Color {
 			Y: int32(c.Y),
 			A: int32(c.A),
 		}
+	case RGB48f:
+		return GrayA64i{
+			Y: colorRgbToGrayI32(int32(c.R*0xFFFF), int32(c.G*0xFFFF), int32(c.B*0xFFFF)),
+			A: 0xFFFF,
+		}
 	case RGB96i:
 		return GrayA64i{
 			Y: colorRgbToGrayI32(int32(c.R), int32(c.G), int32(c.B)),
@@ -127,6 +164,11 @@ func grayA64iModel(c color.Color) color.Color {
 			Y: colorRgbToGrayI32(int32(c.R), int32(c.G), int32(c.B)),
 			A: 0xFFFF,
 		}
+	case RGBA64f:
+		return GrayA64i{
+			Y: colorRgbToGrayI32(int32(c.R*0xFFFF), int32(c.G*0xFFFF), int32(c.B*0xFFFF)),
+			A: int32(c.A * 0xFFFF),
+		}
 	case RGBA128i:
 		return GrayA64i{
 			Y: colorRgbToGrayI32(int32(c.R), int32(c.G), int32(c.B)),
@@ -171,6 +213,11 @@ func grayA64fModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return GrayA64f{
+			Y: float32(c.Y * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case Gray32i:
 		return GrayA64f{
 			Y: float32(c.Y),
@@ -191,6 +238,11 @@ func grayA64fModel(c color.Color) color.Color {
 			Y: float32(c.Y),
 			A: 0xFFFF,
 		}
+	case GrayA32f:
+		return GrayA64f{
+			Y: float32(c.Y * 0xFFFF),
+			A: float32(c.A * 0xFFFF),
+		}
 	case GrayA64i:
 		return GrayA64f{
 			Y: float32(c.Y),
@@ -211,6 +263,11 @@ func grayA64fModel(c color.Color) color.Color {
 			Y: float32(c.Y),
 			A: float32(c.A),
 		}
+	case RGB48f:
+		return GrayA64f{
+			Y: colorRgbToGrayF32(float32(c.R*0xFFFF), float32(c.G*0xFFFF), float32(c.B*0xFFFF)),
+			A: 0xFFFF,
+		}
 	case RGB96i:
 		return GrayA64f{
 			Y: colorRgbToGrayF32(float32(c.R), float32(c.G), float32(c.B)),
@@ -231,6 +288,11 @@ func grayA64fModel(c color.Color) color.Color {
 			Y: colorRgbToGrayF32(float32(c.R), float32(c.G), float32(c.B)),
 			A: 0xFFFF,
 		}
+	case RGBA64f:
+		return GrayA64f{
+			Y: colorRgbToGrayF32(float32(c.R*0xFFFF), float32(c.G*0xFFFF), float32(c.B*0xFFFF)),
+			A: float32(c.A * 0xFFFF),
+		}
 	case RGBA128i:
 		return GrayA64f{
 			Y: colorRgbToGrayF32(float32(c.R), float32(c.G), float32(c.B)),
@@ -275,6 +337,11 @@ func grayA128iModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return GrayA128i{
+			Y: int64(c.Y * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case Gray32i:
 		return GrayA128i{
 			Y: int64(c.Y),
@@ -295,6 +362,11 @@ func grayA128iModel(c color.Color) color.Color {
 			Y: int64(c.Y),
 			A: 0xFFFF,
 		}
+	case GrayA32f:
+		return GrayA128i{
+			Y: int64(c.Y * 0xFFFF),
+			A: int64(c.A * 0xFFFF),
+		}
 	case GrayA64i:
 		return GrayA128i{
 			Y: int64(c.Y),
@@ -315,6 +387,11 @@ func grayA128iModel(c color.Color) color.Color {
 			Y: int64(c.Y),
 			A: int64(c.A),
 		}
+	case RGB48f:
+		return GrayA128i{
+			Y: colorRgbToGrayI64(int64(c.R*0xFFFF), int64(c.G*0xFFFF), int64(c.B*0xFFFF)),
+			A: 0xFFFF,
+		}
 	case RGB96i:
 		return GrayA128i{
 			Y: colorRgbToGrayI64(int64(c.R), int64(c.G), int64(c.B)),
@@ -335,6 +412,11 @@ func grayA128iModel(c color.Color) color.Color {
 			Y: colorRgbToGrayI64(int64(c.R), int64(c.G), int64(c.B)),
 			A: 0xFFFF,
 		}
+	case RGBA64f:
+		return GrayA128i{
+			Y: colorRgbToGrayI64(int64(c.R*0xFFFF), int64(c.G*0xFFFF), int64(c.B*0xFFFF)),
+			A: int64(c.A * 0xFFFF),
+		}
 	case RGBA128i:
 		return GrayA128i{
 			Y: colorRgbToGrayI64(int64(c.R), int64(c.G), int64(c.B)),
@@ -379,6 +461,11 @@ func grayA128fModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return GrayA128f{
+			Y: float64(c.Y * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case Gray32i:
 		return GrayA128f{
 			Y: float64(c.Y),
@@ -399,6 +486,11 @@ func grayA128fModel(c color.Color) color.Color {
 			Y: float64(c.Y),
 			A: 0xFFFF,
 		}
+	case GrayA32f:
+		return GrayA128f{
+			Y: float64(c.Y * 0xFFFF),
+			A: float64(c.A * 0xFFFF),
+		}
 	case GrayA64i:
 		return GrayA128f{
 			Y: float64(c.Y),
@@ -419,6 +511,11 @@ func grayA128fModel(c color.Color) color.Color {
 			Y: float64(c.Y),
 			A: float64(c.A),
 		}
+	case RGB48f:
+		return GrayA128f{
+			Y: colorRgbToGrayF64(float64(c.R*0xFFFF), float64(c.G*0xFFFF), float64(c.B*0xFFFF)),
+			A: 0xFFFF,
+		}
 	case RGB96i:
 		return GrayA128f{
 			Y: colorRgbToGrayF64(float64(c.R), float64(c.G), float64(c.B)),
@@ -439,6 +536,11 @@ func grayA128fModel(c color.Color) color.Color {
 			Y: colorRgbToGrayF64(float64(c.R), float64(c.G), float64(c.B)),
 			A: 0xFFFF,
 		}
+	case RGBA64f:
+		return GrayA128f{
+			Y: colorRgbToGrayF64(float64(c.R*0xFFFF), float64(c.G*0xFFFF), float64(c.B*0xFFFF)),
+			A: float64(c.A * 0xFFFF),
+		}
 	case RGBA128i:
 		return GrayA128f{
 			Y: colorRgbToGrayF64(float64(c.R), float64(c.G), float64(c.B)),
@@ -56,6 +56,31 @@ func rgb48Model(c color.Color) color.Color {
 	}
 }
 
+// RGB48f is a color of half-precision samples from 0 to 1, as Gray16f.
+type RGB48f struct {
+	R, G, B float32
+}
+
+func (c RGB48f) RGBA() (r, g, b, a uint32) {
+	r = colorUnitToUint16(c.R)
+	g = colorUnitToUint16(c.G)
+	b = colorUnitToUint16(c.B)
+	a = 0xFFFF
+	return
+}
+
+func rgb48fModel(c color.Color) color.Color {
+	if c, ok := c.(RGB48f); ok {
+		return c
+	}
+	c1 := rgb96fModel(c).(RGB96f)
+	return RGB48f{
+		R: roundFloat16(c1.R / 0xFFFF),
+		G: roundFloat16(c1.G / 0xFFFF),
+		B: roundFloat16(c1.B / 0xFFFF),
+	}
+}
+
 type RGB96i struct {
 	R, G, B int32
 }
@@ -73,6 +98,12 @@ func rgb96iModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return RGB96i{
+			R: int32(c.Y * 0xFFFF),
+			G: int32(c.Y * 0xFFFF),
+			B: int32(c.Y * 0xFFFF),
+		}
 	case Gray32i:
 		return RGB96i{
 			R: int32(c.Y),
@@ -97,6 +128,12 @@ func rgb96iModel(c color.Color) color.Color {
 			G: int32(c.Y),
 			B: int32(c.Y),
 		}
+	case GrayA32f:
+		return RGB96i{
+			R: int32(c.Y * 0xFFFF),
+			G: int32(c.Y * 0xFFFF),
+			B: int32(c.Y * 0xFFFF),
+		}
 	case GrayA64i:
 		return RGB96i{
 			R: int32(c.Y),
@@ -121,6 +158,12 @@ func rgb96iModel(c color.Color) color.Color {
 			G: int32(c.Y),
 			B: int32(c.Y),
 		}
+	case RGB48f:
+		return RGB96i{
+			R: int32(c.R * 0xFFFF),
+			G: int32(c.G * 0xFFFF),
+			B: int32(c.B * 0xFFFF),
+		}
 	case RGB96i:
 		return RGB96i{
 			R: int32(c.R),
@@ -145,6 +188,12 @@ func rgb96iModel(c color.Color) color.Color {
 			G: int32(c.G),
 			B: int32(c.B),
 		}
+	case RGBA64f:
+		return RGB96i{
+			R: int32(c.R * 0xFFFF),
+			G: int32(c.G * 0xFFFF),
+			B: int32(c.B * 0xFFFF),
+		}
 	case RGBA128i:
 		return RGB96i{
 			R: int32(c.R),
@@ -195,6 +244,12 @@ func rgb96fModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return RGB96f{
+			R: float32(c.Y * 0xFFFF),
+			G: float32(c.Y * 0xFFFF),
+			B: float32(c.Y * 0xFFFF),
+		}
 	case Gray32i:
 		return RGB96f{
 			R: float32(c.Y),
@@ -219,6 +274,12 @@ func rgb96fModel(c color.Color) color.Color {
 			G: float32(c.Y),
 			B: float32(c.Y),
 		}
+	case GrayA32f:
+		return RGB96f{
+			R: float32(c.Y * 0xFFFF),
+			G: float32(c.Y * 0xFFFF),
+			B: float32(c.Y * 0xFFFF),
+		}
 	case GrayA64i:
 		return RGB96f{
 			R: float32(c.Y),
@@ -243,6 +304,12 @@ func rgb96fModel(c color.Color) color.Color {
 			G: float32(c.Y),
 			B: float32(c.Y),
 		}
+	case RGB48f:
+		return RGB96f{
+			R: float32(c.R * 0xFFFF),
+			G: float32(c.G * 0xFFFF),
+			B: float32(c.B * 0xFFFF),
+		}
 	case RGB96i:
 		return RGB96f{
 			R: float32(c.R),
@@ -267,6 +334,12 @@ func rgb96fModel(c color.Color) color.Color {
 			G: float32(c.G),
 			B: float32(c.B),
 		}
+	case RGBA64f:
+		return RGB96f{
+			R: float32(c.R * 0xFFFF),
+			G: float32(c.G * 0xFFFF),
+			B: float32(c.B * 0xFFFF),
+		}
 	case RGBA128i:
 		return RGB96f{
 			R: float32(c.R),
@@ -317,6 +390,12 @@ func rgb192iModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return RGB192i{
+			R: int64(c.Y * 0xFFFF),
+			G: int64(c.Y * 0xFFFF),
+			B: int64(c.Y * 0xFFFF),
+		}
 	case Gray32i:
 		return RGB192i{
 			R: int64(c.Y),
@@ -341,6 +420,12 @@ func rgb192iModel(c color.Color) color.Color {
 			G: int64(c.Y),
 			B: int64(c.Y),
 		}
+	case GrayA32f:
+		return RGB192i{
+			R: int64(c.Y * 0xFFFF),
+			G: int64(c.Y * 0xFFFF),
+			B: int64(c.Y * 0xFFFF),
+		}
 	case GrayA64i:
 		return RGB192i{
 			R: int64(c.Y),
@@ -365,6 +450,12 @@ func rgb192iModel(c color.Color) color.Color {
 			G: int64(c.Y),
 			B: int64(c.Y),
 		}
+	case RGB48f:
+		return RGB192i{
+			R: int64(c.R * 0xFFFF),
+			G: int64(c.G * 0xFFFF),
+			B: int64(c.B * 0xFFFF),
+		}
 	case RGB96i:
 		return RGB192i{
 			R: int64(c.R),
@@ -389,6 +480,12 @@ func rgb192iModel(c color.Color) color.Color {
 			G: int64(c.G),
 			B: int64(c.B),
 		}
+	case RGBA64f:
+		return RGB192i{
+			R: int64(c.R * 0xFFFF),
+			G: int64(c.G * 0xFFFF),
+			B: int64(c.B * 0xFFFF),
+		}
 	case RGBA128i:
 		return RGB192i{
 			R: int64(c.R),
@@ -439,6 +536,12 @@ func rgb192fModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return RGB192f{
+			R: float64(c.Y * 0xFFFF),
+			G: float64(c.Y * 0xFFFF),
+			B: float64(c.Y * 0xFFFF),
+		}
 	case Gray32i:
 		return RGB192f{
 			R: float64(c.Y),
@@ -463,6 +566,12 @@ func rgb192fModel(c color.Color) color.Color {
 			G: float64(c.Y),
 			B: float64(c.Y),
 		}
+	case GrayA32f:
+		return RGB192f{
+			R: float64(c.Y * 0xFFFF),
+			G: float64(c.Y * 0xFFFF),
+			B: float64(c.Y * 0xFFFF),
+		}
 	case GrayA64i:
 		return RGB192f{
 			R: float64(c.Y),
@@ -487,6 +596,12 @@ func rgb192fModel(c color.Color) color.Color {
 			G: float64(c.Y),
 			B: float64(c.Y),
 		}
+	case RGB48f:
+		return RGB192f{
+			R: float64(c.R * 0xFFFF),
+			G: float64(c.G * 0xFFFF),
+			B: float64(c.B * 0xFFFF),
+		}
 	case RGB96i:
 		return RGB192f{
 			R: float64(c.R),
@@ -511,6 +626,12 @@ func rgb192fModel(c color.Color) color.Color {
 			G: float64(c.G),
 			B: float64(c.B),
 		}
+	case RGBA64f:
+		return RGB192f{
+			R: float64(c.R * 0xFFFF),
+			G: float64(c.G * 0xFFFF),
+			B: float64(c.B * 0xFFFF),
+		}
 	case RGBA128i:
 		return RGB192f{
 			R: float64(c.R),
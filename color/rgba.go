@@ -58,6 +58,32 @@ func rgba64Model(c color.Color) color.Color {
 	}
 }
 
+// RGBA64f is an RGB48f color with an alpha sample from 0 to 1.
+type RGBA64f struct {
+	R, G, B, A float32
+}
+
+func (c RGBA64f) RGBA() (r, g, b, a uint32) {
+	r = colorUnitToUint16(c.R)
+	g = colorUnitToUint16(c.G)
+	b = colorUnitToUint16(c.B)
+	a = colorUnitToUint16(c.A)
+	return
+}
+
+func rgba64fModel(c color.Color) color.Color {
+	if c, ok := c.(RGBA64f); ok {
+		return c
+	}
+	c1 := rgba128fModel(c).(RGBA128f)
+	return RGBA64f{
+		R: roundFloat16(c1.R / 0xFFFF),
+		G: roundFloat16(c1.G / 0xFFFF),
+		B: roundFloat16(c1.B / 0xFFFF),
+		A: roundFloat16(c1.A / 0xFFFF),
+	}
+}
+
 type RGBA128i struct {
 	R, G, B, A int32
 }
@@ -75,6 +101,13 @@ func rgba128iModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return RGBA128i{
+			R: int32(c.Y * 0xFFFF),
+			G: int32(c.Y * 0xFFFF),
+			B: int32(c.Y * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case Gray32i:
 		return RGBA128i{
 			R: int32(c.Y),
@@ -103,6 +136,13 @@ func rgba128iModel(c color.Color) color.Color {
 			B: int32(c.Y),
 			A: 0xFFFF,
 		}
+	case GrayA32f:
+		return RGBA128i{
+			R: int32(c.Y * 0xFFFF),
+			G: int32(c.Y * 0xFFFF),
+			B: int32(c.Y * 0xFFFF),
+			A: int32(c.A * 0xFFFF),
+		}
 	case GrayA64i:
 		return RGBA128i{
 			R: int32(c.Y),
@@ -131,6 +171,13 @@ func rgba128iModel(c color.Color) color.Color {
 			B: int32(c.Y),
 			A: int32(c.A),
 		}
+	case RGB48f:
+		return RGBA128i{
+			R: int32(c.R * 0xFFFF),
+			G: int32(c.G * 0xFFFF),
+			B: int32(c.B * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case RGB96i:
 		return RGBA128i{
 			R: int32(c.R),
@@ -159,6 +206,13 @@ func rgba128iModel(c color.Color) color.Color {
 			B: int32(c.B),
 			A: 0xFFFF,
 		}
+	case RGBA64f:
+		return RGBA128i{
+			R: int32(c.R * 0xFFFF),
+			G: int32(c.G * 0xFFFF),
+			B: int32(c.B * 0xFFFF),
+			A: int32(c.A * 0xFFFF),
+		}
 	case RGBA128i:
 		return RGBA128i{
 			R: int32(c.R),
@@ -214,6 +268,13 @@ func rgba128fModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return RGBA128f{
+			R: float32(c.Y * 0xFFFF),
+			G: float32(c.Y * 0xFFFF),
+			B: float32(c.Y * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case Gray32i:
 		return RGBA128f{
 			R: float32(c.Y),
@@ -242,6 +303,13 @@ func rgba128fModel(c color.Color) color.Color {
 			B: float32(c.Y),
 			A: 0xFFFF,
 		}
+	case GrayA32f:
+		return RGBA128f{
+			R: float32(c.Y * 0xFFFF),
+			G: float32(c.Y * 0xFFFF),
+			B: float32(c.Y * 0xFFFF),
+			A: float32(c.A * 0xFFFF),
+		}
 	case GrayA64i:
 		return RGBA128f{
 			R: float32(c.Y),
@@ -270,6 +338,13 @@ func rgba128fModel(c color.Color) color.Color {
 			B: float32(c.Y),
 			A: float32(c.A),
 		}
+	case RGB48f:
+		return RGBA128f{
+			R: float32(c.R * 0xFFFF),
+			G: float32(c.G * 0xFFFF),
+			B: float32(c.B * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case RGB96i:
 		return RGBA128f{
 			R: float32(c.R),
@@ -298,6 +373,13 @@ func rgba128fModel(c color.Color) color.Color {
 			B: float32(c.B),
 			A: 0xFFFF,
 		}
+	case RGBA64f:
+		return RGBA128f{
+			R: float32(c.R * 0xFFFF),
+			G: float32(c.G * 0xFFFF),
+			B: float32(c.B * 0xFFFF),
+			A: float32(c.A * 0xFFFF),
+		}
 	case RGBA128i:
 		return RGBA128f{
 			R: float32(c.R),
@@ -353,6 +435,13 @@ func rgba256iModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return RGBA256i{
+			R: int64(c.Y * 0xFFFF),
+			G: int64(c.Y * 0xFFFF),
+			B: int64(c.Y * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case Gray32i:
 		return RGBA256i{
 			R: int64(c.Y),
@@ -381,6 +470,13 @@ func rgba256iModel(c color.Color) color.Color {
 			B: int64(c.Y),
 			A: 0xFFFF,
 		}
+	case GrayA32f:
+		return RGBA256i{
+			R: int64(c.Y * 0xFFFF),
+			G: int64(c.Y * 0xFFFF),
+			B: int64(c.Y * 0xFFFF),
+			A: int64(c.A * 0xFFFF),
+		}
 	case GrayA64i:
 		return RGBA256i{
 			R: int64(c.Y),
@@ -409,6 +505,13 @@ func rgba256iModel(c color.Color) color.Color {
 			B: int64(c.Y),
 			A: int64(c.A),
 		}
+	case RGB48f:
+		return RGBA256i{
+			R: int64(c.R * 0xFFFF),
+			G: int64(c.G * 0xFFFF),
+			B: int64(c.B * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case RGB96i:
 		return RGBA256i{
 			R: int64(c.R),
@@ -437,6 +540,13 @@ func rgba256iModel(c color.Color) color.Color {
 			B: int64(c.B),
 			A: 0xFFFF,
 		}
+	case RGBA64f:
+		return RGBA256i{
+			R: int64(c.R * 0xFFFF),
+			G: int64(c.G * 0xFFFF),
+			B: int64(c.B * 0xFFFF),
+			A: int64(c.A * 0xFFFF),
+		}
 	case RGBA128i:
 		return RGBA256i{
 			R: int64(c.R),
@@ -492,6 +602,13 @@ func rgba256fModel(c color.Color) color.Color {
 		return c
 	}
 	switch c := c.(type) {
+	case Gray16f:
+		return RGBA256f{
+			R: float64(c.Y * 0xFFFF),
+			G: float64(c.Y * 0xFFFF),
+			B: float64(c.Y * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case Gray32i:
 		return RGBA256f{
 			R: float64(c.Y),
@@ -520,6 +637,13 @@ func rgba256fModel(c color.Color) color.Color {
 			B: float64(c.Y),
 			A: 0xFFFF,
 		}
+	case GrayA32f:
+		return RGBA256f{
+			R: float64(c.Y * 0xFFFF),
+			G: float64(c.Y * 0xFFFF),
+			B: float64(c.Y * 0xFFFF),
+			A: float64(c.A * 0xFFFF),
+		}
 	case GrayA64i:
 		return RGBA256f{
 			R: float64(c.Y),
@@ -548,6 +672,13 @@ func rgba256fModel(c color.Color) color.Color {
 			B: float64(c.Y),
 			A: float64(c.A),
 		}
+	case RGB48f:
+		return RGBA256f{
+			R: float64(c.R * 0xFFFF),
+			G: float64(c.G * 0xFFFF),
+			B: float64(c.B * 0xFFFF),
+			A: 0xFFFF,
+		}
 	case RGB96i:
 		return RGBA256f{
 			R: float64(c.R),
@@ -576,6 +707,13 @@ func rgba256fModel(c color.Color) color.Color {
 			B: float64(c.B),
 			A: 0xFFFF,
 		}
+	case RGBA64f:
+		return RGBA256f{
+			R: float64(c.R * 0xFFFF),
+			G: float64(c.G * 0xFFFF),
+			B: float64(c.B * 0xFFFF),
+			A: float64(c.A * 0xFFFF),
+		}
 	case RGBA128i:
 		return RGBA256f{
 			R: float64(c.R),
@@ -0,0 +1,97 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"reflect"
+
+	colorExt "github.com/chai2010/image/color"
+)
+
+// Downsample returns a copy of m reduced to half its width and height
+// (rounded up), using a 2x2 box filter. The returned image has the same
+// number of channels and the same depth as m, and its bounds start at (0, 0).
+//
+// Images that are not an Image are converted with AsImage first, and a
+// Planar image is downsampled to a Planar image.
+func Downsample(m image.Image) Image {
+	if p, ok := m.(*Planar); ok {
+		return AsPlanar(Downsample(p.Interleave()))
+	}
+	src := AsImage(m)
+	b := src.Bounds()
+	r := image.Rect(0, 0, (b.Dx()+1)/2, (b.Dy()+1)/2)
+	dst, err := NewImage(r, src.Channels(), src.Depth())
+	if err != nil {
+		panic(fmt.Errorf("image: Downsample, %v", err))
+	}
+
+	get, put, size := sampleFuncs(src.Depth())
+	pixelSize := src.Channels() * size
+	srcPix, dstPix := src.Pix(), dst.Pix()
+	for y := 0; y < r.Dy(); y++ {
+		// Rows and columns past the last one repeat the last one.
+		y0, y1 := 2*y, minInt(2*y+1, b.Dy()-1)
+		row0 := srcPix[y0*src.Stride():]
+		row1 := srcPix[y1*src.Stride():]
+		out := dstPix[y*dst.Stride():]
+		for x := 0; x < r.Dx(); x++ {
+			x0, x1 := 2*x*pixelSize, minInt(2*x+1, b.Dx()-1)*pixelSize
+			for c := 0; c < pixelSize; c += size {
+				v := get(row0[x0+c:]) + get(row0[x1+c:]) + get(row1[x0+c:]) + get(row1[x1+c:])
+				put(out[x*pixelSize+c:], v/4)
+			}
+		}
+	}
+	return dst
+}
+
+// sampleFuncs returns functions that read and write a single big-endian
+// sample of the given depth, and the size of a sample in bytes.
+// Integer samples are rounded to the nearest value when written.
+func sampleFuncs(depth reflect.Kind) (get func([]byte) float64, put func([]byte, float64), size int) {
+	switch depth {
+	case reflect.Uint8:
+		get = func(p []byte) float64 { return float64(p[0]) }
+		put = func(p []byte, v float64) { p[0] = uint8(v + 0.5) }
+		return get, put, 1
+	case reflect.Uint16:
+		get = func(p []byte) float64 { return float64(binary.BigEndian.Uint16(p)) }
+		put = func(p []byte, v float64) { binary.BigEndian.PutUint16(p, uint16(v+0.5)) }
+		return get, put, 2
+	case Float16:
+		get = func(p []byte) float64 { return float64(colorExt.Float16ToFloat32(binary.BigEndian.Uint16(p))) }
+		put = func(p []byte, v float64) { binary.BigEndian.PutUint16(p, colorExt.Float32ToFloat16(float32(v))) }
+		return get, put, 2
+	case reflect.Int32:
+		get = func(p []byte) float64 { return float64(int32(binary.BigEndian.Uint32(p))) }
+		put = func(p []byte, v float64) { binary.BigEndian.PutUint32(p, uint32(int32(math.Floor(v+0.5)))) }
+		return get, put, 4
+	case reflect.Float32:
+		get = func(p []byte) float64 { return float64(math.Float32frombits(binary.BigEndian.Uint32(p))) }
+		put = func(p []byte, v float64) { binary.BigEndian.PutUint32(p, math.Float32bits(float32(v))) }
+		return get, put, 4
+	case reflect.Int64:
+		get = func(p []byte) float64 { return float64(int64(binary.BigEndian.Uint64(p))) }
+		put = func(p []byte, v float64) { binary.BigEndian.PutUint64(p, uint64(int64(math.Floor(v+0.5)))) }
+		return get, put, 8
+	case reflect.Float64:
+		get = func(p []byte) float64 { return math.Float64frombits(binary.BigEndian.Uint64(p)) }
+		put = func(p []byte, v float64) { binary.BigEndian.PutUint64(p, math.Float64bits(v)) }
+		return get, put, 8
+	}
+	panic(fmt.Errorf("image: invalid depth: %v", depth))
+}
+
+func minInt(a, b int) int {
+	if a <= b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,51 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"image"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+func TestDownsample(t *testing.T) {
+	m := imageExt.NewGray16(image.Rect(0, 0, 3, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			m.SetGray16(x, y, colorExt.Gray16{Y: uint16(1000 * (3*y + x))})
+		}
+	}
+	d, ok := imageExt.Downsample(m).(*imageExt.Gray16)
+	if !ok {
+		t.Fatalf("want *Gray16, got %T", imageExt.Downsample(m))
+	}
+	if got, want := d.Bounds(), image.Rect(0, 0, 2, 2); !got.Eq(want) {
+		t.Fatalf("want bounds %v, got %v", want, got)
+	}
+	// The last row and column are repeated at the odd edges.
+	want := []uint16{2000, 3500, 6500, 8000}
+	for i, v := range want {
+		if got := d.Gray16At(i%2, i/2).Y; got != v {
+			t.Errorf("at (%d, %d): want %d, got %d", i%2, i/2, v, got)
+		}
+	}
+
+	f := imageExt.NewRGB96f(image.Rect(5, 5, 7, 6))
+	f.SetRGB96f(5, 5, colorExt.RGB96f{R: 1, G: 0.5, B: -1})
+	f.SetRGB96f(6, 5, colorExt.RGB96f{R: 0, G: 0.5, B: 3})
+	c := imageExt.Downsample(f).(*imageExt.RGB96f).RGB96fAt(0, 0)
+	if c != (colorExt.RGB96f{R: 0.5, G: 0.5, B: 1}) {
+		t.Errorf("RGB96f: got %v", c)
+	}
+
+	h := imageExt.NewGrayA32f(image.Rect(0, 0, 2, 1))
+	h.SetGrayA32f(0, 0, colorExt.GrayA32f{Y: 0.25, A: 1})
+	h.SetGrayA32f(1, 0, colorExt.GrayA32f{Y: 0.5, A: 0.5})
+	if c := imageExt.Downsample(h).(*imageExt.GrayA32f).GrayA32fAt(0, 0); c != (colorExt.GrayA32f{Y: 0.375, A: 0.75}) {
+		t.Errorf("GrayA32f: got %v", c)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var (
+	errNotEnoughData = FormatError("not enough compressed data")
+	errTooMuchData   = FormatError("too much compressed data")
+	errInvalidCode   = FormatError("bad Huffman code")
+)
+
+// linesPerBlock returns the number of scanlines that are compressed
+// together.
+func (c Compression) linesPerBlock() int {
+	switch c {
+	case ZIP:
+		return 16
+	case PIZ:
+		return 32
+	}
+	return 1
+}
+
+func (c Compression) String() string {
+	switch c {
+	case None:
+		return "NONE"
+	case RLE:
+		return "RLE"
+	case ZIPS:
+		return "ZIPS"
+	case ZIP:
+		return "ZIP"
+	case PIZ:
+		return "PIZ"
+	}
+	return "Compression(" + strconv.Itoa(int(c)) + ")"
+}
+
+// interleave and predict prepare the data of the RLE and ZIP compressions.
+// The even bytes are moved before the odd bytes, and the bytes are replaced
+// by their difference to the previous byte.
+func interleave(b []byte) []byte {
+	t := make([]byte, len(b))
+	h := (len(b) + 1) / 2
+	for i := range b {
+		if i&1 == 0 {
+			t[i/2] = b[i]
+		} else {
+			t[h+i/2] = b[i]
+		}
+	}
+	for i := len(t) - 1; i > 0; i-- {
+		t[i] = t[i] - t[i-1] + 128
+	}
+	return t
+}
+
+// deinterleave reverses interleave.
+func deinterleave(t []byte) []byte {
+	for i := 1; i < len(t); i++ {
+		t[i] = t[i-1] + t[i] - 128
+	}
+	b := make([]byte, len(t))
+	h := (len(b) + 1) / 2
+	for i := range b {
+		if i&1 == 0 {
+			b[i] = t[i/2]
+		} else {
+			b[i] = t[h+i/2]
+		}
+	}
+	return b
+}
+
+const (
+	minRunLength = 3
+	maxRunLength = 127
+)
+
+// rleCompress codes runs of at least minRunLength bytes with a count byte
+// and the byte, and other bytes with a negative count byte and the bytes.
+func rleCompress(in []byte) []byte {
+	var out []byte
+	for start := 0; start < len(in); {
+		end := start + 1
+		for end < len(in) && in[end] == in[start] && end-start-1 < maxRunLength {
+			end++
+		}
+		if end-start >= minRunLength {
+			out = append(out, byte(end-start-1), in[start])
+			start = end
+			continue
+		}
+		for end < len(in) && (end+1 >= len(in) || in[end] != in[end+1] ||
+			end+2 >= len(in) || in[end+1] != in[end+2]) && end-start < maxRunLength {
+			end++
+		}
+		out = append(out, byte(start-end))
+		out = append(out, in[start:end]...)
+		start = end
+	}
+	return out
+}
+
+func rleUncompress(in []byte, n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for len(in) > 0 {
+		if c := int8(in[0]); c < 0 {
+			count := -int(c)
+			if len(in) < 1+count {
+				return nil, errNotEnoughData
+			}
+			if len(out)+count > n {
+				return nil, errTooMuchData
+			}
+			out = append(out, in[1:1+count]...)
+			in = in[1+count:]
+		} else {
+			count := int(c) + 1
+			if len(in) < 2 {
+				return nil, errNotEnoughData
+			}
+			if len(out)+count > n {
+				return nil, errTooMuchData
+			}
+			for i := 0; i < count; i++ {
+				out = append(out, in[1])
+			}
+			in = in[2:]
+		}
+	}
+	if len(out) != n {
+		return nil, errNotEnoughData
+	}
+	return out, nil
+}
+
+func zipCompress(in []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(in)
+	w.Close()
+	return buf.Bytes()
+}
+
+func zipUncompress(in []byte, n int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out := make([]byte, n)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, errNotEnoughData
+	}
+	if n, _ := r.Read(make([]byte, 1)); n != 0 {
+		return nil, errTooMuchData
+	}
+	return out, nil
+}
+
+// compress compresses the nx by ny samples of a block in the layout of the
+// file: row after row, and in each row, channel after channel.
+func compress(c Compression, raw []byte, chans []channel, nx, ny int) ([]byte, error) {
+	switch c {
+	case None:
+		return raw, nil
+	case RLE:
+		return rleCompress(interleave(raw)), nil
+	case ZIPS, ZIP:
+		return zipCompress(interleave(raw)), nil
+	case PIZ:
+		return pizCompress(raw, chans, nx, ny), nil
+	}
+	return nil, errors.New("exr: unsupported compression: " + c.String())
+}
+
+// decompress reverses compress, and returns rawSize bytes.
+func decompress(c Compression, b []byte, chans []channel, nx, ny int, rawSize int) ([]byte, error) {
+	if len(b) == rawSize {
+		// The blocks that do not compress are stored as they are.
+		return b, nil
+	}
+	switch c {
+	case RLE:
+		t, err := rleUncompress(b, rawSize)
+		if err != nil {
+			return nil, err
+		}
+		return deinterleave(t), nil
+	case ZIPS, ZIP:
+		t, err := zipUncompress(b, rawSize)
+		if err != nil {
+			return nil, err
+		}
+		return deinterleave(t), nil
+	case PIZ:
+		return pizDecompress(b, chans, nx, ny, rawSize)
+	}
+	return nil, errNotEnoughData
+}
@@ -0,0 +1,93 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exr
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestRLE(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 2, 3, 127, 128, 129, 1000} {
+		for _, runs := range []bool{false, true} {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = byte(rnd.Intn(256))
+				if runs && i > 0 && rnd.Intn(8) != 0 {
+					b[i] = b[i-1]
+				}
+			}
+			c := rleCompress(interleave(b))
+			t1, err := rleUncompress(c, n)
+			if err != nil {
+				t.Fatalf("%d bytes: %v", n, err)
+			}
+			if got := deinterleave(t1); !bytes.Equal(got, b) {
+				t.Fatalf("%d bytes, runs %v: got %v, want %v", n, runs, got, b)
+			}
+		}
+	}
+}
+
+func TestHuffman(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, tc := range []struct {
+		n, max int
+	}{
+		{1, 1},
+		{1000, 1},
+		{1000, 7},
+		{5000, 1 << 16},
+		{5000, 300},
+	} {
+		raw := make([]uint16, tc.n)
+		for i := range raw {
+			// A geometric distribution, with runs.
+			raw[i] = uint16(rnd.ExpFloat64() * float64(tc.max) / 8)
+			if int(raw[i]) >= tc.max {
+				raw[i] = uint16(tc.max - 1)
+			}
+			if i > 0 && rnd.Intn(4) == 0 {
+				raw[i] = raw[i-1]
+			}
+		}
+		got := make([]uint16, tc.n)
+		if err := hufUncompress(hufCompress(raw), got); err != nil {
+			t.Fatalf("%d values up to %d: %v", tc.n, tc.max, err)
+		}
+		for i := range raw {
+			if got[i] != raw[i] {
+				t.Fatalf("%d values up to %d: %d: got %d, want %d", tc.n, tc.max, i, got[i], raw[i])
+			}
+		}
+	}
+}
+
+func TestWavelet(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, mx := range []uint16{1<<14 - 1, 1<<16 - 1} {
+		for _, size := range [][2]int{{1, 1}, {7, 5}, {16, 16}, {33, 2}} {
+			nx, ny := size[0], size[1]
+			in := make([]uint16, 2*nx*ny)
+			for i := range in {
+				in[i] = uint16(rnd.Intn(int(mx) + 1))
+			}
+			want := append([]uint16(nil), in...)
+			for j := 0; j < 2; j++ {
+				wav2Encode(in[j:], nx, 2, ny, 2*nx, mx)
+			}
+			for j := 0; j < 2; j++ {
+				wav2Decode(in[j:], nx, 2, ny, 2*nx, mx)
+			}
+			for i := range in {
+				if in[i] != want[i] {
+					t.Fatalf("%dx%d, max %d: %d: got %d, want %d", nx, ny, mx, i, in[i], want[i])
+				}
+			}
+		}
+	}
+}
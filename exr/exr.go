@@ -0,0 +1,101 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package exr implements an OpenEXR image decoder and encoder.
+//
+// It reads and writes single-part scanline and tiled images with HALF and
+// FLOAT channels, and reads UINT channels, with the NONE, RLE, ZIPS, ZIP and
+// PIZ compressions. The tiled images with several levels are decoded at
+// their full resolution.
+//
+// The channels are mapped to the float typed images of the image package:
+// the R, G, B and A channels to *imageExt.RGB96f or *imageExt.RGBA128f, the
+// Y and A channels to *imageExt.Gray32f or *imageExt.GrayA64f, and other
+// channels by their number, in the order of their names. DecodeChannels
+// selects the channels by name instead, and DecodeHalf decodes to the
+// half-float images. As in OpenEXR, the colors of the images with an alpha
+// channel are alpha-premultiplied.
+//
+// The OpenEXR file format is documented at
+// https://www.openexr.com/documentation/openexrfilelayout.pdf.
+package exr
+
+import (
+	"image"
+	"io"
+
+	imageExt "github.com/chai2010/image"
+)
+
+const exrMagic = "\x76\x2f\x31\x01"
+
+// Compression is the compression method of an OpenEXR image.
+type Compression int
+
+// The values are those of the compression attribute.
+const (
+	None Compression = 0
+	RLE  Compression = 1
+	ZIPS Compression = 2
+	ZIP  Compression = 3
+	PIZ  Compression = 4
+)
+
+// PixelType is the type of the samples of the written channels.
+type PixelType int
+
+const (
+	// Auto selects Half for the half-float images and Float for the other
+	// images.
+	Auto  PixelType = iota
+	Float           // 32-bit IEEE 754 numbers.
+	Half            // 16-bit IEEE 754 numbers.
+)
+
+// Options are the encoding parameters.
+type Options struct {
+	// Compression is the compression method. The default is no
+	// compression.
+	Compression Compression
+	// PixelType is the type of the samples. Half samples are rounded to
+	// the nearest half-precision number.
+	PixelType PixelType
+	// TileWidth and TileHeight write a tiled image with tiles of that size
+	// if they are positive, and a scanline image otherwise.
+	TileWidth, TileHeight int
+	// Channels are the names of the channels of the image, in the order of
+	// its samples. The default names are Y, Y and A, R, G and B, or R, G,
+	// B and A.
+	Channels []string
+}
+
+func (opt *Options) Lossless() bool {
+	return opt == nil || opt.PixelType != Half
+}
+
+func (opt *Options) Quality() float32 {
+	return 0
+}
+
+func toOptions(opt imageExt.Options) *Options {
+	if opt, ok := opt.(*Options); ok {
+		return opt
+	}
+	return nil
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt imageExt.Options) error {
+	return Encode(w, m, toOptions(opt))
+}
+
+func init() {
+	imageExt.RegisterFormat(imageExt.Format{
+		Name:         "exr",
+		Extensions:   []string{".exr"},
+		Magics:       []string{exrMagic},
+		DecodeConfig: DecodeConfig,
+		Decode:       Decode,
+		Encode:       imageExtEncode,
+	})
+}
@@ -0,0 +1,367 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+	"strconv"
+)
+
+// A FormatError reports that the input is not a valid OpenEXR image.
+type FormatError string
+
+func (e FormatError) Error() string { return "exr: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// OpenEXR feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "exr: unsupported feature: " + string(e) }
+
+// Flags of the version field.
+const (
+	flagTiled     = 0x200
+	flagLongNames = 0x400
+	flagDeep      = 0x800
+	flagMultiPart = 0x1000
+)
+
+// Pixel types of the channels.
+const (
+	pixelUint  = 0
+	pixelHalf  = 1
+	pixelFloat = 2
+)
+
+// Level modes of the tiled images.
+const (
+	oneLevel     = 0
+	mipmapLevels = 1
+	ripmapLevels = 2
+)
+
+// maxPixels limits the size of the decoded images.
+const maxPixels = 1 << 28
+
+type channel struct {
+	name                 string
+	pixelType            int32
+	pLinear              uint8
+	xSampling, ySampling int32
+}
+
+// size returns the number of bytes of the samples.
+func (c *channel) size() int {
+	if c.pixelType == pixelHalf {
+		return 2
+	}
+	return 4
+}
+
+type header struct {
+	channels      []channel // Sorted by name.
+	compression   Compression
+	dataWindow    image.Rectangle
+	displayWindow image.Rectangle
+	lineOrder     uint8
+
+	tiled                   bool
+	tileWidth, tileHeight   int
+	levelMode, roundingMode int
+}
+
+// pixelSize returns the number of bytes of the samples of a pixel.
+func (h *header) pixelSize() int {
+	n := 0
+	for i := range h.channels {
+		n += h.channels[i].size()
+	}
+	return n
+}
+
+// roundLog2 returns the logarithm of x in base 2, rounded up or down.
+func roundLog2(x int, up bool) int {
+	y := 0
+	if up {
+		for 1<<uint(y) < x {
+			y++
+		}
+		return y
+	}
+	for x > 1 {
+		x >>= 1
+		y++
+	}
+	return y
+}
+
+// levelSize returns the size of level l of a size that is halved at each
+// level.
+func levelSize(size, l int, up bool) int {
+	if up {
+		size = (size + 1<<uint(l) - 1) >> uint(l)
+	} else {
+		size >>= uint(l)
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// numChunks returns the number of scanline blocks or tiles, of all levels.
+func (h *header) numChunks() int {
+	w, ht := h.dataWindow.Dx(), h.dataWindow.Dy()
+	if !h.tiled {
+		n := h.compression.linesPerBlock()
+		return (ht + n - 1) / n
+	}
+	tiles := func(w, h0 int) int {
+		return (w + h.tileWidth - 1) / h.tileWidth * ((h0 + h.tileHeight - 1) / h.tileHeight)
+	}
+	up := h.roundingMode == 1
+	n := 0
+	switch h.levelMode {
+	case mipmapLevels:
+		size := w
+		if ht > size {
+			size = ht
+		}
+		for l := 0; l <= roundLog2(size, up); l++ {
+			n += tiles(levelSize(w, l, up), levelSize(ht, l, up))
+		}
+	case ripmapLevels:
+		for ly := 0; ly <= roundLog2(ht, up); ly++ {
+			for lx := 0; lx <= roundLog2(w, up); lx++ {
+				n += tiles(levelSize(w, lx, up), levelSize(ht, ly, up))
+			}
+		}
+	default:
+		n = tiles(w, ht)
+	}
+	return n
+}
+
+// cstring returns the null-terminated string at the start of b, and the
+// rest of b.
+func cstring(b []byte) (string, []byte, error) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", nil, errNotEnoughHeader
+	}
+	return string(b[:i]), b[i+1:], nil
+}
+
+var errNotEnoughHeader = FormatError("truncated header")
+
+func readBox2i(v []byte) (image.Rectangle, error) {
+	if len(v) != 16 {
+		return image.Rectangle{}, FormatError("bad box2i attribute")
+	}
+	xMin := int32(binary.LittleEndian.Uint32(v[0:]))
+	yMin := int32(binary.LittleEndian.Uint32(v[4:]))
+	xMax := int32(binary.LittleEndian.Uint32(v[8:]))
+	yMax := int32(binary.LittleEndian.Uint32(v[12:]))
+	if xMax < xMin-1 || yMax < yMin-1 || int64(xMax) >= math.MaxInt32 || int64(yMax) >= math.MaxInt32 {
+		return image.Rectangle{}, FormatError("bad box2i attribute")
+	}
+	return image.Rect(int(xMin), int(yMin), int(xMax)+1, int(yMax)+1), nil
+}
+
+func readChannels(v []byte) ([]channel, error) {
+	var chans []channel
+	for {
+		name, rest, err := cstring(v)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			return chans, nil
+		}
+		if len(rest) < 16 {
+			return nil, errNotEnoughHeader
+		}
+		c := channel{
+			name:      name,
+			pixelType: int32(binary.LittleEndian.Uint32(rest[0:])),
+			pLinear:   rest[4],
+			xSampling: int32(binary.LittleEndian.Uint32(rest[8:])),
+			ySampling: int32(binary.LittleEndian.Uint32(rest[12:])),
+		}
+		if c.pixelType < pixelUint || c.pixelType > pixelFloat {
+			return nil, FormatError("bad pixel type of channel " + strconv.Quote(name))
+		}
+		if c.xSampling != 1 || c.ySampling != 1 {
+			return nil, UnsupportedError("subsampled channel " + strconv.Quote(name))
+		}
+		chans = append(chans, c)
+		v = rest[16:]
+	}
+}
+
+// readHeader reads the header at the start of b, and returns the rest of b.
+func readHeader(b []byte) (*header, []byte, error) {
+	if len(b) < 8 {
+		return nil, nil, errNotEnoughHeader
+	}
+	if string(b[:4]) != exrMagic {
+		return nil, nil, FormatError("bad magic number")
+	}
+	version := binary.LittleEndian.Uint32(b[4:])
+	if version&0xff != 2 {
+		return nil, nil, UnsupportedError("version " + strconv.Itoa(int(version&0xff)))
+	}
+	if version&(flagDeep|flagMultiPart) != 0 {
+		return nil, nil, UnsupportedError("deep or multi-part image")
+	}
+	h := &header{tiled: version&flagTiled != 0}
+	b = b[8:]
+
+	seen := map[string]bool{}
+	for {
+		name, rest, err := cstring(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		b = rest
+		if name == "" {
+			break
+		}
+		typ, rest, err := cstring(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) < 4 {
+			return nil, nil, errNotEnoughHeader
+		}
+		size := binary.LittleEndian.Uint32(rest)
+		if uint64(size) > uint64(len(rest)-4) {
+			return nil, nil, errNotEnoughHeader
+		}
+		v := rest[4 : 4+size]
+		b = rest[4+size:]
+		seen[name] = true
+
+		switch name {
+		case "channels":
+			if typ != "chlist" {
+				return nil, nil, FormatError("bad channels attribute")
+			}
+			if h.channels, err = readChannels(v); err != nil {
+				return nil, nil, err
+			}
+		case "compression":
+			if len(v) != 1 {
+				return nil, nil, FormatError("bad compression attribute")
+			}
+			h.compression = Compression(v[0])
+			if h.compression > PIZ {
+				return nil, nil, UnsupportedError("compression " + h.compression.String())
+			}
+		case "dataWindow":
+			if h.dataWindow, err = readBox2i(v); err != nil {
+				return nil, nil, err
+			}
+		case "displayWindow":
+			if h.displayWindow, err = readBox2i(v); err != nil {
+				return nil, nil, err
+			}
+		case "lineOrder":
+			if len(v) != 1 {
+				return nil, nil, FormatError("bad lineOrder attribute")
+			}
+			h.lineOrder = v[0]
+		case "tiles":
+			if len(v) != 9 {
+				return nil, nil, FormatError("bad tiles attribute")
+			}
+			tw := binary.LittleEndian.Uint32(v[0:])
+			th := binary.LittleEndian.Uint32(v[4:])
+			if tw < 1 || th < 1 || tw > maxPixels || th > maxPixels {
+				return nil, nil, FormatError("bad tile size")
+			}
+			h.tileWidth, h.tileHeight = int(tw), int(th)
+			h.levelMode, h.roundingMode = int(v[8]&0xf), int(v[8]>>4)
+			if h.levelMode > ripmapLevels || h.roundingMode > 1 {
+				return nil, nil, FormatError("bad tiles attribute")
+			}
+		}
+	}
+	for _, name := range []string{"channels", "compression", "dataWindow", "displayWindow", "lineOrder"} {
+		if !seen[name] {
+			return nil, nil, FormatError("missing " + name + " attribute")
+		}
+	}
+	if h.tiled && !seen["tiles"] {
+		return nil, nil, FormatError("missing tiles attribute")
+	}
+	if dx, dy := h.dataWindow.Dx(), h.dataWindow.Dy(); dy > 0 && dx > maxPixels/dy {
+		return nil, nil, UnsupportedError("image is too large")
+	}
+	return h, b, nil
+}
+
+// attribute appends the attribute to b.
+func attribute(b []byte, name, typ string, v []byte) []byte {
+	b = append(b, name...)
+	b = append(b, 0)
+	b = append(b, typ...)
+	b = append(b, 0)
+	b = appendUint32(b, uint32(len(v)))
+	return append(b, v...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendBox2i(b []byte, r image.Rectangle) []byte {
+	b = appendUint32(b, uint32(int32(r.Min.X)))
+	b = appendUint32(b, uint32(int32(r.Min.Y)))
+	b = appendUint32(b, uint32(int32(r.Max.X-1)))
+	return appendUint32(b, uint32(int32(r.Max.Y-1)))
+}
+
+// marshal returns the magic number, the version field and the header.
+func (h *header) marshal() []byte {
+	version := uint32(2)
+	var chlist []byte
+	for _, c := range h.channels {
+		if len(c.name) > 31 {
+			version |= flagLongNames
+		}
+		chlist = append(chlist, c.name...)
+		chlist = append(chlist, 0)
+		chlist = appendUint32(chlist, uint32(c.pixelType))
+		chlist = append(chlist, c.pLinear, 0, 0, 0)
+		chlist = appendUint32(chlist, uint32(c.xSampling))
+		chlist = appendUint32(chlist, uint32(c.ySampling))
+	}
+	chlist = append(chlist, 0)
+	if h.tiled {
+		version |= flagTiled
+	}
+
+	b := append([]byte(exrMagic), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], version)
+	b = attribute(b, "channels", "chlist", chlist)
+	b = attribute(b, "compression", "compression", []byte{byte(h.compression)})
+	b = attribute(b, "dataWindow", "box2i", appendBox2i(nil, h.dataWindow))
+	b = attribute(b, "displayWindow", "box2i", appendBox2i(nil, h.displayWindow))
+	b = attribute(b, "lineOrder", "lineOrder", []byte{h.lineOrder})
+	b = attribute(b, "pixelAspectRatio", "float", appendUint32(nil, math.Float32bits(1)))
+	b = attribute(b, "screenWindowCenter", "v2f", make([]byte, 8))
+	b = attribute(b, "screenWindowWidth", "float", appendUint32(nil, math.Float32bits(1)))
+	if h.tiled {
+		tiles := appendUint32(nil, uint32(h.tileWidth))
+		tiles = appendUint32(tiles, uint32(h.tileHeight))
+		tiles = append(tiles, byte(h.levelMode|h.roundingMode<<4))
+		b = attribute(b, "tiles", "tiledesc", tiles)
+	}
+	return append(b, 0)
+}
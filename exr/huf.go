@@ -0,0 +1,439 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exr
+
+import (
+	"container/heap"
+	"encoding/binary"
+)
+
+// The Huffman coder of the PIZ compression, which codes 16-bit values with
+// a canonical code of up to 58 bits. An extra symbol, after the largest
+// value, codes a run of up to 255 repetitions of the previous value.
+const (
+	hufEncBits = 16 // The number of bits of the values.
+	hufDecBits = 14 // The number of bits of the decoding table index.
+	hufEncSize = 1<<hufEncBits + 1
+	hufDecSize = 1 << hufDecBits
+	hufDecMask = hufDecSize - 1
+
+	// The code lengths of the packed code table use these codes for runs
+	// of zero lengths.
+	shortZeroCodeRun = 59
+	longZeroCodeRun  = 63
+	shortestLongRun  = 2 + longZeroCodeRun - shortZeroCodeRun
+	longestLongRun   = 255 + shortestLongRun
+)
+
+// A code is packed with its length in the low 6 bits.
+func hufLength(code uint64) int  { return int(code & 63) }
+func hufCode(code uint64) uint64 { return code >> 6 }
+
+type bitWriter struct {
+	out []byte
+	c   uint64 // The bits not written to out yet.
+	lc  uint   // The number of bits in c.
+}
+
+func (w *bitWriter) writeBits(n uint, bits uint64) {
+	w.c = w.c<<n | bits
+	w.lc += n
+	for w.lc >= 8 {
+		w.lc -= 8
+		w.out = append(w.out, byte(w.c>>w.lc))
+	}
+}
+
+func (w *bitWriter) writeCode(code uint64) {
+	w.writeBits(uint(hufLength(code)), hufCode(code))
+}
+
+// flush writes the remaining bits, padded with zeros.
+func (w *bitWriter) flush() {
+	if w.lc > 0 {
+		w.out = append(w.out, byte(w.c<<(8-w.lc)))
+	}
+}
+
+// hufCanonicalCodeTable replaces the code lengths in hcode with the codes
+// of the canonical Huffman code, with the longest codes first.
+func hufCanonicalCodeTable(hcode []uint64) {
+	var n [59]uint64
+	for _, l := range hcode {
+		n[l]++
+	}
+	var c uint64
+	for i := 58; i > 0; i-- {
+		nc := (c + n[i]) >> 1
+		n[i] = c
+		c = nc
+	}
+	for i, l := range hcode {
+		if l > 0 {
+			hcode[i] = l | n[l]<<6
+			n[l]++
+		}
+	}
+}
+
+// freqHeap is a min-heap of symbols by frequency.
+type freqHeap struct {
+	sym []int
+	frq []uint64
+}
+
+func (h *freqHeap) Len() int           { return len(h.sym) }
+func (h *freqHeap) Less(i, j int) bool { return h.frq[h.sym[i]] < h.frq[h.sym[j]] }
+func (h *freqHeap) Swap(i, j int)      { h.sym[i], h.sym[j] = h.sym[j], h.sym[i] }
+func (h *freqHeap) Push(x interface{}) { h.sym = append(h.sym, x.(int)) }
+func (h *freqHeap) Pop() interface{} {
+	x := h.sym[len(h.sym)-1]
+	h.sym = h.sym[:len(h.sym)-1]
+	return x
+}
+
+// hufBuildEncTable replaces the frequencies of the symbols in frq with
+// their codes, and returns the smallest and largest coded symbols. The
+// largest is the run symbol.
+func hufBuildEncTable(frq []uint64) (im, iM int) {
+	for frq[im] == 0 {
+		im++
+	}
+	// The symbols that are merged into the same node are linked into lists,
+	// whose ends link to themselves.
+	hlink := make([]int, hufEncSize)
+	h := &freqHeap{frq: frq}
+	for i := im; i < hufEncSize; i++ {
+		hlink[i] = i
+		if frq[i] != 0 {
+			h.sym = append(h.sym, i)
+			iM = i
+		}
+	}
+	iM++
+	frq[iM] = 1
+	h.sym = append(h.sym, iM)
+	heap.Init(h)
+
+	scode := make([]uint64, hufEncSize)
+	for h.Len() > 1 {
+		// Merge the two least frequent nodes, which adds a bit to the
+		// codes of their symbols.
+		mm := heap.Pop(h).(int)
+		m := h.sym[0]
+		frq[m] += frq[mm]
+		heap.Fix(h, 0)
+		j := m
+		for {
+			scode[j]++
+			if hlink[j] == j {
+				hlink[j] = mm
+				break
+			}
+			j = hlink[j]
+		}
+		for j := mm; ; j = hlink[j] {
+			scode[j]++
+			if hlink[j] == j {
+				break
+			}
+		}
+	}
+	hufCanonicalCodeTable(scode)
+	copy(frq, scode)
+	return im, iM
+}
+
+// hufPackEncTable returns the code lengths of the symbols from im to iM,
+// with runs of zero lengths.
+func hufPackEncTable(hcode []uint64, im, iM int) []byte {
+	var w bitWriter
+	for ; im <= iM; im++ {
+		l := hufLength(hcode[im])
+		if l == 0 {
+			zerun := 1
+			for im < iM && zerun < longestLongRun && hufLength(hcode[im+1]) == 0 {
+				im++
+				zerun++
+			}
+			if zerun >= 2 {
+				if zerun >= shortestLongRun {
+					w.writeBits(6, longZeroCodeRun)
+					w.writeBits(8, uint64(zerun-shortestLongRun))
+				} else {
+					w.writeBits(6, uint64(shortZeroCodeRun+zerun-2))
+				}
+				continue
+			}
+		}
+		w.writeBits(6, uint64(l))
+	}
+	w.flush()
+	return w.out
+}
+
+// hufUnpackEncTable reads the code table packed by hufPackEncTable, and
+// returns it with the number of bytes that it took.
+func hufUnpackEncTable(b []byte, im, iM int) ([]uint64, int, error) {
+	hcode := make([]uint64, hufEncSize)
+	var c uint64
+	lc, p := 0, 0
+	getBits := func(n int) (uint64, error) {
+		for lc < n {
+			if p >= len(b) {
+				return 0, errNotEnoughData
+			}
+			c = c<<8 | uint64(b[p])
+			p++
+			lc += 8
+		}
+		lc -= n
+		return c >> uint(lc) & (1<<uint(n) - 1), nil
+	}
+	for ; im <= iM; im++ {
+		l, err := getBits(6)
+		if err != nil {
+			return nil, 0, err
+		}
+		zerun := 0
+		switch {
+		case l == longZeroCodeRun:
+			n, err := getBits(8)
+			if err != nil {
+				return nil, 0, err
+			}
+			zerun = int(n) + shortestLongRun
+		case l >= shortZeroCodeRun:
+			zerun = int(l) - shortZeroCodeRun + 2
+		default:
+			hcode[im] = l
+			continue
+		}
+		if im+zerun > iM+1 {
+			return nil, 0, FormatError("bad Huffman code table")
+		}
+		// The lengths are zero already.
+		im += zerun - 1
+	}
+	hufCanonicalCodeTable(hcode)
+	return hcode, p, nil
+}
+
+// hufDec is an entry of the decoding table, which is indexed by the next
+// hufDecBits bits. It holds the symbol of a short code, or the symbols of
+// the long codes that start with the index.
+type hufDec struct {
+	len int
+	lit int
+	p   []int
+}
+
+func hufBuildDecTable(hcode []uint64, im, iM int) ([]hufDec, error) {
+	hdec := make([]hufDec, hufDecSize)
+	for ; im <= iM; im++ {
+		c, l := hufCode(hcode[im]), hufLength(hcode[im])
+		if c>>uint(l) != 0 {
+			return nil, FormatError("bad Huffman code table")
+		}
+		if l > hufDecBits {
+			pl := &hdec[c>>uint(l-hufDecBits)]
+			if pl.len != 0 {
+				return nil, FormatError("bad Huffman code table")
+			}
+			pl.p = append(pl.p, im)
+		} else if l > 0 {
+			base := c << uint(hufDecBits-l)
+			for i := uint64(0); i < 1<<uint(hufDecBits-l); i++ {
+				pl := &hdec[base+i]
+				if pl.len != 0 || pl.p != nil {
+					return nil, FormatError("bad Huffman code table")
+				}
+				pl.len, pl.lit = l, im
+			}
+		}
+	}
+	return hdec, nil
+}
+
+// hufEncode writes the codes of the values of in, and codes runs of the
+// same value with the run symbol rlc when they are shorter.
+func hufEncode(w *bitWriter, hcode []uint64, in []uint16, rlc int) {
+	send := func(s uint16, n int) {
+		// n is the number of repetitions after the first value.
+		sCode, runCode := hcode[s], hcode[rlc]
+		if hufLength(sCode)+hufLength(runCode)+8 < hufLength(sCode)*n {
+			w.writeCode(sCode)
+			w.writeCode(runCode)
+			w.writeBits(8, uint64(n))
+			return
+		}
+		for ; n >= 0; n-- {
+			w.writeCode(sCode)
+		}
+	}
+	s, cs := in[0], 0
+	for _, v := range in[1:] {
+		if v == s && cs < 255 {
+			cs++
+		} else {
+			send(s, cs)
+			cs = 0
+		}
+		s = v
+	}
+	send(s, cs)
+}
+
+// hufDecode decodes the ni bits of in into out.
+func hufDecode(hcode []uint64, hdec []hufDec, in []byte, ni int, rlc int, out []uint16) error {
+	var c uint64
+	lc, p, o := 0, 0, 0
+	ie := (ni + 7) / 8
+	getCode := func(sym int) error {
+		if sym != rlc {
+			if o >= len(out) {
+				return errTooMuchData
+			}
+			out[o] = uint16(sym)
+			o++
+			return nil
+		}
+		if lc < 8 {
+			if p >= len(in) {
+				return errNotEnoughData
+			}
+			c = c<<8 | uint64(in[p])
+			p++
+			lc += 8
+		}
+		lc -= 8
+		n := int(uint8(c >> uint(lc)))
+		if o+n > len(out) {
+			return errTooMuchData
+		}
+		if o == 0 {
+			return errNotEnoughData
+		}
+		for s := out[o-1]; n > 0; n-- {
+			out[o] = s
+			o++
+		}
+		return nil
+	}
+
+	for p < ie {
+		c = c<<8 | uint64(in[p])
+		p++
+		lc += 8
+		for lc >= hufDecBits {
+			pl := &hdec[c>>uint(lc-hufDecBits)&hufDecMask]
+			if pl.len != 0 {
+				lc -= pl.len
+				if err := getCode(pl.lit); err != nil {
+					return err
+				}
+				continue
+			}
+			// Search the long codes.
+			found := false
+			for _, sym := range pl.p {
+				l := hufLength(hcode[sym])
+				for lc < l && p < ie {
+					c = c<<8 | uint64(in[p])
+					p++
+					lc += 8
+				}
+				if lc >= l && hufCode(hcode[sym]) == c>>uint(lc-l)&(1<<uint(l)-1) {
+					lc -= l
+					if err := getCode(sym); err != nil {
+						return err
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errInvalidCode
+			}
+		}
+	}
+
+	// The remaining codes are short, and the padding bits are dropped.
+	i := (8 - ni) & 7
+	c >>= uint(i)
+	lc -= i
+	for lc > 0 {
+		pl := &hdec[c<<uint(hufDecBits-lc)&hufDecMask]
+		if pl.len == 0 || pl.len > lc {
+			return errInvalidCode
+		}
+		lc -= pl.len
+		if err := getCode(pl.lit); err != nil {
+			return err
+		}
+	}
+	if o != len(out) {
+		return errNotEnoughData
+	}
+	return nil
+}
+
+// hufCompress returns the Huffman coding of raw, after its header of 20
+// bytes: the smallest and the largest symbols, the size of the code table
+// and the number of bits of the coded values.
+func hufCompress(raw []uint16) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+	frq := make([]uint64, hufEncSize)
+	for _, v := range raw {
+		frq[v]++
+	}
+	im, iM := hufBuildEncTable(frq)
+	table := hufPackEncTable(frq, im, iM)
+
+	w := &bitWriter{out: make([]byte, 20, 20+len(table)+len(raw))}
+	w.out = append(w.out, table...)
+	hufEncode(w, frq, raw, iM)
+	nBits := 8*(len(w.out)-20-len(table)) + int(w.lc)
+	w.flush()
+	binary.LittleEndian.PutUint32(w.out[0:], uint32(im))
+	binary.LittleEndian.PutUint32(w.out[4:], uint32(iM))
+	binary.LittleEndian.PutUint32(w.out[8:], uint32(len(table)))
+	binary.LittleEndian.PutUint32(w.out[12:], uint32(nBits))
+	return w.out
+}
+
+// hufUncompress decodes the len(raw) values of b into raw.
+func hufUncompress(b []byte, raw []uint16) error {
+	if len(b) == 0 {
+		if len(raw) != 0 {
+			return errNotEnoughData
+		}
+		return nil
+	}
+	if len(b) < 20 {
+		return errNotEnoughData
+	}
+	im := binary.LittleEndian.Uint32(b[0:])
+	iM := binary.LittleEndian.Uint32(b[4:])
+	nBits := int64(binary.LittleEndian.Uint32(b[12:]))
+	if im >= hufEncSize || iM >= hufEncSize {
+		return FormatError("bad Huffman code table size")
+	}
+	hcode, n, err := hufUnpackEncTable(b[20:], int(im), int(iM))
+	if err != nil {
+		return err
+	}
+	b = b[20+n:]
+	if nBits > 8*int64(len(b)) {
+		return errNotEnoughData
+	}
+	hdec, err := hufBuildDecTable(hcode, int(im), int(iM))
+	if err != nil {
+		return err
+	}
+	return hufDecode(hcode, hdec, b, int(nBits), int(iM), raw)
+}
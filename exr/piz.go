@@ -0,0 +1,282 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exr
+
+import (
+	"encoding/binary"
+)
+
+// The PIZ compression maps the 16-bit words of the samples to the smallest
+// range with a lookup table, transforms each channel with a Haar wavelet and
+// codes the result with Huffman coding. 32-bit samples are split into two
+// 16-bit words, which are transformed separately.
+
+const bitmapSize = 1 << 16 >> 3
+
+// wenc14 and wdec14 are the wavelet steps for values of at most 14 bits,
+// which cannot overflow.
+func wenc14(a, b uint16) (l, h uint16) {
+	as, bs := int(int16(a)), int(int16(b))
+	return uint16((as + bs) >> 1), uint16(as - bs)
+}
+
+func wdec14(l, h uint16) (a, b uint16) {
+	hi := int(int16(h))
+	ai := int(int16(l)) + hi&1 + hi>>1
+	return uint16(int16(ai)), uint16(int16(ai - hi))
+}
+
+// wenc16 and wdec16 are the wavelet steps for 16-bit values, modulo 1<<16.
+const (
+	aOffset = 1 << 15
+	mOffset = 1 << 15
+	modMask = 1<<16 - 1
+)
+
+func wenc16(a, b uint16) (l, h uint16) {
+	ao := (int(a) + aOffset) & modMask
+	m := (ao + int(b)) >> 1
+	d := ao - int(b)
+	if d < 0 {
+		m = (m + mOffset) & modMask
+	}
+	return uint16(m), uint16(d & modMask)
+}
+
+func wdec16(l, h uint16) (a, b uint16) {
+	m, d := int(l), int(h)
+	bb := (m - d>>1) & modMask
+	aa := (d + bb - aOffset) & modMask
+	return uint16(aa), uint16(bb)
+}
+
+// wav2Encode transforms the nx by ny values of in, with offsets ox and oy
+// between the columns and the rows, whose largest value is mx.
+func wav2Encode(in []uint16, nx, ox, ny, oy int, mx uint16) {
+	enc := wenc16
+	if mx < 1<<14 {
+		enc = wenc14
+	}
+	n := ny
+	if nx < ny {
+		n = nx
+	}
+	for p, p2 := 1, 2; p2 <= n; p, p2 = p2, p2<<1 {
+		ey := oy * (ny - p2)
+		oy1, oy2, ox1, ox2 := oy*p, oy*p2, ox*p, ox*p2
+		py := 0
+		for ; py <= ey; py += oy2 {
+			px, ex := py, py+ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01, p10 := px+ox1, px+oy1
+				p11 := p10 + ox1
+				i00, i01 := enc(in[px], in[p01])
+				i10, i11 := enc(in[p10], in[p11])
+				in[px], in[p10] = enc(i00, i10)
+				in[p01], in[p11] = enc(i01, i11)
+			}
+			// The odd column.
+			if nx&p != 0 {
+				p10 := px + oy1
+				in[px], in[p10] = enc(in[px], in[p10])
+			}
+		}
+		// The odd row.
+		if ny&p != 0 {
+			px, ex := py, py+ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				in[px], in[p01] = enc(in[px], in[p01])
+			}
+		}
+	}
+}
+
+// wav2Decode reverses wav2Encode.
+func wav2Decode(in []uint16, nx, ox, ny, oy int, mx uint16) {
+	dec := wdec16
+	if mx < 1<<14 {
+		dec = wdec14
+	}
+	n := ny
+	if nx < ny {
+		n = nx
+	}
+	p := 1
+	for p <= n {
+		p <<= 1
+	}
+	p >>= 1
+	p2 := p
+	p >>= 1
+	for ; p >= 1; p2, p = p, p>>1 {
+		ey := oy * (ny - p2)
+		oy1, oy2, ox1, ox2 := oy*p, oy*p2, ox*p, ox*p2
+		py := 0
+		for ; py <= ey; py += oy2 {
+			px, ex := py, py+ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01, p10 := px+ox1, px+oy1
+				p11 := p10 + ox1
+				i00, i10 := dec(in[px], in[p10])
+				i01, i11 := dec(in[p01], in[p11])
+				in[px], in[p01] = dec(i00, i01)
+				in[p10], in[p11] = dec(i10, i11)
+			}
+			if nx&p != 0 {
+				p10 := px + oy1
+				in[px], in[p10] = dec(in[px], in[p10])
+			}
+		}
+		if ny&p != 0 {
+			px, ex := py, py+ox*(nx-p2)
+			for ; px <= ex; px += ox2 {
+				p01 := px + ox1
+				in[px], in[p01] = dec(in[px], in[p01])
+			}
+		}
+	}
+}
+
+// pizChannels returns the offsets of the words of the channels, which are
+// stored one channel after the other.
+func pizChannels(chans []channel, nx, ny int) []int {
+	starts := make([]int, len(chans)+1)
+	for i, c := range chans {
+		starts[i+1] = starts[i] + nx*ny*c.size()/2
+	}
+	return starts
+}
+
+func pizCompress(raw []byte, chans []channel, nx, ny int) []byte {
+	starts := pizChannels(chans, nx, ny)
+	words := make([]uint16, len(raw)/2)
+	next := append([]int(nil), starts...)
+	for y, i := 0, 0; y < ny; y++ {
+		for k, c := range chans {
+			for n := nx * c.size() / 2; n > 0; n-- {
+				words[next[k]] = binary.LittleEndian.Uint16(raw[i:])
+				next[k]++
+				i += 2
+			}
+		}
+	}
+
+	// The bitmap marks the values that are used, but zero.
+	var bitmap [bitmapSize]byte
+	for _, v := range words {
+		bitmap[v>>3] |= 1 << (v & 7)
+	}
+	bitmap[0] &^= 1
+	minNonZero, maxNonZero := bitmapSize-1, 0
+	for i, b := range bitmap {
+		if b != 0 {
+			if i < minNonZero {
+				minNonZero = i
+			}
+			if i > maxNonZero {
+				maxNonZero = i
+			}
+		}
+	}
+	var lut [1 << 16]uint16
+	k := 0
+	for i := range lut {
+		if i == 0 || bitmap[i>>3]&(1<<uint(i&7)) != 0 {
+			lut[i] = uint16(k)
+			k++
+		}
+	}
+	maxValue := uint16(k - 1)
+	for i, v := range words {
+		words[i] = lut[v]
+	}
+
+	out := make([]byte, 4, 8+bitmapSize)
+	binary.LittleEndian.PutUint16(out[0:], uint16(minNonZero))
+	binary.LittleEndian.PutUint16(out[2:], uint16(maxNonZero))
+	if minNonZero <= maxNonZero {
+		out = append(out, bitmap[minNonZero:maxNonZero+1]...)
+	}
+	for k, c := range chans {
+		size := c.size() / 2
+		for j := 0; j < size; j++ {
+			wav2Encode(words[starts[k]+j:], nx, size, ny, nx*size, maxValue)
+		}
+	}
+	huf := hufCompress(words)
+	out = append(out, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(out[len(out)-4:], uint32(len(huf)))
+	return append(out, huf...)
+}
+
+func pizDecompress(b []byte, chans []channel, nx, ny int, rawSize int) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errNotEnoughData
+	}
+	minNonZero := int(binary.LittleEndian.Uint16(b[0:]))
+	maxNonZero := int(binary.LittleEndian.Uint16(b[2:]))
+	b = b[4:]
+	if maxNonZero >= bitmapSize {
+		return nil, FormatError("bad PIZ bitmap")
+	}
+	var bitmap [bitmapSize]byte
+	if minNonZero <= maxNonZero {
+		n := maxNonZero - minNonZero + 1
+		if len(b) < n {
+			return nil, errNotEnoughData
+		}
+		copy(bitmap[minNonZero:], b[:n])
+		b = b[n:]
+	}
+	var lut [1 << 16]uint16
+	k := 0
+	for i := range lut {
+		if i == 0 || bitmap[i>>3]&(1<<uint(i&7)) != 0 {
+			lut[k] = uint16(i)
+			k++
+		}
+	}
+	maxValue := uint16(k - 1)
+
+	if len(b) < 4 {
+		return nil, errNotEnoughData
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+	if n < 0 || n > len(b) {
+		return nil, errNotEnoughData
+	}
+	starts := pizChannels(chans, nx, ny)
+	words := make([]uint16, starts[len(chans)])
+	if 2*len(words) != rawSize {
+		return nil, FormatError("bad PIZ block size")
+	}
+	if err := hufUncompress(b[:n], words); err != nil {
+		return nil, err
+	}
+	for k, c := range chans {
+		size := c.size() / 2
+		for j := 0; j < size; j++ {
+			wav2Decode(words[starts[k]+j:], nx, size, ny, nx*size, maxValue)
+		}
+	}
+	for i, v := range words {
+		words[i] = lut[v]
+	}
+
+	raw := make([]byte, rawSize)
+	next := append([]int(nil), starts...)
+	for y, i := 0, 0; y < ny; y++ {
+		for k, c := range chans {
+			for n := nx * c.size() / 2; n > 0; n-- {
+				binary.LittleEndian.PutUint16(raw[i:], words[next[k]])
+				next[k]++
+				i += 2
+			}
+		}
+	}
+	return raw, nil
+}
@@ -0,0 +1,271 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exr
+
+import (
+	"encoding/binary"
+	"image"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strconv"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// defaultChannels returns the indexes of the channels of the decoded image,
+// which are -1 for missing color channels.
+func defaultChannels(chans []channel) ([]int, error) {
+	index := func(name string) int {
+		for i := range chans {
+			if chans[i].name == name {
+				return i
+			}
+		}
+		return -1
+	}
+	r, g, b, y, a := index("R"), index("G"), index("B"), index("Y"), index("A")
+	var sel []int
+	switch {
+	case r >= 0 || g >= 0 || b >= 0:
+		sel = []int{r, g, b}
+	case y >= 0:
+		sel = []int{y}
+	case len(chans) == 0:
+		return nil, FormatError("no channels")
+	default:
+		for i := 0; i < len(chans) && i < 4; i++ {
+			sel = append(sel, i)
+		}
+		return sel, nil
+	}
+	if a >= 0 {
+		sel = append(sel, a)
+	}
+	return sel, nil
+}
+
+// namedChannels returns the indexes of the named channels.
+func namedChannels(chans []channel, names []string) ([]int, error) {
+	if len(names) < 1 || len(names) > 4 {
+		return nil, UnsupportedError(strconv.Itoa(len(names)) + " channels")
+	}
+	var sel []int
+	for _, name := range names {
+		i := 0
+		for i < len(chans) && chans[i].name != name {
+			i++
+		}
+		if i == len(chans) {
+			return nil, FormatError("missing channel " + strconv.Quote(name))
+		}
+		sel = append(sel, i)
+	}
+	return sel, nil
+}
+
+type decoder struct {
+	h   *header
+	sel []int
+	m   imageExt.Image
+}
+
+// storeBlock stores the samples of the nx by ny block at (x0, y0) in the
+// image.
+func (d *decoder) storeBlock(raw []byte, x0, y0, nx, ny int) {
+	chans := d.h.channels
+	offsets := make([]int, len(chans))
+	rowSize := 0
+	for i := range chans {
+		offsets[i] = rowSize
+		rowSize += nx * chans[i].size()
+	}
+	pix, stride, r := d.m.Pix(), d.m.Stride(), d.m.Rect()
+	n, half := len(d.sel), d.m.Depth() == imageExt.Float16
+	size := 4
+	if half {
+		size = 2
+	}
+	for y := 0; y < ny; y++ {
+		row := raw[y*rowSize : (y+1)*rowSize]
+		p := pix[(y0+y-r.Min.Y)*stride+(x0-r.Min.X)*size*n:]
+		for j, k := range d.sel {
+			if k < 0 {
+				continue
+			}
+			s := row[offsets[k]:]
+			for x := 0; x < nx; x++ {
+				if half && chans[k].pixelType == pixelHalf {
+					binary.BigEndian.PutUint16(p[2*(x*n+j):], binary.LittleEndian.Uint16(s[2*x:]))
+					continue
+				}
+				var v uint32
+				switch chans[k].pixelType {
+				case pixelHalf:
+					v = math.Float32bits(colorExt.Float16ToFloat32(binary.LittleEndian.Uint16(s[2*x:])))
+				case pixelFloat:
+					v = binary.LittleEndian.Uint32(s[4*x:])
+				default:
+					v = math.Float32bits(float32(binary.LittleEndian.Uint32(s[4*x:])))
+				}
+				if half {
+					binary.BigEndian.PutUint16(p[2*(x*n+j):], colorExt.Float32ToFloat16(math.Float32frombits(v)))
+				} else {
+					binary.BigEndian.PutUint32(p[4*(x*n+j):], v)
+				}
+			}
+		}
+	}
+}
+
+// readChunk decodes the chunk at offset off of data.
+func (d *decoder) readChunk(data []byte, off uint64) error {
+	h, dw := d.h, d.h.dataWindow
+	if off >= uint64(len(data)) {
+		return FormatError("bad chunk offset")
+	}
+	b := data[off:]
+	var x0, y0, nx, ny int
+	if h.tiled {
+		if len(b) < 20 {
+			return io.ErrUnexpectedEOF
+		}
+		tx := int(int32(binary.LittleEndian.Uint32(b[0:])))
+		ty := int(int32(binary.LittleEndian.Uint32(b[4:])))
+		lx := int32(binary.LittleEndian.Uint32(b[8:]))
+		ly := int32(binary.LittleEndian.Uint32(b[12:]))
+		if lx != 0 || ly != 0 {
+			// Only the full resolution level is decoded.
+			return nil
+		}
+		if tx < 0 || ty < 0 || tx >= (dw.Dx()+h.tileWidth-1)/h.tileWidth || ty >= (dw.Dy()+h.tileHeight-1)/h.tileHeight {
+			return FormatError("bad tile coordinates")
+		}
+		x0, y0 = dw.Min.X+tx*h.tileWidth, dw.Min.Y+ty*h.tileHeight
+		nx, ny = h.tileWidth, h.tileHeight
+		b = b[16:]
+	} else {
+		if len(b) < 8 {
+			return io.ErrUnexpectedEOF
+		}
+		x0, y0 = dw.Min.X, int(int32(binary.LittleEndian.Uint32(b)))
+		nx, ny = dw.Dx(), h.compression.linesPerBlock()
+		if y0 < dw.Min.Y || y0 >= dw.Max.Y || (y0-dw.Min.Y)%ny != 0 {
+			return FormatError("bad scanline coordinate")
+		}
+		b = b[4:]
+	}
+	if nx > dw.Max.X-x0 {
+		nx = dw.Max.X - x0
+	}
+	if ny > dw.Max.Y-y0 {
+		ny = dw.Max.Y - y0
+	}
+	size := uint64(binary.LittleEndian.Uint32(b))
+	if size > uint64(len(b)-4) {
+		return io.ErrUnexpectedEOF
+	}
+	raw, err := decompress(h.compression, b[4:4+size], h.channels, nx, ny, nx*ny*h.pixelSize())
+	if err != nil {
+		return err
+	}
+	d.storeBlock(raw, x0, y0, nx, ny)
+	return nil
+}
+
+func decode(r io.Reader, names []string, depth reflect.Kind) (image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h, rest, err := readHeader(data)
+	if err != nil {
+		if err == errNotEnoughHeader {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	d := &decoder{h: h}
+	if names != nil {
+		d.sel, err = namedChannels(h.channels, names)
+	} else {
+		d.sel, err = defaultChannels(h.channels)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.m, err = imageExt.NewImage(h.dataWindow, len(d.sel), depth); err != nil {
+		return nil, err
+	}
+	n := h.numChunks()
+	if len(rest) < 8*n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	for i := 0; i < n; i++ {
+		if err := d.readChunk(data, binary.LittleEndian.Uint64(rest[8*i:])); err != nil {
+			return nil, err
+		}
+	}
+	return d.m, nil
+}
+
+// Decode reads an OpenEXR image from r and returns it as an image.Image.
+// The type of the image depends on the channels of the file.
+func Decode(r io.Reader) (image.Image, error) {
+	return decode(r, nil, reflect.Float32)
+}
+
+// DecodeHalf reads an OpenEXR image from r like Decode, and returns it as an
+// *imageExt.Gray16f, *imageExt.GrayA32f, *imageExt.RGB48f or
+// *imageExt.RGBA64f image. The HALF samples are kept as they are, and the
+// FLOAT and UINT samples are rounded to half precision.
+func DecodeHalf(r io.Reader) (image.Image, error) {
+	return decode(r, nil, imageExt.Float16)
+}
+
+// DecodeChannels reads an OpenEXR image from r, and returns its channels
+// with the given names, in that order, as an *imageExt.Gray32f,
+// *imageExt.GrayA64f, *imageExt.RGB96f or *imageExt.RGBA128f image.
+func DecodeChannels(r io.Reader, names ...string) (image.Image, error) {
+	if len(names) == 0 {
+		return nil, UnsupportedError("0 channels")
+	}
+	return decode(r, names, reflect.Float32)
+}
+
+// DecodeConfig returns the color model and dimensions of an OpenEXR image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		data = append(data, buf[:n]...)
+		h, _, herr := readHeader(data)
+		if herr == nil {
+			sel, err := defaultChannels(h.channels)
+			if err != nil {
+				return image.Config{}, err
+			}
+			m, _ := imageExt.NewImage(image.Rectangle{}, len(sel), reflect.Float32)
+			return image.Config{
+				ColorModel: m.ColorModel(),
+				Width:      h.dataWindow.Dx(),
+				Height:     h.dataWindow.Dy(),
+			}, nil
+		}
+		if herr != errNotEnoughHeader {
+			return image.Config{}, herr
+		}
+		if err == io.EOF {
+			return image.Config{}, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return image.Config{}, err
+		}
+	}
+}
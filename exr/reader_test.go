@@ -0,0 +1,181 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"math"
+	"os"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+const testdataDir = "../testdata/"
+
+// testFile returns an uncompressed tiled image with the given header and
+// chunks, which start with their tile coordinates and levels.
+func testFile(h *header, chunks [][]byte) []byte {
+	b := h.marshal()
+	off := uint64(len(b) + 8*len(chunks))
+	for _, c := range chunks {
+		b = append(b, make([]byte, 8)...)
+		binary.LittleEndian.PutUint64(b[len(b)-8:], off)
+		off += uint64(len(c))
+	}
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// testTile returns a tile of FLOAT samples that are all v.
+func testTile(tx, ty, lx, ly int32, n int, v float32) []byte {
+	var b []byte
+	for _, c := range []int32{tx, ty, lx, ly, int32(4 * n)} {
+		b = appendUint32(b, uint32(c))
+	}
+	for i := 0; i < n; i++ {
+		b = appendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
+
+func TestDecodeMipmap(t *testing.T) {
+	h := &header{
+		channels:      []channel{{name: "Y", pixelType: pixelFloat, xSampling: 1, ySampling: 1}},
+		dataWindow:    image.Rect(0, 0, 5, 3),
+		displayWindow: image.Rect(0, 0, 5, 3),
+		tiled:         true,
+		tileWidth:     4,
+		tileHeight:    4,
+		levelMode:     mipmapLevels,
+	}
+	// The levels are 5x3, 2x1 and 1x1.
+	if n := h.numChunks(); n != 4 {
+		t.Fatalf("got %d chunks, want 4", n)
+	}
+	data := testFile(h, [][]byte{
+		testTile(0, 0, 0, 0, 4*3, 1),
+		testTile(1, 0, 0, 0, 1*3, 2),
+		testTile(0, 0, 1, 1, 2*1, 3),
+		testTile(0, 0, 2, 2, 1*1, 4),
+	})
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			want := float32(1)
+			if x >= 4 {
+				want = 2
+			}
+			if c := m.(*imageExt.Gray32f).Gray32fAt(x, y); c.Y != want {
+				t.Fatalf("(%d, %d): got %v, want %v", x, y, c.Y, want)
+			}
+		}
+	}
+
+	h.levelMode = ripmapLevels
+	// The levels are 5, 2 and 1 wide and 3 and 1 high.
+	if n := h.numChunks(); n != (2+1+1)*2 {
+		t.Fatalf("got %d ripmap chunks, want 8", n)
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testImage(image.Rect(0, 0, 7, 9), 2, false), nil); err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeConfig(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Width != 7 || c.Height != 9 || c.ColorModel != colorExt.GrayA64fModel {
+		t.Fatalf("got config %+v", c)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testImage(image.Rect(0, 0, 40, 40), 3, false), &Options{Compression: PIZ}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for _, n := range []int{0, 6, 100, len(data) / 2, len(data) - 1} {
+		if _, err := Decode(bytes.NewReader(data[:n])); err == nil {
+			t.Fatalf("decoding %d of %d bytes: got no error", n, len(data))
+		}
+	}
+	if _, err := DecodeConfig(bytes.NewReader(data[:50])); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// Corrupt compressed data is an error.
+	buf.Reset()
+	if err := Encode(&buf, testImage(image.Rect(0, 0, 40, 40), 3, true), &Options{Compression: ZIP, PixelType: Half}); err != nil {
+		t.Fatal(err)
+	}
+	bad := buf.Bytes()
+	for i := len(bad) - 20; i < len(bad)-10; i++ {
+		bad[i] ^= 0x55
+	}
+	if _, err := Decode(bytes.NewReader(bad)); err == nil {
+		t.Fatal("decoding corrupt data: got no error")
+	}
+
+	h := &header{
+		channels:      []channel{{name: "Y", pixelType: pixelHalf, xSampling: 2, ySampling: 2}},
+		compression:   PIZ,
+		dataWindow:    image.Rect(0, 0, 4, 4),
+		displayWindow: image.Rect(0, 0, 4, 4),
+	}
+	if _, err := Decode(bytes.NewReader(h.marshal())); err == nil {
+		t.Fatal("subsampled channel: got no error")
+	}
+	h.channels[0].xSampling, h.channels[0].ySampling = 1, 1
+	h.compression = 5
+	if _, err := Decode(bytes.NewReader(h.marshal())); err == nil {
+		t.Fatal("PXR24 compression: got no error")
+	}
+}
+
+func TestDecodeOpenEXR(t *testing.T) {
+	// The file is written by OpenEXR with RLE compression and HALF samples.
+	// Its blocks are stored uncompressed, as RLE does not make them smaller.
+	f, err := os.Open(testdataDir + "python.exr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := m.(*imageExt.RGBA128f)
+	if !ok || p.Bounds() != image.Rect(0, 0, 16, 16) {
+		t.Fatalf("got %T with bounds %v", m, m.Bounds())
+	}
+	for _, tc := range []struct {
+		x, y int
+		c    colorExt.RGBA128f
+	}{
+		{6, 0, colorExt.RGBA128f{R: 0.282470703125, G: 0.513671875, B: 0.7060546875, A: 1}},
+		{12, 5, colorExt.RGBA128f{R: 1, G: 0.87060546875, B: 0.294189453125, A: 1}},
+		{9, 8, colorExt.RGBA128f{R: 1, G: 0.87451171875, B: 0.302001953125, A: 1}},
+		{15, 8, colorExt.RGBA128f{A: 0.2783203125}},
+		{15, 15, colorExt.RGBA128f{}},
+	} {
+		if c := p.RGBA128fAt(tc.x, tc.y); c != tc.c {
+			t.Errorf("(%d, %d): got %v, want %v", tc.x, tc.y, c, tc.c)
+		}
+	}
+}
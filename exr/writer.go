@@ -0,0 +1,254 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exr
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+var defaultNames = [][]string{
+	1: {"Y"},
+	2: {"Y", "A"},
+	3: {"R", "G", "B"},
+	4: {"R", "G", "B", "A"},
+}
+
+// byName sorts the indexes of channel names.
+type byName struct {
+	index []int
+	names []string
+}
+
+func (p byName) Len() int           { return len(p.index) }
+func (p byName) Less(i, j int) bool { return p.names[p.index[i]] < p.names[p.index[j]] }
+func (p byName) Swap(i, j int)      { p.index[i], p.index[j] = p.index[j], p.index[i] }
+
+type encoder struct {
+	m      image.Image
+	n      int   // The number of samples per pixel.
+	order  []int // The samples of the channels sorted by name.
+	half   bool
+	h      *header
+	row    []float32
+	pixels imageExt.Image // The float or half-float typed image, or nil.
+}
+
+// readRow reads the samples of nx pixels at (x0, y) into e.row. The float
+// and half-float typed images keep their samples, and the samples of the
+// other images are scaled from 0 to 1.
+func (e *encoder) readRow(x0, y, nx int) {
+	row := e.row[:nx*e.n]
+	if e.pixels != nil {
+		r := e.pixels.Rect()
+		if e.pixels.Depth() == imageExt.Float16 {
+			p := e.pixels.Pix()[(y-r.Min.Y)*e.pixels.Stride()+(x0-r.Min.X)*2*e.n:]
+			for i := range row {
+				row[i] = colorExt.Float16ToFloat32(binary.BigEndian.Uint16(p[2*i:]))
+			}
+			return
+		}
+		p := e.pixels.Pix()[(y-r.Min.Y)*e.pixels.Stride()+(x0-r.Min.X)*4*e.n:]
+		for i := range row {
+			row[i] = math.Float32frombits(binary.BigEndian.Uint32(p[4*i:]))
+		}
+		return
+	}
+	for x := 0; x < nx; x++ {
+		r, g, b, a := e.m.At(x0+x, y).RGBA()
+		s := row[x*e.n:]
+		switch e.n {
+		case 1:
+			s[0] = float32(r) / 0xffff
+		case 3:
+			s[0], s[1], s[2] = float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff
+		case 4:
+			s[0], s[1], s[2], s[3] = float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff, float32(a)/0xffff
+		}
+	}
+}
+
+// block returns the samples of the nx by ny block at (x0, y0) in the layout
+// of the file.
+func (e *encoder) block(x0, y0, nx, ny int) []byte {
+	size := 4
+	if e.half {
+		size = 2
+	}
+	raw := make([]byte, nx*ny*e.n*size)
+	i := 0
+	for y := y0; y < y0+ny; y++ {
+		e.readRow(x0, y, nx)
+		for _, k := range e.order {
+			for x := 0; x < nx; x++ {
+				v := e.row[x*e.n+k]
+				if e.half {
+					binary.LittleEndian.PutUint16(raw[i:], colorExt.Float32ToFloat16(v))
+				} else {
+					binary.LittleEndian.PutUint32(raw[i:], math.Float32bits(v))
+				}
+				i += size
+			}
+		}
+	}
+	return raw
+}
+
+// chunk returns the compressed nx by ny block at (x0, y0), after the
+// coordinates of its chunk.
+func (e *encoder) chunk(coords []int32, x0, y0, nx, ny int) ([]byte, error) {
+	raw := e.block(x0, y0, nx, ny)
+	data, err := compress(e.h.compression, raw, e.h.channels, nx, ny)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= len(raw) {
+		data = raw
+	}
+	var b []byte
+	for _, c := range coords {
+		b = appendUint32(b, uint32(c))
+	}
+	b = appendUint32(b, uint32(len(data)))
+	return append(b, data...), nil
+}
+
+// Encode writes the image m to w in OpenEXR format. The default parameters
+// are used if opt is nil.
+//
+// The samples of the float and half-float typed images with 1 to 4 channels
+// are written as they are, with HALF samples for the half-float images
+// unless opt.PixelType is Float. Other images are written with their Y, RGB
+// or RGBA channels, and their samples are scaled from 0 to 1.
+func Encode(w io.Writer, m image.Image, opt *Options) error {
+	if opt == nil {
+		opt = new(Options)
+	}
+	b := m.Bounds()
+	if b.Empty() {
+		return errors.New("exr: invalid image size: " + strconv.Itoa(b.Dx()) + "x" + strconv.Itoa(b.Dy()))
+	}
+	e := &encoder{m: m, half: opt.PixelType == Half}
+	switch m := m.(type) {
+	case *imageExt.Gray32f, *imageExt.GrayA64f, *imageExt.RGB96f, *imageExt.RGBA128f,
+		*imageExt.Gray16f, *imageExt.GrayA32f, *imageExt.RGB48f, *imageExt.RGBA64f:
+		e.pixels = m.(imageExt.Image)
+		e.n = e.pixels.Channels()
+		if opt.PixelType == Auto && e.pixels.Depth() == imageExt.Float16 {
+			e.half = true
+		}
+	default:
+		switch m.ColorModel() {
+		case color.GrayModel, color.Gray16Model, colorExt.GrayModel, colorExt.Gray16Model:
+			e.n = 1
+		default:
+			e.n = 4
+			if m, ok := m.(interface {
+				Opaque() bool
+			}); ok && m.Opaque() {
+				e.n = 3
+			}
+		}
+	}
+	names := defaultNames[e.n]
+	if opt.Channels != nil {
+		if len(opt.Channels) != e.n {
+			return errors.New("exr: the image has " + strconv.Itoa(e.n) + " channels, not " + strconv.Itoa(len(opt.Channels)))
+		}
+		names = opt.Channels
+	}
+	e.order = make([]int, e.n)
+	for i := range e.order {
+		e.order[i] = i
+	}
+	sort.Sort(byName{e.order, names})
+	e.h = &header{
+		compression:   opt.Compression,
+		dataWindow:    b,
+		displayWindow: b,
+		tiled:         opt.TileWidth > 0 && opt.TileHeight > 0,
+		tileWidth:     opt.TileWidth,
+		tileHeight:    opt.TileHeight,
+	}
+	if e.h.compression < None || e.h.compression > PIZ {
+		return errors.New("exr: unsupported compression: " + e.h.compression.String())
+	}
+	pixelType := int32(pixelFloat)
+	if e.half {
+		pixelType = pixelHalf
+	}
+	for i, k := range e.order {
+		name := names[k]
+		if name == "" || i > 0 && name == names[e.order[i-1]] {
+			return errors.New("exr: invalid channel name: " + strconv.Quote(name))
+		}
+		e.h.channels = append(e.h.channels, channel{name: name, pixelType: pixelType, xSampling: 1, ySampling: 1})
+	}
+
+	var chunks [][]byte
+	if e.h.tiled {
+		e.row = make([]float32, e.h.tileWidth*e.n)
+		for ty := 0; ty*e.h.tileHeight < b.Dy(); ty++ {
+			for tx := 0; tx*e.h.tileWidth < b.Dx(); tx++ {
+				x0, y0 := b.Min.X+tx*e.h.tileWidth, b.Min.Y+ty*e.h.tileHeight
+				nx, ny := e.h.tileWidth, e.h.tileHeight
+				if nx > b.Max.X-x0 {
+					nx = b.Max.X - x0
+				}
+				if ny > b.Max.Y-y0 {
+					ny = b.Max.Y - y0
+				}
+				c, err := e.chunk([]int32{int32(tx), int32(ty), 0, 0}, x0, y0, nx, ny)
+				if err != nil {
+					return err
+				}
+				chunks = append(chunks, c)
+			}
+		}
+	} else {
+		e.row = make([]float32, b.Dx()*e.n)
+		lines := e.h.compression.linesPerBlock()
+		for y0 := b.Min.Y; y0 < b.Max.Y; y0 += lines {
+			ny := lines
+			if ny > b.Max.Y-y0 {
+				ny = b.Max.Y - y0
+			}
+			c, err := e.chunk([]int32{int32(y0)}, b.Min.X, y0, b.Dx(), ny)
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, c)
+		}
+	}
+
+	hdr := e.h.marshal()
+	offsets := make([]byte, 8*len(chunks))
+	off := uint64(len(hdr) + len(offsets))
+	for i, c := range chunks {
+		binary.LittleEndian.PutUint64(offsets[8*i:], off)
+		off += uint64(len(c))
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	if _, err := w.Write(offsets); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if _, err := w.Write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// testImage returns a float typed image of a smooth gradient with noise,
+// whose samples are half-precision numbers if half is true.
+func testImage(r image.Rectangle, channels int, half bool) imageExt.Image {
+	m, err := imageExt.NewImage(r, channels, reflect.Float32)
+	if err != nil {
+		panic(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	pix := m.Pix()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			for c := 0; c < channels; c++ {
+				v := float32(x*(c+1)+y)/64 + float32(rnd.NormFloat64()/100)
+				if half {
+					v = colorExt.Float16ToFloat32(colorExt.Float32ToFloat16(v))
+				}
+				i := (y-r.Min.Y)*m.Stride() + ((x-r.Min.X)*channels+c)*4
+				binary.BigEndian.PutUint32(pix[i:], math.Float32bits(v))
+			}
+		}
+	}
+	return m
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := image.Rect(-3, 5, 70, 45)
+	for _, compression := range []Compression{None, RLE, ZIPS, ZIP, PIZ} {
+		for _, pixelType := range []PixelType{Float, Half} {
+			for _, tiled := range []bool{false, true} {
+				for channels := 1; channels <= 4; channels++ {
+					m0 := testImage(r, channels, pixelType == Half)
+					opt := &Options{Compression: compression, PixelType: pixelType}
+					if tiled {
+						opt.TileWidth, opt.TileHeight = 16, 12
+					}
+					var buf bytes.Buffer
+					if err := Encode(&buf, m0, opt); err != nil {
+						t.Fatalf("%v, %+v: %v", compression, opt, err)
+					}
+					m1, err := Decode(&buf)
+					if err != nil {
+						t.Fatalf("%v, %+v, %d channels: %v", compression, opt, channels, err)
+					}
+					if reflect.TypeOf(m1) != reflect.TypeOf(m0) || m1.Bounds() != r {
+						t.Fatalf("%v, %+v: got %T with bounds %v", compression, opt, m1, m1.Bounds())
+					}
+					if !bytes.Equal(m1.(imageExt.Image).Pix(), m0.Pix()) {
+						t.Fatalf("%v, %+v, %d channels: the pixels differ", compression, opt, channels)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	// A smooth image compresses.
+	m := testImage(image.Rect(0, 0, 128, 64), 3, true)
+	var size0 int
+	for _, compression := range []Compression{None, RLE, ZIP, PIZ} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, &Options{Compression: compression, PixelType: Half}); err != nil {
+			t.Fatal(err)
+		}
+		if compression == None {
+			size0 = buf.Len()
+		} else if buf.Len() >= size0 {
+			t.Fatalf("%v: got %d bytes, uncompressed %d bytes", compression, buf.Len(), size0)
+		}
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	m0 := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	m0.Set(2, 3, color.NRGBA{0xff, 0x80, 0x00, 0x80})
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The samples are premultiplied and scaled from 0 to 1.
+	c := m1.(*imageExt.RGBA128f).RGBA128fAt(2, 3)
+	r, g, b, a := m0.At(2, 3).RGBA()
+	if c.R != float32(r)/0xffff || c.G != float32(g)/0xffff || c.B != float32(b)/0xffff || c.A != float32(a)/0xffff {
+		t.Fatalf("got %v", c)
+	}
+
+	// Opaque gray images have one channel.
+	buf.Reset()
+	if err := Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if m1, err = Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m1.(*imageExt.Gray32f); !ok {
+		t.Fatalf("got %T", m1)
+	}
+}
+
+func TestEncodeHalf(t *testing.T) {
+	r := image.Rect(1, 2, 9, 7)
+	for channels := 1; channels <= 4; channels++ {
+		m0, err := imageExt.NewImage(r, channels, imageExt.Float16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The samples are not clamped to 1.
+		pix := m0.Pix()
+		for i := 0; i < len(pix); i += 2 {
+			binary.BigEndian.PutUint16(pix[i:], colorExt.Float32ToFloat16(float32(i%11)-3))
+		}
+		for _, pixelType := range []PixelType{Auto, Float, Half} {
+			var buf bytes.Buffer
+			if err := Encode(&buf, m0, &Options{Compression: PIZ, PixelType: pixelType}); err != nil {
+				t.Fatal(err)
+			}
+			h, _, err := readHeader(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := int32(pixelHalf)
+			if pixelType == Float {
+				want = pixelFloat
+			}
+			if h.channels[0].pixelType != want {
+				t.Fatalf("%d channels, pixel type %d: got channel type %d", channels, pixelType, h.channels[0].pixelType)
+			}
+
+			m1, err := DecodeHalf(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.TypeOf(m1) != reflect.TypeOf(m0) || !bytes.Equal(m1.(imageExt.Image).Pix(), pix) {
+				t.Fatalf("%d channels, pixel type %d: got %T with different pixels", channels, pixelType, m1)
+			}
+			m2, err := Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m2 := m2.(imageExt.Image); m2.Channels() != channels || m2.Depth() != reflect.Float32 {
+				t.Fatalf("%d channels, pixel type %d: got %T", channels, pixelType, m2)
+			}
+		}
+	}
+
+	// FLOAT samples are rounded by DecodeHalf.
+	m0 := imageExt.NewRGB96f(image.Rect(0, 0, 2, 1))
+	m0.SetRGB96f(1, 0, colorExt.RGB96f{R: 1.0001, G: 4, B: -0.5})
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := DecodeHalf(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m1.(*imageExt.RGB48f).RGB48fAt(1, 0); c != (colorExt.RGB48f{R: 1, G: 4, B: -0.5}) {
+		t.Fatalf("got %v", c)
+	}
+}
+
+func TestChannelNames(t *testing.T) {
+	m0 := testImage(image.Rect(0, 0, 8, 8), 3, false)
+	var buf bytes.Buffer
+	names := []string{"normal.X", "normal.Z", "normal.Y"}
+	if err := Encode(&buf, m0, &Options{Channels: names, Compression: PIZ}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Channels without color names are taken in the order of their names.
+	m1, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c0, c1 := m0.(*imageExt.RGB96f).RGB96fAt(5, 6), m1.(*imageExt.RGB96f).RGB96fAt(5, 6)
+	if c1.R != c0.R || c1.G != c0.B || c1.B != c0.G {
+		t.Fatalf("got %v, want %v in the order X, Y, Z", c1, c0)
+	}
+
+	m1, err = DecodeChannels(bytes.NewReader(data), names...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m1.(imageExt.Image).Pix(), m0.Pix()) {
+		t.Fatal("the pixels differ")
+	}
+	m1, err = DecodeChannels(bytes.NewReader(data), "normal.Y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m1.(*imageExt.Gray32f).Gray32fAt(5, 6); c.Y != c0.B {
+		t.Fatalf("got %v, want %v", c.Y, c0.B)
+	}
+	if _, err := DecodeChannels(bytes.NewReader(data), "R"); err == nil {
+		t.Fatal("decoding a missing channel: got no error")
+	}
+
+	for _, names := range [][]string{{"R", "G"}, {"R", "G", "R"}, {"R", "", "B"}} {
+		if err := Encode(new(bytes.Buffer), m0, &Options{Channels: names}); err == nil {
+			t.Fatalf("channels %q: got no error", names)
+		}
+	}
+}
+
+func TestImageExt(t *testing.T) {
+	m0 := testImage(image.Rect(0, 0, 20, 10), 4, false)
+	var buf bytes.Buffer
+	if err := imageExt.Encode("exr", &buf, m0, &Options{Compression: ZIP}); err != nil {
+		t.Fatal(err)
+	}
+	m1, format, err := imageExt.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "exr" || !bytes.Equal(m1.(imageExt.Image).Pix(), m0.Pix()) {
+		t.Fatalf("got format %q and different pixels", format)
+	}
+}
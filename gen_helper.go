@@ -59,6 +59,14 @@ var types = []TypeInfo{
 		DepthType:  `reflect.Uint16`,
 		PixelSize:  1 * 2,
 	},
+	TypeInfo{
+		FileName:   `gray16f.go`,
+		TypeName:   `Gray16f`,
+		PixCommnet: `[]struct{ Y float16 }`,
+		Channels:   1,
+		DepthType:  `Float16`,
+		PixelSize:  1 * 2,
+	},
 	TypeInfo{
 		FileName:   `gray32i.go`,
 		TypeName:   `Gray32i`,
@@ -111,6 +119,15 @@ var types = []TypeInfo{
 		PixelSize:  2 * 2,
 		HasAlpha:   true,
 	},
+	TypeInfo{
+		FileName:   `graya32f.go`,
+		TypeName:   `GrayA32f`,
+		PixCommnet: `[]struct{ Y, A float16 }`,
+		Channels:   2,
+		DepthType:  `Float16`,
+		PixelSize:  2 * 2,
+		HasAlpha:   true,
+	},
 	TypeInfo{
 		FileName:   `graya64i.go`,
 		TypeName:   `GrayA64i`,
@@ -165,6 +182,14 @@ var types = []TypeInfo{
 		DepthType:  `reflect.Uint16`,
 		PixelSize:  3 * 2,
 	},
+	TypeInfo{
+		FileName:   `rgb48f.go`,
+		TypeName:   `RGB48f`,
+		PixCommnet: `[]struct{ R, G, B float16 }`,
+		Channels:   3,
+		DepthType:  `Float16`,
+		PixelSize:  3 * 2,
+	},
 	TypeInfo{
 		FileName:   `rgb96i.go`,
 		TypeName:   `RGB96i`,
@@ -217,6 +242,15 @@ var types = []TypeInfo{
 		PixelSize:  4 * 2,
 		HasAlpha:   true,
 	},
+	TypeInfo{
+		FileName:   `rgba64f.go`,
+		TypeName:   `RGBA64f`,
+		PixCommnet: `[]struct{ R, G, B, A float16 }`,
+		Channels:   4,
+		DepthType:  `Float16`,
+		PixelSize:  4 * 2,
+		HasAlpha:   true,
+	},
 	TypeInfo{
 		FileName:   `rgba128i.go`,
 		TypeName:   `RGBA128i`,
@@ -373,7 +407,7 @@ func (p *{{.TypeName}}) Opaque() bool {
 	}
 	for y := p.M.Rect.Min.Y; y < p.M.Rect.Max.Y; y++ {
 		for x := p.M.Rect.Min.X; x < p.M.Rect.Max.X; x++ {
-			if _, _, _, a := p.At(x, y).RGBA(); a == 0xFFFF {
+			if _, _, _, a := p.At(x, y).RGBA(); a != 0xFFFF {
 				return false
 			}
 		}
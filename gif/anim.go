@@ -0,0 +1,211 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gif
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	"github.com/chai2010/image/quantize"
+)
+
+// Animation is an animation made of full frames, which GIF turns into an
+// animated GIF whose frames only hold the pixels that change.
+type Animation struct {
+	Image []image.Image // The successive full frames, which have the same size.
+	Delay []int         // The successive delay times, one per frame, in 100ths of a second.
+	// LoopCount controls the number of times the animation is shown, with
+	// the same meaning as that of gif.GIF.
+	// A LoopCount of 0 means to loop forever.
+	// A LoopCount of -1 means to show each frame only once.
+	// Otherwise, the animation is looped LoopCount+1 times.
+	LoopCount int
+	// GlobalPalette selects one palette for all the frames, which is stored
+	// once, instead of a palette per frame.
+	GlobalPalette bool
+	// Quantize selects the quantizer and the dithering of the frames.
+	// Default parameters are used if it is nil.
+	Quantize *quantize.Options
+}
+
+// Add appends a copy of m, shown for delay 100ths of a second, to the
+// frames. The caller may reuse m afterwards.
+func (a *Animation) Add(m image.Image, delay int) {
+	b := m.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, m, b.Min, draw.Src)
+	a.Image = append(a.Image, dst)
+	a.Delay = append(a.Delay, delay)
+}
+
+// toRGBA returns m as an *image.RGBA whose bounds start at the origin.
+func toRGBA(m image.Image) *image.RGBA {
+	if m, ok := m.(*image.RGBA); ok && m.Rect.Min == (image.Point{}) {
+		return m
+	}
+	b := m.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, m, b.Min, draw.Src)
+	return dst
+}
+
+// diffRect returns the smallest rectangle out of which m0 and m1 are the
+// same.
+func diffRect(m0, m1 *image.RGBA, f func(c0, c1 color.RGBA) bool) image.Rectangle {
+	var r image.Rectangle
+	b := m0.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if f(m0.RGBAAt(x, y), m1.RGBAAt(x, y)) {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+// animationFrame is a frame of an animated GIF before its quantization. The
+// pixels of delta that are fully transparent show the previous frames.
+type animationFrame struct {
+	delta    *image.RGBA
+	delay    int
+	disposal byte
+}
+
+// frames returns the frames of the animated GIF. The first frame covers the
+// whole image. Each next frame covers the pixels that differ from the
+// previous frame, and only holds those that do, while the others are
+// transparent and show the previous frame through. A frame that is the same
+// as the previous frame extends its delay instead, and a frame that is
+// followed by transparent pixels where it is not transparent is disposed to
+// the background, which clears it.
+func (a *Animation) frames() ([]animationFrame, error) {
+	if len(a.Image) == 0 {
+		return nil, errors.New("gif: animation has no frames")
+	}
+	if len(a.Delay) != len(a.Image) {
+		return nil, errors.New("gif: mismatched image and delay lengths")
+	}
+	var images []*image.RGBA
+	var delays []int
+	for i, m := range a.Image {
+		m := toRGBA(m)
+		if i > 0 && m.Rect != images[0].Rect {
+			return nil, errors.New("gif: frames have different sizes")
+		}
+		if i > 0 && bytes.Equal(m.Pix, images[len(images)-1].Pix) {
+			delays[len(delays)-1] += a.Delay[i]
+			continue
+		}
+		images = append(images, m)
+		delays = append(delays, a.Delay[i])
+	}
+	bounds := images[0].Rect
+	canvas := image.NewRGBA(bounds)
+	var frames []animationFrame
+	for i, m := range images {
+		r := bounds
+		if i > 0 {
+			r = diffRect(m, canvas, func(c0, c1 color.RGBA) bool { return c0 != c1 })
+		}
+		disposal := byte(gif.DisposalNone)
+		if i+1 < len(images) {
+			clear := diffRect(images[i+1], m, func(c0, c1 color.RGBA) bool { return c0.A == 0 && c1.A != 0 })
+			if !clear.Empty() {
+				disposal = gif.DisposalBackground
+				r = r.Union(clear)
+			}
+		}
+		if r.Empty() {
+			// The frame is the previous frame once cleared, which still
+			// takes a frame to show.
+			r = image.Rect(0, 0, 1, 1)
+		}
+
+		delta := image.NewRGBA(r)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if c := m.RGBAAt(x, y); c != canvas.RGBAAt(x, y) {
+					delta.SetRGBA(x, y, c)
+				}
+			}
+		}
+		draw.Draw(canvas, r, m, r.Min, draw.Src)
+		if disposal == gif.DisposalBackground {
+			draw.Draw(canvas, r, image.Transparent, image.ZP, draw.Src)
+		}
+		frames = append(frames, animationFrame{delta, delays[i], disposal})
+	}
+	return frames, nil
+}
+
+// GIF returns the animation as an animated GIF.
+func (a *Animation) GIF() (*gif.GIF, error) {
+	frames, err := a.frames()
+	if err != nil {
+		return nil, err
+	}
+	q := a.Quantize
+	if q == nil {
+		q = new(quantize.Options)
+	}
+	n := q.NumColors
+	if n < 1 || n > 256 {
+		n = 256
+	}
+	bounds := a.Image[0].Bounds()
+	g := &gif.GIF{
+		LoopCount: a.LoopCount,
+		Config: image.Config{
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+		},
+	}
+
+	var global color.Palette
+	if a.GlobalPalette {
+		// Quantize the frames stacked on top of each other.
+		h := 0
+		for _, f := range frames {
+			h += f.delta.Rect.Dy()
+		}
+		stack := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), h))
+		y := 0
+		for _, f := range frames {
+			r := f.delta.Rect
+			draw.Draw(stack, image.Rect(0, y, r.Dx(), y+r.Dy()), f.delta, r.Min, draw.Src)
+			y += r.Dy()
+		}
+		global = q.Method.Quantize(make(color.Palette, 0, n), stack)
+		g.Config.ColorModel = global
+	}
+	for _, f := range frames {
+		r := f.delta.Rect
+		p := global
+		if p == nil {
+			p = q.Method.Quantize(make(color.Palette, 0, n), f.delta)
+		}
+		pm := image.NewPaletted(r, p)
+		q.Dither.Draw(pm, r, f.delta, r.Min)
+		g.Image = append(g.Image, pm)
+		g.Delay = append(g.Delay, f.delay)
+		g.Disposal = append(g.Disposal, f.disposal)
+	}
+	return g, nil
+}
+
+// EncodeAnimation writes the animation a to w in GIF format.
+func EncodeAnimation(w io.Writer, a *Animation) error {
+	g, err := a.GIF()
+	if err != nil {
+		return err
+	}
+	return gif.EncodeAll(w, g)
+}
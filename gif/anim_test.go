@@ -0,0 +1,170 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gif
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"testing"
+
+	"github.com/chai2010/image/quantize"
+)
+
+// testFrames returns frames of a square moving over a background, which is
+// transparent left of x0. They have fewer than 256 colors, so that they are
+// not changed by the quantization.
+func testFrames(n, x0 int) []image.Image {
+	var frames []image.Image
+	for i := 0; i < n; i++ {
+		m := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+		for y := 0; y < 48; y++ {
+			for x := x0; x < 64; x++ {
+				m.SetNRGBA(x, y, color.NRGBA{uint8(16 * (x / 4)), uint8(16 * (y / 4)), 0x80, 0xff})
+			}
+		}
+		draw.Draw(m, image.Rect(4*i, 10, 4*i+8, 18), image.NewUniform(color.NRGBA{0xff, 0xff, 0xff, 0xff}), image.ZP, draw.Src)
+		frames = append(frames, m)
+	}
+	return frames
+}
+
+// render returns the frames that a viewer shows for g.
+func render(g *gif.GIF) []*image.RGBA {
+	var frames []*image.RGBA
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	for i, m := range g.Image {
+		draw.Draw(canvas, m.Rect, m, m.Rect.Min, draw.Over)
+		frame := image.NewRGBA(canvas.Rect)
+		copy(frame.Pix, canvas.Pix)
+		for j := 0; j < g.Delay[i]; j++ {
+			frames = append(frames, frame)
+		}
+		if g.Disposal[i] == gif.DisposalBackground {
+			draw.Draw(canvas, m.Rect, image.Transparent, image.ZP, draw.Src)
+		}
+	}
+	return frames
+}
+
+// compare compares the frames of a, which have a delay of 1, to the frames
+// shown for its encoded GIF.
+func compare(a *Animation, g *gif.GIF) error {
+	shown := render(g)
+	if len(shown) != len(a.Image) {
+		return fmt.Errorf("got %d frames, want %d", len(shown), len(a.Image))
+	}
+	for i, m := range a.Image {
+		b := m.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r0, g0, b0, a0 := m.At(x, y).RGBA()
+				r1, g1, b1, a1 := shown[i].At(x, y).RGBA()
+				if a0 != a1 || a0 != 0 && (r0 != r1 || g0 != g1 || b0 != b1) {
+					return fmt.Errorf("frame %d: (%d, %d): got %v, want %v", i, x, y, shown[i].At(x, y), m.At(x, y))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestAnimation(t *testing.T) {
+	frames := testFrames(6, 0)
+	// A repeated frame extends the delay of the previous frame.
+	frames = append(frames[:3], frames[2:]...)
+	for _, global := range []bool{false, true} {
+		a := &Animation{LoopCount: 3, GlobalPalette: global}
+		for _, m := range frames {
+			a.Add(m, 1)
+		}
+		var buf bytes.Buffer
+		if err := EncodeAnimation(&buf, a); err != nil {
+			t.Fatal(err)
+		}
+		g, err := DecodeAll(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(g.Image) != 6 || g.Delay[2] != 2 || g.LoopCount != 3 {
+			t.Fatalf("global palette %v: got %d frames, delays %v, loop count %d", global, len(g.Image), g.Delay, g.LoopCount)
+		}
+		if p, _ := g.Config.ColorModel.(color.Palette); global != (len(p) > 0) {
+			t.Fatalf("global palette %v: got color model %v", global, g.Config.ColorModel)
+		}
+		if err := compare(a, g); err != nil {
+			t.Fatalf("global palette %v: %v", global, err)
+		}
+		// The next frames only cover the old and new positions of the
+		// square.
+		for i, m := range g.Image[1:] {
+			if want := image.Rect(4*i, 10, 4*i+12, 18); m.Rect != want {
+				t.Fatalf("global palette %v: frame %d: got bounds %v, want %v", global, i+1, m.Rect, want)
+			}
+		}
+	}
+}
+
+func TestAnimationDisposal(t *testing.T) {
+	// The square moves over the transparent background, which the next
+	// frames must clear.
+	a := new(Animation)
+	for i, m := range testFrames(4, 16) {
+		a.Image = append(a.Image, m)
+		a.Delay = append(a.Delay, 1)
+		if i < 3 && i > 0 {
+			a.Image = append(a.Image, m)
+			a.Delay = append(a.Delay, 1)
+		}
+	}
+	g, err := a.GIF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Disposal[0] != gif.DisposalBackground {
+		t.Fatalf("got disposal methods %v", g.Disposal)
+	}
+	if err := compare(a, g); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnimationQuantize(t *testing.T) {
+	a := &Animation{Quantize: &quantize.Options{Method: quantize.Octree, Dither: quantize.FloydSteinberg, NumColors: 16}}
+	for _, m := range testFrames(3, 16) {
+		a.Add(m, 1)
+	}
+	g, err := a.GIF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range g.Image {
+		if len(m.Palette) > 16 {
+			t.Fatalf("frame %d: got %d colors", i, len(m.Palette))
+		}
+	}
+}
+
+func TestAnimationErrors(t *testing.T) {
+	for _, a := range []*Animation{
+		{},
+		{Image: []image.Image{image.NewGray(image.Rect(0, 0, 4, 4))}},
+		{
+			Image: []image.Image{image.NewGray(image.Rect(0, 0, 4, 4)), image.NewGray(image.Rect(0, 0, 4, 5))},
+			Delay: []int{1, 1},
+		},
+	} {
+		if _, err := a.GIF(); err == nil {
+			t.Fatalf("%+v: got no error", a)
+		}
+	}
+}
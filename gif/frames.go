@@ -0,0 +1,415 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gif
+
+import (
+	"bufio"
+	"compress/lzw"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// Blocks of a GIF file.
+const (
+	sExtension       = 0x21
+	sImageDescriptor = 0x2C
+	sTrailer         = 0x3B
+
+	eGraphicControl = 0xF9
+	eApplication    = 0xFF
+)
+
+// Masks of the flags of the blocks.
+const (
+	fColorTable         = 1 << 7
+	fInterlace          = 1 << 6
+	fColorTableBitsMask = 7
+
+	gcTransparentColorSet = 1 << 0
+	gcDisposalMethodMask  = 7 << 2
+)
+
+var (
+	errNotGIF       = errors.New("gif: not a GIF file")
+	errBadPixel     = errors.New("gif: invalid pixel value")
+	errTooMuchData  = errors.New("gif: too much image data")
+	errNoColorTable = errors.New("gif: no color table")
+)
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// blockReader reads the data sub-blocks that follow an image descriptor as
+// one stream.
+type blockReader struct {
+	r    *bufio.Reader
+	n    int // The number of bytes left in the current sub-block.
+	done bool
+}
+
+func (b *blockReader) fill() error {
+	for b.n == 0 {
+		if b.done {
+			return io.EOF
+		}
+		n, err := b.r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if n == 0 {
+			b.done = true
+			return io.EOF
+		}
+		b.n = int(n)
+	}
+	return nil
+}
+
+func (b *blockReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := b.fill(); err != nil {
+		return 0, err
+	}
+	if len(p) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.r.Read(p)
+	b.n -= n
+	return n, unexpectedEOF(err)
+}
+
+func (b *blockReader) ReadByte() (byte, error) {
+	if err := b.fill(); err != nil {
+		return 0, err
+	}
+	c, err := b.r.ReadByte()
+	if err == nil {
+		b.n--
+	}
+	return c, unexpectedEOF(err)
+}
+
+// close skips the sub-blocks that are left.
+func (b *blockReader) close() error {
+	for {
+		if _, err := b.r.Discard(b.n); err != nil {
+			return unexpectedEOF(err)
+		}
+		b.n = 0
+		if err := b.fill(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// FrameReader reads the frames of an animated GIF image one at a time. Each
+// frame is drawn over the previous frames, after their disposal, into a full
+// image of the canvas, as viewers show them. Only the canvas and the current
+// frame are held in memory, so that long animations take bounded memory.
+//
+// The canvas starts fully transparent, and DisposalBackground clears a frame
+// to transparent pixels, as web browsers do.
+type FrameReader struct {
+	r         *bufio.Reader
+	config    image.Config
+	global    color.Palette
+	loopCount int
+
+	canvas   *image.RGBA
+	typed    *imageExt.RGBA
+	previous *image.RGBA // The pixels that DisposalPrevious restores.
+	rect     image.Rectangle
+	disposal byte
+
+	index     int
+	delay     int
+	timestamp time.Duration
+	tmp       [1024]byte // Big enough for a color table of 256 colors.
+	err       error
+}
+
+// NewFrameReader returns a FrameReader that reads the frames of the GIF
+// image in r. It reads the header of the image.
+func NewFrameReader(r io.Reader) (*FrameReader, error) {
+	d := &FrameReader{
+		r:         bufio.NewReader(r),
+		config:    image.Config{ColorModel: color.RGBAModel},
+		loopCount: -1,
+		index:     -1,
+	}
+	if _, err := io.ReadFull(d.r, d.tmp[:13]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if s := string(d.tmp[:6]); s != "GIF87a" && s != "GIF89a" {
+		return nil, errNotGIF
+	}
+	d.config.Width = int(d.tmp[6]) | int(d.tmp[7])<<8
+	d.config.Height = int(d.tmp[8]) | int(d.tmp[9])<<8
+	if flags := d.tmp[10]; flags&fColorTable != 0 {
+		p, err := d.readColorTable(flags)
+		if err != nil {
+			return nil, err
+		}
+		d.global = p
+	}
+	d.canvas = image.NewRGBA(image.Rect(0, 0, d.config.Width, d.config.Height))
+	d.typed = new(imageExt.RGBA).Init(d.canvas.Pix, d.canvas.Stride, d.canvas.Rect)
+	return d, nil
+}
+
+func (d *FrameReader) readColorTable(flags byte) (color.Palette, error) {
+	n := 1 << (1 + uint(flags&fColorTableBitsMask))
+	if _, err := io.ReadFull(d.r, d.tmp[:3*n]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	p := make(color.Palette, n)
+	for i := range p {
+		p[i] = color.RGBA{d.tmp[3*i+0], d.tmp[3*i+1], d.tmp[3*i+2], 0xFF}
+	}
+	return p, nil
+}
+
+// Config returns the color model of the frames, which is color.RGBAModel, and
+// the size of the canvas.
+func (d *FrameReader) Config() image.Config { return d.config }
+
+// LoopCount returns the loop count, with the same meaning as that of
+// gif.GIF. It is known once the first frame is read.
+func (d *FrameReader) LoopCount() int { return d.loopCount }
+
+// Next reads the next frame, and reports whether there is one. It returns
+// false at the end of the image or on an error, which Err returns.
+func (d *FrameReader) Next() bool {
+	if d.err != nil {
+		return false
+	}
+	if d.err = d.next(); d.err != nil {
+		return false
+	}
+	return true
+}
+
+// Err returns the error that stopped Next, or nil at the end of the image.
+func (d *FrameReader) Err() error {
+	if d.err == io.EOF {
+		return nil
+	}
+	return d.err
+}
+
+// Image returns the current frame. It is overwritten by the next call to
+// Next, so it must be copied to be kept.
+func (d *FrameReader) Image() *image.RGBA { return d.canvas }
+
+// RGBA returns the current frame as an *imageExt.RGBA, which shares the pixels
+// of Image.
+func (d *FrameReader) RGBA() *imageExt.RGBA { return d.typed }
+
+// Index returns the index of the current frame, from 0.
+func (d *FrameReader) Index() int { return d.index }
+
+// Delay returns the delay time of the current frame, in 100ths of a second.
+func (d *FrameReader) Delay() int { return d.delay }
+
+// Timestamp returns the time at which the current frame is shown, which is
+// the sum of the delays of the previous frames.
+func (d *FrameReader) Timestamp() time.Duration { return d.timestamp }
+
+func (d *FrameReader) next() error {
+	// Dispose of the current frame.
+	if d.index >= 0 {
+		d.timestamp += time.Duration(d.delay) * 10 * time.Millisecond
+		switch d.disposal {
+		case gif.DisposalBackground:
+			draw.Draw(d.canvas, d.rect, image.Transparent, image.ZP, draw.Src)
+		case gif.DisposalPrevious:
+			draw.Draw(d.canvas, d.rect, d.previous, d.rect.Min, draw.Src)
+		}
+	}
+
+	var disposal byte
+	delay, transparent := 0, -1
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		switch c {
+		case sExtension:
+			label, err := d.r.ReadByte()
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			switch label {
+			case eGraphicControl:
+				if _, err := io.ReadFull(d.r, d.tmp[:6]); err != nil {
+					return unexpectedEOF(err)
+				}
+				if d.tmp[0] != 4 || d.tmp[5] != 0 {
+					return errors.New("gif: invalid graphic control extension")
+				}
+				flags := d.tmp[1]
+				disposal = (flags & gcDisposalMethodMask) >> 2
+				delay = int(d.tmp[2]) | int(d.tmp[3])<<8
+				if flags&gcTransparentColorSet != 0 {
+					transparent = int(d.tmp[4])
+				}
+				continue
+			case eApplication:
+				n, err := d.r.ReadByte()
+				if err != nil {
+					return unexpectedEOF(err)
+				}
+				if _, err := io.ReadFull(d.r, d.tmp[:n]); err != nil {
+					return unexpectedEOF(err)
+				}
+				if n == 11 && string(d.tmp[:11]) == "NETSCAPE2.0" {
+					if _, err := io.ReadFull(d.r, d.tmp[:1]); err != nil {
+						return unexpectedEOF(err)
+					}
+					if n := d.tmp[0]; n > 0 {
+						if _, err := io.ReadFull(d.r, d.tmp[:n]); err != nil {
+							return unexpectedEOF(err)
+						}
+						if n == 3 && d.tmp[0] == 1 {
+							d.loopCount = int(d.tmp[1]) | int(d.tmp[2])<<8
+						}
+					}
+				}
+			}
+			// Skip the sub-blocks that are left.
+			if err := (&blockReader{r: d.r}).close(); err != nil {
+				return err
+			}
+
+		case sImageDescriptor:
+			if err := d.readFrame(transparent, disposal); err != nil {
+				return err
+			}
+			d.index++
+			d.delay = delay
+			d.disposal = disposal
+			return nil
+
+		case sTrailer:
+			return io.EOF
+
+		default:
+			return errors.New("gif: unknown block type")
+		}
+	}
+}
+
+// readFrame reads an image descriptor and its data, and draws the image over
+// the canvas.
+func (d *FrameReader) readFrame(transparent int, disposal byte) error {
+	if _, err := io.ReadFull(d.r, d.tmp[:9]); err != nil {
+		return unexpectedEOF(err)
+	}
+	left := int(d.tmp[0]) | int(d.tmp[1])<<8
+	top := int(d.tmp[2]) | int(d.tmp[3])<<8
+	width := int(d.tmp[4]) | int(d.tmp[5])<<8
+	height := int(d.tmp[6]) | int(d.tmp[7])<<8
+	flags := d.tmp[8]
+	p := d.global
+	if flags&fColorTable != 0 {
+		var err error
+		if p, err = d.readColorTable(flags); err != nil {
+			return err
+		}
+	}
+	if p == nil {
+		return errNoColorTable
+	}
+
+	litWidth, err := d.r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if litWidth < 2 || litWidth > 8 {
+		return errors.New("gif: pixel size out of range")
+	}
+	br := &blockReader{r: d.r}
+	lr := lzw.NewReader(br, lzw.LSB, int(litWidth))
+	defer lr.Close()
+
+	// Save the pixels under the frame, before drawing it, if its disposal
+	// restores them.
+	r := image.Rect(left, top, left+width, top+height)
+	d.rect = r.Intersect(d.canvas.Rect)
+	if disposal == gif.DisposalPrevious {
+		if d.previous == nil {
+			d.previous = image.NewRGBA(d.canvas.Rect)
+		}
+		draw.Draw(d.previous, d.rect, d.canvas, d.rect.Min, draw.Src)
+	}
+
+	colors := make([]color.RGBA, len(p))
+	for i, c := range p {
+		colors[i] = color.RGBAModel.Convert(c).(color.RGBA)
+	}
+	row := make([]byte, width)
+	for i := 0; i < height; i++ {
+		y := i
+		if flags&fInterlace != 0 {
+			y = interlacedRow(i, height)
+		}
+		if _, err := io.ReadFull(lr, row); err != nil {
+			return unexpectedEOF(err)
+		}
+		y += top
+		if y < d.rect.Min.Y || y >= d.rect.Max.Y {
+			continue
+		}
+		for j, c := range row {
+			x := left + j
+			if int(c) == transparent || x < d.rect.Min.X || x >= d.rect.Max.X {
+				continue
+			}
+			if int(c) >= len(colors) {
+				return errBadPixel
+			}
+			d.canvas.SetRGBA(x, y, colors[c])
+		}
+	}
+	// There must be no more than the pixels of the frame, but the code that
+	// ends them may be missing.
+	if n, err := lr.Read(d.tmp[:1]); n != 0 || (err != io.EOF && err != io.ErrUnexpectedEOF) {
+		if err != nil {
+			return err
+		}
+		return errTooMuchData
+	}
+	return br.close()
+}
+
+// interlacedRow returns the row of the i-th row of an interlaced image, whose
+// rows are stored every 8 rows from row 0, then every 8 rows from row 4,
+// every 4 rows from row 2 and every 2 rows from row 1.
+func interlacedRow(i, height int) int {
+	for _, pass := range [...]struct{ start, step int }{{0, 8}, {4, 8}, {2, 4}, {1, 2}} {
+		n := (height - pass.start + pass.step - 1) / pass.step
+		if i < n {
+			return pass.start + i*pass.step
+		}
+		i -= n
+	}
+	return i
+}
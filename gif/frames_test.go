@@ -0,0 +1,161 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+const testdataDir = "../testdata/"
+
+func TestFrameReader(t *testing.T) {
+	for _, filename := range []string{
+		"video-001.gif",
+		"video-001.interlaced.gif",
+		"video-001.5bpp.gif",
+	} {
+		data, err := ioutil.ReadFile(testdataDir + filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := NewFrameReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		if !d.Next() {
+			t.Fatalf("%s: no frame: %v", filename, d.Err())
+		}
+		m := d.Image()
+		b := want.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r0, g0, b0, a0 := want.At(x, y).RGBA()
+				r1, g1, b1, a1 := m.At(x, y).RGBA()
+				if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+					t.Fatalf("%s: (%d, %d): got %v, want %v", filename, x, y, m.At(x, y), want.At(x, y))
+				}
+			}
+		}
+		if c := d.RGBA().RGBAAt(3, 5); c.R != m.RGBAAt(3, 5).R || c.A != m.RGBAAt(3, 5).A {
+			t.Fatalf("%s: the typed image differs", filename)
+		}
+		if d.Next() || d.Err() != nil {
+			t.Fatalf("%s: got another frame or an error: %v", filename, d.Err())
+		}
+
+		// Truncated images are errors.
+		d, err = NewFrameReader(bytes.NewReader(data[:len(data)/2]))
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		if d.Next() || d.Err() == nil {
+			t.Fatalf("%s: decoding a truncated image succeeded", filename)
+		}
+	}
+}
+
+func TestFrameReaderAnimation(t *testing.T) {
+	a := &Animation{LoopCount: 2}
+	for i, m := range testFrames(5, 16) {
+		a.Add(m, i+1)
+	}
+	var buf bytes.Buffer
+	if err := EncodeAnimation(&buf, a); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewFrameReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := d.Config(); c.Width != 64 || c.Height != 48 {
+		t.Fatalf("got config %+v", c)
+	}
+	var timestamp time.Duration
+	for i := 0; d.Next(); i++ {
+		if d.Index() != i || d.Delay() != i+1 || d.Timestamp() != timestamp {
+			t.Fatalf("frame %d: got index %d, delay %d, timestamp %v", i, d.Index(), d.Delay(), d.Timestamp())
+		}
+		timestamp += time.Duration(i+1) * 10 * time.Millisecond
+		m, want := d.Image(), a.Image[i]
+		for y := 0; y < 48; y++ {
+			for x := 0; x < 64; x++ {
+				_, _, _, a0 := want.At(x, y).RGBA()
+				if c := m.RGBAAt(x, y); a0 == 0 && c.A != 0 || a0 != 0 && c != want.At(x, y) {
+					t.Fatalf("frame %d: (%d, %d): got %v, want %v", i, x, y, c, want.At(x, y))
+				}
+			}
+		}
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Index() != 4 || d.LoopCount() != 2 {
+		t.Fatalf("got %d frames, loop count %d", d.Index()+1, d.LoopCount())
+	}
+}
+
+func TestFrameReaderDisposalPrevious(t *testing.T) {
+	p := color.Palette{
+		color.RGBA{0xff, 0x00, 0x00, 0xff},
+		color.RGBA{0x00, 0xff, 0x00, 0xff},
+		color.RGBA{0x00, 0x00, 0xff, 0xff},
+		color.RGBA{},
+	}
+	fill := func(r image.Rectangle, i uint8) *image.Paletted {
+		m := image.NewPaletted(r, p)
+		for j := range m.Pix {
+			m.Pix[j] = i
+		}
+		return m
+	}
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			fill(image.Rect(0, 0, 8, 8), 0),
+			fill(image.Rect(2, 2, 6, 6), 1),
+			fill(image.Rect(4, 4, 8, 8), 2),
+		},
+		Delay:    []int{0, 0, 0},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalBackground},
+	}
+	// The transparent index keeps the pixels under the third frame.
+	g.Image[2].Pix[0] = 3
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewFrameReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if !d.Next() {
+			t.Fatalf("frame %d: %v", i, d.Err())
+		}
+	}
+	m := d.Image()
+	for _, tc := range []struct {
+		x, y int
+		want color.Color
+	}{
+		{0, 0, p[0]},
+		{3, 3, p[0]}, // The second frame is restored.
+		{4, 4, p[0]}, // The transparent pixel of the third frame.
+		{5, 5, p[2]},
+	} {
+		if c := m.At(tc.x, tc.y); c != tc.want {
+			t.Fatalf("(%d, %d): got %v, want %v", tc.x, tc.y, c, tc.want)
+		}
+	}
+}
@@ -13,11 +13,16 @@ import (
 	"io"
 
 	imageExt "github.com/chai2010/image"
+	"github.com/chai2010/image/quantize"
 )
 
 // Options are the encoding and decoding parameters.
 type Options struct {
 	gif.Options
+	// Quantize selects the quantizer and the dithering of images that are
+	// not paletted, unless Quantizer or Drawer are set. If Quantize is nil,
+	// they are mapped to the Plan 9 palette with Floyd-Steinberg dithering.
+	Quantize *quantize.Options
 }
 
 func (opt *Options) Lossless() bool {
@@ -54,11 +59,22 @@ func EncodeAll(w io.Writer, g *gif.GIF) error {
 
 // Encode writes the Image m to w in GIF format.
 func Encode(w io.Writer, m image.Image, opt *Options) error {
-	if opt != nil {
-		return gif.Encode(w, m, &opt.Options)
-	} else {
+	if opt == nil {
 		return gif.Encode(w, m, nil)
 	}
+	o := opt.Options
+	if q := opt.Quantize; q != nil {
+		if o.NumColors == 0 {
+			o.NumColors = q.NumColors
+		}
+		if o.Quantizer == nil {
+			o.Quantizer = q.Method
+		}
+		if o.Drawer == nil {
+			o.Drawer = q.Dither
+		}
+	}
+	return gif.Encode(w, m, &o)
 }
 
 func toOptions(opt imageExt.Options) *Options {
@@ -115,7 +115,7 @@ func (p *GrayA32) Opaque() bool {
 	}
 	for y := p.M.Rect.Min.Y; y < p.M.Rect.Max.Y; y++ {
 		for x := p.M.Rect.Min.X; x < p.M.Rect.Max.X; x++ {
-			if _, _, _, a := p.At(x, y).RGBA(); a == 0xFFFF {
+			if _, _, _, a := p.At(x, y).RGBA(); a != 0xFFFF {
 				return false
 			}
 		}
@@ -0,0 +1,82 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hdr implements a Radiance HDR (RGBE) image decoder and encoder.
+//
+// The images are decoded to *image.RGB96f images, with the samples of the
+// file: they are not divided by the exposure, and the samples of XYZE
+// images are X, Y and Z. Both the flat and the run-length encoded scanlines
+// are decoded, in any orientation.
+//
+// The format is documented in the Radiance file formats at
+// https://radsite.lbl.gov/radiance/refer/filefmts.pdf.
+package hdr
+
+import (
+	"image"
+	"io"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// Pixel formats of the FORMAT header line.
+const (
+	FormatRGBE = "32-bit_rle_rgbe"
+	FormatXYZE = "32-bit_rle_xyze"
+)
+
+// Header is the header of a Radiance image.
+type Header struct {
+	// Format is the pixel format, FormatRGBE or FormatXYZE.
+	Format string
+	// Exposure is the product of the EXPOSURE lines, by which the samples
+	// have been multiplied. It is 1 if there are none.
+	Exposure float64
+	// Orientation is the orientation of the scanlines, as in the resolution
+	// string: "-Y +X" for rows from top to bottom and from left to right,
+	// "+Y +X" for rows from bottom to top, and "+X -Y" for columns from
+	// left to right and from top to bottom, for instance.
+	Orientation string
+	// Width and Height are the dimensions of the image.
+	Width, Height int
+}
+
+// Options are the encoding parameters.
+type Options struct {
+	// Exposure is written to the EXPOSURE header line if it is neither 0
+	// nor 1. The samples are written as they are.
+	Exposure float64
+	// Flat writes the scanlines without run-length encoding.
+	Flat bool
+}
+
+func (opt *Options) Lossless() bool {
+	return false
+}
+
+func (opt *Options) Quality() float32 {
+	return 0
+}
+
+func toOptions(opt imageExt.Options) *Options {
+	if opt, ok := opt.(*Options); ok {
+		return opt
+	}
+	return nil
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt imageExt.Options) error {
+	return Encode(w, m, toOptions(opt))
+}
+
+func init() {
+	imageExt.RegisterFormat(imageExt.Format{
+		Name:         "hdr",
+		Extensions:   []string{".hdr", ".pic", ".rgbe"},
+		Magics:       []string{"#?RADIANCE", "#?RGBE"},
+		DecodeConfig: DecodeConfig,
+		Decode:       Decode,
+		Encode:       imageExtEncode,
+	})
+}
@@ -0,0 +1,292 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hdr
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// A FormatError reports that the input is not a valid Radiance image.
+type FormatError string
+
+func (e FormatError) Error() string { return "hdr: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// Radiance feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "hdr: unsupported feature: " + string(e) }
+
+// maxPixels limits the size of the decoded images.
+const maxPixels = 1 << 28
+
+// The run-length encoded scanlines have this range of lengths.
+const (
+	minRLELength = 8
+	maxRLELength = 0x7fff
+)
+
+// rgbeToFloat converts an RGBE pixel as Radiance does, to the middle of the
+// range of the samples that it represents.
+func rgbeToFloat(c [4]byte) (r, g, b float32) {
+	if c[3] == 0 {
+		return 0, 0, 0
+	}
+	f := math.Ldexp(1, int(c[3])-(128+8))
+	return float32((float64(c[0]) + 0.5) * f), float32((float64(c[1]) + 0.5) * f), float32((float64(c[2]) + 0.5) * f)
+}
+
+type decoder struct {
+	r *bufio.Reader
+	h Header
+	// The resolution string, which has the major axis first.
+	axes [2]string
+	lens [2]int
+	prev [4]byte // The last pixel, which old run-length encoded pixels repeat.
+}
+
+func (d *decoder) readLine() (string, error) {
+	line, err := d.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", FormatError("header line is too long")
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (d *decoder) readHeader() error {
+	line, err := d.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "#?") {
+		return FormatError("bad magic number")
+	}
+	d.h.Exposure = 1
+	for {
+		if line, err = d.readLine(); err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "FORMAT="):
+			d.h.Format = strings.TrimSpace(line[len("FORMAT="):])
+		case strings.HasPrefix(line, "EXPOSURE="):
+			e, err := strconv.ParseFloat(strings.TrimSpace(line[len("EXPOSURE="):]), 64)
+			if err != nil || e <= 0 {
+				return FormatError("bad exposure " + strconv.Quote(line))
+			}
+			d.h.Exposure *= e
+		}
+	}
+	switch d.h.Format {
+	case "":
+		d.h.Format = FormatRGBE
+	case FormatRGBE, FormatXYZE:
+	default:
+		return UnsupportedError("format " + strconv.Quote(d.h.Format))
+	}
+
+	if line, err = d.readLine(); err != nil {
+		return err
+	}
+	f := strings.Fields(line)
+	if len(f) != 4 || len(f[0]) != 2 || len(f[2]) != 2 || f[0][1] == f[2][1] {
+		return FormatError("bad resolution string " + strconv.Quote(line))
+	}
+	for i := 0; i < 2; i++ {
+		axis := f[2*i]
+		if axis[0] != '+' && axis[0] != '-' || axis[1] != 'X' && axis[1] != 'Y' {
+			return FormatError("bad resolution string " + strconv.Quote(line))
+		}
+		n, err := strconv.Atoi(f[2*i+1])
+		if err != nil || n < 0 || n > maxPixels {
+			return FormatError("bad resolution string " + strconv.Quote(line))
+		}
+		d.axes[i], d.lens[i] = axis, n
+		if axis[1] == 'X' {
+			d.h.Width = n
+		} else {
+			d.h.Height = n
+		}
+	}
+	if d.lens[0] > 0 && d.lens[1] > maxPixels/d.lens[0] {
+		return UnsupportedError("image is too large")
+	}
+	d.h.Orientation = d.axes[0] + " " + d.axes[1]
+	return nil
+}
+
+// readFlat reads the pixels of a scanline that is not run-length encoded,
+// or is with the old encoding, where the pixels 1, 1, 1, n repeat the
+// previous pixel n times, shifted left by 8 bits more for each repeat pixel
+// in a row.
+func (d *decoder) readFlat(scan [][4]byte) error {
+	shift := uint(0)
+	for i := 0; i < len(scan); {
+		var c [4]byte
+		if _, err := io.ReadFull(d.r, c[:]); err != nil {
+			return unexpectedEOF(err)
+		}
+		if c[0] != 1 || c[1] != 1 || c[2] != 1 {
+			scan[i], d.prev = c, c
+			i++
+			shift = 0
+			continue
+		}
+		if shift > 16 {
+			return FormatError("bad run length")
+		}
+		n := int(c[3]) << shift
+		if n > len(scan)-i {
+			return FormatError("bad run length")
+		}
+		for ; n > 0; n-- {
+			scan[i] = d.prev
+			i++
+		}
+		shift += 8
+	}
+	return nil
+}
+
+// readScanline reads the pixels of a scanline.
+func (d *decoder) readScanline(scan [][4]byte) error {
+	if len(scan) < minRLELength || len(scan) > maxRLELength {
+		return d.readFlat(scan)
+	}
+	b, err := d.r.Peek(4)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if b[0] != 2 || b[1] != 2 || b[2]&0x80 != 0 {
+		return d.readFlat(scan)
+	}
+	if int(binary.BigEndian.Uint16(b[2:])) != len(scan) {
+		return FormatError("bad scanline length")
+	}
+	d.r.Discard(4)
+	for k := 0; k < 4; k++ {
+		for i := 0; i < len(scan); {
+			code, err := d.r.ReadByte()
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			if code > 128 {
+				n := int(code & 127)
+				if n > len(scan)-i {
+					return FormatError("bad run length")
+				}
+				v, err := d.r.ReadByte()
+				if err != nil {
+					return unexpectedEOF(err)
+				}
+				for ; n > 0; n-- {
+					scan[i][k] = v
+					i++
+				}
+				continue
+			}
+			n := int(code)
+			if n == 0 || n > len(scan)-i {
+				return FormatError("bad run length")
+			}
+			for ; n > 0; n-- {
+				if scan[i][k], err = d.r.ReadByte(); err != nil {
+					return unexpectedEOF(err)
+				}
+				i++
+			}
+		}
+	}
+	d.prev = scan[len(scan)-1]
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// coord returns the coordinate of the k-th of n pixels along the axis.
+func coord(axis string, k, n int) int {
+	if axis == "-Y" || axis == "+X" {
+		return k
+	}
+	return n - 1 - k
+}
+
+func (d *decoder) decode() (*imageExt.RGB96f, error) {
+	m := imageExt.NewRGB96f(image.Rect(0, 0, d.h.Width, d.h.Height))
+	scan := make([][4]byte, d.lens[1])
+	for i := 0; i < d.lens[0]; i++ {
+		if err := d.readScanline(scan); err != nil {
+			return nil, err
+		}
+		c0 := coord(d.axes[0], i, d.lens[0])
+		for j, c := range scan {
+			x, y := c0, coord(d.axes[1], j, d.lens[1])
+			if d.axes[0][1] == 'Y' {
+				x, y = y, x
+			}
+			r, g, b := rgbeToFloat(c)
+			p := m.M.Pix[m.PixOffset(x, y):]
+			binary.BigEndian.PutUint32(p[0:], math.Float32bits(r))
+			binary.BigEndian.PutUint32(p[4:], math.Float32bits(g))
+			binary.BigEndian.PutUint32(p[8:], math.Float32bits(b))
+		}
+	}
+	return m, nil
+}
+
+// Decode reads a Radiance image from r and returns it as an *image.RGB96f.
+func Decode(r io.Reader) (image.Image, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return d.decode()
+}
+
+// DecodeHeader reads the header of a Radiance image from r.
+func DecodeHeader(r io.Reader) (*Header, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return &d.h, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a Radiance image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := DecodeHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: colorExt.RGB96fModel,
+		Width:      h.Width,
+		Height:     h.Height,
+	}, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hdr
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"strings"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// testPixel returns the RGBE pixel whose red sample is v.
+func testPixel(v byte) []byte {
+	return []byte{v, 0, 0, 128 + 8}
+}
+
+// red returns the red samples of m, row by row.
+func red(m image.Image) [][]float32 {
+	b := m.Bounds()
+	rows := make([][]float32, b.Dy())
+	for y := range rows {
+		for x := 0; x < b.Dx(); x++ {
+			rows[y] = append(rows[y], m.(*imageExt.RGB96f).RGB96fAt(x, y).R-0.5)
+		}
+	}
+	return rows
+}
+
+func TestDecodeOrientation(t *testing.T) {
+	// The pixels 1 to 6 of a 3x2 image, in the order of the file.
+	var pix []byte
+	for v := byte(1); v <= 6; v++ {
+		pix = append(pix, testPixel(v)...)
+	}
+	for _, tc := range []struct {
+		res  string
+		want [][]float32
+	}{
+		{"-Y 2 +X 3", [][]float32{{1, 2, 3}, {4, 5, 6}}},
+		{"-Y 2 -X 3", [][]float32{{3, 2, 1}, {6, 5, 4}}},
+		{"+Y 2 +X 3", [][]float32{{4, 5, 6}, {1, 2, 3}}},
+		{"+Y 2 -X 3", [][]float32{{6, 5, 4}, {3, 2, 1}}},
+		{"+X 3 -Y 2", [][]float32{{1, 3, 5}, {2, 4, 6}}},
+		{"+X 3 +Y 2", [][]float32{{2, 4, 6}, {1, 3, 5}}},
+		{"-X 3 -Y 2", [][]float32{{5, 3, 1}, {6, 4, 2}}},
+		{"-X 3 +Y 2", [][]float32{{6, 4, 2}, {5, 3, 1}}},
+	} {
+		data := append([]byte("#?RADIANCE\n\n"+tc.res+"\n"), pix...)
+		m, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.res, err)
+		}
+		if m.Bounds() != image.Rect(0, 0, 3, 2) {
+			t.Fatalf("%s: got bounds %v", tc.res, m.Bounds())
+		}
+		got := red(m)
+		for y := range got {
+			for x := range got[y] {
+				if got[y][x] != tc.want[y][x] {
+					t.Fatalf("%s: got %v, want %v", tc.res, got, tc.want)
+				}
+			}
+		}
+		h, err := DecodeHeader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Orientation != tc.res[:2]+" "+tc.res[5:7] {
+			t.Fatalf("%s: got orientation %q", tc.res, h.Orientation)
+		}
+	}
+}
+
+func TestDecodeOldRLE(t *testing.T) {
+	// The repeat pixels repeat the previous pixel, across scanlines, and
+	// repeat pixels in a row are shifted by 8 bits more.
+	var data []byte
+	data = append(data, "#?RGBE\n\n-Y 3 +X 300\n"...)
+	data = append(data, testPixel(7)...)
+	data = append(data, 1, 1, 1, 43, 1, 1, 1, 1)
+	data = append(data, 1, 1, 1, 44, 1, 1, 1, 1)
+	data = append(data, testPixel(9)...)
+	data = append(data, 1, 1, 1, 42, 1, 1, 1, 1)
+	data = append(data, testPixel(8)...)
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := red(m)
+	for y, row := range rows {
+		for x, v := range row {
+			want := float32(7)
+			if y == 2 {
+				want = 9
+				if x == 299 {
+					want = 8
+				}
+			}
+			if v != want {
+				t.Fatalf("(%d, %d): got %v, want %v", x, y, v, want)
+			}
+		}
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	data := "#?RADIANCE\n" +
+		"# A comment\n" +
+		"SOFTWARE=test\n" +
+		"FORMAT=32-bit_rle_xyze\n" +
+		"EXPOSURE=2\n" +
+		"EXPOSURE= 0.25 \n" +
+		"\n" +
+		"+Y 1 +X 2\n" +
+		"\x01\x02\x03\x80\x00\x00\x00\x00"
+	h, err := DecodeHeader(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Header{Format: FormatXYZE, Exposure: 0.5, Orientation: "+Y +X", Width: 2, Height: 1}
+	if *h != want {
+		t.Fatalf("got %+v, want %+v", *h, want)
+	}
+	m, err := Decode(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m.(*imageExt.RGB96f).RGB96fAt(0, 0); c != (colorExt.RGB96f{R: 1.5 / 256, G: 2.5 / 256, B: 3.5 / 256}) {
+		t.Fatalf("got %v", c)
+	}
+
+	c, err := DecodeConfig(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Width != 2 || c.Height != 1 || c.ColorModel != colorExt.RGB96fModel {
+		t.Fatalf("got config %+v", c)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{Exposure: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if h, err = DecodeHeader(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want = Header{Format: FormatRGBE, Exposure: 0.5, Orientation: "-Y +X", Width: 2, Height: 1}
+	if *h != want {
+		t.Fatalf("got %+v, want %+v", *h, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"P6\n",
+		"#?RADIANCE\n",
+		"#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n",
+		"#?RADIANCE\nFORMAT=16-bit\n\n-Y 1 +X 1\n",
+		"#?RADIANCE\nEXPOSURE=x\n\n-Y 1 +X 1\n",
+		"#?RADIANCE\nEXPOSURE=-1\n\n-Y 1 +X 1\n",
+		"#?RADIANCE\n\n-Y 1 -Y 1\n",
+		"#?RADIANCE\n\n-Y 1 +X\n",
+		"#?RADIANCE\n\nY 1 X 1\n",
+		"#?RADIANCE\n\n-Y -1 +X 1\n",
+		"#?RADIANCE\n\n-Y 100000 +X 100000\n",
+		"#?RADIANCE\n\n-Y 1 +X 1\n",
+		"#?RADIANCE\n\n-Y 1 +X 2\n\x01\x02\x03\x80",
+		"#?RADIANCE\n\n-Y 1 +X 2\n\x01\x02\x03\x80\x01\x01\x01\x02",
+		"#?RADIANCE\n\n-Y 1 +X 8\n\x02\x02\x00\x09",
+		"#?RADIANCE\n\n-Y 1 +X 8\n\x02\x02\x00\x08\x00",
+		"#?RADIANCE\n\n-Y 1 +X 8\n\x02\x02\x00\x08\x89\x00",
+		"#?RADIANCE\n\n-Y 1 +X 8\n\x02\x02\x00\x08\x88\x00",
+	} {
+		if _, err := Decode(strings.NewReader(data)); err == nil {
+			t.Fatalf("%q: got no error", data)
+		}
+	}
+	if _, err := DecodeConfig(strings.NewReader("#?RADIANCE\n\n")); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hdr
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"io"
+	"math"
+	"strconv"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// minRun is the length from which the repeated samples are written as runs.
+const minRun = 4
+
+// floatToRGBE converts a pixel to RGBE as Radiance does. The negative
+// samples and NaNs are written as 0, and the samples that are too large
+// as the largest value.
+func floatToRGBE(r, g, b float32) [4]byte {
+	v := [3]float64{float64(r), float64(g), float64(b)}
+	mx := 0.0
+	for i := range v {
+		if !(v[i] > 0) {
+			v[i] = 0
+		}
+		if v[i] > mx {
+			mx = v[i]
+		}
+	}
+	if mx <= 1e-32 {
+		return [4]byte{}
+	}
+	frac, e := math.Frexp(mx)
+	if e > 127 || math.IsInf(mx, 1) {
+		return [4]byte{255, 255, 255, 255}
+	}
+	if e < -127 {
+		return [4]byte{}
+	}
+	d := frac * 255.9999 / mx
+	return [4]byte{byte(v[0] * d), byte(v[1] * d), byte(v[2] * d), byte(e + 128)}
+}
+
+// appendRLE appends the samples in s with the adaptive run-length encoding.
+func appendRLE(b, s []byte) []byte {
+	for i := 0; i < len(s); {
+		// Find the next run that is long enough.
+		start, run := i, 0
+		for ; start < len(s); start++ {
+			run = 1
+			for start+run < len(s) && run < 127 && s[start+run] == s[start] {
+				run++
+			}
+			if run >= minRun {
+				break
+			}
+		}
+		for i < start {
+			n := start - i
+			if n > 128 {
+				n = 128
+			}
+			b = append(b, byte(n))
+			b = append(b, s[i:i+n]...)
+			i += n
+		}
+		if start < len(s) {
+			b = append(b, byte(128+run), s[start])
+			i = start + run
+		}
+	}
+	return b
+}
+
+// readRow reads the pixels of the y-th row of m to scan.
+func readRow(m image.Image, y int, scan [][4]byte) {
+	b := m.Bounds()
+	switch m := m.(type) {
+	case *imageExt.RGB96f:
+		for i := range scan {
+			c := m.RGB96fAt(b.Min.X+i, y)
+			scan[i] = floatToRGBE(c.R, c.G, c.B)
+		}
+	case *imageExt.RGBA128f:
+		for i := range scan {
+			c := m.RGBA128fAt(b.Min.X+i, y)
+			scan[i] = floatToRGBE(c.R, c.G, c.B)
+		}
+	case *imageExt.Gray32f:
+		for i := range scan {
+			c := m.Gray32fAt(b.Min.X+i, y)
+			scan[i] = floatToRGBE(c.Y, c.Y, c.Y)
+		}
+	default:
+		for i := range scan {
+			r, g, b, _ := m.At(b.Min.X+i, y).RGBA()
+			scan[i] = floatToRGBE(float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff)
+		}
+	}
+}
+
+// Encode writes the image m to w in the Radiance RGBE format, with the rows
+// from top to bottom. The samples of the float typed images are written as
+// they are, and the others are scaled from 0 to 1. The alpha channel is
+// dropped. The options may be nil.
+func Encode(w io.Writer, m image.Image, opt *Options) error {
+	if opt == nil {
+		opt = new(Options)
+	}
+	b := m.Bounds()
+	if b.Dx() > maxPixels || b.Dy() > maxPixels {
+		return errors.New("hdr: image is too large")
+	}
+	if opt.Exposure != 0 && !(opt.Exposure > 0 && opt.Exposure <= math.MaxFloat64) {
+		return errors.New("hdr: invalid exposure")
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("#?RADIANCE\nFORMAT=" + FormatRGBE + "\n")
+	if opt.Exposure != 0 && opt.Exposure != 1 {
+		bw.WriteString("EXPOSURE=" + strconv.FormatFloat(opt.Exposure, 'g', -1, 64) + "\n")
+	}
+	bw.WriteString("\n-Y " + strconv.Itoa(b.Dy()) + " +X " + strconv.Itoa(b.Dx()) + "\n")
+
+	rle := !opt.Flat && b.Dx() >= minRLELength && b.Dx() <= maxRLELength
+	scan := make([][4]byte, b.Dx())
+	samples := make([]byte, b.Dx())
+	var buf []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		readRow(m, y, scan)
+		buf = buf[:0]
+		if rle {
+			buf = append(buf, 2, 2, byte(b.Dx()>>8), byte(b.Dx()))
+			for k := 0; k < 4; k++ {
+				for i := range scan {
+					samples[i] = scan[i][k]
+				}
+				buf = appendRLE(buf, samples)
+			}
+		} else {
+			for _, c := range scan {
+				buf = append(buf, c[:]...)
+			}
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,175 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hdr
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// testImage returns an image of RGBE pixels, with runs, whose samples
+// are exact after a round trip.
+func testImage(r image.Rectangle) *imageExt.RGB96f {
+	m := imageExt.NewRGB96f(r)
+	rnd := rand.New(rand.NewSource(1))
+	var c [4]byte
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if rnd.Intn(3) != 0 {
+				c = [4]byte{byte(rnd.Intn(256)), byte(rnd.Intn(256)), byte(128 + rnd.Intn(128)), byte(120 + rnd.Intn(16))}
+			}
+			cr, cg, cb := rgbeToFloat(c)
+			m.SetRGB96f(x, y, colorExt.RGB96f{R: cr, G: cg, B: cb})
+		}
+	}
+	return m
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 0, 0),
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 7, 3),
+		image.Rect(-3, 5, 70, 45),
+		image.Rect(0, 0, 300, 2),
+	} {
+		for _, flat := range []bool{false, true} {
+			m0 := testImage(r)
+			var buf bytes.Buffer
+			if err := Encode(&buf, m0, &Options{Flat: flat}); err != nil {
+				t.Fatalf("%v, flat %v: %v", r, flat, err)
+			}
+			data := append([]byte(nil), buf.Bytes()...)
+			m1, err := Decode(&buf)
+			if err != nil {
+				t.Fatalf("%v, flat %v: %v", r, flat, err)
+			}
+			if m1.Bounds() != image.Rect(0, 0, r.Dx(), r.Dy()) {
+				t.Fatalf("%v, flat %v: got bounds %v", r, flat, m1.Bounds())
+			}
+			if !bytes.Equal(m1.(*imageExt.RGB96f).Pix(), m0.Pix()) {
+				t.Fatalf("%v, flat %v: the pixels differ", r, flat)
+			}
+
+			// Encoding the decoded image gives the same file.
+			buf.Reset()
+			if err := Encode(&buf, m1, &Options{Flat: flat}); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Fatalf("%v, flat %v: the files differ", r, flat)
+			}
+		}
+	}
+}
+
+func TestEncodeRLE(t *testing.T) {
+	m := testImage(image.Rect(0, 0, 64, 64))
+	var flat, rle bytes.Buffer
+	if err := Encode(&flat, m, &Options{Flat: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&rle, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rle.Len() >= flat.Len() {
+		t.Fatalf("got %d bytes, flat %d bytes", rle.Len(), flat.Len())
+	}
+
+	for _, n := range []int{8, 127, 128, 129, 300, 1000} {
+		for _, runs := range []bool{false, true} {
+			s := make([]byte, n)
+			for i := range s {
+				s[i] = byte(i)
+				if runs {
+					s[i] = byte(i / 5)
+				}
+			}
+			data := []byte{2, 2, byte(n >> 8), byte(n)}
+			for k := 0; k < 4; k++ {
+				data = appendRLE(data, s)
+			}
+			d := &decoder{r: bufio.NewReader(bytes.NewReader(data))}
+			scan := make([][4]byte, n)
+			if err := d.readScanline(scan); err != nil {
+				t.Fatalf("%d samples, runs %v: %v", n, runs, err)
+			}
+			for i, c := range scan {
+				if c != [4]byte{s[i], s[i], s[i], s[i]} {
+					t.Fatalf("%d samples, runs %v: %d: got %v, want %d", n, runs, i, c, s[i])
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	m0 := imageExt.NewRGBA128f(image.Rect(0, 0, 10, 10))
+	m0.SetRGBA128f(2, 3, colorExt.RGBA128f{R: 1000, G: 0.5, B: -1, A: 0.25})
+	m0.SetRGBA128f(4, 3, colorExt.RGBA128f{R: float32(math.NaN()), G: float32(math.Inf(1)), B: 1e-40, A: 1})
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The alpha channel is dropped, and the samples are within the
+	// precision of the shared exponent.
+	c := m1.(*imageExt.RGB96f).RGB96fAt(2, 3)
+	if math.Abs(float64(c.R)-1000) > 1000.0/256 || math.Abs(float64(c.G)-0.5) > 1000.0/256 || c.B != 2 {
+		t.Fatalf("got %v", c)
+	}
+	if c := m1.(*imageExt.RGB96f).RGB96fAt(4, 3); c.R != c.G || c.R != c.B || c.G < 1e38 {
+		t.Fatalf("got %v", c)
+	}
+
+	// The other images are scaled from 0 to 1.
+	m2 := image.NewGray(image.Rect(0, 0, 4, 4))
+	m2.SetGray(1, 1, color.Gray{0xff})
+	buf.Reset()
+	if err := Encode(&buf, m2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if m1, err = Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if c := m1.(*imageExt.RGB96f).RGB96fAt(1, 1); math.Abs(float64(c.G)-1) > 1.0/256 {
+		t.Fatalf("got %v", c)
+	}
+}
+
+func TestImageExt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "probe.hdr")
+
+	m0 := testImage(image.Rect(0, 0, 20, 10))
+	if err := imageExt.Save(name, m0, &Options{Exposure: 2}); err != nil {
+		t.Fatal(err)
+	}
+	m1, format, err := imageExt.Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "hdr" || !bytes.Equal(m1.(*imageExt.RGB96f).Pix(), m0.Pix()) {
+		t.Fatalf("got format %q and different pixels", format)
+	}
+}
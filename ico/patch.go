@@ -0,0 +1,46 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ico
+
+import (
+	"image"
+	"io"
+
+	imageExt "github.com/chai2010/image"
+)
+
+func toOptions(opt imageExt.Options) *Options {
+	if opt, ok := opt.(*Options); ok {
+		return opt
+	}
+	return nil
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt imageExt.Options) error {
+	return Encode(w, m, toOptions(opt))
+}
+
+func imageExtEncodeCursor(w io.Writer, m image.Image, opt imageExt.Options) error {
+	return EncodeAll(w, &ICO{Image: []image.Image{m}, Cursor: true}, toOptions(opt))
+}
+
+func init() {
+	imageExt.RegisterFormat(imageExt.Format{
+		Name:         "ico",
+		Extensions:   []string{".ico"},
+		Magics:       []string{"\x00\x00\x01\x00"},
+		DecodeConfig: DecodeConfig,
+		Decode:       Decode,
+		Encode:       imageExtEncode,
+	})
+	imageExt.RegisterFormat(imageExt.Format{
+		Name:         "cur",
+		Extensions:   []string{".cur"},
+		Magics:       []string{"\x00\x00\x02\x00"},
+		DecodeConfig: DecodeConfig,
+		Decode:       Decode,
+		Encode:       imageExtEncodeCursor,
+	})
+}
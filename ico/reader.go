@@ -0,0 +1,483 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ico implements an ICO and CUR image decoder and encoder.
+//
+// Icon and cursor files are directories of images of different sizes and
+// color depths. Each image is a BMP image without the file header, followed
+// by a 1 bit transparency mask, or a PNG image.
+//
+// The ICO specification is at
+// http://msdn.microsoft.com/en-us/library/ms997538.aspx.
+package ico
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/chai2010/image/bmp"
+	"github.com/chai2010/image/png"
+)
+
+// ErrUnsupported means that the input image uses a valid but unsupported
+// feature.
+var ErrUnsupported = errors.New("ico: unsupported image")
+
+var errFormat = errors.New("ico: invalid format")
+
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+// Resource types of the directory header.
+const (
+	typeIcon   = 1
+	typeCursor = 2
+)
+
+const (
+	dirHeaderLen     = 6
+	dirEntryLen      = 16
+	fileHeaderLen    = 14  // BMP file header, which the images do not have.
+	coreHeaderLen    = 12  // BITMAPCOREHEADER.
+	infoHeaderLen    = 40  // BITMAPINFOHEADER.
+	maxHeaderLen     = 124 // BITMAPV5HEADER.
+	maxSize          = 256
+	biRGB            = 0
+	biBitFields      = 3
+	biAlphaBitFields = 6
+)
+
+func readUint16(b []byte) uint16 {
+	return uint16(b[0]) | uint16(b[1])<<8
+}
+
+func readUint32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+// ICO represents the images of an icon or a cursor file.
+type ICO struct {
+	Image []image.Image
+	// HotSpot are the hotspots of a cursor's images, relative to their
+	// top-left corner. They are only stored in cursor files.
+	HotSpot []image.Point
+	// Cursor reports whether the file is a cursor (.cur) rather than an
+	// icon (.ico).
+	Cursor bool
+}
+
+// entry is an entry of the image directory. For cursors, planes and
+// bitCount hold the hotspot.
+type entry struct {
+	planes, bitCount int
+	size, offset     uint32
+}
+
+// readDir reads the directory header and entries of an icon or cursor file.
+func readDir(data []byte) (cursor bool, entries []entry, err error) {
+	cursor, entries, err = readDirEntries(data)
+	if err != nil {
+		return false, nil, err
+	}
+	for _, e := range entries {
+		if uint64(e.offset)+uint64(e.size) > uint64(len(data)) {
+			return false, nil, errFormat
+		}
+	}
+	return cursor, entries, nil
+}
+
+// readDirEntries reads the directory header and entries at the start of
+// data, without checking that the images are within data.
+func readDirEntries(data []byte) (cursor bool, entries []entry, err error) {
+	if len(data) < dirHeaderLen || readUint16(data[0:]) != 0 {
+		return false, nil, errFormat
+	}
+	switch readUint16(data[2:]) {
+	case typeIcon:
+	case typeCursor:
+		cursor = true
+	default:
+		return false, nil, errFormat
+	}
+	n := int(readUint16(data[4:]))
+	if n == 0 || len(data) < dirHeaderLen+n*dirEntryLen {
+		return false, nil, errFormat
+	}
+	entries = make([]entry, n)
+	for i := range entries {
+		b := data[dirHeaderLen+i*dirEntryLen:]
+		e := &entries[i]
+		e.planes, e.bitCount = int(readUint16(b[4:])), int(readUint16(b[6:]))
+		e.size, e.offset = readUint32(b[8:]), readUint32(b[12:])
+	}
+	return cursor, entries, nil
+}
+
+// byOffset sorts the indices of entries by the offsets of the entries.
+type byOffset struct {
+	order   []int
+	entries []entry
+}
+
+func (b byOffset) Len() int { return len(b.order) }
+func (b byOffset) Less(i, j int) bool {
+	return b.entries[b.order[i]].offset < b.entries[b.order[j]].offset
+}
+func (b byOffset) Swap(i, j int) { b.order[i], b.order[j] = b.order[j], b.order[i] }
+
+// dibHeader returns the header of the BMP image without the file header
+// that data starts with, with the height of the image rather than twice the
+// height, and the offsets of the pixels and the AND mask. Data must hold
+// at least the header.
+func dibHeader(data []byte) (h []byte, pixOffset, maskOffset int, err error) {
+	if len(data) < 4 {
+		return nil, 0, 0, errFormat
+	}
+	n := readUint32(data)
+	if n != coreHeaderLen && (n < infoHeaderLen || n > maxHeaderLen) {
+		return nil, 0, 0, ErrUnsupported
+	}
+	headerLen := int(n)
+	if len(data) < headerLen {
+		return nil, 0, 0, errFormat
+	}
+	var width, height, bpp, colorsUsed, compression int
+	paletteEntryLen := 4
+	h = make([]byte, headerLen)
+	copy(h, data)
+	if headerLen == coreHeaderLen {
+		width, height = int(readUint16(h[4:])), int(readUint16(h[6:]))
+		bpp = int(readUint16(h[10:]))
+		paletteEntryLen = 3
+		height /= 2
+		h[6], h[7] = uint8(height), uint8(height>>8)
+	} else {
+		width, height = int(int32(readUint32(h[4:]))), int(int32(readUint32(h[8:])))
+		bpp = int(readUint16(h[14:]))
+		compression = int(readUint32(h[16:]))
+		colorsUsed = int(readUint32(h[32:]))
+		height /= 2
+		h[8], h[9], h[10], h[11] = uint8(height), uint8(height>>8), uint8(height>>16), uint8(height>>24)
+	}
+	if width <= 0 || height <= 0 || width > 1<<16 || height > 1<<16 {
+		return nil, 0, 0, ErrUnsupported
+	}
+
+	// Find the AND mask, which follows the palette and the pixels.
+	pixOffset = headerLen
+	if bpp <= 8 {
+		n := 1 << uint(bpp)
+		if colorsUsed != 0 && colorsUsed < n {
+			n = colorsUsed
+		}
+		pixOffset += n * paletteEntryLen
+	}
+	switch compression {
+	case biRGB:
+	case biBitFields, biAlphaBitFields:
+		if headerLen == infoHeaderLen {
+			pixOffset += 12
+			if compression == biAlphaBitFields {
+				pixOffset += 4
+			}
+		}
+	default:
+		return nil, 0, 0, ErrUnsupported
+	}
+	maskOffset = pixOffset + ((width*bpp+31)/32)*4*height
+	return h, pixOffset, maskOffset, nil
+}
+
+// bmpFileHeader returns the BMP file header of an image of size bytes
+// without the file header, whose pixels start at pixOffset.
+func bmpFileHeader(size, pixOffset int) []byte {
+	fh := make([]byte, fileHeaderLen)
+	fh[0], fh[1] = 'B', 'M'
+	putUint32(fh[2:], uint32(fileHeaderLen+size))
+	putUint32(fh[10:], uint32(fileHeaderLen+pixOffset))
+	return fh
+}
+
+// decodeDIB decodes a BMP image without the file header. Its height is
+// twice the image height, as the pixels are followed by the AND mask.
+func decodeDIB(data []byte) (image.Image, error) {
+	h, pixOffset, maskOffset, err := dibHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the bmp package decode the pixels.
+	m, err := bmp.Decode(io.MultiReader(
+		bytes.NewReader(bmpFileHeader(len(data), pixOffset)),
+		bytes.NewReader(h),
+		bytes.NewReader(data[len(h):]),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	// Images with an alpha channel do not need the mask.
+	if o, ok := m.(interface {
+		Opaque() bool
+	}); ok && !o.Opaque() {
+		return m, nil
+	}
+	b := m.Bounds()
+	maskLen := ((b.Dx() + 31) / 32) * 4 * b.Dy()
+	if maskOffset+maskLen > len(data) {
+		// Some writers leave out the mask.
+		return m, nil
+	}
+	return applyMask(m, data[maskOffset:maskOffset+maskLen]), nil
+}
+
+// entryConfig returns the color model and dimensions of the image read
+// from r, a BMP image without the file header or a PNG image. It reads no
+// more than the headers and the palette of the image. The AND mask of a
+// BMP image is not read, so that the color model of an image made partly
+// transparent by its mask is the one of its pixels.
+func entryConfig(r io.Reader) (image.Config, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return image.Config{}, err
+	}
+	if string(b[:]) == pngHeader[:4] {
+		return png.DecodeConfig(io.MultiReader(bytes.NewReader(b[:]), r))
+	}
+	n := readUint32(b[:])
+	if n != coreHeaderLen && (n < infoHeaderLen || n > maxHeaderLen) {
+		return image.Config{}, ErrUnsupported
+	}
+	data := make([]byte, n)
+	copy(data, b[:])
+	if _, err := io.ReadFull(r, data[4:]); err != nil {
+		return image.Config{}, err
+	}
+	h, pixOffset, _, err := dibHeader(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return bmp.DecodeConfig(io.MultiReader(
+		bytes.NewReader(bmpFileHeader(0, pixOffset)),
+		bytes.NewReader(h),
+		r,
+	))
+}
+
+// applyMask returns m with the pixels that are set in the bottom-up AND
+// mask made transparent. If no pixels are set, m is returned unchanged.
+func applyMask(m image.Image, mask []byte) image.Image {
+	transparent := false
+	for _, v := range mask {
+		if v != 0 {
+			transparent = true
+			break
+		}
+	}
+	if !transparent {
+		return m
+	}
+	b := m.Bounds()
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, m, b.Min, draw.Src)
+	stride := len(mask) / b.Dy()
+	for y := 0; y < b.Dy(); y++ {
+		row := mask[(b.Dy()-1-y)*stride:]
+		for x := 0; x < b.Dx(); x++ {
+			if row[x/8]&(0x80>>uint(x%8)) != 0 {
+				i := y*dst.Stride + x*4
+				dst.Pix[i+0], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = 0, 0, 0, 0
+			}
+		}
+	}
+	return dst
+}
+
+// DecodeAll reads an icon or cursor file from r and returns all of its
+// images.
+func DecodeAll(r io.Reader) (*ICO, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cursor, entries, err := readDir(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &ICO{
+		Image:  make([]image.Image, len(entries)),
+		Cursor: cursor,
+	}
+	if cursor {
+		p.HotSpot = make([]image.Point, len(entries))
+	}
+	for i, e := range entries {
+		b := data[e.offset : e.offset+e.size]
+		if bytes.HasPrefix(b, []byte(pngHeader)) {
+			p.Image[i], err = png.Decode(bytes.NewReader(b))
+		} else {
+			p.Image[i], err = decodeDIB(b)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cursor {
+			p.HotSpot[i] = image.Pt(e.planes, e.bitCount)
+		}
+	}
+	return p, nil
+}
+
+// colorDepth returns the number of bits per pixel of the images of color
+// model cm.
+func colorDepth(cm color.Model) int {
+	switch cm := cm.(type) {
+	case color.Palette:
+		n := 1
+		for 1<<uint(n) < len(cm) {
+			n++
+		}
+		return n
+	}
+	if cm == color.GrayModel {
+		return 8
+	}
+	return 32
+}
+
+// imageConfig returns the color model and dimensions of m.
+func imageConfig(m image.Image) image.Config {
+	return image.Config{
+		ColorModel: m.ColorModel(),
+		Width:      m.Bounds().Dx(),
+		Height:     m.Bounds().Dy(),
+	}
+}
+
+// better reports whether the image of c0 is preferred over the one of c1
+// when both of them are large enough, or both of them are too small. If
+// smaller is true, the smaller image is better.
+func better(c0, c1 image.Config, smaller bool) bool {
+	if a0, a1 := c0.Width*c0.Height, c1.Width*c1.Height; a0 != a1 {
+		return a0 < a1 == smaller
+	}
+	return colorDepth(c0.ColorModel) > colorDepth(c1.ColorModel)
+}
+
+// Best returns the index of the image that best matches a size of width x
+// height pixels: the smallest image that is at least as large, or the
+// largest image if all of them are smaller. Among images of the same size,
+// the one with the highest color depth is chosen. Best returns -1 if p has
+// no images.
+func (p *ICO) Best(width, height int) int {
+	configs := make([]image.Config, len(p.Image))
+	for i, m := range p.Image {
+		configs[i] = imageConfig(m)
+	}
+	best := -1
+	for i, c := range configs {
+		if c.Width >= width && c.Height >= height {
+			if best < 0 || better(c, configs[best], true) {
+				best = i
+			}
+		}
+	}
+	if best < 0 {
+		return largest(configs)
+	}
+	return best
+}
+
+// largest returns the index of the largest image of configs, or -1 if
+// there are none.
+func largest(configs []image.Config) int {
+	largest := -1
+	for i, c := range configs {
+		if largest < 0 || better(c, configs[largest], false) {
+			largest = i
+		}
+	}
+	return largest
+}
+
+// Decode reads an icon or cursor file from r and returns its largest image,
+// with the highest color depth, as an image.Image. Only that image is
+// decoded.
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	_, entries, err := readDir(data)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]image.Config, len(entries))
+	for i, e := range entries {
+		if configs[i], err = entryConfig(bytes.NewReader(data[e.offset : e.offset+e.size])); err != nil {
+			return nil, err
+		}
+	}
+	e := entries[largest(configs)]
+	b := data[e.offset : e.offset+e.size]
+	if bytes.HasPrefix(b, []byte(pngHeader)) {
+		return png.Decode(bytes.NewReader(b))
+	}
+	return decodeDIB(b)
+}
+
+// DecodeConfig returns the color model and dimensions of the image that
+// Decode returns, reading only the directory and the headers of the images.
+// The color model of a BMP image made partly transparent by its AND mask
+// is the one of its pixels, while Decode returns an *image.NRGBA.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	var b [dirHeaderLen]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return image.Config{}, err
+	}
+	dir := make([]byte, dirHeaderLen+int(readUint16(b[4:]))*dirEntryLen)
+	copy(dir, b[:])
+	if _, err := io.ReadFull(r, dir[dirHeaderLen:]); err != nil {
+		return image.Config{}, err
+	}
+	_, entries, err := readDirEntries(dir)
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	// Read the images in file order, skipping all but their headers.
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Sort(byOffset{order, entries})
+	configs := make([]image.Config, len(entries))
+	pos := int64(len(dir))
+	for _, i := range order {
+		e := entries[i]
+		if int64(e.offset) < pos {
+			return image.Config{}, errFormat
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, int64(e.offset)-pos); err != nil {
+			return image.Config{}, err
+		}
+		lr := &io.LimitedReader{R: r, N: int64(e.size)}
+		if configs[i], err = entryConfig(lr); err != nil {
+			return image.Config{}, err
+		}
+		pos = int64(e.offset) + int64(e.size) - lr.N
+	}
+	return configs[largest(configs)], nil
+}
+
+func init() {
+	image.RegisterFormat("ico", "\x00\x00\x01\x00", Decode, DecodeConfig)
+	image.RegisterFormat("cur", "\x00\x00\x02\x00", Decode, DecodeConfig)
+}
@@ -0,0 +1,218 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ico
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func compare(img0, img1 image.Image) error {
+	b := img1.Bounds()
+	if !b.Eq(img0.Bounds()) {
+		return fmt.Errorf("wrong image size: want %s, got %s", img0.Bounds(), b)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c0 := img0.At(x, y)
+			c1 := img1.At(x, y)
+			r0, g0, b0, a0 := c0.RGBA()
+			r1, g1, b1, a1 := c1.RGBA()
+			if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+				return fmt.Errorf("pixel at (%d, %d) has wrong color: want %v, got %v", x, y, c0, c1)
+			}
+		}
+	}
+	return nil
+}
+
+// buildICO returns an icon file holding the given images. The images are
+// BMP images without the file header, or PNG images.
+func buildICO(typ int, hotSpots []image.Point, images ...[]byte) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &dirHeader{typ: uint16(typ), count: uint16(len(images))})
+	offset := dirHeaderLen + dirEntryLen*len(images)
+	for i, b := range images {
+		e := dirEntry{size: uint32(len(b)), offset: uint32(offset)}
+		if hotSpots != nil {
+			e.planes, e.bitCount = uint16(hotSpots[i].X), uint16(hotSpots[i].Y)
+		}
+		binary.Write(buf, binary.LittleEndian, &e)
+		offset += len(b)
+	}
+	for _, b := range images {
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+// buildDIB returns a BMP image without the file header. The height in the
+// header is doubled, and rows and mask are stored bottom-up.
+func buildDIB(width, height, bpp int, palette, rows, mask []byte) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &infoHeader{
+		headerSize: infoHeaderLen,
+		width:      int32(width),
+		height:     int32(2 * height),
+		planes:     1,
+		bpp:        uint16(bpp),
+		colorUse:   uint32(len(palette) / 4),
+	})
+	buf.Write(palette)
+	buf.Write(rows)
+	buf.Write(mask)
+	return buf.Bytes()
+}
+
+func TestDecodePaletted(t *testing.T) {
+	// A 4x2 image with a black and a white color. The bottom row is black,
+	// and the right half of the top row is transparent.
+	palette := []byte{0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0}
+	rows := []byte{
+		0x00, 0, 0, 0,
+		0xF0, 0, 0, 0,
+	}
+	mask := []byte{
+		0x00, 0, 0, 0,
+		0x30, 0, 0, 0,
+	}
+	want := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		want.Set(x, 1, color.Black)
+	}
+	want.Set(0, 0, color.White)
+	want.Set(1, 0, color.White)
+
+	m, err := Decode(bytes.NewReader(buildICO(typeIcon, nil, buildDIB(4, 2, 1, palette, rows, mask))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compare(want, m); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without transparent pixels, the paletted image is returned as is.
+	m, err = Decode(bytes.NewReader(buildICO(typeIcon, nil, buildDIB(4, 2, 1, palette, rows, make([]byte, 8)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.(*image.Paletted); !ok {
+		t.Fatalf("got %T, want *image.Paletted", m)
+	}
+}
+
+func TestDecodeAlpha(t *testing.T) {
+	// The alpha channel of 32 bit images takes precedence over the mask.
+	rows := []byte{
+		0x10, 0x20, 0x30, 0x80, 0x40, 0x50, 0x60, 0xFF,
+	}
+	m, err := Decode(bytes.NewReader(buildICO(typeIcon, nil, buildDIB(2, 1, 32, nil, rows, []byte{0xC0, 0, 0, 0}))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	want.Pix = []byte{0x30, 0x20, 0x10, 0x80, 0x60, 0x50, 0x40, 0xFF}
+	if err := compare(want, m); err != nil {
+		t.Fatal(err)
+	}
+
+	// If all alpha values are zero, the mask is used.
+	rows[3], rows[7] = 0, 0
+	m, err = Decode(bytes.NewReader(buildICO(typeIcon, nil, buildDIB(2, 1, 32, nil, rows, []byte{0x40, 0, 0, 0}))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Pix = []byte{0x30, 0x20, 0x10, 0xFF, 0, 0, 0, 0}
+	if err := compare(want, m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	dib := buildDIB(1, 1, 24, nil, []byte{1, 2, 3, 0}, make([]byte, 4))
+	for _, data := range [][]byte{
+		nil,
+		[]byte("\x00\x00\x03\x00\x01\x00"),
+		buildICO(typeIcon, nil),
+		buildICO(typeIcon, nil, dib)[:dirHeaderLen+dirEntryLen+8],
+		buildICO(typeIcon, nil, []byte{1, 2, 3, 4, 5}),
+		// A header size of 0x7ffffff0 bytes.
+		buildICO(typeIcon, nil, []byte{0xf0, 0xff, 0xff, 0x7f, 1, 0, 0, 0}),
+	} {
+		if _, err := Decode(bytes.NewReader(data)); err == nil {
+			t.Fatalf("decoding %q succeeded", data)
+		}
+		if _, err := DecodeConfig(bytes.NewReader(data)); err == nil {
+			t.Fatalf("decoding the config of %q succeeded", data)
+		}
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	palette := []byte{0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0}
+	small := buildDIB(1, 1, 24, nil, []byte{1, 2, 3, 0}, make([]byte, 4))
+	large := buildDIB(4, 2, 1, palette, make([]byte, 8), make([]byte, 8))
+	data := buildICO(typeIcon, nil, small, large)
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Width != 4 || c.Height != 2 || !reflect.DeepEqual(c.ColorModel, m.ColorModel()) {
+		t.Fatalf("got config %+v of the image %T %v", c, m, m.Bounds())
+	}
+
+	// Only the directory and the headers and palettes of the images are
+	// read, so the pixels of the last image are not needed.
+	end := dirHeaderLen + 2*dirEntryLen + len(small) + infoHeaderLen + len(palette)
+	if _, err := DecodeConfig(bytes.NewReader(data[:end])); err != nil {
+		t.Fatal(err)
+	}
+
+	// The images of an icon written as PNG images.
+	var buf bytes.Buffer
+	p := &ICO{Image: []image.Image{image.NewGray(image.Rect(0, 0, 8, 8)), image.NewNRGBA(image.Rect(0, 0, 16, 16))}}
+	if err := EncodeAll(&buf, p, &Options{PNG: true}); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := DecodeConfig(bytes.NewReader(buf.Bytes())); err != nil || c.Width != 16 || c.ColorModel != color.NRGBAModel {
+		t.Fatalf("got config %+v, error %v", c, err)
+	}
+}
+
+func TestBest(t *testing.T) {
+	p := &ICO{Image: []image.Image{
+		image.NewPaletted(image.Rect(0, 0, 32, 32), make(color.Palette, 16)),
+		image.NewNRGBA(image.Rect(0, 0, 16, 16)),
+		image.NewNRGBA(image.Rect(0, 0, 32, 32)),
+		image.NewNRGBA(image.Rect(0, 0, 48, 48)),
+		image.NewPaletted(image.Rect(0, 0, 16, 16), make(color.Palette, 2)),
+	}}
+	for _, tc := range []struct {
+		width, height, want int
+	}{
+		{0, 0, 1},
+		{16, 16, 1},
+		{20, 20, 2},
+		{32, 16, 2},
+		{48, 48, 3},
+		{64, 64, 3},
+	} {
+		if got := p.Best(tc.width, tc.height); got != tc.want {
+			t.Fatalf("Best(%d, %d): got %d, want %d", tc.width, tc.height, got, tc.want)
+		}
+	}
+	if got := (&ICO{}).Best(16, 16); got != -1 {
+		t.Fatalf("got %d, want -1", got)
+	}
+}
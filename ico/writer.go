@@ -0,0 +1,180 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ico
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+
+	"github.com/chai2010/image/png"
+)
+
+type dirHeader struct {
+	reserved uint16
+	typ      uint16
+	count    uint16
+}
+
+type dirEntry struct {
+	width      uint8
+	height     uint8
+	colorCount uint8
+	reserved   uint8
+	planes     uint16
+	bitCount   uint16
+	size       uint32
+	offset     uint32
+}
+
+type infoHeader struct {
+	headerSize      uint32
+	width           int32
+	height          int32
+	planes          uint16
+	bpp             uint16
+	compression     uint32
+	imageSize       uint32
+	xPixelsPerMeter uint32
+	yPixelsPerMeter uint32
+	colorUse        uint32
+	colorImportant  uint32
+}
+
+// Options are the encoding parameters.
+type Options struct {
+	// PNG stores all images in PNG format. By default, only images of
+	// 256x256 pixels are stored as PNG, as Windows Vista and later
+	// versions expect, and smaller images as 32 bit BMP images with an
+	// AND mask, which all versions of Windows can read.
+	PNG bool
+}
+
+func (opt *Options) Lossless() bool {
+	return true
+}
+
+func (opt *Options) Quality() float32 {
+	return 0
+}
+
+func putUint32(b []byte, v uint32) {
+	b[0], b[1], b[2], b[3] = uint8(v), uint8(v>>8), uint8(v>>16), uint8(v>>24)
+}
+
+// encodeDIB returns m as a 32 bit BMP image without the file header,
+// followed by an AND mask of its fully transparent pixels.
+func encodeDIB(m image.Image) []byte {
+	b := m.Bounds()
+	rgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), m, b.Min, draw.Src)
+
+	maskStride := ((b.Dx() + 31) / 32) * 4
+	pixLen, maskLen := 4*b.Dx()*b.Dy(), maskStride*b.Dy()
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &infoHeader{
+		headerSize: infoHeaderLen,
+		width:      int32(b.Dx()),
+		height:     int32(2 * b.Dy()),
+		planes:     1,
+		bpp:        32,
+		imageSize:  uint32(pixLen + maskLen),
+	})
+	data := make([]byte, infoHeaderLen+pixLen+maskLen)
+	copy(data, buf.Bytes())
+	pix, mask := data[infoHeaderLen:], data[infoHeaderLen+pixLen:]
+	for y := 0; y < b.Dy(); y++ {
+		// The rows are stored bottom-up.
+		src := rgba.Pix[y*rgba.Stride : y*rgba.Stride+4*b.Dx()]
+		dst := pix[(b.Dy()-1-y)*4*b.Dx():]
+		row := mask[(b.Dy()-1-y)*maskStride:]
+		for x := 0; x < b.Dx(); x++ {
+			// BMP images are stored in BGRA order rather than RGBA order.
+			i := 4 * x
+			dst[i+0], dst[i+1], dst[i+2], dst[i+3] = src[i+2], src[i+1], src[i+0], src[i+3]
+			if src[i+3] == 0 {
+				row[x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return data
+}
+
+// EncodeAll writes the images in p to w as an icon or cursor file. Default
+// parameters are used if a nil *Options is passed.
+//
+// The images must be at most 256 pixels wide and high.
+func EncodeAll(w io.Writer, p *ICO, opt *Options) error {
+	if opt == nil {
+		opt = new(Options)
+	}
+	if len(p.Image) == 0 {
+		return errors.New("ico: no images")
+	}
+	if len(p.Image) > 0xFFFF {
+		return errors.New("ico: too many images")
+	}
+	if p.HotSpot != nil && len(p.HotSpot) != len(p.Image) {
+		return errors.New("ico: mismatched image and hotspot lengths")
+	}
+
+	h := &dirHeader{typ: typeIcon, count: uint16(len(p.Image))}
+	if p.Cursor {
+		h.typ = typeCursor
+	}
+	entries := make([]dirEntry, len(p.Image))
+	data := make([][]byte, len(p.Image))
+	offset := dirHeaderLen + dirEntryLen*len(p.Image)
+	for i, m := range p.Image {
+		d := m.Bounds().Size()
+		if d.X < 1 || d.Y < 1 || d.X > maxSize || d.Y > maxSize {
+			return errors.New("ico: invalid image size")
+		}
+		if opt.PNG || d.X == maxSize && d.Y == maxSize {
+			buf := new(bytes.Buffer)
+			if err := png.Encode(buf, m); err != nil {
+				return err
+			}
+			data[i] = buf.Bytes()
+		} else {
+			data[i] = encodeDIB(m)
+		}
+
+		e := &entries[i]
+		// A width or height of 256 is stored as 0.
+		e.width, e.height = uint8(d.X), uint8(d.Y)
+		e.planes, e.bitCount = 1, 32
+		if p.Cursor {
+			e.planes, e.bitCount = 0, 0
+			if p.HotSpot != nil {
+				e.planes, e.bitCount = uint16(p.HotSpot[i].X), uint16(p.HotSpot[i].Y)
+			}
+		}
+		e.size, e.offset = uint32(len(data[i])), uint32(offset)
+		offset += len(data[i])
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, entries); err != nil {
+		return err
+	}
+	for _, b := range data {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode writes the image m to w as an icon file with a single image.
+// Default parameters are used if a nil *Options is passed.
+func Encode(w io.Writer, m image.Image, opt *Options) error {
+	return EncodeAll(w, &ICO{Image: []image.Image{m}}, opt)
+}
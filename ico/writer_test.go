@@ -0,0 +1,127 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ico
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+)
+
+func testImage(size int) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			a := uint8(0xFF)
+			if x < y {
+				a = uint8(x * 0xFF / size)
+			}
+			m.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x + y), a})
+		}
+	}
+	return m
+}
+
+func TestEncodeAll(t *testing.T) {
+	p := &ICO{Image: []image.Image{testImage(16), testImage(33), testImage(256)}}
+	for _, opt := range []*Options{nil, {PNG: true}} {
+		buf := new(bytes.Buffer)
+		if err := EncodeAll(buf, p, opt); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		_, entries, err := readDir(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range entries {
+			isPNG := bytes.HasPrefix(data[e.offset:], []byte(pngHeader))
+			if want := opt != nil || i == 2; isPNG != want {
+				t.Fatalf("%+v: image %d: got PNG %v, want %v", opt, i, isPNG, want)
+			}
+		}
+
+		p1, err := DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p1.Cursor || p1.HotSpot != nil || len(p1.Image) != len(p.Image) {
+			t.Fatalf("got %+v", p1)
+		}
+		for i := range p.Image {
+			if err := compare(p.Image[i], p1.Image[i]); err != nil {
+				t.Fatalf("%+v: image %d: %v", opt, i, err)
+			}
+		}
+	}
+}
+
+func TestEncodeMask(t *testing.T) {
+	m := testImage(4)
+	m.Pix[3] = 0
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The mask of the top row is the last row of the image.
+	data := buf.Bytes()
+	mask := data[len(data)-16:]
+	if want := []byte{0x80, 0, 0, 0}; !bytes.Equal(mask[12:], want) {
+		t.Fatalf("got mask %x, want %x", mask[12:], want)
+	}
+}
+
+func TestEncodeCursor(t *testing.T) {
+	p := &ICO{
+		Image:   []image.Image{testImage(16), testImage(32)},
+		HotSpot: []image.Point{{1, 2}, {3, 4}},
+		Cursor:  true,
+	}
+	buf := new(bytes.Buffer)
+	if err := EncodeAll(buf, p, nil); err != nil {
+		t.Fatal(err)
+	}
+	p1, err := DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p1.Cursor || !reflect.DeepEqual(p1.HotSpot, p.HotSpot) {
+		t.Fatalf("got cursor %v with hotspots %v", p1.Cursor, p1.HotSpot)
+	}
+
+	// Cursors are written through the image package by extension.
+	buf.Reset()
+	if err := imageExt.Encode("cur", buf, testImage(8), nil); err != nil {
+		t.Fatal(err)
+	}
+	m, format, err := imageExt.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "cur" {
+		t.Fatalf("got format %q, want %q", format, "cur")
+	}
+	if err := compare(testImage(8), m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	for _, p := range []*ICO{
+		{},
+		{Image: []image.Image{testImage(257)}},
+		{Image: []image.Image{image.NewGray(image.Rect(0, 0, 0, 1))}},
+		{Image: []image.Image{testImage(16)}, HotSpot: []image.Point{{}, {}}},
+	} {
+		if err := EncodeAll(ioutil.Discard, p, nil); err == nil {
+			t.Fatalf("encoding %v succeeded", p)
+		}
+	}
+}
@@ -19,36 +19,45 @@ import (
 var (
 	_ Image = (*Gray)(nil)
 	_ Image = (*Gray16)(nil)
+	_ Image = (*Gray16f)(nil)
 	_ Image = (*Gray32i)(nil)
 	_ Image = (*Gray32f)(nil)
 	_ Image = (*Gray64i)(nil)
 	_ Image = (*Gray64f)(nil)
 	_ Image = (*GrayA)(nil)
 	_ Image = (*GrayA32)(nil)
+	_ Image = (*GrayA32f)(nil)
 	_ Image = (*GrayA64i)(nil)
 	_ Image = (*GrayA64f)(nil)
 	_ Image = (*GrayA128i)(nil)
 	_ Image = (*GrayA128f)(nil)
 	_ Image = (*RGB)(nil)
 	_ Image = (*RGB48)(nil)
+	_ Image = (*RGB48f)(nil)
 	_ Image = (*RGB96i)(nil)
 	_ Image = (*RGB96f)(nil)
 	_ Image = (*RGB192i)(nil)
 	_ Image = (*RGB192f)(nil)
 	_ Image = (*RGBA)(nil)
 	_ Image = (*RGBA64)(nil)
+	_ Image = (*RGBA64f)(nil)
 	_ Image = (*RGBA128i)(nil)
 	_ Image = (*RGBA128f)(nil)
 	_ Image = (*RGBA256i)(nil)
 	_ Image = (*RGBA256f)(nil)
 )
 
+// Float16 is the Depth of the images of IEEE 754 half-precision samples,
+// which are from 0 to 1. Go has no float16 type, and no reflect.Kind for it.
+const Float16 reflect.Kind = 0x100
+
 type Image interface {
 	// Get original type, such as *image.Gray, *image.RGBA, etc.
 	BaseType() image.Image
 
 	// Pix holds the image's pixels, as pixel values in big-endian order format. The pixel at
 	// (x, y) starts at Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*PixelSize].
+	// Images for which IsPlanar is true hold their channels in separate planes instead.
 	Pix() []byte
 	// Stride is the Pix stride (in bytes) between vertically adjacent pixels.
 	Stride() int
@@ -57,7 +66,7 @@ type Image interface {
 
 	// 1:Gray, 2:GrayA, 3:RGB, 4:RGBA
 	Channels() int
-	// Uint8/Uint16/Int32/Int64/Float32/Float64
+	// Uint8/Uint16/Int32/Int64/Float16/Float32/Float64
 	Depth() reflect.Kind
 
 	draw.Image
@@ -149,12 +158,17 @@ func AsImage(m image.Image) Image {
 }
 
 func CloneImage(m image.Image) Image {
+	if p, ok := m.(*Planar); ok {
+		return new(Planar).Init(append([]uint8(nil), p.M.Pix...), p.M.Stride, p.M.PlaneStride, p.M.Rect, p.M.Channels, p.M.Depth)
+	}
 	if m, ok := m.(Image); ok {
 		switch channels, depth := m.Channels(), m.Depth(); {
 		case channels == 1 && depth == reflect.Uint8:
 			return new(Gray).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 1 && depth == reflect.Uint16:
 			return new(Gray16).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
+		case channels == 1 && depth == Float16:
+			return new(Gray16f).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 1 && depth == reflect.Int32:
 			return new(Gray32i).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 1 && depth == reflect.Float32:
@@ -168,6 +182,8 @@ func CloneImage(m image.Image) Image {
 			return new(GrayA).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 2 && depth == reflect.Uint16:
 			return new(GrayA32).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
+		case channels == 2 && depth == Float16:
+			return new(GrayA32f).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 2 && depth == reflect.Int32:
 			return new(GrayA64i).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 2 && depth == reflect.Float32:
@@ -181,6 +197,8 @@ func CloneImage(m image.Image) Image {
 			return new(RGB).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 3 && depth == reflect.Uint16:
 			return new(RGB48).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
+		case channels == 3 && depth == Float16:
+			return new(RGB48f).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 3 && depth == reflect.Int32:
 			return new(RGB96i).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 3 && depth == reflect.Float32:
@@ -194,6 +212,8 @@ func CloneImage(m image.Image) Image {
 			return new(RGBA).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 4 && depth == reflect.Uint16:
 			return new(RGBA64).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
+		case channels == 4 && depth == Float16:
+			return new(RGBA64f).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 4 && depth == reflect.Int32:
 			return new(RGBA128i).Init(append([]uint8(nil), m.Pix()...), m.Stride(), m.Rect())
 		case channels == 4 && depth == reflect.Float32:
@@ -232,6 +252,9 @@ func NewImage(r image.Rectangle, channels int, depth reflect.Kind) (m Image, err
 	case channels == 1 && depth == reflect.Uint16:
 		m = NewGray16(r)
 		return
+	case channels == 1 && depth == Float16:
+		m = NewGray16f(r)
+		return
 	case channels == 1 && depth == reflect.Int32:
 		m = NewGray32i(r)
 		return
@@ -251,14 +274,17 @@ func NewImage(r image.Rectangle, channels int, depth reflect.Kind) (m Image, err
 	case channels == 2 && depth == reflect.Uint16:
 		m = NewGrayA32(r)
 		return
+	case channels == 2 && depth == Float16:
+		m = NewGrayA32f(r)
+		return
 	case channels == 2 && depth == reflect.Int32:
-		m = NewGrayA64f(r)
+		m = NewGrayA64i(r)
 		return
 	case channels == 2 && depth == reflect.Float32:
 		m = NewGrayA64f(r)
 		return
 	case channels == 2 && depth == reflect.Int64:
-		m = NewGrayA128f(r)
+		m = NewGrayA128i(r)
 		return
 	case channels == 2 && depth == reflect.Float64:
 		m = NewGrayA128f(r)
@@ -270,6 +296,9 @@ func NewImage(r image.Rectangle, channels int, depth reflect.Kind) (m Image, err
 	case channels == 3 && depth == reflect.Uint16:
 		m = NewRGB48(r)
 		return
+	case channels == 3 && depth == Float16:
+		m = NewRGB48f(r)
+		return
 	case channels == 3 && depth == reflect.Int32:
 		m = NewRGB96i(r)
 		return
@@ -289,6 +318,9 @@ func NewImage(r image.Rectangle, channels int, depth reflect.Kind) (m Image, err
 	case channels == 4 && depth == reflect.Uint16:
 		m = NewRGBA64(r)
 		return
+	case channels == 4 && depth == Float16:
+		m = NewRGBA64f(r)
+		return
 	case channels == 4 && depth == reflect.Int32:
 		m = NewRGBA128i(r)
 		return
@@ -7,6 +7,7 @@ package image_test
 import (
 	"image"
 	"image/color"
+	"reflect"
 	"testing"
 
 	imageExt "github.com/chai2010/image"
@@ -32,6 +33,12 @@ func TestImage(t *testing.T) {
 		imageExt.NewRGB(image.Rect(0, 0, 10, 10)),
 		imageExt.NewRGB48(image.Rect(0, 0, 10, 10)),
 		imageExt.NewRGB96f(image.Rect(0, 0, 10, 10)),
+		imageExt.NewGrayA(image.Rect(0, 0, 10, 10)),
+		imageExt.NewRGBA64(image.Rect(0, 0, 10, 10)),
+		imageExt.NewGray16f(image.Rect(0, 0, 10, 10)),
+		imageExt.NewGrayA32f(image.Rect(0, 0, 10, 10)),
+		imageExt.NewRGB48f(image.Rect(0, 0, 10, 10)),
+		imageExt.NewRGBA64f(image.Rect(0, 0, 10, 10)),
 	}
 	for _, m := range testImage {
 		if !image.Rect(0, 0, 10, 10).Eq(m.Bounds()) {
@@ -77,6 +84,61 @@ func TestImage(t *testing.T) {
 	}
 }
 
+func TestOpaque(t *testing.T) {
+	r := image.Rect(0, 0, 3, 2)
+	for _, m := range []tImage{
+		imageExt.NewGrayA(r),
+		imageExt.NewGrayA32(r),
+		imageExt.NewGrayA64i(r),
+		imageExt.NewGrayA64f(r),
+		imageExt.NewGrayA128i(r),
+		imageExt.NewGrayA128f(r),
+		imageExt.NewRGBA(r),
+		imageExt.NewRGBA64(r),
+		imageExt.NewRGBA128i(r),
+		imageExt.NewRGBA128f(r),
+		imageExt.NewRGBA256i(r),
+		imageExt.NewRGBA256f(r),
+	} {
+		if m.Opaque() {
+			t.Errorf("%T: a transparent image is opaque", m)
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				m.Set(x, y, image.Opaque)
+			}
+		}
+		if !m.Opaque() {
+			t.Errorf("%T: an opaque image is not opaque", m)
+		}
+		m.Set(2, 1, color.NRGBA{R: 0xff, A: 0x80})
+		if m.Opaque() {
+			t.Errorf("%T: an image with a translucent pixel is opaque", m)
+		}
+	}
+}
+
+func TestNewImage(t *testing.T) {
+	r := image.Rect(1, 2, 4, 3)
+	for channels := 1; channels <= 4; channels++ {
+		for _, depth := range []reflect.Kind{
+			reflect.Uint8, reflect.Uint16, imageExt.Float16,
+			reflect.Int32, reflect.Float32, reflect.Int64, reflect.Float64,
+		} {
+			m, err := imageExt.NewImage(r, channels, depth)
+			if err != nil {
+				t.Fatalf("%d channels of %v: %v", channels, depth, err)
+			}
+			if m.Channels() != channels || m.Depth() != depth || m.Bounds() != r {
+				t.Errorf("%d channels of %v: got %T with %d channels of %v", channels, depth, m, m.Channels(), m.Depth())
+			}
+			if m := imageExt.CloneImage(m); m.Channels() != channels || m.Depth() != depth {
+				t.Errorf("%d channels of %v: got a clone %T with %d channels of %v", channels, depth, m, m.Channels(), m.Depth())
+			}
+		}
+	}
+}
+
 func Test16BitsPerColorChannel(t *testing.T) {
 	testColorModel := []color.Model{
 		colorExt.RGB48Model,
@@ -101,3 +163,49 @@ func Test16BitsPerColorChannel(t *testing.T) {
 		}
 	}
 }
+
+func TestFloat16(t *testing.T) {
+	r := image.Rect(0, 0, 3, 2)
+	for channels, want := range []imageExt.Image{
+		1: imageExt.NewGray16f(r),
+		2: imageExt.NewGrayA32f(r),
+		3: imageExt.NewRGB48f(r),
+		4: imageExt.NewRGBA64f(r),
+	} {
+		if want == nil {
+			continue
+		}
+		m, err := imageExt.NewImage(r, channels, imageExt.Float16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.TypeOf(m) != reflect.TypeOf(want) || m.Depth() != imageExt.Float16 || len(m.Pix()) != 2*channels*3*2 {
+			t.Fatalf("%d channels: got %T with depth %v and %d bytes", channels, m, m.Depth(), len(m.Pix()))
+		}
+		if c := imageExt.CloneImage(m); reflect.TypeOf(c) != reflect.TypeOf(want) {
+			t.Fatalf("%d channels: got clone %T", channels, c)
+		}
+	}
+
+	// The samples are big-endian half-precision numbers.
+	m := imageExt.NewRGBA64f(r)
+	m.SetRGBA64f(1, 1, colorExt.RGBA64f{R: 1, G: 0.5, B: -2, A: 65504})
+	want := []byte{0x3c, 0x00, 0x38, 0x00, 0xc0, 0x00, 0x7b, 0xff}
+	if got := m.Pix()[m.PixOffset(1, 1):][:8]; string(got) != string(want) {
+		t.Fatalf("got pixel % x, want % x", got, want)
+	}
+	if c := m.RGBA64fAt(1, 1); c != (colorExt.RGBA64f{R: 1, G: 0.5, B: -2, A: 65504}) {
+		t.Fatalf("got %v", c)
+	}
+
+	// The samples are from 0 to 1, and rounded to half precision.
+	if c := colorExt.Gray16fModel.Convert(color.Gray16{Y: 0x8000}); c != (colorExt.Gray16f{Y: 0.5}) {
+		t.Fatalf("got %v", c)
+	}
+	if c := colorExt.Gray32fModel.Convert(colorExt.Gray16f{Y: 0.5}); c != (colorExt.Gray32f{Y: 0.5 * 0xFFFF}) {
+		t.Fatalf("got %v", c)
+	}
+	if r, g, b, a := (colorExt.RGB48f{R: 2, G: 0.5, B: -1}).RGBA(); r != 0xFFFF || g != 0x8000 || b != 0 || a != 0xFFFF {
+		t.Fatalf("got %#x, %#x, %#x, %#x", r, g, b, a)
+	}
+}
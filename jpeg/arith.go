@@ -0,0 +1,461 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jpeg
+
+// The sizes of the statistics areas of the DC and AC coefficients, which are
+// large enough for the bins of section F.1.4.4.
+const (
+	dcStatBins = 64
+	acStatBins = 256
+)
+
+// qmStates is table D.2 of the spec: the probability estimation state machine
+// of the arithmetic decoder. The last state, which is not part of the spec,
+// has a fixed probability of 0.5, like libjpeg's, and is used to decode the
+// signs of the AC coefficients and the refinement bits of the DC coefficients.
+var qmStates = [...]struct {
+	qe               uint32 // Estimated probability of the LPS.
+	nextLPS, nextMPS uint8  // Next state after an LPS and after an MPS.
+	switchMPS        bool   // Whether the MPS sense switches after an LPS.
+}{
+	{0x5a1d, 1, 1, true}, {0x2586, 14, 2, false}, {0x1114, 16, 3, false}, {0x080b, 18, 4, false},
+	{0x03d8, 20, 5, false}, {0x01da, 23, 6, false}, {0x00e5, 25, 7, false}, {0x006f, 28, 8, false},
+	{0x0036, 30, 9, false}, {0x001a, 33, 10, false}, {0x000d, 35, 11, false}, {0x0006, 9, 12, false},
+	{0x0003, 10, 13, false}, {0x0001, 12, 13, false}, {0x5a7f, 15, 15, true}, {0x3f25, 36, 16, false},
+	{0x2cf2, 38, 17, false}, {0x207c, 39, 18, false}, {0x17b9, 40, 19, false}, {0x1182, 42, 20, false},
+	{0x0cef, 43, 21, false}, {0x09a1, 45, 22, false}, {0x072f, 46, 23, false}, {0x055c, 48, 24, false},
+	{0x0406, 49, 25, false}, {0x0303, 51, 26, false}, {0x0240, 52, 27, false}, {0x01b1, 54, 28, false},
+	{0x0144, 56, 29, false}, {0x00f5, 57, 30, false}, {0x00b7, 59, 31, false}, {0x008a, 60, 32, false},
+	{0x0068, 62, 33, false}, {0x004e, 63, 34, false}, {0x003b, 32, 35, false}, {0x002c, 33, 9, false},
+	{0x5ae1, 37, 37, true}, {0x484c, 64, 38, false}, {0x3a0d, 65, 39, false}, {0x2ef1, 67, 40, false},
+	{0x261f, 68, 41, false}, {0x1f33, 69, 42, false}, {0x19a8, 70, 43, false}, {0x1518, 72, 44, false},
+	{0x1177, 73, 45, false}, {0x0e74, 74, 46, false}, {0x0bfb, 75, 47, false}, {0x09f8, 77, 48, false},
+	{0x0861, 78, 49, false}, {0x0706, 79, 50, false}, {0x05cd, 48, 51, false}, {0x04de, 50, 52, false},
+	{0x040f, 50, 53, false}, {0x0363, 51, 54, false}, {0x02d4, 52, 55, false}, {0x025c, 53, 56, false},
+	{0x01f8, 54, 57, false}, {0x01a4, 55, 58, false}, {0x0160, 56, 59, false}, {0x0125, 57, 60, false},
+	{0x00f6, 58, 61, false}, {0x00cb, 59, 62, false}, {0x00ab, 61, 63, false}, {0x008f, 61, 32, false},
+	{0x5b12, 65, 65, true}, {0x4d04, 80, 66, false}, {0x412c, 81, 67, false}, {0x37d8, 82, 68, false},
+	{0x2fe8, 83, 69, false}, {0x293c, 84, 70, false}, {0x2379, 86, 71, false}, {0x1edf, 87, 72, false},
+	{0x1aa9, 87, 73, false}, {0x174e, 72, 74, false}, {0x1424, 72, 75, false}, {0x119c, 74, 76, false},
+	{0x0f6b, 74, 77, false}, {0x0d51, 75, 78, false}, {0x0bb6, 77, 79, false}, {0x0a40, 77, 48, false},
+	{0x5832, 80, 81, true}, {0x4d1c, 88, 82, false}, {0x438e, 89, 83, false}, {0x3bdd, 90, 84, false},
+	{0x34ee, 91, 85, false}, {0x2eae, 92, 86, false}, {0x299a, 93, 87, false}, {0x2516, 86, 71, false},
+	{0x5570, 88, 89, true}, {0x4ca9, 95, 90, false}, {0x44d9, 96, 91, false}, {0x3e22, 97, 92, false},
+	{0x3824, 99, 93, false}, {0x32b4, 99, 94, false}, {0x2e17, 93, 86, false}, {0x56a8, 95, 96, true},
+	{0x4f46, 101, 97, false}, {0x47e5, 102, 98, false}, {0x41cf, 103, 99, false}, {0x3c3d, 104, 100, false},
+	{0x375e, 99, 93, false}, {0x5231, 105, 102, false}, {0x4c0f, 106, 103, false}, {0x4639, 107, 104, false},
+	{0x415e, 103, 99, false}, {0x5627, 105, 106, true}, {0x50e7, 108, 107, false}, {0x4b85, 109, 103, false},
+	{0x5597, 110, 109, false}, {0x504f, 111, 107, false}, {0x5a10, 110, 111, true}, {0x5522, 112, 109, false},
+	{0x59eb, 112, 111, true},
+	{0x5a1d, 113, 113, false},
+}
+
+// fixedState is the state of the bin with a fixed probability.
+const fixedState = 113
+
+// arithmetic is the state of the arithmetic decoder, specified in section D.2.
+// A statistics bin holds the index of its state in qmStates in its low 7 bits,
+// and the sense of the MPS in its high bit.
+type arithmetic struct {
+	c, a uint32
+	ct   int
+	// marker is whether a marker ended the entropy-coded segment, after which
+	// zeros are decoded.
+	marker bool
+
+	dcStats   [maxTh + 1][dcStatBins]uint8
+	acStats   [maxTh + 1][acStatBins]uint8
+	fixedBin  uint8
+	dcContext [maxComponents]int
+
+	// dcL, dcU and acK are the conditioning parameters of the DAC marker,
+	// specified in section B.2.4.3.
+	dcL, dcU [maxTh + 1]uint8
+	acK      [maxTh + 1]uint8
+}
+
+// errBadArithmeticCode means that an arithmetic-coded value is out of range.
+var errBadArithmeticCode = FormatError("bad arithmetic code")
+
+// setDefaultConditioning sets the conditioning parameters that apply until a
+// DAC marker changes them, as per section F.1.4.4.
+func (a *arithmetic) setDefaultConditioning() {
+	for i := range a.dcL {
+		a.dcL[i], a.dcU[i], a.acK[i] = 0, 1, 5
+	}
+}
+
+// Specified in section B.2.4.3.
+func (d *decoder) processDAC(n int) error {
+	if n%2 != 0 {
+		return FormatError("DAC has wrong length")
+	}
+	for ; n > 0; n -= 2 {
+		if err := d.readFull(d.tmp[:2]); err != nil {
+			return err
+		}
+		tc, tb, cs := d.tmp[0]>>4, d.tmp[0]&0x0f, d.tmp[1]
+		if tb > maxTh {
+			return FormatError("bad Tb value")
+		}
+		switch tc {
+		case dcTable:
+			l, u := cs&0x0f, cs>>4
+			if l > u {
+				return FormatError("bad DAC conditioning values")
+			}
+			d.arith.dcL[tb], d.arith.dcU[tb] = l, u
+		case acTable:
+			if cs < 1 || cs > 63 {
+				return FormatError("bad DAC conditioning values")
+			}
+			d.arith.acK[tb] = cs
+		default:
+			return FormatError("bad Tc value")
+		}
+	}
+	return nil
+}
+
+// resetArith resets the arithmetic decoder and the statistics of the scan's
+// components, at the start of a scan and of each restart interval, as per
+// sections F.2.4 and G.2.
+func (d *decoder) resetArith(scan []scanComponent, zigStart int32, ah uint32) {
+	a := &d.arith
+	for _, s := range scan {
+		if !d.progressive || zigStart == 0 && ah == 0 {
+			a.dcStats[s.td] = [dcStatBins]uint8{}
+			a.dcContext[s.compIndex] = 0
+		}
+		if !d.progressive || zigStart != 0 {
+			a.acStats[s.ta] = [acStatBins]uint8{}
+		}
+	}
+	a.fixedBin = fixedState
+	// A negative ct makes the decoder read the two bytes that initialize
+	// the C register.
+	a.c, a.a, a.ct, a.marker = 0, 0, -16, false
+}
+
+// readArithByte returns the next byte of arithmetic-coded data. Unlike
+// Huffman-coded data, it is valid for a marker to end the data before the
+// decoder has read all of it, in which case the marker is left unread and
+// zeros are returned.
+func (d *decoder) readArithByte() (byte, error) {
+	if d.arith.marker {
+		return 0, nil
+	}
+	x, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	if x != 0xff {
+		return x, nil
+	}
+	for x == 0xff {
+		if x, err = d.readByte(); err != nil {
+			return 0, err
+		}
+	}
+	if x == 0x00 {
+		return 0xff, nil
+	}
+	// The buffer always holds the last two bytes read, as fill keeps them.
+	d.bytes.i -= 2
+	d.arith.marker = true
+	return 0, nil
+}
+
+// decodeArith decodes a binary decision with the statistics bin st, as
+// specified in section D.2.
+func (d *decoder) decodeArith(st *uint8) (int, error) {
+	a := &d.arith
+	// Renormalize and read the data, as per section D.2.6.
+	for a.a < 0x8000 {
+		a.ct--
+		if a.ct < 0 {
+			x, err := d.readArithByte()
+			if err != nil {
+				return 0, err
+			}
+			a.c = a.c<<8 | uint32(x)
+			a.ct += 8
+			if a.ct < 0 {
+				a.ct++
+				if a.ct == 0 {
+					// The two initial bytes are in the C register.
+					a.a = 0x8000
+				}
+			}
+		}
+		a.a <<= 1
+	}
+
+	sv := *st
+	s := &qmStates[sv&0x7f]
+	lps := s.nextLPS
+	if s.switchMPS {
+		lps |= 0x80
+	}
+	// Decode and estimate the probability, as per sections D.2.4 and D.2.5.
+	a.a -= s.qe
+	if temp := a.a << uint(a.ct); a.c >= temp {
+		a.c -= temp
+		// Conditional LPS exchange.
+		if a.a < s.qe {
+			*st = sv&0x80 ^ s.nextMPS
+		} else {
+			*st = sv&0x80 ^ lps
+			sv ^= 0x80
+		}
+		a.a = s.qe
+	} else if a.a < 0x8000 {
+		// Conditional MPS exchange.
+		if a.a < s.qe {
+			*st = sv&0x80 ^ lps
+			sv ^= 0x80
+		} else {
+			*st = sv&0x80 ^ s.nextMPS
+		}
+	}
+	return int(sv >> 7), nil
+}
+
+// decodeArithCategory decodes the rest of the magnitude category of a nonzero
+// value, which is at least m, with the statistics bins from stats[st], as per
+// figure F.23. It returns the category, as a power of two, and the bin that
+// ended it.
+func (d *decoder) decodeArithCategory(stats []uint8, st int, m int32) (int32, int, error) {
+	for {
+		bit, err := d.decodeArith(&stats[st])
+		if err != nil {
+			return 0, 0, err
+		}
+		if bit == 0 {
+			return m, st, nil
+		}
+		if m <<= 1; m == 0x8000 {
+			return 0, 0, errBadArithmeticCode
+		}
+		st++
+	}
+}
+
+// decodeArithMagnitude decodes the magnitude bits of a nonzero value of the
+// category m with the statistics bin st, as per figure F.24, and returns the
+// magnitude.
+func (d *decoder) decodeArithMagnitude(st *uint8, m int32) (int32, error) {
+	v := m
+	for m >>= 1; m != 0; m >>= 1 {
+		bit, err := d.decodeArith(st)
+		if err != nil {
+			return 0, err
+		}
+		if bit != 0 {
+			v |= m
+		}
+	}
+	return v + 1, nil
+}
+
+// decodeArithDC decodes the DC difference of a block of the component with
+// the conditioning table tbl, as specified in section F.2.4.1.
+func (d *decoder) decodeArithDC(compIndex, tbl uint8) (int32, error) {
+	a := &d.arith
+	stats := a.dcStats[tbl][:]
+	st := a.dcContext[compIndex]
+	nonZero, err := d.decodeArith(&stats[st])
+	if err != nil || nonZero == 0 {
+		a.dcContext[compIndex] = 0
+		return 0, err
+	}
+	sign, err := d.decodeArith(&stats[st+1])
+	if err != nil {
+		return 0, err
+	}
+	st += 2 + sign
+	m := int32(0)
+	bit, err := d.decodeArith(&stats[st])
+	if err != nil {
+		return 0, err
+	}
+	if bit != 0 {
+		// Table F.4 puts the bins of the larger categories at X1 = 20.
+		if m, st, err = d.decodeArithCategory(stats, 20, 1); err != nil {
+			return 0, err
+		}
+	}
+	// Set the conditioning category of the next difference, as per section
+	// F.1.4.4.1.2.
+	switch {
+	case m < int32(1)<<a.dcL[tbl]>>1:
+		a.dcContext[compIndex] = 0
+	case m > int32(1)<<a.dcU[tbl]>>1:
+		a.dcContext[compIndex] = 12 + 4*sign
+	default:
+		a.dcContext[compIndex] = 4 + 4*sign
+	}
+	v, err := d.decodeArithMagnitude(&stats[st+14], m)
+	if sign != 0 {
+		v = -v
+	}
+	return v, err
+}
+
+// decodeArithAC decodes the AC coefficients zigStart to zigEnd of a block
+// with the conditioning table tbl, and scales them by 1<<al, as specified in
+// sections F.2.4.2 and G.2.
+func (d *decoder) decodeArithAC(b *block, tbl uint8, zigStart, zigEnd int32, al uint32) error {
+	a := &d.arith
+	stats := a.acStats[tbl][:]
+	for zig := zigStart; zig <= zigEnd; zig++ {
+		st := 3 * int(zig-1)
+		eob, err := d.decodeArith(&stats[st])
+		if err != nil {
+			return err
+		}
+		if eob != 0 {
+			break
+		}
+		for {
+			nonZero, err := d.decodeArith(&stats[st+1])
+			if err != nil {
+				return err
+			}
+			if nonZero != 0 {
+				break
+			}
+			st += 3
+			if zig++; zig > zigEnd {
+				return errBadArithmeticCode
+			}
+		}
+		sign, err := d.decodeArith(&a.fixedBin)
+		if err != nil {
+			return err
+		}
+		st += 2
+		m := int32(0)
+		bit, err := d.decodeArith(&stats[st])
+		if err != nil {
+			return err
+		}
+		if bit != 0 {
+			m = 1
+			if bit, err = d.decodeArith(&stats[st]); err != nil {
+				return err
+			}
+			if bit != 0 {
+				x1 := 217
+				if zig <= int32(a.acK[tbl]) {
+					x1 = 189
+				}
+				if m, st, err = d.decodeArithCategory(stats, x1, 2); err != nil {
+					return err
+				}
+			}
+		}
+		v, err := d.decodeArithMagnitude(&stats[st+14], m)
+		if err != nil {
+			return err
+		}
+		if sign != 0 {
+			v = -v
+		}
+		b[unzig[zig]] = v << al
+	}
+	return nil
+}
+
+// refineArithAC decodes a successive approximation refinement of the AC
+// coefficients zigStart to zigEnd of a block with the conditioning table
+// tbl, as specified in section G.2.
+func (d *decoder) refineArithAC(b *block, tbl uint8, zigStart, zigEnd int32, al uint32) error {
+	a := &d.arith
+	stats := a.acStats[tbl][:]
+	// The end of the block in the previous stages.
+	eobx := zigEnd
+	for ; eobx > 0 && b[unzig[eobx]] == 0; eobx-- {
+	}
+	for zig := zigStart; zig <= zigEnd; zig++ {
+		st := 3 * int(zig-1)
+		if zig > eobx {
+			eob, err := d.decodeArith(&stats[st])
+			if err != nil {
+				return err
+			}
+			if eob != 0 {
+				break
+			}
+		}
+		for {
+			c := &b[unzig[zig]]
+			if *c != 0 {
+				bit, err := d.decodeArith(&stats[st+2])
+				if err != nil {
+					return err
+				}
+				if bit != 0 {
+					if *c < 0 {
+						*c -= 1 << al
+					} else {
+						*c += 1 << al
+					}
+				}
+				break
+			}
+			nonZero, err := d.decodeArith(&stats[st+1])
+			if err != nil {
+				return err
+			}
+			if nonZero != 0 {
+				sign, err := d.decodeArith(&a.fixedBin)
+				if err != nil {
+					return err
+				}
+				*c = 1 << al
+				if sign != 0 {
+					*c = -*c
+				}
+				break
+			}
+			st += 3
+			if zig++; zig > zigEnd {
+				return errBadArithmeticCode
+			}
+		}
+	}
+	return nil
+}
+
+// decodeArithBlock decodes the data of a block in an arithmetic-coded scan.
+// dc is the DC prediction of the block's component.
+func (d *decoder) decodeArithBlock(b *block, s *scanComponent, zigStart, zigEnd int32, ah, al uint32, dc *int32) error {
+	if zigStart == 0 {
+		if ah != 0 {
+			// A DC refinement is the next bit of the coefficient, as per
+			// section G.1.3.1.
+			bit, err := d.decodeArith(&d.arith.fixedBin)
+			if bit != 0 {
+				b[0] |= 1 << al
+			}
+			return err
+		}
+		delta, err := d.decodeArithDC(s.compIndex, s.td)
+		if err != nil {
+			return err
+		}
+		*dc += delta
+		b[0] = *dc << al
+		if zigEnd == 0 {
+			return nil
+		}
+		zigStart = 1
+	}
+	if ah != 0 {
+		return d.refineArithAC(b, s.ta, zigStart, zigEnd, al)
+	}
+	return d.decodeArithAC(b, s.ta, zigStart, zigEnd, al)
+}
@@ -0,0 +1,190 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jpeg
+
+import (
+	"errors"
+	"io"
+)
+
+// Block is the quantized DCT coefficients of an 8x8 block, in natural (not
+// zig-zag) order: Block[8*v+u] is the coefficient of the horizontal frequency
+// u and the vertical frequency v.
+type Block [blockSize]int16
+
+// Component is an image component of a JPEG image.
+type Component struct {
+	ID   uint8 // Component identifier.
+	H, V int   // Horizontal and vertical sampling factors.
+	// Quant is the quantization table, in natural order.
+	Quant [blockSize]uint16
+	// Blocks are the blocks of the component, Stride blocks per row. They
+	// cover the MCU grid, which may extend past the image.
+	Stride int
+	Blocks []Block
+}
+
+// Segment is an APPn or COM marker segment.
+type Segment struct {
+	Marker uint8 // 0xe0 to 0xef for APPn segments and 0xfe for COM segments.
+	Data   []byte
+}
+
+// Coefficients are the quantized DCT coefficients of a JPEG image, which can
+// be transformed and written again without a loss of quality.
+type Coefficients struct {
+	Width, Height int
+	Components    []Component
+	// Segments are the APPn and COM segments of the image, such as the
+	// JFIF, Exif and ICC profile segments, in the order of the file.
+	Segments []Segment
+}
+
+// maxSamplingFactors returns the largest sampling factors of the components,
+// which give the size of the MCUs.
+func (c *Coefficients) maxSamplingFactors() (hmax, vmax int) {
+	for _, comp := range c.Components {
+		if comp.H > hmax {
+			hmax = comp.H
+		}
+		if comp.V > vmax {
+			vmax = comp.V
+		}
+	}
+	return hmax, vmax
+}
+
+// mcuSize returns the number of MCUs per row and column of the image.
+func (c *Coefficients) mcuSize() (mcuX, mcuY int) {
+	hmax, vmax := c.maxSamplingFactors()
+	return (c.Width + 8*hmax - 1) / (8 * hmax), (c.Height + 8*vmax - 1) / (8 * vmax)
+}
+
+// check returns an error if c cannot be encoded.
+func (c *Coefficients) check() error {
+	if c.Width <= 0 || c.Height <= 0 {
+		return errors.New("jpeg: image is empty")
+	}
+	if c.Width >= 1<<16 || c.Height >= 1<<16 {
+		return errors.New("jpeg: image is too large to encode")
+	}
+	if len(c.Components) == 0 || len(c.Components) > maxComponents {
+		return errors.New("jpeg: invalid number of components")
+	}
+	hmax, vmax := c.maxSamplingFactors()
+	mcuX, mcuY := c.mcuSize()
+	totalHV := 0
+	for i, comp := range c.Components {
+		for _, prev := range c.Components[:i] {
+			if comp.ID == prev.ID {
+				return errors.New("jpeg: repeated component identifier")
+			}
+		}
+		if comp.H != 1 && comp.H != 2 && comp.H != 4 || comp.V != 1 && comp.V != 2 && comp.V != 4 ||
+			hmax%comp.H != 0 || vmax%comp.V != 0 {
+			return errors.New("jpeg: invalid sampling factors")
+		}
+		totalHV += comp.H * comp.V
+		if comp.Stride != mcuX*comp.H || len(comp.Blocks) != mcuX*comp.H*mcuY*comp.V {
+			return errors.New("jpeg: invalid number of blocks")
+		}
+		for _, q := range comp.Quant {
+			if q == 0 {
+				return errors.New("jpeg: invalid quantization table")
+			}
+		}
+		// The DC differences and the AC coefficients of 8-bit images have
+		// at most 11 and 10 bits, as per section F.1.2.
+		for j := range comp.Blocks {
+			b := &comp.Blocks[j]
+			if b[0] < -1024 || b[0] > 1023 {
+				return errors.New("jpeg: coefficient out of range")
+			}
+			for _, ac := range b[1:] {
+				if ac < -1023 || ac > 1023 {
+					return errors.New("jpeg: coefficient out of range")
+				}
+			}
+		}
+	}
+	// Section B.2.3 states that if there is more than one component then the
+	// total H*V values in a scan must be <= 10.
+	if len(c.Components) > 1 && totalHV > 10 {
+		return errors.New("jpeg: total sampling factors too large")
+	}
+	for _, s := range c.Segments {
+		if (s.Marker < app0Marker || s.Marker > app15Marker) && s.Marker != comMarker {
+			return errors.New("jpeg: invalid segment marker")
+		}
+		if len(s.Data) > 0xffff-2 {
+			return errors.New("jpeg: segment is too large")
+		}
+	}
+	return nil
+}
+
+// processSegment keeps an APPn or COM segment of length n.
+func (d *decoder) processSegment(marker uint8, n int) error {
+	data := make([]byte, n)
+	if err := d.readFull(data); err != nil {
+		return err
+	}
+	switch {
+	case marker == app0Marker && n >= 5:
+		d.jfif = string(data[:5]) == "JFIF\x00"
+	case marker == app14Marker && n >= 12 && string(data[:5]) == "Adobe":
+		d.adobeTransformValid = true
+		d.adobeTransform = data[11]
+	}
+	d.segments = append(d.segments, Segment{Marker: marker, Data: data})
+	return nil
+}
+
+// DecodeCoefficients reads a JPEG image from r and returns its quantized DCT
+// coefficients, without reconstructing the image. Arithmetic-coded images are
+// supported, but 12-bit images are not.
+func DecodeCoefficients(r io.Reader) (*Coefficients, error) {
+	d := decoder{coeffOnly: true}
+	if _, err := d.decode(r, false); err != nil {
+		return nil, err
+	}
+	if d.precision != 8 {
+		return nil, UnsupportedError("coefficients of 12-bit precision")
+	}
+	c := &Coefficients{
+		Width:      d.width,
+		Height:     d.height,
+		Components: make([]Component, d.nComp),
+		Segments:   d.segments,
+	}
+	mcuX := (d.width + 8*d.maxH - 1) / (8 * d.maxH)
+	mcuY := (d.height + 8*d.maxV - 1) / (8 * d.maxV)
+	for i := range c.Components {
+		dc := &d.comp[i]
+		comp := &c.Components[i]
+		comp.ID, comp.H, comp.V = dc.c, dc.h, dc.v
+		for zig, q := range d.quant[dc.tq] {
+			comp.Quant[unzig[zig]] = uint16(q)
+		}
+		comp.Stride = mcuX * dc.h
+		comp.Blocks = make([]Block, mcuX*dc.h*mcuY*dc.v)
+		for j, b := range d.progCoeffs[i] {
+			for k, x := range b {
+				comp.Blocks[j][k] = int16(x)
+			}
+		}
+	}
+	return c, nil
+}
+
+// EncodeCoefficients writes the coefficients c to w in JPEG format. Only the
+// Progressive, RestartInterval and OptimizeHuffman fields of opt are used.
+// Default parameters are used if a nil *Options is passed.
+func EncodeCoefficients(w io.Writer, c *Coefficients, opt *Options) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return encodeCoefficients(w, c, opt)
+}
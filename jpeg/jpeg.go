@@ -16,8 +16,25 @@ import (
 )
 
 // Options are the encoding and decoding parameters.
+// Quality ranges from 1 to 100 inclusive, higher is better.
 type Options struct {
 	jpeg.Options
+	// Subsampling is the chroma subsampling of color images.
+	Subsampling Subsampling
+	// Progressive selects a progressive image, whose Huffman tables are
+	// always optimized.
+	Progressive bool
+	// RestartInterval is the number of MCUs between restart markers.
+	// Zero means no restart markers.
+	RestartInterval int
+	// OptimizeHuffman selects Huffman tables optimized for the image,
+	// instead of the tables of section K.3 of the spec.
+	OptimizeHuffman bool
+	// LuminanceTable and ChrominanceTable are the quantization tables, in
+	// natural order. They are used unscaled instead of the tables that
+	// Quality selects, if not nil.
+	LuminanceTable   *[64]uint8
+	ChrominanceTable *[64]uint8
 }
 
 func (opt *Options) Lossless() bool {
@@ -31,27 +48,6 @@ func (opt *Options) Quality() float32 {
 	return 0
 }
 
-// DecodeConfig returns the color model and dimensions of a JPEG image without
-// decoding the entire image.
-func DecodeConfig(r io.Reader) (config image.Config, err error) {
-	return jpeg.DecodeConfig(r)
-}
-
-// Decode reads a JPEG image from r and returns it as an image.Image.
-func Decode(r io.Reader) (m image.Image, err error) {
-	return jpeg.Decode(r)
-}
-
-// Encode writes the Image m to w in JPEG 4:2:0 baseline format with the given
-// options. Default parameters are used if a nil *Options is passed.
-func Encode(w io.Writer, m image.Image, opt *Options) error {
-	if opt != nil {
-		return jpeg.Encode(w, m, &opt.Options)
-	} else {
-		return jpeg.Encode(w, m, nil)
-	}
-}
-
 func toOptions(opt imageExt.Options) *Options {
 	if opt, ok := opt.(*Options); ok {
 		return opt
@@ -0,0 +1,149 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jpeg
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// idctCos[x][u] is the basis function C(u)/2 * cos((2x+1)uπ/16) of the 1D
+// inverse DCT of section A.3.3.
+var idctCos = func() (t [8][8]float64) {
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			c := 0.5
+			if u == 0 {
+				c = 0.5 / math.Sqrt2
+			}
+			t[x][u] = c * math.Cos(float64((2*x+1)*u)*math.Pi/16)
+		}
+	}
+	return t
+}()
+
+// idct12 performs a 2D inverse DCT on the dequantized coefficients of a
+// 12-bit block. Unlike idct, whose fixed-point arithmetic is sized for 8-bit
+// samples, it works in floating point.
+func idct12(b *block) {
+	var tmp [blockSize]float64
+	for v := 0; v < 8; v++ {
+		for x := 0; x < 8; x++ {
+			s := 0.0
+			for u := 0; u < 8; u++ {
+				s += idctCos[x][u] * float64(b[8*v+u])
+			}
+			tmp[8*v+x] = s
+		}
+	}
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			s := 0.0
+			for v := 0; v < 8; v++ {
+				s += idctCos[y][v] * tmp[8*v+x]
+			}
+			b[8*y+x] = int32(math.Floor(s + 0.5))
+		}
+	}
+}
+
+// clamp12 level shifts c by +2048 and clips it to [0, 4095].
+func clamp12(c int32) int32 {
+	if c < -2048 {
+		return 0
+	}
+	if c > 2047 {
+		return 4095
+	}
+	return c + 2048
+}
+
+// scale12 scales a 12-bit sample to 16 bits.
+func scale12(c int32) uint16 {
+	return uint16(c<<4 | c>>8)
+}
+
+// ycbcrToRGB12 converts a 12-bit YCbCr triple to RGB, with the fixed-point
+// JFIF conversion of color.YCbCrToRGB.
+func ycbcrToRGB12(y, cb, cr int32) (r, g, b int32) {
+	yy := y<<16 + 1<<15
+	cb -= 2048
+	cr -= 2048
+	r = clamp12((yy+91881*cr)>>16 - 2048)
+	g = clamp12((yy-22554*cb-46802*cr)>>16 - 2048)
+	b = clamp12((yy+116130*cb)>>16 - 2048)
+	return r, g, b
+}
+
+// reconstructBlock12 performs the inverse DCT of a dequantized 12-bit block
+// and stores it to the samples of its component.
+func (d *decoder) reconstructBlock12(b *block, bx, by, compIndex int) {
+	idct12(b)
+	stride := d.stride16[compIndex]
+	dst := d.pix16[compIndex][8*(by*stride+bx):]
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			dst[y*stride+x] = uint16(clamp12(b[8*y+x]))
+		}
+	}
+}
+
+// convert12 converts the 12-bit samples to an *image.Gray16 or, for color
+// images, an *imageExt.RGB48, scaling them to 16 bits and upsampling the
+// subsampled components.
+func (d *decoder) convert12() image.Image {
+	bounds := image.Rect(0, 0, d.width, d.height)
+	if d.nComp == 1 {
+		img := image.NewGray16(bounds)
+		for y := 0; y < d.height; y++ {
+			src, dst := d.pix16[0][y*d.stride16[0]:], img.Pix[y*img.Stride:]
+			for x := 0; x < d.width; x++ {
+				c := scale12(int32(src[x]))
+				dst[2*x+0] = uint8(c >> 8)
+				dst[2*x+1] = uint8(c)
+			}
+		}
+		return img
+	}
+
+	isRGB := d.isRGB()
+	img := imageExt.NewRGB48(bounds)
+	for y := 0; y < d.height; y++ {
+		dst := img.M.Pix[y*img.M.Stride:]
+		for x := 0; x < d.width; x++ {
+			var s [3]int32
+			for i := range s {
+				c := &d.comp[i]
+				s[i] = int32(d.pix16[i][y/c.expandV*d.stride16[i]+x/c.expandH])
+			}
+			if !isRGB {
+				s[0], s[1], s[2] = ycbcrToRGB12(s[0], s[1], s[2])
+			}
+			for i, v := range s {
+				c := scale12(v)
+				dst[6*x+2*i+0] = uint8(c >> 8)
+				dst[6*x+2*i+1] = uint8(c)
+			}
+		}
+	}
+	return img
+}
+
+// config12 returns the configuration of a 12-bit image.
+func (d *decoder) config12() image.Config {
+	var cm color.Model = color.Gray16Model
+	if d.nComp != 1 {
+		cm = colorExt.RGB48Model
+	}
+	return image.Config{
+		ColorModel: cm,
+		Width:      d.width,
+		Height:     d.height,
+	}
+}
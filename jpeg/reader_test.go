@@ -0,0 +1,742 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jpeg
+
+import (
+	"bytes"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// arithEncoder is the arithmetic encoder of section D.1, which the tests use
+// to make arithmetic-coded images.
+type arithEncoder struct {
+	w          *bytes.Buffer
+	c          uint64
+	a          uint32
+	sc, zc, ct int
+	buffer     int
+
+	dcStats   [maxTh + 1][dcStatBins]uint8
+	acStats   [maxTh + 1][acStatBins]uint8
+	fixedBin  uint8
+	dcContext [maxComponents]int
+	lastDC    [maxComponents]int32
+
+	// The conditioning parameters of all tables.
+	dcL, dcU, acK int
+}
+
+func (e *arithEncoder) emitZeros() {
+	for ; e.zc > 0; e.zc-- {
+		e.w.WriteByte(0x00)
+	}
+}
+
+func (e *arithEncoder) emitStuffed(x int) {
+	e.w.WriteByte(byte(x))
+	if x == 0xff {
+		e.w.WriteByte(0x00)
+	}
+}
+
+// encode encodes the binary decision val with the statistics bin st.
+func (e *arithEncoder) encode(st *uint8, val int) {
+	sv := *st
+	s := &qmStates[sv&0x7f]
+	lps := s.nextLPS
+	if s.switchMPS {
+		lps |= 0x80
+	}
+	e.a -= s.qe
+	if val != int(sv>>7) {
+		if e.a >= s.qe {
+			e.c += uint64(e.a)
+			e.a = s.qe
+		}
+		*st = sv&0x80 ^ lps
+	} else {
+		if e.a >= 0x8000 {
+			return
+		}
+		if e.a < s.qe {
+			e.c += uint64(e.a)
+			e.a = s.qe
+		}
+		*st = sv&0x80 ^ s.nextMPS
+	}
+	for e.a < 0x8000 || e.ct == -1 {
+		e.a <<= 1
+		e.c <<= 1
+		if e.ct--; e.ct != 0 {
+			continue
+		}
+		temp := int(e.c >> 19)
+		switch {
+		case temp > 0xff:
+			if e.buffer >= 0 {
+				e.emitZeros()
+				e.emitStuffed(e.buffer + 1)
+			}
+			e.zc += e.sc
+			e.sc = 0
+			e.buffer = temp & 0xff
+		case temp == 0xff:
+			e.sc++
+		default:
+			if e.buffer == 0 {
+				e.zc++
+			} else if e.buffer >= 0 {
+				e.emitZeros()
+				e.w.WriteByte(byte(e.buffer))
+			}
+			if e.sc > 0 {
+				e.emitZeros()
+				for ; e.sc > 0; e.sc-- {
+					e.w.WriteByte(0xff)
+					e.w.WriteByte(0x00)
+				}
+			}
+			e.buffer = temp & 0xff
+		}
+		e.c &= 0x7ffff
+		e.ct += 8
+	}
+}
+
+// finish terminates the entropy-coded segment, as per section D.1.8.
+func (e *arithEncoder) finish() {
+	if temp := (uint64(e.a) - 1 + e.c) & 0xffff0000; temp < e.c {
+		e.c = temp + 0x8000
+	} else {
+		e.c = temp
+	}
+	e.c <<= uint(e.ct)
+	if e.c&0xf8000000 != 0 {
+		if e.buffer >= 0 {
+			e.emitZeros()
+			e.emitStuffed(e.buffer + 1)
+		}
+		e.zc += e.sc
+		e.sc = 0
+	} else {
+		if e.buffer == 0 {
+			e.zc++
+		} else if e.buffer >= 0 {
+			e.emitZeros()
+			e.w.WriteByte(byte(e.buffer))
+		}
+		if e.sc > 0 {
+			e.emitZeros()
+			for ; e.sc > 0; e.sc-- {
+				e.w.WriteByte(0xff)
+				e.w.WriteByte(0x00)
+			}
+		}
+	}
+	if e.c&0x7fff800 != 0 {
+		e.emitZeros()
+		e.emitStuffed(int(e.c>>19) & 0xff)
+		if e.c&0x7f800 != 0 {
+			e.emitStuffed(int(e.c>>11) & 0xff)
+		}
+	}
+}
+
+func (e *arithEncoder) reset(s *arithScan, progressive bool) {
+	for _, ci := range s.comps {
+		if !progressive || s.ss == 0 && s.ah == 0 {
+			e.dcStats[ci] = [dcStatBins]uint8{}
+			e.dcContext[ci] = 0
+			e.lastDC[ci] = 0
+		}
+		if !progressive || s.ss != 0 {
+			e.acStats[ci] = [acStatBins]uint8{}
+		}
+	}
+	e.fixedBin = fixedState
+	e.c, e.a, e.sc, e.zc, e.ct, e.buffer = 0, 0x10000, 0, 0, 11, -1
+}
+
+// encodeMagnitude encodes the magnitude category and bits of v-1 > 0, as per
+// figures F.8 and F.9, with the statistics bin st and then the bins from x1.
+// If x1 < 0, the second bin of the category is stats[st], and the bins of
+// the larger categories start at -x1.
+func (e *arithEncoder) encodeMagnitude(stats []uint8, st, x1 int, v int32) {
+	m := int32(0)
+	if v--; v != 0 {
+		e.encode(&stats[st], 1)
+		m = 1
+		v2 := v >> 1
+		if x1 < 0 && v2 != 0 {
+			e.encode(&stats[st], 1)
+			m <<= 1
+			v2 >>= 1
+			x1 = -x1
+		}
+		if x1 > 0 {
+			st = x1
+			for ; v2 != 0; v2 >>= 1 {
+				e.encode(&stats[st], 1)
+				m <<= 1
+				st++
+			}
+		}
+	}
+	e.encode(&stats[st], 0)
+	for st, m = st+14, m>>1; m != 0; m >>= 1 {
+		bit := 0
+		if m&v != 0 {
+			bit = 1
+		}
+		e.encode(&stats[st], bit)
+	}
+}
+
+func (e *arithEncoder) encodeDC(ci int, v int32) {
+	stats := e.dcStats[ci][:]
+	st := e.dcContext[ci]
+	if v == 0 {
+		e.encode(&stats[st], 0)
+		e.dcContext[ci] = 0
+		return
+	}
+	e.encode(&stats[st], 1)
+	sign := 0
+	if v < 0 {
+		v, sign = -v, 1
+	}
+	e.encode(&stats[st+1], sign)
+	m := int32(0)
+	for x := (v - 1) >> 1; x != 0; x >>= 1 {
+		m++
+	}
+	if v > 1 {
+		m = 1 << uint(m)
+	}
+	switch {
+	case m < int32(1)<<uint(e.dcL)>>1:
+		e.dcContext[ci] = 0
+	case m > int32(1)<<uint(e.dcU)>>1:
+		e.dcContext[ci] = 12 + 4*sign
+	default:
+		e.dcContext[ci] = 4 + 4*sign
+	}
+	e.encodeMagnitude(stats, st+2+sign, 20, v)
+}
+
+func (e *arithEncoder) encodeAC(b *Block, ci, ss, se int, al uint) {
+	stats := e.acStats[ci][:]
+	coef := func(k int) int32 {
+		if v := int32(b[unzig[k]]); v < 0 {
+			return -(-v >> al)
+		} else {
+			return v >> al
+		}
+	}
+	ke := se
+	for ke >= ss && coef(ke) == 0 {
+		ke--
+	}
+	k := ss
+	for ; k <= ke; k++ {
+		st := 3 * (k - 1)
+		e.encode(&stats[st], 0)
+		for coef(k) == 0 {
+			e.encode(&stats[st+1], 0)
+			st += 3
+			k++
+		}
+		e.encode(&stats[st+1], 1)
+		v, sign := coef(k), 0
+		if v < 0 {
+			v, sign = -v, 1
+		}
+		e.encode(&e.fixedBin, sign)
+		x1 := 217
+		if k <= e.acK {
+			x1 = 189
+		}
+		e.encodeMagnitude(stats, st+2, -x1, v)
+	}
+	if k <= se {
+		e.encode(&stats[3*(k-1)], 1)
+	}
+}
+
+func (e *arithEncoder) refineAC(b *Block, ci, ss, se int, al uint) {
+	stats := e.acStats[ci][:]
+	abs := func(k int) int32 {
+		if v := int32(b[unzig[k]]); v < 0 {
+			return -v
+		} else {
+			return v
+		}
+	}
+	ke := se
+	for ke >= ss && abs(ke)>>al == 0 {
+		ke--
+	}
+	kex := ke
+	for kex >= ss && abs(kex)>>(al+1) == 0 {
+		kex--
+	}
+	k := ss
+	for ; k <= ke; k++ {
+		st := 3 * (k - 1)
+		if k > kex {
+			e.encode(&stats[st], 0)
+		}
+		for {
+			if v := abs(k) >> al; v>>1 != 0 {
+				e.encode(&stats[st+2], int(v&1))
+				break
+			} else if v != 0 {
+				e.encode(&stats[st+1], 1)
+				sign := 0
+				if b[unzig[k]] < 0 {
+					sign = 1
+				}
+				e.encode(&e.fixedBin, sign)
+				break
+			}
+			e.encode(&stats[st+1], 0)
+			st += 3
+			k++
+		}
+	}
+	if k <= se {
+		e.encode(&stats[3*(k-1)], 1)
+	}
+}
+
+type arithScan struct {
+	comps          []int
+	ss, se, ah, al int
+}
+
+func (e *arithEncoder) encodeBlock(b *Block, ci int, s *arithScan) {
+	al := uint(s.al)
+	switch {
+	case s.ss == 0 && s.ah == 0:
+		dc := int32(b[0]) >> al
+		e.encodeDC(ci, dc-e.lastDC[ci])
+		e.lastDC[ci] = dc
+		if s.se > 0 {
+			e.encodeAC(b, ci, 1, s.se, al)
+		}
+	case s.ss == 0:
+		e.encode(&e.fixedBin, int(int32(b[0])>>al)&1)
+	case s.ah == 0:
+		e.encodeAC(b, ci, s.ss, s.se, al)
+	default:
+		e.refineAC(b, ci, s.ss, s.se, al)
+	}
+}
+
+func writeSegment(w *bytes.Buffer, marker uint8, data []byte) {
+	w.Write([]byte{0xff, marker, uint8((len(data) + 2) >> 8), uint8(len(data) + 2)})
+	w.Write(data)
+}
+
+// encodeArithmetic writes c as an arithmetic-coded image of the given
+// precision, with a restart marker every ri MCUs.
+func encodeArithmetic(c *Coefficients, precision int, progressive bool, ri int) []byte {
+	var w bytes.Buffer
+	e := &arithEncoder{w: &w, dcL: 1, dcU: 3, acK: 12}
+	w.Write([]byte{0xff, soiMarker})
+	for _, s := range c.Segments {
+		writeSegment(&w, s.Marker, s.Data)
+	}
+	var dac []byte
+	for i, comp := range c.Components {
+		dqt := []byte{uint8(0x10 | i)}
+		for zig := 0; zig < blockSize; zig++ {
+			q := comp.Quant[unzig[zig]]
+			dqt = append(dqt, uint8(q>>8), uint8(q))
+		}
+		writeSegment(&w, dqtMarker, dqt)
+		dac = append(dac, uint8(i), uint8(e.dcU<<4|e.dcL), uint8(0x10|i), uint8(e.acK))
+	}
+	writeSegment(&w, dacMarker, dac)
+	sof := []byte{uint8(precision), uint8(c.Height >> 8), uint8(c.Height), uint8(c.Width >> 8), uint8(c.Width), uint8(len(c.Components))}
+	for i, comp := range c.Components {
+		sof = append(sof, comp.ID, uint8(comp.H<<4|comp.V), uint8(i))
+	}
+	marker := uint8(sof9Marker)
+	if progressive {
+		marker = sof10Marker
+	}
+	writeSegment(&w, marker, sof)
+	if ri > 0 {
+		writeSegment(&w, driMarker, []byte{uint8(ri >> 8), uint8(ri)})
+	}
+
+	all := make([]int, len(c.Components))
+	for i := range all {
+		all[i] = i
+	}
+	scans := []arithScan{{all, 0, blockSize - 1, 0, 0}}
+	if progressive {
+		scans = []arithScan{{all, 0, 0, 0, 1}, {all, 0, 0, 1, 0}}
+		for i := range c.Components {
+			scans = append(scans,
+				arithScan{[]int{i}, 1, 5, 0, 1},
+				arithScan{[]int{i}, 6, blockSize - 1, 0, 1},
+				arithScan{[]int{i}, 1, blockSize - 1, 1, 0},
+			)
+		}
+	}
+	hmax, vmax := c.maxSamplingFactors()
+	mcuX, mcuY := c.mcuSize()
+	for _, s := range scans {
+		sos := []byte{uint8(len(s.comps))}
+		for _, i := range s.comps {
+			sos = append(sos, c.Components[i].ID, uint8(i<<4|i))
+		}
+		sos = append(sos, uint8(s.ss), uint8(s.se), uint8(s.ah<<4|s.al))
+		writeSegment(&w, sosMarker, sos)
+		e.reset(&s, progressive)
+		n := 0
+		unit := func() {
+			if ri > 0 && n > 0 && n%ri == 0 {
+				e.finish()
+				w.Write([]byte{0xff, uint8(rst0Marker + (n/ri-1)%8)})
+				e.reset(&s, progressive)
+			}
+			n++
+		}
+		if len(s.comps) == 1 {
+			i := s.comps[0]
+			comp := &c.Components[i]
+			if len(c.Components) == 1 {
+				comp.H, comp.V = 1, 1
+			}
+			bw := ((c.Width*comp.H+hmax-1)/hmax + 7) / 8
+			bh := ((c.Height*comp.V+vmax-1)/vmax + 7) / 8
+			for by := 0; by < bh; by++ {
+				for bx := 0; bx < bw; bx++ {
+					unit()
+					e.encodeBlock(&comp.Blocks[by*comp.Stride+bx], i, &s)
+				}
+			}
+		} else {
+			for my := 0; my < mcuY; my++ {
+				for mx := 0; mx < mcuX; mx++ {
+					unit()
+					for _, i := range s.comps {
+						comp := &c.Components[i]
+						for y := 0; y < comp.V; y++ {
+							for x := 0; x < comp.H; x++ {
+								e.encodeBlock(&comp.Blocks[(my*comp.V+y)*comp.Stride+mx*comp.H+x], i, &s)
+							}
+						}
+					}
+				}
+			}
+		}
+		e.finish()
+	}
+	w.Write([]byte{0xff, eoiMarker})
+	return w.Bytes()
+}
+
+func TestDecodeArithmetic(t *testing.T) {
+	for _, filename := range []string{
+		"video-001.q50.420.jpeg",
+		"video-001.q50.422.progressive.jpeg",
+		"video-001.q50.444.jpeg",
+		"video-005.gray.q50.jpeg",
+	} {
+		data, err := ioutil.ReadFile(testdataDir + filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := DecodeCoefficients(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		want, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		for _, progressive := range []bool{false, true} {
+			for _, ri := range []int{0, 3} {
+				arith := encodeArithmetic(c, 8, progressive, ri)
+				m, err := Decode(bytes.NewReader(arith))
+				if err != nil {
+					t.Fatalf("%s: progressive %v, restart interval %d: %v", filename, progressive, ri, err)
+				}
+				if d := averageDelta(want, m); d != 0 {
+					t.Fatalf("%s: progressive %v, restart interval %d: average delta %d", filename, progressive, ri, d)
+				}
+				c1, err := DecodeCoefficients(bytes.NewReader(arith))
+				if err != nil {
+					t.Fatalf("%s: progressive %v, restart interval %d: %v", filename, progressive, ri, err)
+				}
+				if !reflect.DeepEqual(c, c1) {
+					t.Fatalf("%s: progressive %v, restart interval %d: coefficients differ", filename, progressive, ri)
+				}
+			}
+		}
+	}
+}
+
+// sampleChecksum returns the CRC-32 checksum of the samples of a YCbCr or
+// gray image, row by row.
+func sampleChecksum(m image.Image) uint32 {
+	h := crc32.NewIEEE()
+	b := m.Bounds()
+	switch m := m.(type) {
+	case *image.YCbCr:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			h.Write(m.Y[m.YOffset(b.Min.X, y):][:b.Dx()])
+		}
+		cw := m.COffset(b.Max.X-1, b.Min.Y) - m.COffset(b.Min.X, b.Min.Y) + 1
+		for _, p := range [][]byte{m.Cb, m.Cr} {
+			prev := -1
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				if i := m.COffset(b.Min.X, y); i != prev {
+					h.Write(p[i:][:cw])
+					prev = i
+				}
+			}
+		}
+	case *image.Gray:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			h.Write(m.Pix[m.PixOffset(b.Min.X, y):][:b.Dx()])
+		}
+	}
+	return h.Sum32()
+}
+
+func TestDecodeArithmeticLibjpeg(t *testing.T) {
+	// The arithmetic-coded files were transcoded losslessly from the
+	// Huffman-coded ones by libjpeg-turbo 2.1.5, as jpegtran -arithmetic
+	// does. The checksums are those of the samples decoded by image/jpeg
+	// from the Huffman-coded files.
+	for _, tc := range []struct {
+		filename, huffman string
+		checksum          uint32
+	}{
+		{"video-001.q50.420.arith.jpeg", "video-001.q50.420.jpeg", 0x20070f5b},
+		// Progressive, with a restart interval of 4 MCUs.
+		{"video-001.q50.422.progressive.arith.jpeg", "video-001.q50.422.progressive.jpeg", 0x93ff331a},
+		// With a restart interval of 7 MCUs.
+		{"video-005.gray.q50.arith.jpeg", "video-005.gray.q50.jpeg", 0x31175752},
+	} {
+		data, err := ioutil.ReadFile(testdataDir + tc.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		huffman, err := ioutil.ReadFile(testdataDir + tc.huffman)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.filename, err)
+		}
+		want, err := jpeg.Decode(bytes.NewReader(huffman))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.huffman, err)
+		}
+		if got := sampleChecksum(want); got != tc.checksum {
+			t.Fatalf("%s: got checksum %#08x, want %#08x", tc.huffman, got, tc.checksum)
+		}
+		if got := sampleChecksum(m); got != tc.checksum {
+			t.Fatalf("%s: got checksum %#08x, want %#08x", tc.filename, got, tc.checksum)
+		}
+		c, err := DecodeCoefficients(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.filename, err)
+		}
+		c1, err := DecodeCoefficients(bytes.NewReader(huffman))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.huffman, err)
+		}
+		for i := range c.Components {
+			if !reflect.DeepEqual(c.Components[i].Blocks, c1.Components[i].Blocks) {
+				t.Fatalf("%s: the coefficients of component %d differ", tc.filename, i)
+			}
+		}
+	}
+}
+
+// scaleTo12Bit multiplies the coefficients of c by 16, which scales the
+// samples from 8 to 12 bits.
+func scaleTo12Bit(c *Coefficients) {
+	for i := range c.Components {
+		for j := range c.Components[i].Blocks {
+			b := &c.Components[i].Blocks[j]
+			for k := range b {
+				b[k] *= 16
+			}
+		}
+	}
+}
+
+// encode12BitHuffman writes c, whose coefficients are those of a 12-bit
+// image, as an extended Huffman-coded image.
+func encode12BitHuffman(c *Coefficients) ([]byte, error) {
+	var b bytes.Buffer
+	if err := encodeCoefficients(&b, c, &Options{OptimizeHuffman: true}); err != nil {
+		return nil, err
+	}
+	data := b.Bytes()
+	i := bytes.Index(data, []byte{0xff, sof0Marker})
+	data[i+1], data[i+4] = sof1Marker, 12
+	return data, nil
+}
+
+func TestDecode12Bit(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		cm       color.Model
+	}{
+		{"video-001.q50.420.jpeg", colorExt.RGB48Model},
+		{"video-001.q50.444.progressive.jpeg", colorExt.RGB48Model},
+		{"video-005.gray.q50.jpeg", color.Gray16Model},
+	} {
+		c, want, err := decodeFile(testdataDir + tc.filename)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.filename, err)
+		}
+		scaleTo12Bit(c)
+		huffman, err := encode12BitHuffman(c)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.filename, err)
+		}
+		for _, data := range [][]byte{
+			huffman,
+			encodeArithmetic(c, 12, false, 0),
+			encodeArithmetic(c, 12, true, 5),
+		} {
+			m, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: %v", tc.filename, err)
+			}
+			switch m.(type) {
+			case *image.Gray16, *imageExt.RGB48:
+			default:
+				t.Fatalf("%s: got %T", tc.filename, m)
+			}
+			if m.Bounds() != want.Bounds() {
+				t.Fatalf("%s: got bounds %v", tc.filename, m.Bounds())
+			}
+			if d := averageDelta(want, m); d > 1<<8 {
+				t.Fatalf("%s: average delta is too high: %d", tc.filename, d)
+			}
+			config, err := DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: %v", tc.filename, err)
+			}
+			if config.ColorModel != tc.cm || config.Width != c.Width || config.Height != c.Height {
+				t.Fatalf("%s: got config %+v", tc.filename, config)
+			}
+			if _, err := DecodeCoefficients(bytes.NewReader(data)); err == nil {
+				t.Fatalf("%s: decoding 12-bit coefficients succeeded", tc.filename)
+			}
+		}
+	}
+
+	// Baseline images have 8-bit precision.
+	data, err := ioutil.ReadFile(testdataDir + "video-005.gray.q50.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte{0xff, sof0Marker})
+	data[i+4] = 12
+	if _, err := Decode(bytes.NewReader(data)); err == nil {
+		t.Fatal("decoding a 12-bit baseline image succeeded")
+	}
+}
+
+func TestDecodeCMYK(t *testing.T) {
+	c, m0, err := decodeFile(testdataDir + "video-001.q50.444.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ycbcr := m0.(*image.YCbCr)
+	k := c.Components[0]
+	k.ID = 4
+	c.Components = append(c.Components, k)
+	for _, transform := range []uint8{adobeTransformUnknown, adobeTransformYCbCrK} {
+		c.Segments = []Segment{{Marker: app14Marker, Data: []byte{'A', 'd', 'o', 'b', 'e', 0, 100, 0, 0, 0, 0, transform}}}
+		var b bytes.Buffer
+		if err := EncodeCoefficients(&b, c, nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range [][]byte{b.Bytes(), encodeArithmetic(c, 8, true, 0)} {
+			m, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("transform %d: %v", transform, err)
+			}
+			cmyk, ok := m.(*image.CMYK)
+			if !ok {
+				t.Fatalf("transform %d: got %T", transform, m)
+			}
+			for y := 0; y < c.Height; y++ {
+				for x := 0; x < c.Width; x++ {
+					yy := ycbcr.Y[ycbcr.YOffset(x, y)]
+					cb := ycbcr.Cb[ycbcr.COffset(x, y)]
+					cr := ycbcr.Cr[ycbcr.COffset(x, y)]
+					// Adobe CMYK images are inverted, and the YCbCr
+					// channels of YCCK images are the inverted CMY.
+					want := color.CMYK{255 - yy, 255 - cb, 255 - cr, 255 - yy}
+					if transform == adobeTransformYCbCrK {
+						want.C, want.M, want.Y = color.YCbCrToRGB(yy, cb, cr)
+					}
+					if got := cmyk.CMYKAt(x, y); got != want {
+						t.Fatalf("transform %d: (%d, %d): got %v, want %v", transform, x, y, got, want)
+					}
+				}
+			}
+			config, err := DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.ColorModel != color.CMYKModel {
+				t.Fatalf("transform %d: got color model %v", transform, config.ColorModel)
+			}
+		}
+	}
+}
+
+func TestDecodeProgressiveRestartInterval(t *testing.T) {
+	m0, err := readPNG(testdataDir + "video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var baseline, progressive bytes.Buffer
+	if err := Encode(&baseline, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	opt := &Options{Options: jpeg.Options{Quality: jpeg.DefaultQuality}, Progressive: true, RestartInterval: 3}
+	if err := Encode(&progressive, m0, opt); err != nil {
+		t.Fatal(err)
+	}
+	want, err := jpeg.Decode(&baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The restart intervals of the non-interleaved scans count blocks, not
+	// the 16x16 MCUs of the interleaved scans.
+	m1, err := Decode(&progressive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := averageDelta(want, m1); d != 0 {
+		t.Fatalf("average delta %d", d)
+	}
+}
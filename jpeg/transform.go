@@ -0,0 +1,268 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jpeg
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+// Transform is a lossless transformation of a JPEG image, with the same
+// meaning as that of jpegtran.
+type Transform int
+
+const (
+	TransformNone  Transform = iota
+	FlipHorizontal           // Mirror left to right.
+	FlipVertical             // Mirror top to bottom.
+	Transpose                // Mirror across the top-left to bottom-right diagonal.
+	Transverse               // Mirror across the top-right to bottom-left diagonal.
+	Rotate90                 // Rotate 90 degrees clockwise.
+	Rotate180                // Rotate 180 degrees.
+	Rotate270                // Rotate 270 degrees clockwise.
+)
+
+// transformOps are the transposition, and then the horizontal and vertical
+// flips, that make up each Transform.
+var transformOps = [...][3]bool{
+	TransformNone:  {false, false, false},
+	FlipHorizontal: {false, true, false},
+	FlipVertical:   {false, false, true},
+	Transpose:      {true, false, false},
+	Transverse:     {true, true, true},
+	Rotate90:       {true, true, false},
+	Rotate180:      {false, true, true},
+	Rotate270:      {true, false, true},
+}
+
+// transformBlock transposes and flips the block src into dst. Flipping a
+// block negates the coefficients of the odd frequencies along the flipped
+// axis.
+func transformBlock(dst, src *Block, transpose, flipX, flipY bool) {
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			x := src[8*v+u]
+			du, dv := u, v
+			if transpose {
+				du, dv = v, u
+			}
+			if flipX && du%2 == 1 {
+				x = -x
+			}
+			if flipY && dv%2 == 1 {
+				x = -x
+			}
+			dst[8*dv+du] = x
+		}
+	}
+}
+
+// Transform returns the image transformed by t. Partial MCUs at the right
+// and bottom edges cannot be moved to the left or top edges, so they are
+// trimmed off the edges that t moves there, like jpegtran -trim does.
+func (c *Coefficients) Transform(t Transform) (*Coefficients, error) {
+	if t < 0 || int(t) >= len(transformOps) {
+		return nil, errors.New("jpeg: invalid transform")
+	}
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	transpose, flipX, flipY := transformOps[t][0], transformOps[t][1], transformOps[t][2]
+	srcFlipX, srcFlipY := flipX, flipY
+	if transpose {
+		srcFlipX, srcFlipY = flipY, flipX
+	}
+	hmax, vmax := c.maxSamplingFactors()
+	w, h := c.Width, c.Height
+	if srcFlipX {
+		w -= w % (8 * hmax)
+	}
+	if srcFlipY {
+		h -= h % (8 * vmax)
+	}
+	if w == 0 || h == 0 {
+		return nil, errors.New("jpeg: image is too small to transform")
+	}
+	mcuX := (w + 8*hmax - 1) / (8 * hmax)
+	mcuY := (h + 8*vmax - 1) / (8 * vmax)
+
+	dst := &Coefficients{
+		Width:      w,
+		Height:     h,
+		Components: make([]Component, len(c.Components)),
+		Segments:   append([]Segment(nil), c.Segments...),
+	}
+	if transpose {
+		dst.Width, dst.Height = h, w
+	}
+	for i := range c.Components {
+		src, d := &c.Components[i], &dst.Components[i]
+		sbw, sbh := mcuX*src.H, mcuY*src.V
+		dbw, dbh := sbw, sbh
+		d.ID, d.H, d.V, d.Quant = src.ID, src.H, src.V, src.Quant
+		if transpose {
+			// The sampling factors and quantization tables are
+			// transposed too.
+			d.H, d.V = src.V, src.H
+			dbw, dbh = sbh, sbw
+			for v := 0; v < 8; v++ {
+				for u := 0; u < 8; u++ {
+					d.Quant[8*u+v] = src.Quant[8*v+u]
+				}
+			}
+		}
+		d.Stride = dbw
+		d.Blocks = make([]Block, dbw*dbh)
+		for sy := 0; sy < sbh; sy++ {
+			for sx := 0; sx < sbw; sx++ {
+				x, y := sx, sy
+				if transpose {
+					x, y = sy, sx
+				}
+				if flipX {
+					x = dbw - 1 - x
+				}
+				if flipY {
+					y = dbh - 1 - y
+				}
+				transformBlock(&d.Blocks[y*dbw+x], &src.Blocks[sy*src.Stride+sx], transpose, flipX, flipY)
+			}
+		}
+	}
+	return dst, nil
+}
+
+// Crop returns the part of the image within r. The top-left corner of r is
+// moved up and left to the nearest MCU boundary, since the image can only be
+// cut along the MCU grid without a loss of quality.
+func (c *Coefficients) Crop(r image.Rectangle) (*Coefficients, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	r = r.Intersect(image.Rect(0, 0, c.Width, c.Height))
+	if r.Empty() {
+		return nil, errors.New("jpeg: crop rectangle is outside the image")
+	}
+	hmax, vmax := c.maxSamplingFactors()
+	x0, y0 := r.Min.X/(8*hmax), r.Min.Y/(8*vmax)
+	dst := &Coefficients{
+		Width:      r.Max.X - 8*hmax*x0,
+		Height:     r.Max.Y - 8*vmax*y0,
+		Components: make([]Component, len(c.Components)),
+		Segments:   append([]Segment(nil), c.Segments...),
+	}
+	mcuX := (dst.Width + 8*hmax - 1) / (8 * hmax)
+	mcuY := (dst.Height + 8*vmax - 1) / (8 * vmax)
+	for i := range c.Components {
+		src, d := &c.Components[i], &dst.Components[i]
+		d.ID, d.H, d.V, d.Quant = src.ID, src.H, src.V, src.Quant
+		d.Stride = mcuX * d.H
+		d.Blocks = make([]Block, d.Stride*mcuY*d.V)
+		for y := 0; y < mcuY*d.V; y++ {
+			i := (y0*d.V+y)*src.Stride + x0*d.H
+			copy(d.Blocks[y*d.Stride:(y+1)*d.Stride], src.Blocks[i:])
+		}
+	}
+	return dst, nil
+}
+
+// isYCbCr reports whether c is a color image in the YCbCr color space, using
+// the same rules as the decoder.
+func (c *Coefficients) isYCbCr() bool {
+	if len(c.Components) != 3 {
+		return false
+	}
+	jfif, adobeTransform := false, -1
+	for _, s := range c.Segments {
+		switch {
+		case s.Marker == app0Marker && len(s.Data) >= 5:
+			jfif = string(s.Data[:5]) == "JFIF\x00"
+		case s.Marker == app14Marker && len(s.Data) >= 12 && string(s.Data[:5]) == "Adobe":
+			adobeTransform = int(s.Data[11])
+		}
+	}
+	if jfif {
+		return true
+	}
+	if adobeTransform == adobeTransformUnknown {
+		return false
+	}
+	return c.Components[0].ID != 'R' || c.Components[1].ID != 'G' || c.Components[2].ID != 'B'
+}
+
+// Grayscale returns the luminance component of a YCbCr image, as a grayscale
+// image.
+func (c *Coefficients) Grayscale() (*Coefficients, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	if len(c.Components) != 1 && !c.isYCbCr() {
+		return nil, errors.New("jpeg: image is not a YCbCr image")
+	}
+	// A single component is not interleaved, so its blocks are laid out
+	// as if it had no subsampling.
+	src := &c.Components[0]
+	bw, bh := (c.Width+7)/8, (c.Height+7)/8
+	dst := &Coefficients{
+		Width:  c.Width,
+		Height: c.Height,
+		Components: []Component{{
+			ID:     src.ID,
+			H:      1,
+			V:      1,
+			Quant:  src.Quant,
+			Stride: bw,
+			Blocks: make([]Block, bw*bh),
+		}},
+		Segments: append([]Segment(nil), c.Segments...),
+	}
+	for y := 0; y < bh; y++ {
+		copy(dst.Components[0].Blocks[y*bw:(y+1)*bw], src.Blocks[y*src.Stride:])
+	}
+	return dst, nil
+}
+
+// TransformOptions are the parameters of Transcode.
+type TransformOptions struct {
+	Grayscale bool      // Whether to keep the luminance only.
+	Transform Transform // The transformation.
+	// Crop is the part of the transformed image to keep, or the whole image
+	// if it is empty.
+	Crop image.Rectangle
+	// Options are the encoding parameters of the result, of which only
+	// the Progressive, RestartInterval and OptimizeHuffman fields are used.
+	Options *Options
+}
+
+// Transcode reads a JPEG image from r, and writes it to w after converting it
+// to grayscale, transforming it and cropping it as opt says, without a loss of
+// quality. The APPn and COM segments are copied. Default parameters, which
+// copy the image, are used if a nil *TransformOptions is passed.
+func Transcode(w io.Writer, r io.Reader, opt *TransformOptions) error {
+	if opt == nil {
+		opt = new(TransformOptions)
+	}
+	c, err := DecodeCoefficients(r)
+	if err != nil {
+		return err
+	}
+	if opt.Grayscale {
+		if c, err = c.Grayscale(); err != nil {
+			return err
+		}
+	}
+	if opt.Transform != TransformNone {
+		if c, err = c.Transform(opt.Transform); err != nil {
+			return err
+		}
+	}
+	if !opt.Crop.Empty() {
+		if c, err = c.Crop(opt.Crop); err != nil {
+			return err
+		}
+	}
+	return EncodeCoefficients(w, c, opt.Options)
+}
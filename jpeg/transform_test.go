@@ -0,0 +1,273 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jpeg
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+var transformTestFiles = []string{
+	"video-001.jpeg",
+	"video-001.progressive.jpeg",
+	"video-001.q50.420.jpeg",
+	"video-001.q50.422.progressive.jpeg",
+	"video-001.q50.440.jpeg",
+	"video-001.q50.444.jpeg",
+	"video-005.gray.q50.2x2.jpeg",
+	"video-005.gray.q50.progressive.jpeg",
+}
+
+func decodeFile(filename string) (*Coefficients, image.Image, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := DecodeCoefficients(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := jpeg.Decode(bytes.NewReader(data))
+	return c, m, err
+}
+
+func encodeCoefficientsDecode(c *Coefficients, opt *Options) (image.Image, error) {
+	var b bytes.Buffer
+	if err := EncodeCoefficients(&b, c, opt); err != nil {
+		return nil, err
+	}
+	return jpeg.Decode(&b)
+}
+
+// maxDelta returns the largest delta of a channel in RGB space between the
+// pixels of m1 and the pixels of m0 at the positions given by f.
+func maxDelta(m0, m1 image.Image, f func(x, y int) (int, int)) int64 {
+	var max int64
+	b := m1.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r0, g0, b0, _ := m0.At(f(x, y)).RGBA()
+			r1, g1, b1, _ := m1.At(x, y).RGBA()
+			for _, d := range []int64{delta(r0, r1), delta(g0, g1), delta(b0, b1)} {
+				if d > max {
+					max = d
+				}
+			}
+		}
+	}
+	return max
+}
+
+func TestCoefficients(t *testing.T) {
+	for _, filename := range transformTestFiles {
+		c, m0, err := decodeFile(testdataDir + filename)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		if c.Width != m0.Bounds().Dx() || c.Height != m0.Bounds().Dy() {
+			t.Fatalf("%s: got size %dx%d", filename, c.Width, c.Height)
+		}
+		for _, opt := range []*Options{
+			nil,
+			{Progressive: true},
+			{OptimizeHuffman: true, RestartInterval: 2},
+		} {
+			m1, err := encodeCoefficientsDecode(c, opt)
+			if err != nil {
+				t.Fatalf("%s: %+v: %v", filename, opt, err)
+			}
+			if d := averageDelta(m0, m1); d != 0 {
+				t.Fatalf("%s: %+v: average delta %d", filename, opt, d)
+			}
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	for _, filename := range transformTestFiles {
+		c, m0, err := decodeFile(testdataDir + filename)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		for tr := TransformNone; tr <= Rotate270; tr++ {
+			c1, err := c.Transform(tr)
+			if err != nil {
+				t.Fatalf("%s: %d: %v", filename, tr, err)
+			}
+			m1, err := encodeCoefficientsDecode(c1, nil)
+			if err != nil {
+				t.Fatalf("%s: %d: %v", filename, tr, err)
+			}
+			transpose, flipX, flipY := transformOps[tr][0], transformOps[tr][1], transformOps[tr][2]
+			w, h := m1.Bounds().Dx(), m1.Bounds().Dy()
+			if transpose {
+				w, h = h, w
+			}
+			if w > c.Width || h > c.Height || c.Width-w >= 16 || c.Height-h >= 16 {
+				t.Fatalf("%s: %d: got size %v", filename, tr, m1.Bounds())
+			}
+			d := maxDelta(m0, m1, func(x, y int) (int, int) {
+				if flipX {
+					x = m1.Bounds().Dx() - 1 - x
+				}
+				if flipY {
+					y = m1.Bounds().Dy() - 1 - y
+				}
+				if transpose {
+					x, y = y, x
+				}
+				return x, y
+			})
+			// The inverse DCT rounds differently along each axis, and the
+			// color conversion magnifies the rounding errors.
+			if d > 4<<8 {
+				t.Fatalf("%s: %d: max delta is too high: %d", filename, tr, d)
+			}
+		}
+	}
+}
+
+func TestTransformInverse(t *testing.T) {
+	c, _, err := decodeFile(testdataDir + "video-001.q50.420.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Trim the image to whole MCUs so that no transform trims it further.
+	if c, err = c.Crop(image.Rect(0, 0, c.Width&^15, c.Height&^15)); err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range [][]Transform{
+		{Rotate90, Rotate90, Rotate90, Rotate90},
+		{Rotate90, Rotate270},
+		{Rotate180, Rotate180},
+		{Rotate90, FlipHorizontal, Transpose},
+		{FlipHorizontal, FlipVertical, Rotate180},
+		{Transverse, Transverse},
+	} {
+		c1 := c
+		for _, tr := range seq {
+			if c1, err = c1.Transform(tr); err != nil {
+				t.Fatalf("%v: %v", seq, err)
+			}
+		}
+		if !reflect.DeepEqual(c, c1) {
+			t.Fatalf("%v: not the identity", seq)
+		}
+	}
+}
+
+func TestCrop(t *testing.T) {
+	c, m0, err := decodeFile(testdataDir + "video-001.q50.420.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, err := c.Crop(image.Rect(20, 37, 90, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The top-left corner is moved to the 16x16 MCU grid.
+	if c1.Width != 90-16 || c1.Height != c.Height-32 {
+		t.Fatalf("got size %dx%d", c1.Width, c1.Height)
+	}
+	m1, err := encodeCoefficientsDecode(c1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := maxDelta(m0, m1, func(x, y int) (int, int) { return x + 16, y + 32 }); d != 0 {
+		t.Fatalf("max delta %d", d)
+	}
+
+	for _, r := range []image.Rectangle{
+		image.Rect(c.Width, 0, c.Width+10, 10),
+		image.Rect(10, 10, 10, 20),
+	} {
+		if _, err := c.Crop(r); err == nil {
+			t.Fatalf("cropping to %v succeeded", r)
+		}
+	}
+}
+
+func TestGrayscale(t *testing.T) {
+	c, m0, err := decodeFile(testdataDir + "video-001.q50.420.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, err := c.Grayscale()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c1.Components) != 1 {
+		t.Fatalf("got %d components", len(c1.Components))
+	}
+	m1, err := encodeCoefficientsDecode(c1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray, ok := m1.(*image.Gray)
+	if !ok {
+		t.Fatalf("got %T", m1)
+	}
+	y0 := m0.(*image.YCbCr)
+	for y := 0; y < c.Height; y++ {
+		for x := 0; x < c.Width; x++ {
+			if g, want := gray.GrayAt(x, y).Y, y0.Y[y0.YOffset(x, y)]; g != want {
+				t.Fatalf("(%d, %d): got %d, want %d", x, y, g, want)
+			}
+		}
+	}
+
+	// An RGB image has no luminance component.
+	c.Segments = []Segment{{Marker: app14Marker, Data: []byte("Adobe\x00\x64\x00\x00\x00\x00\x00")}}
+	if _, err := c.Grayscale(); err == nil {
+		t.Fatal("converting an RGB image succeeded")
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "video-001.q50.422.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeCoefficients(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Segments = append(c.Segments,
+		Segment{Marker: app0Marker + 1, Data: []byte("Exif\x00\x00")},
+		Segment{Marker: comMarker, Data: []byte("comment")},
+	)
+	var b0 bytes.Buffer
+	if err := EncodeCoefficients(&b0, c, nil); err != nil {
+		t.Fatal(err)
+	}
+	var b1 bytes.Buffer
+	opt := &TransformOptions{
+		Grayscale: true,
+		Transform: Rotate90,
+		Crop:      image.Rect(8, 8, 40, 48),
+		Options:   &Options{Progressive: true},
+	}
+	if err := Transcode(&b1, &b0, opt); err != nil {
+		t.Fatal(err)
+	}
+	c1, err := DecodeCoefficients(&b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c1.Components) != 1 || c1.Width != 32 || c1.Height != 40 {
+		t.Fatalf("got %d components, size %dx%d", len(c1.Components), c1.Width, c1.Height)
+	}
+	if !reflect.DeepEqual(c1.Segments, c.Segments) {
+		t.Fatalf("got segments %v, want %v", c1.Segments, c.Segments)
+	}
+
+	if err := Transcode(ioutil.Discard, bytes.NewReader(data), &TransformOptions{Transform: Rotate270 + 1}); err == nil {
+		t.Fatal("transcoding with an invalid transform succeeded")
+	}
+}
@@ -0,0 +1,1025 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jpeg
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// div returns a/b rounded to the nearest integer, instead of rounded to zero.
+func div(a, b int32) int32 {
+	if a >= 0 {
+		return (a + (b >> 1)) / b
+	}
+	return -((-a + (b >> 1)) / b)
+}
+
+// bitCount counts the number of bits needed to hold an integer.
+var bitCount = [256]byte{
+	0, 1, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4,
+	5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+	6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6,
+	6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6,
+	7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8,
+	8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8,
+	8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8,
+	8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8,
+	8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8,
+	8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8,
+	8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8,
+	8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8,
+}
+
+type quantIndex int
+
+const (
+	quantIndexLuminance quantIndex = iota
+	quantIndexChrominance
+	nQuantIndex
+)
+
+// unscaledQuant are the unscaled quantization tables in zig-zag order. Each
+// encoder copies and scales the tables according to its quality parameter.
+// The values are derived from section K.1 of the spec, after converting from
+// natural to zig-zag order.
+var unscaledQuant = [nQuantIndex][blockSize]byte{
+	// Luminance.
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	// Chrominance.
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+type huffIndex int
+
+const (
+	huffIndexLuminanceDC huffIndex = iota
+	huffIndexLuminanceAC
+	huffIndexChrominanceDC
+	huffIndexChrominanceAC
+	nHuffIndex
+)
+
+// huffmanSpec specifies a Huffman encoding.
+type huffmanSpec struct {
+	// count[i] is the number of codes of length i+1 bits.
+	count [16]byte
+	// value[i] is the decoded value of the i'th codeword.
+	value []byte
+}
+
+// theHuffmanSpec is the Huffman encoding specifications.
+//
+// This is the Huffman encoding of section K.3 of the spec, which is used
+// unless the tables are optimized for the image.
+//
+// The DC tables have 12 decoded values, called categories.
+//
+// The AC tables have 162 decoded values: bytes that pack a 4-bit Run and a
+// 4-bit Size. There are 16 valid Runs and 10 valid Sizes, plus two special R|S
+// cases: 0|0 (meaning EOB) and F|0 (meaning ZRL).
+var theHuffmanSpec = [nHuffIndex]huffmanSpec{
+	// Luminance DC.
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	// Luminance AC.
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	// Chrominance DC.
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	// Chrominance AC.
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// huffmanLUT is a compiled look-up table representation of a huffmanSpec.
+// Each value maps to a uint32 of which the 8 most significant bits hold the
+// codeword size in bits and the 24 least significant bits hold the codeword.
+// The maximum codeword size is 16 bits.
+type huffmanLUT []uint32
+
+func (h *huffmanLUT) init(s huffmanSpec) {
+	maxValue := 0
+	for _, v := range s.value {
+		if int(v) > maxValue {
+			maxValue = int(v)
+		}
+	}
+	*h = make([]uint32, maxValue+1)
+	code, k := uint32(0), 0
+	for i := 0; i < len(s.count); i++ {
+		nBits := uint32(i+1) << 24
+		for j := uint8(0); j < s.count[i]; j++ {
+			(*h)[s.value[k]] = nBits | code
+			code++
+			k++
+		}
+		code <<= 1
+	}
+}
+
+// optimalHuffmanSpec returns the Huffman encoding with codewords of at most
+// 16 bits that is optimal for the given frequencies of the 256 values,
+// following section K.2 of the spec.
+func optimalHuffmanSpec(freq *[256]int) huffmanSpec {
+	// One codeword of the longest length is reserved, so that no codeword
+	// consists of all 1 bits.
+	var (
+		f        [257]int
+		codesize [257]int
+		others   [257]int
+	)
+	copy(f[:], freq[:])
+	f[256] = 1
+	for i := range others {
+		others[i] = -1
+	}
+	for {
+		// Find the two least frequent values, preferring the larger value
+		// on ties so that the reserved codeword gets the longest code.
+		c1, c2 := -1, -1
+		for i, v := range f {
+			if v > 0 && (c1 < 0 || v <= f[c1]) {
+				c1 = i
+			}
+		}
+		for i, v := range f {
+			if v > 0 && i != c1 && (c2 < 0 || v <= f[c2]) {
+				c2 = i
+			}
+		}
+		if c2 < 0 {
+			break
+		}
+		// Merge the two trees.
+		f[c1] += f[c2]
+		f[c2] = 0
+		codesize[c1]++
+		for others[c1] >= 0 {
+			c1 = others[c1]
+			codesize[c1]++
+		}
+		others[c1] = c2
+		codesize[c2]++
+		for others[c2] >= 0 {
+			c2 = others[c2]
+			codesize[c2]++
+		}
+	}
+
+	var bits [257]int
+	for _, n := range codesize {
+		if n > 0 {
+			bits[n]++
+		}
+	}
+	// Limit the codeword lengths to 16 bits.
+	for i := len(bits) - 1; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+	// Drop the reserved codeword.
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]--
+
+	var s huffmanSpec
+	for i := 1; i <= 16; i++ {
+		s.count[i-1] = byte(bits[i])
+	}
+	for n := 1; n < len(bits); n++ {
+		for v := 0; v < 256; v++ {
+			if codesize[v] == n {
+				s.value = append(s.value, byte(v))
+			}
+		}
+	}
+	return s
+}
+
+// writer is a buffered writer.
+type writer interface {
+	Flush() error
+	io.Writer
+	io.ByteWriter
+}
+
+// frameComponent is a component of the frame being encoded.
+type frameComponent struct {
+	*Component
+	tq int // Quantization table destination selector.
+	th int // Huffman table destination selector.
+	// width and height are the size of the component in pixels, excluding
+	// the padding up to the MCU grid.
+	width, height int
+}
+
+// scan is a scan of the frame: the spectral selection ss to se, in zig-zag
+// order, of the given components.
+type scan struct {
+	comps  []int
+	ss, se int
+}
+
+// encoder encodes an image to the JPEG format.
+type encoder struct {
+	// w is the writer to write to. err is the first error encountered during
+	// writing. All attempted writes after the first error become no-ops.
+	w   writer
+	err error
+	// buf is a scratch buffer.
+	buf [16]byte
+	// bits and nBits are accumulated bits to write to w.
+	bits, nBits uint32
+	// quant is the quantization tables, in zig-zag order.
+	quant  [maxTq + 1][blockSize]uint16
+	nQuant int
+	// size is the image size, and mcuX and mcuY are the number of MCUs
+	// per row and column of the interleaved scans.
+	size       image.Point
+	mcuX, mcuY int
+	comp       []frameComponent
+	// restartInterval is the number of MCUs between restart markers.
+	restartInterval int
+	progressive     bool
+	optimize        bool
+	// lut is the Huffman encodings of the current scan. If counting is
+	// true, the scan is not written and the frequencies of the Huffman
+	// coded values are accumulated in freq instead.
+	lut      [nHuffIndex]huffmanLUT
+	counting bool
+	freq     [nHuffIndex][256]int
+	// eobrun is the number of pending end-of-band blocks of a progressive
+	// AC scan.
+	eobrun int
+}
+
+func (e *encoder) flush() {
+	if e.err != nil {
+		return
+	}
+	e.err = e.w.Flush()
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(p)
+}
+
+func (e *encoder) writeByte(b byte) {
+	if e.err != nil {
+		return
+	}
+	e.err = e.w.WriteByte(b)
+}
+
+// emit emits the least significant nBits bits of bits to the bit-stream.
+// The precondition is bits < 1<<nBits && nBits <= 16.
+func (e *encoder) emit(bits, nBits uint32) {
+	if e.counting {
+		return
+	}
+	nBits += e.nBits
+	bits <<= 32 - nBits
+	bits |= e.bits
+	for nBits >= 8 {
+		b := uint8(bits >> 24)
+		e.writeByte(b)
+		if b == 0xff {
+			e.writeByte(0x00)
+		}
+		bits <<= 8
+		nBits -= 8
+	}
+	e.bits, e.nBits = bits, nBits
+}
+
+// emitHuff emits the given value with the given Huffman encoder.
+func (e *encoder) emitHuff(h huffIndex, value int32) {
+	if e.counting {
+		e.freq[h][value]++
+		return
+	}
+	x := e.lut[h][value]
+	e.emit(x&(1<<24-1), x>>24)
+}
+
+// emitHuffRLE emits a run of runLength copies of value encoded with the given
+// Huffman encoder.
+func (e *encoder) emitHuffRLE(h huffIndex, runLength, value int32) {
+	a, b := value, value
+	if a < 0 {
+		a, b = -value, value-1
+	}
+	var nBits uint32
+	if a < 0x100 {
+		nBits = uint32(bitCount[a])
+	} else {
+		nBits = 8 + uint32(bitCount[a>>8])
+	}
+	e.emitHuff(h, runLength<<4|int32(nBits))
+	if nBits > 0 {
+		e.emit(uint32(b)&(1<<nBits-1), nBits)
+	}
+}
+
+// emitEOBRun emits the pending end-of-band run of a progressive AC scan.
+func (e *encoder) emitEOBRun(h huffIndex) {
+	if e.eobrun == 0 {
+		return
+	}
+	nBits := uint32(0)
+	for e.eobrun>>(nBits+1) != 0 {
+		nBits++
+	}
+	e.emitHuff(h, int32(nBits<<4))
+	if nBits > 0 {
+		e.emit(uint32(e.eobrun)&(1<<nBits-1), nBits)
+	}
+	e.eobrun = 0
+}
+
+// padBits pads the last byte of the bit-stream with 1's.
+func (e *encoder) padBits() {
+	if e.nBits > 0 {
+		e.emit(1<<(8-e.nBits)-1, 8-e.nBits)
+	}
+}
+
+// writeMarkerHeader writes the header for a marker with the given length.
+func (e *encoder) writeMarkerHeader(marker uint8, markerlen int) {
+	e.buf[0] = 0xff
+	e.buf[1] = marker
+	e.buf[2] = uint8(markerlen >> 8)
+	e.buf[3] = uint8(markerlen & 0xff)
+	e.write(e.buf[:4])
+}
+
+// extended reports whether a quantization table needs 16-bit precision, which
+// baseline images do not allow.
+func (e *encoder) extended() bool {
+	for _, q := range e.quant[:e.nQuant] {
+		for _, x := range q {
+			if x > 0xff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeDQT writes the Define Quantization Table marker.
+func (e *encoder) writeDQT() {
+	markerlen := 2
+	for _, q := range e.quant[:e.nQuant] {
+		markerlen += 1 + blockSize
+		for _, x := range q {
+			if x > 0xff {
+				markerlen += blockSize
+				break
+			}
+		}
+	}
+	e.writeMarkerHeader(dqtMarker, markerlen)
+	for i, q := range e.quant[:e.nQuant] {
+		pq := 0
+		for _, x := range q {
+			if x > 0xff {
+				pq = 1
+				break
+			}
+		}
+		e.writeByte(uint8(pq<<4 | i))
+		for _, x := range q {
+			if pq == 1 {
+				e.writeByte(uint8(x >> 8))
+			}
+			e.writeByte(uint8(x))
+		}
+	}
+}
+
+// writeDRI writes the Define Restart Interval marker.
+func (e *encoder) writeDRI() {
+	e.writeMarkerHeader(driMarker, 4)
+	e.buf[0] = uint8(e.restartInterval >> 8)
+	e.buf[1] = uint8(e.restartInterval & 0xff)
+	e.write(e.buf[:2])
+}
+
+// writeSOF writes the Start Of Frame marker, which is SOF0 (Baseline
+// Sequential), SOF1 (Extended Sequential) or SOF2 (Progressive).
+func (e *encoder) writeSOF() {
+	marker := uint8(sof0Marker)
+	if e.progressive {
+		marker = sof2Marker
+	} else if e.extended() {
+		marker = sof1Marker
+	}
+	e.writeMarkerHeader(marker, 8+3*len(e.comp))
+	e.buf[0] = 8 // 8-bit color.
+	e.buf[1] = uint8(e.size.Y >> 8)
+	e.buf[2] = uint8(e.size.Y & 0xff)
+	e.buf[3] = uint8(e.size.X >> 8)
+	e.buf[4] = uint8(e.size.X & 0xff)
+	e.buf[5] = uint8(len(e.comp))
+	e.write(e.buf[:6])
+	for _, c := range e.comp {
+		e.buf[0] = c.ID
+		e.buf[1] = uint8(c.H<<4 | c.V)
+		e.buf[2] = uint8(c.tq)
+		e.write(e.buf[:3])
+	}
+}
+
+// writeDHT writes the Define Huffman Table marker for the given Huffman
+// encodings, and compiles them for the following scans.
+func (e *encoder) writeDHT(specs []huffmanSpec, index []huffIndex) {
+	markerlen := 2
+	for _, s := range specs {
+		markerlen += 1 + 16 + len(s.value)
+	}
+	e.writeMarkerHeader(dhtMarker, markerlen)
+	for i, s := range specs {
+		// The table class is 0 for DC and 1 for AC tables, and the
+		// Luminance and Chrominance tables have ids 0 and 1.
+		e.writeByte(uint8(index[i]&1)<<4 | uint8(index[i]>>1))
+		e.write(s.count[:])
+		e.write(s.value)
+		e.lut[index[i]].init(s)
+	}
+}
+
+// huffIndexes returns the Huffman encodings used by the scan.
+func (e *encoder) huffIndexes(s *scan) []huffIndex {
+	var used [nHuffIndex]bool
+	for _, i := range s.comps {
+		t := huffIndex(2 * e.comp[i].th)
+		if s.ss == 0 {
+			used[t+0] = true
+		}
+		if s.se > 0 {
+			used[t+1] = true
+		}
+	}
+	var index []huffIndex
+	for h, ok := range used {
+		if ok {
+			index = append(index, huffIndex(h))
+		}
+	}
+	return index
+}
+
+// writeSOS writes the Start Of Scan marker.
+func (e *encoder) writeSOS(s *scan) {
+	e.writeMarkerHeader(sosMarker, 6+2*len(s.comps))
+	e.writeByte(uint8(len(s.comps)))
+	for _, i := range s.comps {
+		// A component uses the DC and AC tables with the same id.
+		t := uint8(e.comp[i].th)
+		e.writeByte(e.comp[i].ID)
+		e.writeByte(t<<4 | t)
+	}
+	// Section B.2.3 of the spec says that the successive approximation
+	// bit positions Ah and Al are zero for sequential DCTs. Progressive
+	// scans use spectral selection only, so they are zero too.
+	e.buf[0] = uint8(s.ss)
+	e.buf[1] = uint8(s.se)
+	e.buf[2] = 0x00
+	e.write(e.buf[:3])
+}
+
+// writeScan writes a scan, optimizing its Huffman encodings if needed.
+func (e *encoder) writeScan(s *scan) {
+	if e.optimize {
+		index := e.huffIndexes(s)
+		for _, h := range index {
+			e.freq[h] = [256]int{}
+		}
+		e.counting = true
+		e.encodeScan(s)
+		e.counting = false
+		specs := make([]huffmanSpec, len(index))
+		for i, h := range index {
+			specs[i] = optimalHuffmanSpec(&e.freq[h])
+		}
+		e.writeDHT(specs, index)
+	}
+	e.writeSOS(s)
+	e.encodeScan(s)
+	e.padBits()
+}
+
+// encodeScan encodes the entropy-coded data of a scan. A scan of one
+// component is not interleaved, and only covers the blocks of the component
+// that hold image data.
+func (e *encoder) encodeScan(s *scan) {
+	var prevDC [maxComponents]int32
+	e.eobrun = 0
+	n := 0
+	mcu := func() {
+		if e.restartInterval > 0 && n > 0 && n%e.restartInterval == 0 {
+			e.restart(s, n/e.restartInterval-1)
+			prevDC = [maxComponents]int32{}
+		}
+		n++
+	}
+	if len(s.comps) == 1 {
+		i := s.comps[0]
+		c := &e.comp[i]
+		for by := 0; by < (c.height+7)/8; by++ {
+			for bx := 0; bx < (c.width+7)/8; bx++ {
+				mcu()
+				e.encodeBlock(&c.Blocks[by*c.Stride+bx], c.th, s, &prevDC[i])
+			}
+		}
+	} else {
+		for my := 0; my < e.mcuY; my++ {
+			for mx := 0; mx < e.mcuX; mx++ {
+				mcu()
+				for _, i := range s.comps {
+					c := &e.comp[i]
+					for y := 0; y < c.V; y++ {
+						for x := 0; x < c.H; x++ {
+							b := &c.Blocks[(my*c.V+y)*c.Stride+mx*c.H+x]
+							e.encodeBlock(b, c.th, s, &prevDC[i])
+						}
+					}
+				}
+			}
+		}
+	}
+	if s.se > 0 {
+		e.emitEOBRun(huffIndex(2*e.comp[s.comps[0]].th + 1))
+	}
+}
+
+// restart writes the n'th restart marker of a scan.
+func (e *encoder) restart(s *scan, n int) {
+	if s.se > 0 {
+		e.emitEOBRun(huffIndex(2*e.comp[s.comps[0]].th + 1))
+	}
+	if e.counting {
+		return
+	}
+	e.padBits()
+	e.writeByte(0xff)
+	e.writeByte(uint8(rst0Marker + n%8))
+}
+
+// encodeBlock encodes the spectral selection of the scan of a block, using
+// the Huffman encodings with the given id. The DC component is delta-encoded
+// against prevDC, which is updated.
+func (e *encoder) encodeBlock(b *Block, th int, s *scan, prevDC *int32) {
+	zig := s.ss
+	if zig == 0 {
+		// Emit the DC delta.
+		dc := int32(b[0])
+		e.emitHuffRLE(huffIndex(2*th+0), 0, dc-*prevDC)
+		*prevDC = dc
+		zig++
+	}
+	if zig > s.se {
+		return
+	}
+	// Emit the AC components.
+	h, runLength := huffIndex(2*th+1), int32(0)
+	for ; zig <= s.se; zig++ {
+		ac := int32(b[unzig[zig]])
+		if ac == 0 {
+			runLength++
+			continue
+		}
+		if e.progressive {
+			e.emitEOBRun(h)
+		}
+		for runLength > 15 {
+			e.emitHuff(h, 0xf0)
+			runLength -= 16
+		}
+		e.emitHuffRLE(h, runLength, ac)
+		runLength = 0
+	}
+	if runLength > 0 {
+		if !e.progressive {
+			e.emitHuff(h, 0x00)
+			return
+		}
+		// Section G.1.2.2 of the spec limits the end-of-band runs to
+		// 0x7fff blocks.
+		if e.eobrun++; e.eobrun == 0x7fff {
+			e.emitEOBRun(h)
+		}
+	}
+}
+
+// scans returns the scans of the image. A progressive image has an
+// interleaved DC scan, followed by AC scans of each component.
+func (e *encoder) scans() []scan {
+	all := make([]int, len(e.comp))
+	for i := range all {
+		all[i] = i
+	}
+	if !e.progressive {
+		return []scan{{all, 0, blockSize - 1}}
+	}
+	ss := []scan{{all, 0, 0}, {[]int{0}, 1, 5}}
+	for i := 1; i < len(e.comp); i++ {
+		ss = append(ss, scan{[]int{i}, 1, blockSize - 1})
+	}
+	return append(ss, scan{[]int{0}, 6, blockSize - 1})
+}
+
+// isGray reports whether m is a single-channel image.
+func isGray(m image.Image) bool {
+	if p, ok := m.(imageExt.Image); ok {
+		return p.Channels() == 1
+	}
+	switch m.ColorModel() {
+	case color.GrayModel, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+// planes converts m to its full resolution Y, Cb and Cr planes, or the Y
+// plane of a gray image, padded by replicating the edges to the given size.
+func planes(m image.Image, gray bool, w, h int) [][]uint8 {
+	b := m.Bounds()
+	n := 3
+	if gray {
+		n = 1
+	}
+	p := make([][]uint8, n)
+	for i := range p {
+		p[i] = make([]uint8, w*h)
+	}
+	rgba, _ := m.(*image.RGBA)
+	ycbcr, _ := m.(*image.YCbCr)
+	grayImage, _ := m.(*image.Gray)
+	for y := 0; y < h; y++ {
+		sy := b.Min.Y + y
+		if sy >= b.Max.Y {
+			sy = b.Max.Y - 1
+		}
+		for x := 0; x < w; x++ {
+			sx := b.Min.X + x
+			if sx >= b.Max.X {
+				sx = b.Max.X - 1
+			}
+			i := y*w + x
+			switch {
+			case grayImage != nil:
+				p[0][i] = grayImage.Pix[grayImage.PixOffset(sx, sy)]
+			case gray:
+				p[0][i] = color.GrayModel.Convert(m.At(sx, sy)).(color.Gray).Y
+			case ycbcr != nil:
+				ci := ycbcr.COffset(sx, sy)
+				p[0][i] = ycbcr.Y[ycbcr.YOffset(sx, sy)]
+				p[1][i] = ycbcr.Cb[ci]
+				p[2][i] = ycbcr.Cr[ci]
+			case rgba != nil:
+				pix := rgba.Pix[rgba.PixOffset(sx, sy):]
+				p[0][i], p[1][i], p[2][i] = color.RGBToYCbCr(pix[0], pix[1], pix[2])
+			default:
+				r, g, b, _ := m.At(sx, sy).RGBA()
+				p[0][i], p[1][i], p[2][i] = color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			}
+		}
+	}
+	return p
+}
+
+// transform subsamples the plane of width w to the component c, and computes
+// the quantized DCT coefficients of its blocks, which cover mcuX by mcuY
+// MCUs.
+func transform(c *Component, plane []uint8, w, hmax, vmax, mcuX, mcuY int) {
+	sx, sy := hmax/c.H, vmax/c.V
+	bh := mcuY * c.V
+	c.Stride = mcuX * c.H
+	c.Blocks = make([]Block, c.Stride*bh)
+	var b block
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < c.Stride; bx++ {
+			for j := 0; j < 8; j++ {
+				for i := 0; i < 8; i++ {
+					x, y := (8*bx+i)*sx, (8*by+j)*sy
+					sum := 0
+					for v := 0; v < sy; v++ {
+						for u := 0; u < sx; u++ {
+							sum += int(plane[(y+v)*w+x+u])
+						}
+					}
+					n := sx * sy
+					b[8*j+i] = int32((sum + n/2) / n)
+				}
+			}
+			fdct(&b)
+			dst := &c.Blocks[by*c.Stride+bx]
+			for k := range b {
+				dst[k] = int16(div(b[k], 8*int32(c.Quant[k])))
+			}
+		}
+	}
+}
+
+// Subsampling is the chroma subsampling of a color JPEG image.
+type Subsampling int
+
+const (
+	Subsampling420 Subsampling = iota // The default.
+	Subsampling422
+	Subsampling440
+	Subsampling444
+)
+
+// samplingFactors are the horizontal and vertical sampling factors of the
+// luminance component for each Subsampling.
+var samplingFactors = [...][2]int{
+	Subsampling420: {2, 2},
+	Subsampling422: {2, 1},
+	Subsampling440: {1, 2},
+	Subsampling444: {1, 1},
+}
+
+// quantTables returns the quantization tables for the options, in natural
+// order.
+func quantTables(opt *Options) (quant [nQuantIndex][blockSize]uint16, err error) {
+	// Clip quality to [1, 100].
+	quality := jpeg.DefaultQuality
+	if opt != nil {
+		quality = opt.Options.Quality
+		if quality < 1 {
+			quality = 1
+		} else if quality > 100 {
+			quality = 100
+		}
+	}
+	// Convert from a quality rating to a scaling factor.
+	var scale int
+	if quality < 50 {
+		scale = 5000 / quality
+	} else {
+		scale = 200 - quality*2
+	}
+	// Initialize the quantization tables.
+	for i := range quant {
+		var table *[blockSize]uint8
+		if opt != nil {
+			table = [...]*[blockSize]uint8{opt.LuminanceTable, opt.ChrominanceTable}[i]
+		}
+		for j := range quant[i] {
+			if table != nil {
+				// User-supplied tables are in natural order, and are
+				// not scaled.
+				if table[unzig[j]] == 0 {
+					return quant, errors.New("jpeg: invalid quantization table")
+				}
+				quant[i][unzig[j]] = uint16(table[unzig[j]])
+				continue
+			}
+			x := int(unscaledQuant[i][j])
+			x = (x*scale + 50) / 100
+			if x < 1 {
+				x = 1
+			} else if x > 255 {
+				x = 255
+			}
+			quant[i][unzig[j]] = uint16(x)
+		}
+	}
+	return quant, nil
+}
+
+// Encode writes the Image m to w in JPEG format with the given options.
+// Default parameters, which give a 4:2:0 baseline image, are used if a nil
+// *Options is passed. Single-channel images are written as grayscale images.
+func Encode(w io.Writer, m image.Image, opt *Options) error {
+	b := m.Bounds()
+	if b.Dx() >= 1<<16 || b.Dy() >= 1<<16 {
+		return errors.New("jpeg: image is too large to encode")
+	}
+	if b.Empty() {
+		return errors.New("jpeg: image is empty")
+	}
+	f := samplingFactors[Subsampling420]
+	if opt != nil {
+		if opt.Subsampling < 0 || int(opt.Subsampling) >= len(samplingFactors) {
+			return errors.New("jpeg: invalid subsampling")
+		}
+		f = samplingFactors[opt.Subsampling]
+	}
+	quant, err := quantTables(opt)
+	if err != nil {
+		return err
+	}
+
+	// Set up the components. Gray images have no subsampling.
+	c := &Coefficients{Width: b.Dx(), Height: b.Dy()}
+	gray := isGray(m)
+	if gray {
+		c.Components = []Component{{ID: 1, H: 1, V: 1, Quant: quant[quantIndexLuminance]}}
+	} else {
+		c.Components = []Component{
+			{ID: 1, H: f[0], V: f[1], Quant: quant[quantIndexLuminance]},
+			{ID: 2, H: 1, V: 1, Quant: quant[quantIndexChrominance]},
+			{ID: 3, H: 1, V: 1, Quant: quant[quantIndexChrominance]},
+		}
+	}
+	hmax, vmax := c.Components[0].H, c.Components[0].V
+	mcuX := (c.Width + 8*hmax - 1) / (8 * hmax)
+	mcuY := (c.Height + 8*vmax - 1) / (8 * vmax)
+	pw, ph := 8*hmax*mcuX, 8*vmax*mcuY
+	for i, p := range planes(m, gray, pw, ph) {
+		transform(&c.Components[i], p, pw, hmax, vmax, mcuX, mcuY)
+	}
+	return encodeCoefficients(w, c, opt)
+}
+
+// encodeCoefficients writes the coefficients c, which are valid, to w with
+// the scan and Huffman table options of opt.
+func encodeCoefficients(w io.Writer, c *Coefficients, opt *Options) error {
+	var e encoder
+	if opt != nil {
+		if opt.RestartInterval < 0 || opt.RestartInterval > 0xffff {
+			return errors.New("jpeg: invalid restart interval")
+		}
+		e.restartInterval = opt.RestartInterval
+		// Progressive scans have end-of-band runs, which are not in
+		// the tables of section K.3 of the spec.
+		e.progressive = opt.Progressive
+		e.optimize = opt.OptimizeHuffman || opt.Progressive
+	}
+	if ww, ok := w.(writer); ok {
+		e.w = ww
+	} else {
+		e.w = bufio.NewWriter(w)
+	}
+
+	// Set up the components. They share the quantization tables with the
+	// same values, and the components after the first one share the
+	// Huffman tables.
+	hmax, vmax := c.maxSamplingFactors()
+	e.size = image.Pt(c.Width, c.Height)
+	e.mcuX = (c.Width + 8*hmax - 1) / (8 * hmax)
+	e.mcuY = (c.Height + 8*vmax - 1) / (8 * vmax)
+	e.comp = make([]frameComponent, len(c.Components))
+	for i := range c.Components {
+		fc := &e.comp[i]
+		fc.Component = &c.Components[i]
+		fc.width = (c.Width*fc.H + hmax - 1) / hmax
+		fc.height = (c.Height*fc.V + vmax - 1) / vmax
+		if i > 0 {
+			fc.th = 1
+		}
+		var q [blockSize]uint16
+		for zig := range q {
+			q[zig] = fc.Quant[unzig[zig]]
+		}
+		fc.tq = -1
+		for j := 0; j < e.nQuant; j++ {
+			if e.quant[j] == q {
+				fc.tq = j
+				break
+			}
+		}
+		if fc.tq < 0 {
+			fc.tq = e.nQuant
+			e.quant[e.nQuant] = q
+			e.nQuant++
+		}
+	}
+
+	// Write the Start Of Image marker.
+	e.buf[0] = 0xff
+	e.buf[1] = soiMarker
+	e.write(e.buf[:2])
+	// Write the application and comment segments.
+	for _, s := range c.Segments {
+		e.writeMarkerHeader(s.Marker, 2+len(s.Data))
+		e.write(s.Data)
+	}
+	// Write the quantization tables.
+	e.writeDQT()
+	// Write the image dimensions.
+	e.writeSOF()
+	// Write the Huffman tables, unless they are optimized for each scan.
+	if !e.optimize {
+		specs := theHuffmanSpec[:]
+		index := []huffIndex{0, 1, 2, 3}
+		if len(e.comp) == 1 {
+			// Drop the Chrominance tables.
+			specs, index = specs[:2], index[:2]
+		}
+		e.writeDHT(specs, index)
+	}
+	if e.restartInterval > 0 {
+		e.writeDRI()
+	}
+	// Write the image data.
+	for _, s := range e.scans() {
+		e.writeScan(&s)
+	}
+	// Write the End Of Image marker.
+	e.buf[0] = 0xff
+	e.buf[1] = eoiMarker
+	e.write(e.buf[:2])
+	e.flush()
+	return e.err
+}
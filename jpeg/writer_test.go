@@ -0,0 +1,285 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jpeg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+)
+
+const testdataDir = "../testdata/"
+
+func readPNG(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// averageDelta returns the average delta in RGB space. The two images must
+// have the same bounds.
+func averageDelta(m0, m1 image.Image) int64 {
+	b := m0.Bounds()
+	var sum, n int64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c0 := m0.At(x, y)
+			c1 := m1.At(x, y)
+			r0, g0, b0, _ := c0.RGBA()
+			r1, g1, b1, _ := c1.RGBA()
+			sum += delta(r0, r1)
+			sum += delta(g0, g1)
+			sum += delta(b0, b1)
+			n += 3
+		}
+	}
+	return sum / n
+}
+
+func delta(u0, u1 uint32) int64 {
+	d := int64(u0) - int64(u1)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func encodeDecode(m image.Image, opt *Options) (image.Image, []byte, error) {
+	var b bytes.Buffer
+	if err := Encode(&b, m, opt); err != nil {
+		return nil, nil, err
+	}
+	m1, err := jpeg.Decode(bytes.NewReader(b.Bytes()))
+	return m1, b.Bytes(), err
+}
+
+func TestWriter(t *testing.T) {
+	m0, err := readPNG(testdataDir + "video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratio := map[Subsampling]image.YCbCrSubsampleRatio{
+		Subsampling420: image.YCbCrSubsampleRatio420,
+		Subsampling422: image.YCbCrSubsampleRatio422,
+		Subsampling440: image.YCbCrSubsampleRatio440,
+		Subsampling444: image.YCbCrSubsampleRatio444,
+	}
+	for _, s := range []Subsampling{Subsampling420, Subsampling422, Subsampling440, Subsampling444} {
+		for _, progressive := range []bool{false, true} {
+			for _, optimize := range []bool{false, true} {
+				opt := &Options{
+					Options:         jpeg.Options{Quality: 90},
+					Subsampling:     s,
+					Progressive:     progressive,
+					OptimizeHuffman: optimize,
+				}
+				m1, data, err := encodeDecode(m0, opt)
+				if err != nil {
+					t.Fatalf("%+v: %v", opt, err)
+				}
+				if m1.Bounds() != m0.Bounds() {
+					t.Fatalf("%+v: got bounds %v, want %v", opt, m1.Bounds(), m0.Bounds())
+				}
+				if got := m1.(*image.YCbCr).SubsampleRatio; got != ratio[s] {
+					t.Fatalf("%+v: got subsample ratio %v", opt, got)
+				}
+				if sof := bytes.Contains(data, []byte{0xff, sof2Marker}); sof != progressive {
+					t.Fatalf("%+v: got SOF2 marker %v", opt, sof)
+				}
+				if d := averageDelta(m0, m1); d > 4<<8 {
+					t.Fatalf("%+v: average delta is too high: %d", opt, d)
+				}
+			}
+		}
+	}
+}
+
+func TestWriterOptimizeHuffman(t *testing.T) {
+	m0, err := readPNG(testdataDir + "video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, data0, err := encodeDecode(m0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, data1, err := encodeDecode(m0, &Options{Options: jpeg.Options{Quality: jpeg.DefaultQuality}, OptimizeHuffman: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data1) >= len(data0) {
+		t.Fatalf("optimized size %d, default size %d", len(data1), len(data0))
+	}
+	// The coefficients are the same.
+	m0, err = jpeg.Decode(bytes.NewReader(data0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := averageDelta(m0, m1); d != 0 {
+		t.Fatalf("average delta %d", d)
+	}
+}
+
+func TestWriterRestartInterval(t *testing.T) {
+	m0, err := readPNG(testdataDir + "video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, want, err := encodeDecode(m0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want0, err := jpeg.Decode(bytes.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The image/jpeg decoder counts the restart intervals of progressive
+	// scans in interleaved MCUs, so it only decodes progressive images with
+	// restart markers and subsampling if the blocks of a luminance MCU are
+	// within a restart interval.
+	for _, opt := range []*Options{
+		{Options: jpeg.Options{Quality: jpeg.DefaultQuality}, RestartInterval: 3},
+		{Options: jpeg.Options{Quality: jpeg.DefaultQuality}, RestartInterval: 3, Subsampling: Subsampling444, Progressive: true},
+	} {
+		m1, data, err := encodeDecode(m0, opt)
+		if err != nil {
+			t.Fatalf("%+v: %v", opt, err)
+		}
+		if !bytes.Contains(data, []byte{0xff, driMarker, 0x00, 0x04, 0x00, 0x03}) {
+			t.Fatalf("%+v: no DRI marker", opt)
+		}
+		for n := 0; n < 8; n++ {
+			if !bytes.Contains(data, []byte{0xff, byte(rst0Marker + n)}) {
+				t.Fatalf("%+v: no RST%d marker", opt, n)
+			}
+		}
+		if opt.Subsampling != Subsampling420 {
+			continue
+		}
+		if d := averageDelta(want0, m1); d != 0 {
+			t.Fatalf("%+v: average delta %d", opt, d)
+		}
+	}
+}
+
+func TestWriterGray(t *testing.T) {
+	r := image.Rect(0, 0, 37, 21)
+	gray := image.NewGray(r)
+	gray16 := image.NewGray16(r)
+	typed := imageExt.NewGray(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			v := uint8(x*3 + y*5)
+			gray.SetGray(x, y, color.Gray{v})
+			gray16.SetGray16(x, y, color.Gray16{uint16(v) * 0x101})
+			typed.Set(x, y, color.Gray{v})
+		}
+	}
+	for _, m := range []image.Image{gray, gray16, typed} {
+		for _, opt := range []*Options{nil, {Options: jpeg.Options{Quality: jpeg.DefaultQuality}, Progressive: true, RestartInterval: 2}} {
+			m1, data, err := encodeDecode(m, opt)
+			if err != nil {
+				t.Fatalf("%T: %v", m, err)
+			}
+			if _, ok := m1.(*image.Gray); !ok {
+				t.Fatalf("%T: got %T", m, m1)
+			}
+			if i := bytes.Index(data, []byte{0xff, sof0Marker}); opt == nil && (i < 0 || data[i+9] != 1) {
+				t.Fatalf("%T: not a single component image", m)
+			}
+			if d := averageDelta(gray, m1); d > 3<<8 {
+				t.Fatalf("%T: average delta is too high: %d", m, d)
+			}
+		}
+	}
+}
+
+func TestWriterQuantizationTables(t *testing.T) {
+	m0, err := readPNG(testdataDir + "video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lum, chrom [64]uint8
+	for i := range lum {
+		lum[i] = 1
+		chrom[i] = uint8(2 + i)
+	}
+	opt := &Options{
+		Subsampling:      Subsampling444,
+		LuminanceTable:   &lum,
+		ChrominanceTable: &chrom,
+	}
+	m1, data, err := encodeDecode(m0, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte{0xff, dqtMarker})
+	if i < 0 {
+		t.Fatal("no DQT marker")
+	}
+	dqt := data[i+4:]
+	if dqt[0] != 0 || !bytes.Equal(dqt[1:65], lum[:]) {
+		t.Fatalf("got luminance table %v", dqt[:65])
+	}
+	// The tables are written in zig-zag order.
+	if dqt[65] != 1 || dqt[66] != chrom[0] || dqt[67] != chrom[1] || dqt[68] != chrom[8] {
+		t.Fatalf("got chrominance table %v", dqt[65:130])
+	}
+	if d := averageDelta(m0, m1); d > 2<<8 {
+		t.Fatalf("average delta is too high: %d", d)
+	}
+
+	lum[5] = 0
+	if err := Encode(ioutil.Discard, m0, opt); err == nil {
+		t.Fatal("encoding with a zero quantizer succeeded")
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for _, opt := range []*Options{
+		{Subsampling: -1},
+		{Subsampling: Subsampling444 + 1},
+		{RestartInterval: -1},
+		{RestartInterval: 0x10000},
+	} {
+		if err := Encode(ioutil.Discard, m, opt); err == nil {
+			t.Fatalf("encoding with %+v succeeded", opt)
+		}
+	}
+	if err := Encode(ioutil.Discard, image.NewRGBA(image.Rect(0, 0, 0, 4)), nil); err == nil {
+		t.Fatal("encoding an empty image succeeded")
+	}
+}
+
+func TestSave(t *testing.T) {
+	m0, err := readPNG(testdataDir + "video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	opt := &Options{Options: jpeg.Options{Quality: 90}, Subsampling: Subsampling444, Progressive: true}
+	if err := imageExtEncode(&b, m0, opt); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := jpeg.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(m1.(*image.YCbCr).SubsampleRatio); got != fmt.Sprint(image.YCbCrSubsampleRatio444) {
+		t.Fatalf("got subsample ratio %v", got)
+	}
+}
@@ -0,0 +1,433 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"reflect"
+
+	colorExt "github.com/chai2010/image/color"
+)
+
+var _ Image = (*Planar)(nil)
+
+// Planar is an image whose channels are stored in separate planes, as in
+// TIFF images with a PlanarConfiguration of 2 and in CHW tensors. Its
+// samples, colors and color model are those of the interleaved image of the
+// same channels and depth, which Interleave returns.
+//
+// Pix holds the planes one after the other: the sample of the c-th channel
+// at (x, y) starts at Pix[c*PlaneStride + (y-Rect.Min.Y)*Stride +
+// (x-Rect.Min.X)*SampleSize], where SampleSize is the size of a sample of
+// the depth.
+type Planar struct {
+	M struct {
+		Pix         []uint8
+		Stride      int
+		PlaneStride int
+		Rect        image.Rectangle
+		Channels    int
+		Depth       reflect.Kind
+	}
+}
+
+// NewPlanar returns a new Planar with the given bounds, channels and depth.
+func NewPlanar(r image.Rectangle, channels int, depth reflect.Kind) (*Planar, error) {
+	if _, err := NewImage(image.Rectangle{}, channels, depth); err != nil {
+		return nil, err
+	}
+	size := sampleSize(depth)
+	stride := size * r.Dx()
+	pix := make([]uint8, channels*stride*r.Dy())
+	return new(Planar).Init(pix, stride, stride*r.Dy(), r, channels, depth), nil
+}
+
+func (p *Planar) Init(pix []uint8, stride, planeStride int, rect image.Rectangle, channels int, depth reflect.Kind) *Planar {
+	*p = Planar{}
+	p.M.Pix = pix
+	p.M.Stride = stride
+	p.M.PlaneStride = planeStride
+	p.M.Rect = rect
+	p.M.Channels = channels
+	p.M.Depth = depth
+	return p
+}
+
+func (p *Planar) BaseType() image.Image { return p }
+func (p *Planar) Pix() []byte           { return p.M.Pix }
+func (p *Planar) Stride() int           { return p.M.Stride }
+func (p *Planar) Rect() image.Rectangle { return p.M.Rect }
+func (p *Planar) Channels() int         { return p.M.Channels }
+func (p *Planar) Depth() reflect.Kind   { return p.M.Depth }
+
+func (p *Planar) ColorModel() color.Model { return p.pixel().ColorModel() }
+
+func (p *Planar) Bounds() image.Rectangle { return p.M.Rect }
+
+// pixel returns an interleaved image of one pixel of the channels and depth.
+func (p *Planar) pixel() Image {
+	m, err := NewImage(image.Rect(0, 0, 1, 1), p.M.Channels, p.M.Depth)
+	if err != nil {
+		panic(fmt.Errorf("image: Planar, %v", err))
+	}
+	return m
+}
+
+func (p *Planar) At(x, y int) color.Color {
+	// A pixel has at most four samples of eight bytes.
+	var pix [4 * 8]uint8
+	if (image.Point{x, y}).In(p.M.Rect) {
+		i, size := p.PixOffset(x, y), sampleSize(p.M.Depth)
+		for c := 0; c < p.M.Channels; c++ {
+			copy(pix[c*size:(c+1)*size], p.M.Pix[c*p.M.PlaneStride+i:])
+		}
+	}
+	return pixelAt(pix[:], p.M.Channels, p.M.Depth)
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the sample of the first channel at (x, y).
+func (p *Planar) PixOffset(x, y int) int {
+	return (y-p.M.Rect.Min.Y)*p.M.Stride + (x-p.M.Rect.Min.X)*sampleSize(p.M.Depth)
+}
+
+func (p *Planar) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.M.Rect)) {
+		return
+	}
+	var pix [4 * 8]uint8
+	setPixel(pix[:], p.M.Channels, p.M.Depth, c)
+	i, size := p.PixOffset(x, y), sampleSize(p.M.Depth)
+	for c := 0; c < p.M.Channels; c++ {
+		copy(p.M.Pix[c*p.M.PlaneStride+i:], pix[c*size:(c+1)*size])
+	}
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *Planar) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.M.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return new(Planar).Init(nil, 0, 0, image.Rectangle{}, p.M.Channels, p.M.Depth)
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return new(Planar).Init(
+		p.M.Pix[i:],
+		p.M.Stride,
+		p.M.PlaneStride,
+		r,
+		p.M.Channels,
+		p.M.Depth,
+	)
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *Planar) Opaque() bool {
+	if p.M.Channels != 2 && p.M.Channels != 4 {
+		return true
+	}
+	// The alpha samples scale as the gray samples of the same depth.
+	alpha := p.Channel(p.M.Channels - 1)
+	for y := p.M.Rect.Min.Y; y < p.M.Rect.Max.Y; y++ {
+		for x := p.M.Rect.Min.X; x < p.M.Rect.Max.X; x++ {
+			if a, _, _, _ := alpha.At(x, y).RGBA(); a != 0xFFFF {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Channel returns the plane of the i-th channel, as a Gray, Gray16, Gray16f,
+// Gray32i, Gray32f, Gray64i or Gray64f image of the depth of p. The returned
+// value shares pixels with the original image.
+func (p *Planar) Channel(i int) Image {
+	if i < 0 || i >= p.M.Channels {
+		panic(fmt.Errorf("image: Planar.Channel, invalid channel: %d", i))
+	}
+	pix := p.M.Pix
+	if len(pix) != 0 {
+		pix = pix[i*p.M.PlaneStride:]
+	}
+	return newGrayImage(pix, p.M.Stride, p.M.Rect, p.M.Depth)
+}
+
+// Interleave returns a copy of p as an interleaved image of the same
+// channels and depth.
+func (p *Planar) Interleave() Image {
+	m, err := NewImage(p.M.Rect, p.M.Channels, p.M.Depth)
+	if err != nil {
+		panic(fmt.Errorf("image: Planar.Interleave, %v", err))
+	}
+	for c := 0; c < p.M.Channels; c++ {
+		copySamples(m, c, p.Channel(c), 0)
+	}
+	return m
+}
+
+// IsPlanar reports whether m is a Planar image, whose Pix does not have
+// the interleaved layout of the other Image types. Code that reads Pix
+// should check it and use Interleave or Channel instead.
+func IsPlanar(m image.Image) bool {
+	_, ok := m.(*Planar)
+	return ok
+}
+
+// AsPlanar returns m if it is a Planar, and otherwise a copy of m as a
+// Planar of the channels and depth of AsImage(m).
+func AsPlanar(m image.Image) *Planar {
+	if p, ok := m.(*Planar); ok {
+		return p
+	}
+	src := AsImage(m)
+	p, err := NewPlanar(src.Bounds(), src.Channels(), src.Depth())
+	if err != nil {
+		panic(fmt.Errorf("image: AsPlanar, %v", err))
+	}
+	for c := 0; c < src.Channels(); c++ {
+		copySamples(p.Channel(c), 0, src, c)
+	}
+	return p
+}
+
+// SplitChannels returns copies of the channels of AsImage(m), as Gray,
+// Gray16, Gray16f, Gray32i, Gray32f, Gray64i or Gray64f images of its
+// depth.
+func SplitChannels(m image.Image) []Image {
+	src := AsImage(m)
+	p, planar := src.(*Planar)
+	gray := make([]Image, src.Channels())
+	for c := range gray {
+		gray[c], _ = NewImage(src.Bounds(), 1, src.Depth())
+		if planar {
+			copySamples(gray[c], 0, p.Channel(c), 0)
+		} else {
+			copySamples(gray[c], 0, src, c)
+		}
+	}
+	return gray
+}
+
+// MergeChannels returns an interleaved image of the gray images, which must
+// have one channel, the same depth and the same bounds. There must be from
+// one to four of them, for the gray, gray and alpha, RGB and RGBA channels.
+func MergeChannels(gray ...Image) (Image, error) {
+	if len(gray) == 0 {
+		return nil, fmt.Errorf("image: MergeChannels, no channels")
+	}
+	r, depth := gray[0].Bounds(), gray[0].Depth()
+	for _, g := range gray {
+		if g.Channels() != 1 || g.Depth() != depth || g.Bounds() != r {
+			return nil, fmt.Errorf("image: MergeChannels, invalid channel: channels = %v, depth = %v, bounds = %v",
+				g.Channels(), g.Depth(), g.Bounds())
+		}
+	}
+	m, err := NewImage(r, len(gray), depth)
+	if err != nil {
+		return nil, err
+	}
+	for c, g := range gray {
+		copySamples(m, c, g, 0)
+	}
+	return m, nil
+}
+
+// copySamples copies the samples of the channel sc of src to the channel dc
+// of dst, which have the same bounds and depth.
+func copySamples(dst Image, dc int, src Image, sc int) {
+	r, size := dst.Rect(), sampleSize(dst.Depth())
+	dstPix, dstStep := dst.Pix(), size*dst.Channels()
+	srcPix, srcStep := src.Pix(), size*src.Channels()
+	for y := 0; y < r.Dy(); y++ {
+		d := dstPix[y*dst.Stride()+dc*size:]
+		s := srcPix[y*src.Stride()+sc*size:]
+		switch size {
+		case 1:
+			for x := 0; x < r.Dx(); x++ {
+				d[x*dstStep] = s[x*srcStep]
+			}
+		default:
+			for x := 0; x < r.Dx(); x++ {
+				copy(d[x*dstStep:x*dstStep+size], s[x*srcStep:])
+			}
+		}
+	}
+}
+
+// pixelAt returns the color of the interleaved samples of a pixel of the
+// channels and depth.
+func pixelAt(pix []byte, channels int, depth reflect.Kind) color.Color {
+	switch {
+	case channels == 1 && depth == reflect.Uint8:
+		return pGrayAt(pix)
+	case channels == 1 && depth == reflect.Uint16:
+		return pGray16At(pix)
+	case channels == 1 && depth == Float16:
+		return pGray16fAt(pix)
+	case channels == 1 && depth == reflect.Int32:
+		return pGray32iAt(pix)
+	case channels == 1 && depth == reflect.Float32:
+		return pGray32fAt(pix)
+	case channels == 1 && depth == reflect.Int64:
+		return pGray64iAt(pix)
+	case channels == 1 && depth == reflect.Float64:
+		return pGray64fAt(pix)
+
+	case channels == 2 && depth == reflect.Uint8:
+		return pGrayAAt(pix)
+	case channels == 2 && depth == reflect.Uint16:
+		return pGrayA32At(pix)
+	case channels == 2 && depth == Float16:
+		return pGrayA32fAt(pix)
+	case channels == 2 && depth == reflect.Int32:
+		return pGrayA64iAt(pix)
+	case channels == 2 && depth == reflect.Float32:
+		return pGrayA64fAt(pix)
+	case channels == 2 && depth == reflect.Int64:
+		return pGrayA128iAt(pix)
+	case channels == 2 && depth == reflect.Float64:
+		return pGrayA128fAt(pix)
+
+	case channels == 3 && depth == reflect.Uint8:
+		return pRGBAt(pix)
+	case channels == 3 && depth == reflect.Uint16:
+		return pRGB48At(pix)
+	case channels == 3 && depth == Float16:
+		return pRGB48fAt(pix)
+	case channels == 3 && depth == reflect.Int32:
+		return pRGB96iAt(pix)
+	case channels == 3 && depth == reflect.Float32:
+		return pRGB96fAt(pix)
+	case channels == 3 && depth == reflect.Int64:
+		return pRGB192iAt(pix)
+	case channels == 3 && depth == reflect.Float64:
+		return pRGB192fAt(pix)
+
+	case channels == 4 && depth == reflect.Uint8:
+		return pRGBAAt(pix)
+	case channels == 4 && depth == reflect.Uint16:
+		return pRGBA64At(pix)
+	case channels == 4 && depth == Float16:
+		return pRGBA64fAt(pix)
+	case channels == 4 && depth == reflect.Int32:
+		return pRGBA128iAt(pix)
+	case channels == 4 && depth == reflect.Float32:
+		return pRGBA128fAt(pix)
+	case channels == 4 && depth == reflect.Int64:
+		return pRGBA256iAt(pix)
+	case channels == 4 && depth == reflect.Float64:
+		return pRGBA256fAt(pix)
+	}
+	panic(fmt.Errorf("image: invalid channels and depth: %v, %v", channels, depth))
+}
+
+// setPixel sets the interleaved samples of a pixel of the channels and depth
+// to c.
+func setPixel(pix []byte, channels int, depth reflect.Kind, c color.Color) {
+	switch {
+	case channels == 1 && depth == reflect.Uint8:
+		pSetGray(pix, colorExt.GrayModel.Convert(c).(colorExt.Gray))
+	case channels == 1 && depth == reflect.Uint16:
+		pSetGray16(pix, colorExt.Gray16Model.Convert(c).(colorExt.Gray16))
+	case channels == 1 && depth == Float16:
+		pSetGray16f(pix, colorExt.Gray16fModel.Convert(c).(colorExt.Gray16f))
+	case channels == 1 && depth == reflect.Int32:
+		pSetGray32i(pix, colorExt.Gray32iModel.Convert(c).(colorExt.Gray32i))
+	case channels == 1 && depth == reflect.Float32:
+		pSetGray32f(pix, colorExt.Gray32fModel.Convert(c).(colorExt.Gray32f))
+	case channels == 1 && depth == reflect.Int64:
+		pSetGray64i(pix, colorExt.Gray64iModel.Convert(c).(colorExt.Gray64i))
+	case channels == 1 && depth == reflect.Float64:
+		pSetGray64f(pix, colorExt.Gray64fModel.Convert(c).(colorExt.Gray64f))
+
+	case channels == 2 && depth == reflect.Uint8:
+		pSetGrayA(pix, colorExt.GrayAModel.Convert(c).(colorExt.GrayA))
+	case channels == 2 && depth == reflect.Uint16:
+		pSetGrayA32(pix, colorExt.GrayA32Model.Convert(c).(colorExt.GrayA32))
+	case channels == 2 && depth == Float16:
+		pSetGrayA32f(pix, colorExt.GrayA32fModel.Convert(c).(colorExt.GrayA32f))
+	case channels == 2 && depth == reflect.Int32:
+		pSetGrayA64i(pix, colorExt.GrayA64iModel.Convert(c).(colorExt.GrayA64i))
+	case channels == 2 && depth == reflect.Float32:
+		pSetGrayA64f(pix, colorExt.GrayA64fModel.Convert(c).(colorExt.GrayA64f))
+	case channels == 2 && depth == reflect.Int64:
+		pSetGrayA128i(pix, colorExt.GrayA128iModel.Convert(c).(colorExt.GrayA128i))
+	case channels == 2 && depth == reflect.Float64:
+		pSetGrayA128f(pix, colorExt.GrayA128fModel.Convert(c).(colorExt.GrayA128f))
+
+	case channels == 3 && depth == reflect.Uint8:
+		pSetRGB(pix, colorExt.RGBModel.Convert(c).(colorExt.RGB))
+	case channels == 3 && depth == reflect.Uint16:
+		pSetRGB48(pix, colorExt.RGB48Model.Convert(c).(colorExt.RGB48))
+	case channels == 3 && depth == Float16:
+		pSetRGB48f(pix, colorExt.RGB48fModel.Convert(c).(colorExt.RGB48f))
+	case channels == 3 && depth == reflect.Int32:
+		pSetRGB96i(pix, colorExt.RGB96iModel.Convert(c).(colorExt.RGB96i))
+	case channels == 3 && depth == reflect.Float32:
+		pSetRGB96f(pix, colorExt.RGB96fModel.Convert(c).(colorExt.RGB96f))
+	case channels == 3 && depth == reflect.Int64:
+		pSetRGB192i(pix, colorExt.RGB192iModel.Convert(c).(colorExt.RGB192i))
+	case channels == 3 && depth == reflect.Float64:
+		pSetRGB192f(pix, colorExt.RGB192fModel.Convert(c).(colorExt.RGB192f))
+
+	case channels == 4 && depth == reflect.Uint8:
+		pSetRGBA(pix, colorExt.RGBAModel.Convert(c).(colorExt.RGBA))
+	case channels == 4 && depth == reflect.Uint16:
+		pSetRGBA64(pix, colorExt.RGBA64Model.Convert(c).(colorExt.RGBA64))
+	case channels == 4 && depth == Float16:
+		pSetRGBA64f(pix, colorExt.RGBA64fModel.Convert(c).(colorExt.RGBA64f))
+	case channels == 4 && depth == reflect.Int32:
+		pSetRGBA128i(pix, colorExt.RGBA128iModel.Convert(c).(colorExt.RGBA128i))
+	case channels == 4 && depth == reflect.Float32:
+		pSetRGBA128f(pix, colorExt.RGBA128fModel.Convert(c).(colorExt.RGBA128f))
+	case channels == 4 && depth == reflect.Int64:
+		pSetRGBA256i(pix, colorExt.RGBA256iModel.Convert(c).(colorExt.RGBA256i))
+	case channels == 4 && depth == reflect.Float64:
+		pSetRGBA256f(pix, colorExt.RGBA256fModel.Convert(c).(colorExt.RGBA256f))
+	default:
+		panic(fmt.Errorf("image: invalid channels and depth: %v, %v", channels, depth))
+	}
+}
+
+// sampleSize returns the size of a sample of the depth in bytes.
+func sampleSize(depth reflect.Kind) int {
+	switch depth {
+	case reflect.Uint8:
+		return 1
+	case reflect.Uint16, Float16:
+		return 2
+	case reflect.Int32, reflect.Float32:
+		return 4
+	case reflect.Int64, reflect.Float64:
+		return 8
+	}
+	panic(fmt.Errorf("image: invalid depth: %v", depth))
+}
+
+// newGrayImage returns the one channel image of the depth with the pixels.
+func newGrayImage(pix []uint8, stride int, r image.Rectangle, depth reflect.Kind) Image {
+	switch depth {
+	case reflect.Uint8:
+		return new(Gray).Init(pix, stride, r)
+	case reflect.Uint16:
+		return new(Gray16).Init(pix, stride, r)
+	case Float16:
+		return new(Gray16f).Init(pix, stride, r)
+	case reflect.Int32:
+		return new(Gray32i).Init(pix, stride, r)
+	case reflect.Float32:
+		return new(Gray32f).Init(pix, stride, r)
+	case reflect.Int64:
+		return new(Gray64i).Init(pix, stride, r)
+	case reflect.Float64:
+		return new(Gray64f).Init(pix, stride, r)
+	}
+	panic(fmt.Errorf("image: invalid depth: %v", depth))
+}
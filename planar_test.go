@@ -0,0 +1,187 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// randImage returns an interleaved image of random samples.
+func randImage(r image.Rectangle, channels int, depth reflect.Kind) imageExt.Image {
+	m, err := imageExt.NewImage(r, channels, depth)
+	if err != nil {
+		panic(err)
+	}
+	rand.New(rand.NewSource(1)).Read(m.Pix())
+	return m
+}
+
+func TestPlanar(t *testing.T) {
+	r := image.Rect(-2, 3, 5, 7)
+	for channels := 1; channels <= 4; channels++ {
+		for _, depth := range []reflect.Kind{reflect.Uint8, reflect.Uint16, imageExt.Float16, reflect.Int32, reflect.Float32, reflect.Int64, reflect.Float64} {
+			m := randImage(r, channels, depth)
+			p := imageExt.AsPlanar(m)
+			if p.Channels() != channels || p.Depth() != depth || p.Bounds() != r || len(p.Pix()) != len(m.Pix()) {
+				t.Fatalf("%d channels, depth %v: got %d channels, depth %v, bounds %v", channels, depth, p.Channels(), p.Depth(), p.Bounds())
+			}
+			if p.ColorModel() != m.ColorModel() {
+				t.Fatalf("%d channels, depth %v: the color models differ", channels, depth)
+			}
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					// The colors are printed, as NaNs are not equal.
+					if c0, c1 := fmt.Sprint(m.At(x, y)), fmt.Sprint(p.At(x, y)); c0 != c1 {
+						t.Fatalf("%d channels, depth %v: (%d, %d): got %v, want %v", channels, depth, x, y, c1, c0)
+					}
+				}
+			}
+			if !bytes.Equal(p.Interleave().Pix(), m.Pix()) {
+				t.Fatalf("%d channels, depth %v: the interleaved pixels differ", channels, depth)
+			}
+			if reflect.TypeOf(p.Interleave()) != reflect.TypeOf(m) {
+				t.Fatalf("%d channels, depth %v: got %T", channels, depth, p.Interleave())
+			}
+
+			// Setting the colors of m writes the samples of m.
+			p1, err := imageExt.NewPlanar(r, channels, depth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					p1.Set(x, y, m.At(x, y))
+				}
+			}
+			if !bytes.Equal(p1.Pix(), p.Pix()) {
+				t.Fatalf("%d channels, depth %v: the set pixels differ", channels, depth)
+			}
+			if p1.Opaque() != (channels%2 == 1) {
+				t.Fatalf("%d channels, depth %v: got opaque %v", channels, depth, p1.Opaque())
+			}
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					p1.Set(x, y, color.White)
+				}
+			}
+			if !p1.Opaque() {
+				t.Fatalf("%d channels, depth %v: an opaque image is not opaque", channels, depth)
+			}
+		}
+	}
+}
+
+func TestPlanarImage(t *testing.T) {
+	p, err := imageExt.NewPlanar(image.Rect(0, 0, 10, 10), 4, reflect.Uint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imageExt.NewPlanar(image.Rect(0, 0, 10, 10), 5, reflect.Uint8); err == nil {
+		t.Fatal("5 channels: got no error")
+	}
+	if !imageExt.IsPlanar(p) || imageExt.IsPlanar(p.Interleave()) {
+		t.Fatal("IsPlanar is wrong")
+	}
+	if p.Opaque() {
+		t.Fatal("a transparent image is opaque")
+	}
+	p.Set(6, 3, color.RGBA{0x10, 0x20, 0x30, 0xff})
+	if c := p.At(6, 3); c != (colorExt.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xff}) {
+		t.Fatalf("got %v", c)
+	}
+	// The channels are in separate planes.
+	for i, v := range []uint8{0x10, 0x20, 0x30, 0xff} {
+		if got := p.Pix()[i*100+3*10+6]; got != v {
+			t.Fatalf("channel %d: got %#x, want %#x", i, got, v)
+		}
+	}
+
+	s := p.SubImage(image.Rect(6, 3, 8, 5)).(*imageExt.Planar)
+	if c := s.At(6, 3); c != p.At(6, 3) {
+		t.Fatalf("sub-image: got %v", c)
+	}
+	s.Set(7, 4, color.White)
+	if c := p.At(7, 4); c != (colorExt.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+		t.Fatalf("sub-image: the pixels are not shared, got %v", c)
+	}
+	if !s.SubImage(image.Rect(6, 3, 7, 4)).(*imageExt.Planar).Opaque() {
+		t.Fatal("sub-image: an opaque pixel is not opaque")
+	}
+	if c := s.At(0, 0); c != (colorExt.RGBA{}) {
+		t.Fatalf("sub-image: got %v outside", c)
+	}
+	p.SubImage(image.Rect(10, 10, 10, 10))
+
+	// The channel views share pixels with the image.
+	g := s.Channel(1).(*imageExt.Gray)
+	if g.Bounds() != s.Bounds() || g.GrayAt(6, 3).Y != 0x20 {
+		t.Fatalf("got a channel with bounds %v and %v", g.Bounds(), g.GrayAt(6, 3))
+	}
+	g.SetGray(6, 4, colorExt.Gray{Y: 0x77})
+	if c := p.At(6, 4).(colorExt.RGBA); c.G != 0x77 {
+		t.Fatalf("the channel pixels are not shared, got %v", c)
+	}
+
+	c := imageExt.CloneImage(s).(*imageExt.Planar)
+	c.Set(6, 3, color.Black)
+	if c.At(7, 4) != s.At(7, 4) || s.At(6, 3) == c.At(6, 3) {
+		t.Fatal("the clone is not a copy")
+	}
+	d := imageExt.Downsample(p).(*imageExt.Planar)
+	if want := imageExt.Downsample(p.Interleave()); !bytes.Equal(d.Interleave().Pix(), want.Pix()) {
+		t.Fatal("the downsampled pixels differ")
+	}
+}
+
+func TestSplitChannels(t *testing.T) {
+	r := image.Rect(1, 2, 8, 5)
+	m := randImage(r, 3, reflect.Uint16).(*imageExt.RGB48)
+	gray := imageExt.SplitChannels(m)
+	if len(gray) != 3 {
+		t.Fatalf("got %d channels", len(gray))
+	}
+	for i, g := range gray {
+		g := g.(*imageExt.Gray16)
+		c := m.RGB48At(4, 3)
+		if want := []uint16{c.R, c.G, c.B}[i]; g.Gray16At(4, 3).Y != want || g.Bounds() != r {
+			t.Fatalf("channel %d: got %v, want %#x", i, g.Gray16At(4, 3), want)
+		}
+	}
+	for _, split := range [][]imageExt.Image{gray, imageExt.SplitChannels(imageExt.AsPlanar(m))} {
+		merged, err := imageExt.MergeChannels(split...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(merged.Pix(), m.Pix()) {
+			t.Fatal("the merged pixels differ")
+		}
+	}
+
+	// Other images are split as AsImage images.
+	if gray := imageExt.SplitChannels(image.NewNRGBA(r)); len(gray) != 4 || gray[0].Depth() != reflect.Uint16 {
+		t.Fatalf("got %d channels of depth %v", len(gray), gray[0].Depth())
+	}
+
+	for _, gray := range [][]imageExt.Image{
+		nil,
+		{m},
+		{gray[0], imageExt.NewGray(r)},
+		{gray[0], imageExt.NewGray16(image.Rect(0, 0, 7, 3))},
+		{gray[0], gray[1], gray[2], gray[0], gray[1]},
+	} {
+		if _, err := imageExt.MergeChannels(gray...); err == nil {
+			t.Fatalf("%d channels: got no error", len(gray))
+		}
+	}
+}
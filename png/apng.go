@@ -0,0 +1,369 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"io"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// Disposal Methods, with the same values as those of the gif package.
+const (
+	DisposalNone       = 0x01
+	DisposalBackground = 0x02
+	DisposalPrevious   = 0x03
+)
+
+// Blend Operations.
+const (
+	BlendSource = 0x00
+	BlendOver   = 0x01
+)
+
+// APNG represents the possibly multiple images stored in an animated PNG file.
+type APNG struct {
+	Image []image.Image // The successive images.
+	Delay []int         // The successive delay times, one per frame, in 100ths of a second.
+	// LoopCount controls the number of times an animation will be
+	// restarted during display, with the same meaning as that of the gif
+	// package.
+	// A LoopCount of 0 means to loop forever.
+	// A LoopCount of -1 means to show each frame only once.
+	// Otherwise, the animation is looped LoopCount+1 times.
+	LoopCount int
+	// Disposal is the successive disposal methods, one per frame. For
+	// backwards compatibility, a nil Disposal is valid to pass to EncodeAll,
+	// and implies that each frame's disposal method is 0 (no disposal
+	// specified), which is treated as DisposalNone.
+	Disposal []byte
+	// Blend is the successive blend operations, one per frame. A nil Blend
+	// is valid to pass to EncodeAll, and implies BlendOver for each frame.
+	Blend []byte
+	// Config is the global color model and the size of the canvas. If the
+	// canvas size is zero, the bounds of the first frame are used.
+	Config image.Config
+	// Default is the image that decoders without APNG support show, if it
+	// is not the first frame. It covers the whole canvas.
+	Default image.Image
+}
+
+// frameControl is the content of an fcTL chunk.
+type frameControl struct {
+	width, height      int
+	x, y               int
+	delayNum, delayDen uint16
+	dispose, blend     byte
+}
+
+// parseSequence reads the sequence number at the start of a chunk of length
+// bytes, and returns the length of the remaining data.
+func (d *decoder) parseSequence(length uint32) (uint32, error) {
+	if length < 4 {
+		return 0, FormatError("bad " + string(d.tmp[4:8]) + " length")
+	}
+	if _, err := io.ReadFull(d.r, d.tmp[:4]); err != nil {
+		return 0, err
+	}
+	d.crc.Write(d.tmp[:4])
+	if binary.BigEndian.Uint32(d.tmp[:4]) != d.seq {
+		return 0, FormatError("bad sequence number")
+	}
+	d.seq++
+	return length - 4, nil
+}
+
+func (d *decoder) parseacTL(length uint32) error {
+	if length != 8 {
+		return FormatError("bad acTL length")
+	}
+	if _, err := io.ReadFull(d.r, d.tmp[:8]); err != nil {
+		return err
+	}
+	d.crc.Write(d.tmp[:8])
+	switch plays := int(binary.BigEndian.Uint32(d.tmp[4:8])); plays {
+	case 0:
+		d.anim.LoopCount = 0
+	case 1:
+		d.anim.LoopCount = -1
+	default:
+		d.anim.LoopCount = plays - 1
+	}
+	return d.verifyChecksum()
+}
+
+func (d *decoder) parsefcTL(length uint32) error {
+	if length != 26 {
+		return FormatError("bad fcTL length")
+	}
+	if _, err := d.parseSequence(length); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(d.r, d.tmp[:22]); err != nil {
+		return err
+	}
+	d.crc.Write(d.tmp[:22])
+	f := frameControl{
+		width:    int(binary.BigEndian.Uint32(d.tmp[0:4])),
+		height:   int(binary.BigEndian.Uint32(d.tmp[4:8])),
+		x:        int(binary.BigEndian.Uint32(d.tmp[8:12])),
+		y:        int(binary.BigEndian.Uint32(d.tmp[12:16])),
+		delayNum: binary.BigEndian.Uint16(d.tmp[16:18]),
+		delayDen: binary.BigEndian.Uint16(d.tmp[18:20]),
+		dispose:  d.tmp[20],
+		blend:    d.tmp[21],
+	}
+	if f.width <= 0 || f.height <= 0 || f.x < 0 || f.y < 0 ||
+		f.width > d.width-f.x || f.height > d.height-f.y {
+		return FormatError("bad frame bounds")
+	}
+	if d.stage < dsSeenIDAT && (f.x != 0 || f.y != 0 || f.width != d.width || f.height != d.height) {
+		return FormatError("bad default frame bounds")
+	}
+	if f.dispose > 2 {
+		return FormatError("bad dispose op")
+	}
+	if f.blend > 1 {
+		return FormatError("bad blend op")
+	}
+	d.frame, d.hasFrame = f, true
+	return d.verifyChecksum()
+}
+
+// parsefdAT decodes the frame whose image data starts with an fdAT chunk of
+// length bytes.
+func (d *decoder) parsefdAT(length uint32) error {
+	n, err := d.parseSequence(length)
+	if err != nil {
+		return err
+	}
+	width, height := d.width, d.height
+	d.width, d.height = d.frame.width, d.frame.height
+	d.fdAT, d.idatLength = true, n
+	img, err := d.decode()
+	d.width, d.height = width, height
+	d.fdAT = false
+	if err != nil {
+		return err
+	}
+	if err := d.verifyChecksum(); err != nil {
+		return err
+	}
+	d.addFrame(img)
+	return nil
+}
+
+// addFrame appends img to the animation, at the position and with the
+// timing of the last fcTL chunk.
+func (d *decoder) addFrame(img image.Image) {
+	f := d.frame
+	translate(img, f.x, f.y)
+	den := int(f.delayDen)
+	if den == 0 {
+		// A denominator of 0 means 100ths of a second.
+		den = 100
+	}
+	// Disposal ops 0, 1 and 2 are DisposalNone, DisposalBackground and
+	// DisposalPrevious.
+	d.anim.Image = append(d.anim.Image, img)
+	d.anim.Delay = append(d.anim.Delay, (int(f.delayNum)*100+den/2)/den)
+	d.anim.Disposal = append(d.anim.Disposal, f.dispose+DisposalNone)
+	d.anim.Blend = append(d.anim.Blend, f.blend)
+	d.hasFrame = false
+}
+
+// translate moves the origin of the decoded image m to (x, y).
+func translate(m image.Image, x, y int) {
+	if x == 0 && y == 0 {
+		return
+	}
+	r := m.Bounds().Add(image.Pt(x, y))
+	switch m := m.(type) {
+	case *image.Gray:
+		m.Rect = r
+	case *image.Gray16:
+		m.Rect = r
+	case *image.NRGBA:
+		m.Rect = r
+	case *image.NRGBA64:
+		m.Rect = r
+	case *image.RGBA:
+		m.Rect = r
+	case *image.RGBA64:
+		m.Rect = r
+	case *image.Paletted:
+		m.Rect = r
+	case *imageExt.RGB:
+		m.M.Rect = r
+	case *imageExt.RGB48:
+		m.M.Rect = r
+	case *imageExt.GrayA:
+		m.M.Rect = r
+	case *imageExt.GrayA32:
+		m.M.Rect = r
+	}
+}
+
+// DecodeAll reads an animated PNG image from r and returns the sequential
+// frames and timing information. A PNG image without animation is returned
+// as a single frame.
+func DecodeAll(r io.Reader) (*APNG, error) {
+	d := &decoder{
+		r:    r,
+		crc:  crc32.NewIEEE(),
+		anim: new(APNG),
+	}
+	if err := d.checkHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	for d.stage != dsSeenIEND {
+		if err := d.parseChunk(false); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	a := d.anim
+	if len(a.Image) == 0 {
+		// The file has no animation, or ends before its frames.
+		a.Image, a.Delay = []image.Image{d.img}, []int{0}
+		a.Disposal, a.Blend = []byte{0}, []byte{BlendSource}
+		a.Default = nil
+	}
+	a.Config = image.Config{
+		ColorModel: d.img.ColorModel(),
+		Width:      d.width,
+		Height:     d.height,
+	}
+	return a, nil
+}
+
+func (e *encoder) writeacTL(frames, loopCount int) {
+	plays := 0
+	switch {
+	case loopCount < 0:
+		plays = 1
+	case loopCount > 0:
+		plays = loopCount + 1
+	}
+	writeUint32(e.tmp[0:4], uint32(frames))
+	writeUint32(e.tmp[4:8], uint32(plays))
+	e.writeChunk(e.tmp[:8], "acTL")
+}
+
+func (e *encoder) writefcTL(r image.Rectangle, delay int, disposal, blend byte) {
+	writeUint32(e.tmp[0:4], e.seq)
+	writeUint32(e.tmp[4:8], uint32(r.Dx()))
+	writeUint32(e.tmp[8:12], uint32(r.Dy()))
+	writeUint32(e.tmp[12:16], uint32(r.Min.X))
+	writeUint32(e.tmp[16:20], uint32(r.Min.Y))
+	binary.BigEndian.PutUint16(e.tmp[20:22], uint16(delay))
+	binary.BigEndian.PutUint16(e.tmp[22:24], 100)
+	e.tmp[24], e.tmp[25] = disposal, blend
+	e.seq++
+	e.writeChunk(e.tmp[:26], "fcTL")
+}
+
+// EncodeAll writes the images in a to w in animated PNG format. Default
+// parameters are used if a nil *Options is passed. The frames share the
+// color type of the file, so they are encoded with a palette only if they
+// all have the same one.
+func EncodeAll(w io.Writer, a *APNG, opt *Options) error {
+	if opt == nil {
+		opt = new(Options)
+	}
+	if err := checkOptions(opt); err != nil {
+		return err
+	}
+	if len(a.Image) == 0 {
+		return errors.New("png: must provide at least one image")
+	}
+	if len(a.Image) != len(a.Delay) {
+		return errors.New("png: mismatched image and delay lengths")
+	}
+	if a.Disposal != nil && len(a.Image) != len(a.Disposal) {
+		return errors.New("png: mismatched image and disposal lengths")
+	}
+	if a.Blend != nil && len(a.Image) != len(a.Blend) {
+		return errors.New("png: mismatched image and blend lengths")
+	}
+
+	canvas := image.Rect(0, 0, a.Config.Width, a.Config.Height)
+	if canvas.Empty() {
+		canvas.Max = a.Image[0].Bounds().Max
+	}
+	if err := checkSize(canvas.Dx(), canvas.Dy()); err != nil {
+		return err
+	}
+	images := make([]image.Image, len(a.Image))
+	for i, m := range a.Image {
+		images[i] = interleave(m)
+	}
+	frames := images
+	if a.Default != nil {
+		if a.Default.Bounds() != canvas {
+			return errors.New("png: default image does not cover the canvas")
+		}
+		frames = append([]image.Image{interleave(a.Default)}, frames...)
+	} else if a.Image[0].Bounds() != canvas {
+		return errors.New("png: first frame does not cover the canvas")
+	}
+	for i, m := range a.Image {
+		if b := m.Bounds(); b.Empty() || !b.In(canvas) {
+			return errors.New("png: frame bounds outside canvas")
+		}
+		if a.Delay[i] < 0 || a.Delay[i] > 0xffff {
+			return errors.New("png: invalid delay")
+		}
+		if a.Disposal != nil && a.Disposal[i] > DisposalPrevious {
+			return errors.New("png: invalid disposal method")
+		}
+		if a.Blend != nil && a.Blend[i] > BlendOver {
+			return errors.New("png: invalid blend operation")
+		}
+	}
+
+	e := &encoder{
+		opt:    opt,
+		w:      w,
+		frames: frames,
+		width:  canvas.Dx(),
+		height: canvas.Dy(),
+	}
+	e.chooseFormat()
+
+	_, e.err = io.WriteString(w, pngHeader)
+	e.writeIHDR()
+	e.writeacTL(len(a.Image), a.LoopCount)
+	e.writeMetadataBeforePLTE()
+	e.writePLTEAndTRNS()
+	e.writeMetadata()
+	if a.Default != nil {
+		e.m = frames[0]
+		e.writeIDATs()
+	}
+	for i, m := range images {
+		disposal, blend := byte(0), byte(BlendOver)
+		if a.Disposal != nil && a.Disposal[i] != 0 {
+			disposal = a.Disposal[i] - DisposalNone
+		}
+		if a.Blend != nil {
+			blend = a.Blend[i]
+		}
+		e.writefcTL(m.Bounds(), a.Delay[i], disposal, blend)
+		e.m, e.fdAT = m, i > 0 || a.Default != nil
+		e.writeIDATs()
+	}
+	e.writeIEND()
+	return e.err
+}
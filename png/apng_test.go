@@ -0,0 +1,237 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func testFrame(r image.Rectangle, seed int) *image.NRGBA {
+	m := image.NewNRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.SetNRGBA(x, y, color.NRGBA{uint8(x * seed), uint8(y + seed), uint8(x + y), uint8(0xff - x*y)})
+		}
+	}
+	return m
+}
+
+func encodeDecodeAll(a *APNG, opt *Options) (*APNG, []byte, error) {
+	var b bytes.Buffer
+	if err := EncodeAll(&b, a, opt); err != nil {
+		return nil, nil, err
+	}
+	a1, err := DecodeAll(bytes.NewReader(b.Bytes()))
+	return a1, b.Bytes(), err
+}
+
+func TestEncodeAll(t *testing.T) {
+	a := &APNG{
+		Image: []image.Image{
+			testFrame(image.Rect(0, 0, 16, 12), 1),
+			testFrame(image.Rect(3, 2, 10, 11), 2),
+			testFrame(image.Rect(15, 11, 16, 12), 3),
+		},
+		Delay:     []int{10, 0, 250},
+		Disposal:  []byte{DisposalNone, DisposalBackground, DisposalPrevious},
+		Blend:     []byte{BlendSource, BlendOver, BlendSource},
+		LoopCount: 2,
+	}
+	for _, opt := range []*Options{nil, {Interlace: true}, {Filter: FilterPaeth}} {
+		a1, _, err := encodeDecodeAll(a, opt)
+		if err != nil {
+			t.Fatalf("%+v: %v", opt, err)
+		}
+		if len(a1.Image) != len(a.Image) {
+			t.Fatalf("%+v: got %d frames, want %d", opt, len(a1.Image), len(a.Image))
+		}
+		for i := range a.Image {
+			if b0, b1 := a.Image[i].Bounds(), a1.Image[i].Bounds(); b0 != b1 {
+				t.Fatalf("%+v: frame %d: got bounds %v, want %v", opt, i, b1, b0)
+			}
+			if err := diff(a.Image[i], a1.Image[i]); err != nil {
+				t.Fatalf("%+v: frame %d: %v", opt, i, err)
+			}
+		}
+		if !reflect.DeepEqual(a1.Delay, a.Delay) {
+			t.Fatalf("%+v: got delays %v, want %v", opt, a1.Delay, a.Delay)
+		}
+		if !bytes.Equal(a1.Disposal, a.Disposal) || !bytes.Equal(a1.Blend, a.Blend) {
+			t.Fatalf("%+v: got disposal %v and blend %v", opt, a1.Disposal, a1.Blend)
+		}
+		if a1.LoopCount != a.LoopCount || a1.Default != nil {
+			t.Fatalf("%+v: got loop count %d and default image %v", opt, a1.LoopCount, a1.Default)
+		}
+		if a1.Config.Width != 16 || a1.Config.Height != 12 {
+			t.Fatalf("%+v: got config %+v", opt, a1.Config)
+		}
+	}
+
+	// Decode returns the first frame.
+	var b bytes.Buffer
+	if err := EncodeAll(&b, a, nil); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Decode(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(a.Image[0], m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeAllDefault(t *testing.T) {
+	def := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range def.Pix {
+		def.Pix[i] = uint8(i)
+	}
+	frame := image.NewGray(image.Rect(2, 2, 6, 5))
+	for i := range frame.Pix {
+		frame.Pix[i] = uint8(3 * i)
+	}
+	a := &APNG{
+		Image:     []image.Image{frame},
+		Delay:     []int{5},
+		LoopCount: -1,
+		Config:    image.Config{Width: 8, Height: 8},
+		Default:   def,
+	}
+	a1, data, err := encodeDecodeAll(a, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ct, _ := ihdr(data); depth != 8 || ct != ctGrayscale {
+		t.Fatalf("got bit depth %d and color type %d", depth, ct)
+	}
+	if a1.Default == nil || len(a1.Image) != 1 || a1.LoopCount != -1 {
+		t.Fatalf("got %d frames, loop count %d and default image %v", len(a1.Image), a1.LoopCount, a1.Default)
+	}
+	if err := diff(def, a1.Default); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(frame, a1.Image[0]); err != nil {
+		t.Fatal(err)
+	}
+	if a1.Image[0].Bounds() != frame.Bounds() {
+		t.Fatalf("got bounds %v, want %v", a1.Image[0].Bounds(), frame.Bounds())
+	}
+
+	// Decode returns the default image.
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(def, m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeAllPalette(t *testing.T) {
+	pal := color.Palette{color.Black, color.White, color.NRGBA{0xff, 0, 0, 0x80}}
+	frames := make([]image.Image, 3)
+	for i := range frames {
+		m := image.NewPaletted(image.Rect(0, 0, 7, 5), pal)
+		for j := range m.Pix {
+			m.Pix[j] = uint8((i + j) % len(pal))
+		}
+		frames[i] = m
+	}
+	a := &APNG{Image: frames, Delay: make([]int, len(frames))}
+	a1, data, err := encodeDecodeAll(a, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ct, _ := ihdr(data); depth != 2 || ct != ctPaletted {
+		t.Fatalf("got bit depth %d and color type %d", depth, ct)
+	}
+	for i := range frames {
+		if err := diff(frames[i], a1.Image[i]); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+
+	// Frames with different palettes share a generated palette.
+	frames[1] = testFrame(image.Rect(1, 1, 3, 3), 1)
+	a1, data, err = encodeDecodeAll(a, &Options{Palette: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ct, _ := ihdr(data); ct != ctPaletted {
+		t.Fatalf("got color type %d", ct)
+	}
+	for i := range frames {
+		if err := diff(frames[i], a1.Image[i]); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+}
+
+func TestDecodeAllStill(t *testing.T) {
+	m := testFrame(image.Rect(0, 0, 5, 4), 1)
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	a, err := DecodeAll(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Image) != 1 || a.Default != nil {
+		t.Fatalf("got %d frames and default image %v", len(a.Image), a.Default)
+	}
+	if err := diff(m, a.Image[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeAllErrors(t *testing.T) {
+	m := testFrame(image.Rect(0, 0, 4, 4), 1)
+	for _, a := range []*APNG{
+		{},
+		{Image: []image.Image{m}},
+		{Image: []image.Image{m}, Delay: []int{0}, Disposal: []byte{0, 0}},
+		{Image: []image.Image{m}, Delay: []int{0}, Blend: []byte{2}},
+		{Image: []image.Image{m}, Delay: []int{0x10000}},
+		{Image: []image.Image{m, testFrame(image.Rect(2, 2, 5, 5), 1)}, Delay: []int{0, 0}},
+		{Image: []image.Image{testFrame(image.Rect(1, 0, 4, 4), 1)}, Delay: []int{0}},
+		{Image: []image.Image{m}, Delay: []int{0}, Default: testFrame(image.Rect(0, 0, 3, 4), 1)},
+	} {
+		if err := EncodeAll(ioutil.Discard, a, nil); err == nil {
+			t.Fatalf("encoding %+v succeeded", a)
+		}
+	}
+}
+
+func TestDecodeAllErrors(t *testing.T) {
+	a := &APNG{
+		Image: []image.Image{testFrame(image.Rect(0, 0, 4, 4), 0), testFrame(image.Rect(0, 0, 4, 4), 1)},
+		Delay: []int{0, 0},
+	}
+	var b bytes.Buffer
+	if err := EncodeAll(&b, a, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	// Break the sequence number of the second fcTL chunk.
+	i := bytes.LastIndex(data, []byte("fcTL"))
+	bad := append([]byte(nil), data...)
+	bad[i+7]++
+	binary.BigEndian.PutUint32(bad[i+30:], crc32.ChecksumIEEE(bad[i:i+30]))
+	if _, err := DecodeAll(bytes.NewReader(bad)); err == nil {
+		t.Fatal("decoding a bad sequence number succeeded")
+	}
+	// Decode ignores the animation chunks.
+	if _, err := Decode(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,518 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"unicode/utf8"
+)
+
+// A RenderingIntent is the rendering intent of an sRGB chunk.
+type RenderingIntent uint8
+
+const (
+	Perceptual           RenderingIntent = 0
+	RelativeColorimetric RenderingIntent = 1
+	Saturation           RenderingIntent = 2
+	AbsoluteColorimetric RenderingIntent = 3
+)
+
+// A Text is the keyword and text of a tEXt, zTXt or iTXt chunk.
+type Text struct {
+	Keyword string
+	Text    string
+	// Compressed is whether the text is compressed, as in zTXt chunks.
+	Compressed bool
+	// International is whether the text is stored in an iTXt chunk, in
+	// UTF-8 rather than Latin-1. Texts that cannot be stored in Latin-1
+	// are always written as iTXt chunks.
+	International bool
+	// LanguageTag and TranslatedKeyword are only stored in iTXt chunks.
+	LanguageTag       string
+	TranslatedKeyword string
+}
+
+// Chromaticities are the CIE x and y chromaticities of the white point and
+// the primaries of a cHRM chunk.
+type Chromaticities struct {
+	WhiteX, WhiteY float64
+	RedX, RedY     float64
+	GreenX, GreenY float64
+	BlueX, BlueY   float64
+}
+
+// A Chunk is an ancillary chunk that the package does not interpret, such
+// as a private chunk.
+//
+// The case of the 4th letter of its Type tells whether the chunk is safe to
+// copy into a file whose image data was modified: lowercase letters are
+// safe, and uppercase letters are not, as in tIME.
+type Chunk struct {
+	Type string
+	Data []byte
+}
+
+// Metadata holds the ancillary chunks of a PNG file. The zero values of its
+// fields mean that the chunk is absent.
+type Metadata struct {
+	// Text holds the tEXt, zTXt and iTXt chunks, in file order.
+	Text []Text
+	// Gamma is the image gamma of a gAMA chunk, such as 1/2.2.
+	Gamma float64
+	// Chromaticities is the content of a cHRM chunk.
+	Chromaticities *Chromaticities
+	// SRGB is whether there is an sRGB chunk, whose rendering intent is
+	// RenderingIntent.
+	SRGB            bool
+	RenderingIntent RenderingIntent
+	// ICCProfile is the uncompressed profile of an iCCP chunk, whose name
+	// is ICCProfileName.
+	ICCProfileName string
+	ICCProfile     []byte
+	// PixelsPerUnitX and PixelsPerUnitY are the pixel density of a pHYs
+	// chunk. The unit is the meter if UnitMeter is true, and unknown
+	// otherwise, so that only the pixel aspect ratio is given.
+	PixelsPerUnitX, PixelsPerUnitY uint32
+	UnitMeter                      bool
+	// Background is the color of a bKGD chunk. Its samples are scaled to
+	// the bit depth of the encoded image, and the nearest palette entry is
+	// used for paletted images.
+	Background color.Color
+	// SignificantBits is the number of significant bits of each channel of
+	// an sBIT chunk. It is only written if it has one entry per channel of
+	// the encoded image, counting the palette entries as 3 channels.
+	SignificantBits []uint8
+	// Chunks holds the other ancillary chunks, such as private chunks, in
+	// file order. They are written before the image data. DecodeMetadata
+	// only keeps the chunks that are safe to copy.
+	Chunks []Chunk
+}
+
+// DPI returns the horizontal and vertical pixel density in dots per inch,
+// if the unit of the pHYs chunk is the meter.
+func (m *Metadata) DPI() (x, y float64, ok bool) {
+	if !m.UnitMeter || m.PixelsPerUnitX == 0 || m.PixelsPerUnitY == 0 {
+		return 0, 0, false
+	}
+	return float64(m.PixelsPerUnitX) * 0.0254, float64(m.PixelsPerUnitY) * 0.0254, true
+}
+
+// SetDPI sets the pixel density of the pHYs chunk in dots per inch.
+func (m *Metadata) SetDPI(x, y float64) {
+	m.PixelsPerUnitX = uint32(math.Floor(x/0.0254 + 0.5))
+	m.PixelsPerUnitY = uint32(math.Floor(y/0.0254 + 0.5))
+	m.UnitMeter = true
+}
+
+// apngChunks are the chunks that DecodeAll reads, rather than Chunks.
+var apngChunks = map[string]bool{
+	"acTL": true,
+	"fcTL": true,
+	"fdAT": true,
+}
+
+// readChunkData reads the data and the checksum of a chunk of length bytes.
+func (d *decoder) readChunkData(length uint32) ([]byte, error) {
+	if length > 0x7fffffff {
+		return nil, FormatError("bad chunk length")
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(length)); err != nil {
+		return nil, err
+	}
+	d.crc.Write(buf.Bytes())
+	if err := d.verifyChecksum(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cutNul returns the bytes of b before and after its first NUL byte.
+func cutNul(b []byte) (before, after []byte, ok bool) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return b, nil, false
+	}
+	return b[:i], b[i+1:], true
+}
+
+// maxInflatedLen is the maximum length of the decompressed data of a zTXt,
+// iTXt or iCCP chunk.
+const maxInflatedLen = 8 << 20
+
+func inflate(b []byte, method byte) ([]byte, error) {
+	if method != 0 {
+		return nil, UnsupportedError("compression method")
+	}
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, FormatError(err.Error())
+	}
+	defer r.Close()
+	b, err = ioutil.ReadAll(io.LimitReader(r, maxInflatedLen+1))
+	if err != nil {
+		return nil, FormatError(err.Error())
+	}
+	if len(b) > maxInflatedLen {
+		return nil, UnsupportedError("decompressed chunk too large")
+	}
+	return b, nil
+}
+
+func latin1ToString(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// parseMetadata reads an ancillary chunk of the given type into d.meta.
+// A malformed chunk is skipped, as the image does not depend on it.
+func (d *decoder) parseMetadata(name string, length uint32) error {
+	data, err := d.readChunkData(length)
+	if err != nil {
+		return err
+	}
+	d.parseMetadataChunk(name, data)
+	return nil
+}
+
+// parseMetadataChunk parses the data of an ancillary chunk into d.meta. The
+// unknown chunks that are not safe to copy are skipped.
+func (d *decoder) parseMetadataChunk(name string, data []byte) (err error) {
+	m := d.meta
+	switch name {
+	case "tEXt":
+		k, v, ok := cutNul(data)
+		if !ok {
+			return FormatError("bad tEXt chunk")
+		}
+		m.Text = append(m.Text, Text{Keyword: latin1ToString(k), Text: latin1ToString(v)})
+	case "zTXt":
+		k, v, ok := cutNul(data)
+		if !ok || len(v) < 1 {
+			return FormatError("bad zTXt chunk")
+		}
+		if v, err = inflate(v[1:], v[0]); err != nil {
+			return err
+		}
+		m.Text = append(m.Text, Text{Keyword: latin1ToString(k), Text: latin1ToString(v), Compressed: true})
+	case "iTXt":
+		k, v, ok := cutNul(data)
+		if !ok || len(v) < 2 {
+			return FormatError("bad iTXt chunk")
+		}
+		t := Text{Keyword: latin1ToString(k), Compressed: v[0] != 0, International: true}
+		method := v[1]
+		lang, v, ok := cutNul(v[2:])
+		if !ok {
+			return FormatError("bad iTXt chunk")
+		}
+		tk, v, ok := cutNul(v)
+		if !ok {
+			return FormatError("bad iTXt chunk")
+		}
+		if t.Compressed {
+			if v, err = inflate(v, method); err != nil {
+				return err
+			}
+		}
+		t.LanguageTag, t.TranslatedKeyword, t.Text = string(lang), string(tk), string(v)
+		m.Text = append(m.Text, t)
+	case "gAMA":
+		if len(data) != 4 {
+			return FormatError("bad gAMA length")
+		}
+		m.Gamma = float64(binary.BigEndian.Uint32(data)) / 100000
+	case "cHRM":
+		if len(data) != 32 {
+			return FormatError("bad cHRM length")
+		}
+		var v [8]float64
+		for i := range v {
+			v[i] = float64(binary.BigEndian.Uint32(data[4*i:])) / 100000
+		}
+		m.Chromaticities = &Chromaticities{v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7]}
+	case "sRGB":
+		if len(data) != 1 {
+			return FormatError("bad sRGB length")
+		}
+		m.SRGB, m.RenderingIntent = true, RenderingIntent(data[0])
+	case "iCCP":
+		k, v, ok := cutNul(data)
+		if !ok || len(v) < 1 {
+			return FormatError("bad iCCP chunk")
+		}
+		if m.ICCProfile, err = inflate(v[1:], v[0]); err != nil {
+			return err
+		}
+		m.ICCProfileName = latin1ToString(k)
+	case "pHYs":
+		if len(data) != 9 {
+			return FormatError("bad pHYs length")
+		}
+		m.PixelsPerUnitX = binary.BigEndian.Uint32(data[0:4])
+		m.PixelsPerUnitY = binary.BigEndian.Uint32(data[4:8])
+		m.UnitMeter = data[8] == 1
+	case "bKGD":
+		return d.parsebKGD(data)
+	case "sBIT":
+		m.SignificantBits = data
+	default:
+		if name[3]&0x20 != 0 {
+			m.Chunks = append(m.Chunks, Chunk{Type: name, Data: data})
+		}
+	}
+	return nil
+}
+
+// sample16 scales a sample of d.depth bits to 16 bits.
+func (d *decoder) sample16(v uint16) uint16 {
+	return uint16(uint32(v) * 0xffff / (1<<uint(d.depth) - 1))
+}
+
+func (d *decoder) parsebKGD(data []byte) error {
+	switch {
+	case cbPaletted(d.cb):
+		if len(data) != 1 {
+			return FormatError("bad bKGD length")
+		}
+		if int(data[0]) < len(d.palette) {
+			d.meta.Background = d.palette[data[0]]
+		}
+	case d.cb == cbTC8 || d.cb == cbTCA8 || d.cb == cbTC16 || d.cb == cbTCA16:
+		if len(data) != 6 {
+			return FormatError("bad bKGD length")
+		}
+		d.meta.Background = color.RGBA64{
+			d.sample16(binary.BigEndian.Uint16(data[0:2])),
+			d.sample16(binary.BigEndian.Uint16(data[2:4])),
+			d.sample16(binary.BigEndian.Uint16(data[4:6])),
+			0xffff,
+		}
+	default:
+		if len(data) != 2 {
+			return FormatError("bad bKGD length")
+		}
+		d.meta.Background = color.Gray16{d.sample16(binary.BigEndian.Uint16(data))}
+	}
+	return nil
+}
+
+// DecodeMetadata reads the ancillary chunks of a PNG image from r, without
+// decoding the image data.
+func DecodeMetadata(r io.Reader) (*Metadata, error) {
+	d := &decoder{
+		r:        r,
+		crc:      crc32.NewIEEE(),
+		meta:     new(Metadata),
+		metaOnly: true,
+	}
+	if err := d.checkHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	for d.stage != dsSeenIEND {
+		if err := d.parseChunk(false); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	return d.meta, nil
+}
+
+func (e *encoder) writeText(t Text) {
+	k, ok := toLatin1(t.Keyword)
+	if !ok || len(k) < 1 || len(k) > 79 {
+		e.err = FormatError("invalid text keyword: " + t.Keyword)
+		return
+	}
+	v, latin1 := toLatin1(t.Text)
+	latin1 = latin1 && !t.International
+	var b bytes.Buffer
+	b.Write(k)
+	b.WriteByte(0)
+	switch {
+	case latin1 && !t.Compressed:
+		b.Write(v)
+		e.writeChunk(b.Bytes(), "tEXt")
+	case latin1:
+		b.WriteByte(0)
+		e.deflate(&b, v)
+		e.writeChunk(b.Bytes(), "zTXt")
+	default:
+		if !utf8.ValidString(t.Text) || !utf8.ValidString(t.TranslatedKeyword) {
+			e.err = FormatError("invalid UTF-8 text")
+			return
+		}
+		if t.Compressed {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+		b.WriteByte(0)
+		b.WriteString(t.LanguageTag)
+		b.WriteByte(0)
+		b.WriteString(t.TranslatedKeyword)
+		b.WriteByte(0)
+		if t.Compressed {
+			e.deflate(&b, []byte(t.Text))
+		} else {
+			b.WriteString(t.Text)
+		}
+		e.writeChunk(b.Bytes(), "iTXt")
+	}
+}
+
+// toLatin1 returns s in Latin-1, and whether s holds only Latin-1
+// characters other than NUL.
+func toLatin1(s string) ([]byte, bool) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r == 0 || r > 0xff {
+			return b, false
+		}
+		b = append(b, byte(r))
+	}
+	return b, true
+}
+
+// deflate appends the zlib compressed data to b.
+func (e *encoder) deflate(b *bytes.Buffer, data []byte) {
+	zw, err := zlib.NewWriterLevel(b, levelToZlib(e.opt.CompressionLevel))
+	if err != nil {
+		e.err = err
+		return
+	}
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		e.err = err
+	}
+}
+
+// sampleAt scales a 16 bit sample to the bit depth of the encoded image.
+func (e *encoder) sampleAt(v uint32) uint16 {
+	depth, _ := cbFormat(e.cb)
+	max := uint32(1)<<depth - 1
+	return uint16((v*max + 0x7fff) / 0xffff)
+}
+
+// writeMetadataBeforePLTE writes the ancillary chunks that precede the
+// palette.
+func (e *encoder) writeMetadataBeforePLTE() {
+	m := e.opt.Metadata
+	if m == nil {
+		return
+	}
+	if c := m.Chromaticities; c != nil {
+		for i, v := range []float64{c.WhiteX, c.WhiteY, c.RedX, c.RedY, c.GreenX, c.GreenY, c.BlueX, c.BlueY} {
+			writeUint32(e.tmp[4*i:], uint32(math.Floor(v*100000+0.5)))
+		}
+		e.writeChunk(e.tmp[:32], "cHRM")
+	}
+	if m.Gamma != 0 {
+		writeUint32(e.tmp[:4], uint32(math.Floor(m.Gamma*100000+0.5)))
+		e.writeChunk(e.tmp[:4], "gAMA")
+	}
+	if m.ICCProfile != nil {
+		name, ok := toLatin1(m.ICCProfileName)
+		if !ok || len(name) < 1 || len(name) > 79 {
+			e.err = FormatError("invalid ICC profile name: " + m.ICCProfileName)
+			return
+		}
+		var b bytes.Buffer
+		b.Write(name)
+		b.Write([]byte{0, 0})
+		e.deflate(&b, m.ICCProfile)
+		e.writeChunk(b.Bytes(), "iCCP")
+	}
+	if m.SignificantBits != nil {
+		depth, ct := cbFormat(e.cb)
+		n := map[uint8]int{ctGrayscale: 1, ctTrueColor: 3, ctPaletted: 3, ctGrayscaleAlpha: 2, ctTrueColorAlpha: 4}[ct]
+		if ct == ctPaletted {
+			depth = 8
+		}
+		ok := len(m.SignificantBits) == n
+		for _, v := range m.SignificantBits {
+			ok = ok && v > 0 && v <= depth
+		}
+		if ok {
+			e.writeChunk(m.SignificantBits, "sBIT")
+		}
+	}
+	if m.SRGB {
+		e.tmp[0] = uint8(m.RenderingIntent)
+		e.writeChunk(e.tmp[:1], "sRGB")
+	}
+}
+
+// writeMetadata writes the ancillary chunks that follow the palette.
+func (e *encoder) writeMetadata() {
+	m := e.opt.Metadata
+	if m == nil {
+		return
+	}
+	if m.Background != nil {
+		c := color.RGBA64Model.Convert(m.Background).(color.RGBA64)
+		switch _, ct := cbFormat(e.cb); ct {
+		case ctPaletted:
+			e.tmp[0] = uint8(e.pal.Index(m.Background))
+			e.writeChunk(e.tmp[:1], "bKGD")
+		case ctTrueColor, ctTrueColorAlpha:
+			binary.BigEndian.PutUint16(e.tmp[0:2], e.sampleAt(uint32(c.R)))
+			binary.BigEndian.PutUint16(e.tmp[2:4], e.sampleAt(uint32(c.G)))
+			binary.BigEndian.PutUint16(e.tmp[4:6], e.sampleAt(uint32(c.B)))
+			e.writeChunk(e.tmp[:6], "bKGD")
+		default:
+			y := color.Gray16Model.Convert(m.Background).(color.Gray16).Y
+			binary.BigEndian.PutUint16(e.tmp[0:2], e.sampleAt(uint32(y)))
+			e.writeChunk(e.tmp[:2], "bKGD")
+		}
+	}
+	if m.PixelsPerUnitX != 0 || m.PixelsPerUnitY != 0 {
+		writeUint32(e.tmp[0:4], m.PixelsPerUnitX)
+		writeUint32(e.tmp[4:8], m.PixelsPerUnitY)
+		e.tmp[8] = 0
+		if m.UnitMeter {
+			e.tmp[8] = 1
+		}
+		e.writeChunk(e.tmp[:9], "pHYs")
+	}
+	for _, t := range m.Text {
+		e.writeText(t)
+	}
+	for _, c := range m.Chunks {
+		if !validChunkType(c.Type) || apngChunks[c.Type] {
+			e.err = FormatError("invalid ancillary chunk type: " + c.Type)
+			return
+		}
+		e.writeChunk(c.Data, c.Type)
+	}
+}
+
+// validChunkType reports whether typ is the type of an ancillary chunk.
+func validChunkType(typ string) bool {
+	if len(typ) != 4 || typ[0] < 'a' || typ[0] > 'z' {
+		return false
+	}
+	for i := 0; i < 4; i++ {
+		if c := typ[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
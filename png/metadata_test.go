@@ -0,0 +1,207 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func encodeMetadata(m image.Image, opt *Options) (*Metadata, []byte, error) {
+	var b bytes.Buffer
+	if err := EncodeOptions(&b, m, opt); err != nil {
+		return nil, nil, err
+	}
+	meta, err := DecodeMetadata(bytes.NewReader(b.Bytes()))
+	return meta, b.Bytes(), err
+}
+
+func TestMetadata(t *testing.T) {
+	meta := &Metadata{
+		Text: []Text{
+			{Keyword: "Title", Text: "Café"},
+			{Keyword: "Description", Text: strings.Repeat("provenance ", 100), Compressed: true},
+			{Keyword: "Author", Text: "世界"},
+			{Keyword: "Comment", Text: "text", International: true, Compressed: true, LanguageTag: "en", TranslatedKeyword: "Comment"},
+		},
+		Gamma: 0.45455,
+		Chromaticities: &Chromaticities{
+			0.3127, 0.329,
+			0.64, 0.33,
+			0.3, 0.6,
+			0.15, 0.06,
+		},
+		ICCProfileName:  "profile",
+		ICCProfile:      []byte("not really an ICC profile"),
+		Background:      color.RGBA64{0x1212, 0x3434, 0x5656, 0xffff},
+		SignificantBits: []uint8{5, 6, 5},
+		Chunks: []Chunk{
+			{Type: "prVt", Data: []byte("private data")},
+			{Type: "tIME", Data: []byte{0x07, 0xde, 1, 2, 3, 4, 5}},
+		},
+	}
+	meta.SetDPI(300, 150)
+
+	m := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for i := range m.Pix {
+		m.Pix[i] = 0xff
+	}
+	meta1, data, err := encodeMetadata(m, &Options{Metadata: meta})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ct, _ := ihdr(data); depth != 8 || ct != ctTrueColor {
+		t.Fatalf("got bit depth %d and color type %d", depth, ct)
+	}
+	for _, typ := range []string{"tEXt", "zTXt", "iTXt", "gAMA", "cHRM", "iCCP", "bKGD", "sBIT", "pHYs", "prVt"} {
+		if !bytes.Contains(data, []byte(typ)) {
+			t.Fatalf("no %s chunk", typ)
+		}
+	}
+
+	// Texts that are not Latin-1 are stored in iTXt chunks. The tIME chunk
+	// is written, but not decoded, as it is not safe to copy.
+	if !bytes.Contains(data, []byte("tIME")) {
+		t.Fatal("no tIME chunk")
+	}
+	want := *meta
+	want.Text = append([]Text(nil), meta.Text...)
+	want.Text[2].International = true
+	want.Chunks = meta.Chunks[:1]
+	if !reflect.DeepEqual(meta1, &want) {
+		t.Fatalf("got %+v, want %+v", meta1, &want)
+	}
+	if x, y, ok := meta1.DPI(); !ok || math.Abs(x-300) > 0.05 || math.Abs(y-150) > 0.05 {
+		t.Fatalf("got DPI %v, %v, %v", x, y, ok)
+	}
+
+	// Decode ignores the metadata.
+	m1, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(m, m1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The metadata is passed through unchanged when re-encoding.
+	meta2, _, err := encodeMetadata(m1, &Options{Metadata: meta1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(meta2, meta1) {
+		t.Fatalf("got %+v, want %+v", meta2, meta1)
+	}
+}
+
+func TestMetadataColorTypes(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 2, 2))
+	gray.Pix = []uint8{0, 0xff, 0xff, 0}
+	pal := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.Black, color.White, color.NRGBA{0xff, 0, 0, 0xff}})
+	for _, tc := range []struct {
+		m          image.Image
+		opt        Options
+		background color.Color
+		sBIT       []uint8
+		chunk      bool
+	}{
+		{gray, Options{}, color.Gray16{0x8080}, []uint8{7}, true},
+		{gray, Options{ReduceBitDepth: true}, color.Gray16{0xffff}, []uint8{7}, false},
+		{pal, Options{}, color.NRGBA{0xff, 0, 0, 0xff}, []uint8{8, 8, 8}, true},
+		{pal, Options{}, color.NRGBA{0xfe, 0x10, 0, 0xff}, []uint8{8}, false},
+	} {
+		tc.opt.Metadata = &Metadata{
+			SRGB:            true,
+			RenderingIntent: RelativeColorimetric,
+			Background:      tc.background,
+			SignificantBits: tc.sBIT,
+		}
+		meta, data, err := encodeMetadata(tc.m, &tc.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !meta.SRGB || meta.RenderingIntent != RelativeColorimetric {
+			t.Fatalf("%T: got sRGB %v with intent %d", tc.m, meta.SRGB, meta.RenderingIntent)
+		}
+		if reflect.DeepEqual(meta.SignificantBits, tc.sBIT) != tc.chunk {
+			t.Fatalf("%T, %+v: got significant bits %v", tc.m, tc.opt, meta.SignificantBits)
+		}
+		if bytes.Contains(data, []byte("sBIT")) != tc.chunk {
+			t.Fatalf("%T, %+v: got sBIT chunk %v", tc.m, tc.opt, !tc.chunk)
+		}
+		// The background is the nearest color of the encoded image.
+		if _, ok := tc.m.(*image.Paletted); ok {
+			if r, g, b, _ := meta.Background.RGBA(); r != 0xffff || g != 0 || b != 0 {
+				t.Fatalf("got background %v", meta.Background)
+			}
+		} else if _, ok := meta.Background.(color.Gray16); !ok {
+			t.Fatalf("got background %v", meta.Background)
+		}
+	}
+}
+
+func TestMetadataErrors(t *testing.T) {
+	m := image.NewGray(image.Rect(0, 0, 2, 2))
+	for _, meta := range []*Metadata{
+		{Text: []Text{{Keyword: "", Text: "x"}}},
+		{Text: []Text{{Keyword: strings.Repeat("k", 80), Text: "x"}}},
+		{Text: []Text{{Keyword: "世", Text: "x"}}},
+		{Text: []Text{{Keyword: "k", Text: "\xff", International: true}}},
+		{ICCProfileName: "", ICCProfile: []byte{1}},
+		{Chunks: []Chunk{{Type: "IDAT"}}},
+		{Chunks: []Chunk{{Type: "fcTL"}}},
+		{Chunks: []Chunk{{Type: "ab1d"}}},
+	} {
+		if err := EncodeOptions(ioutil.Discard, m, &Options{Metadata: meta}); err == nil {
+			t.Fatalf("encoding %+v succeeded", meta)
+		}
+	}
+}
+
+func TestDecodeMetadataMalformed(t *testing.T) {
+	var bomb bytes.Buffer
+	bomb.WriteString("Bomb\x00\x00")
+	zw := zlib.NewWriter(&bomb)
+	zw.Write(make([]byte, maxInflatedLen+1))
+	zw.Close()
+	meta := &Metadata{
+		Text: []Text{{Keyword: "Title", Text: "kept"}},
+		Chunks: []Chunk{
+			{Type: "gAMA", Data: []byte{0, 1, 2}},
+			{Type: "zTXt", Data: []byte("Method\x00\x01text")},
+			{Type: "zTXt", Data: bomb.Bytes()},
+			{Type: "iTXt", Data: []byte("Short\x00\x01")},
+			{Type: "pHYs", Data: []byte{1}},
+		},
+	}
+	meta1, _, err := encodeMetadata(image.NewGray(image.Rect(0, 0, 1, 1)), &Options{Metadata: meta})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Metadata{Text: meta.Text}
+	if !reflect.DeepEqual(meta1, want) {
+		t.Fatalf("got %+v, want %+v", meta1, want)
+	}
+}
+
+func TestDecodeMetadataFile(t *testing.T) {
+	b, err := ioutil.ReadFile(testdataDir + "video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeMetadata(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeMetadata(bytes.NewReader(b[:len(b)-1])); err == nil {
+		t.Fatal("decoding a truncated file succeeded")
+	}
+}
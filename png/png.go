@@ -4,12 +4,15 @@
 
 // Package png implements a PNG image decoder and encoder.
 //
+// DecodeAll and EncodeAll read and write animated PNG (APNG) files, whose
+// frames are ignored by Decode.
+//
 // The PNG specification is at http://www.w3.org/TR/PNG/.
+// The APNG specification is at https://wiki.mozilla.org/APNG_Specification.
 package png
 
 import (
 	"image"
-	"image/png"
 	"io"
 
 	imageExt "github.com/chai2010/image"
@@ -17,27 +20,15 @@ import (
 
 const pngHeader = "\x89PNG\r\n\x1a\n"
 
-// DecodeConfig returns the color model and dimensions of a PNG image
-// without decoding the entire image.
-func DecodeConfig(r io.Reader) (config image.Config, err error) {
-	return png.DecodeConfig(r)
-}
-
-// Decode reads a PNG image from r and returns it as an image.Image.
-// The type of Image returned depends on the PNG contents.
-func Decode(r io.Reader) (m image.Image, err error) {
-	return png.Decode(r)
-}
-
-// Encode writes the Image m to w in PNG format.
-// Any Image may be encoded, but images that are not image.NRGBA
-// might be encoded lossily.
-func Encode(w io.Writer, m image.Image) error {
-	return png.Encode(w, m)
+func toOptions(opt imageExt.Options) *Options {
+	if opt, ok := opt.(*Options); ok {
+		return opt
+	}
+	return nil
 }
 
 func imageExtEncode(w io.Writer, m image.Image, opt imageExt.Options) error {
-	return Encode(w, m)
+	return EncodeOptions(w, m, toOptions(opt))
 }
 
 func init() {
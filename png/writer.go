@@ -0,0 +1,1115 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bufio"
+	"compress/zlib"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+	"reflect"
+	"strconv"
+
+	imageExt "github.com/chai2010/image"
+	"github.com/chai2010/image/quantize"
+)
+
+// cbFormat returns the bit depth and the color type of cb.
+func cbFormat(cb int) (depth, colorType uint8) {
+	switch cb {
+	case cbG1:
+		return 1, ctGrayscale
+	case cbG2:
+		return 2, ctGrayscale
+	case cbG4:
+		return 4, ctGrayscale
+	case cbG8:
+		return 8, ctGrayscale
+	case cbGA8:
+		return 8, ctGrayscaleAlpha
+	case cbTC8:
+		return 8, ctTrueColor
+	case cbP1:
+		return 1, ctPaletted
+	case cbP2:
+		return 2, ctPaletted
+	case cbP4:
+		return 4, ctPaletted
+	case cbP8:
+		return 8, ctPaletted
+	case cbTCA8:
+		return 8, ctTrueColorAlpha
+	case cbG16:
+		return 16, ctGrayscale
+	case cbGA16:
+		return 16, ctGrayscaleAlpha
+	case cbTC16:
+		return 16, ctTrueColor
+	case cbTCA16:
+		return 16, ctTrueColorAlpha
+	}
+	return 0, 0
+}
+
+// cbBitsPerPixel returns the number of bits per pixel of cb.
+func cbBitsPerPixel(cb int) int {
+	depth, ct := cbFormat(cb)
+	switch ct {
+	case ctGrayscaleAlpha:
+		return 2 * int(depth)
+	case ctTrueColor:
+		return 3 * int(depth)
+	case ctTrueColorAlpha:
+		return 4 * int(depth)
+	}
+	return int(depth)
+}
+
+// palettedCB returns the paletted cb with the fewest bits per pixel that
+// holds a palette of n colors.
+func palettedCB(n int) int {
+	switch {
+	case n <= 2:
+		return cbP1
+	case n <= 4:
+		return cbP2
+	case n <= 16:
+		return cbP4
+	}
+	return cbP8
+}
+
+// CompressionLevel indicates the compression level.
+type CompressionLevel int
+
+const (
+	DefaultCompression CompressionLevel = 0
+	NoCompression      CompressionLevel = -1
+	BestSpeed          CompressionLevel = -2
+	BestCompression    CompressionLevel = -3
+
+	// Positive CompressionLevel values from 1 to 9 are zlib compression
+	// levels.
+)
+
+// Filter selects the filters that are applied to the rows of an image
+// before they are compressed.
+type Filter int
+
+const (
+	// FilterDefault uses FilterAdaptive for images with 8 or 16 bits per
+	// sample, and FilterNone for paletted and low bit depth images, as
+	// filters are rarely useful on them.
+	FilterDefault Filter = iota
+	FilterNone
+	FilterSub
+	FilterUp
+	FilterAverage
+	FilterPaeth
+	// FilterAdaptive chooses, for each row, the filter that minimizes the
+	// sum of absolute differences. This is the same heuristic that libpng
+	// uses.
+	FilterAdaptive
+)
+
+// Options are the encoding parameters.
+type Options struct {
+	CompressionLevel CompressionLevel
+	Filter           Filter
+	// Palette writes images with at most 256 distinct colors as paletted
+	// images if that takes fewer bits per pixel. Transparent colors are
+	// stored in a tRNS chunk.
+	Palette bool
+	// ReduceBitDepth writes 16 bit images whose samples all fit in 8 bits
+	// with 8 bits per sample, and gray images whose levels are all
+	// multiples of 255/(2^n-1) with n = 1, 2 or 4 bits per pixel.
+	ReduceBitDepth bool
+	// ColorKey writes images whose pixels are all either fully opaque or
+	// fully transparent without an alpha channel. A tRNS chunk marks a
+	// color that no opaque pixel uses as transparent.
+	ColorKey bool
+	// Interlace writes the image with Adam7 interlacing.
+	Interlace bool
+	// Metadata holds the ancillary chunks written with the image, such as
+	// texts or the pixel density. The Metadata returned by DecodeMetadata
+	// may be passed through unchanged, as it only holds the unknown chunks
+	// that are safe to copy.
+	Metadata *Metadata
+	// Quantize, if not nil, makes EncodeOptions write images that are not
+	// paletted as paletted images, with a palette and dithering that it
+	// selects.
+	// EncodeAll does not use it, since the frames need a common palette.
+	Quantize *quantize.Options
+}
+
+func (opt *Options) Lossless() bool {
+	return true
+}
+
+func (opt *Options) Quality() float32 {
+	return 0
+}
+
+type encoder struct {
+	opt    *Options
+	w      io.Writer
+	m      image.Image
+	cb     int
+	pal    color.Palette
+	index  map[color.NRGBA]uint8 // The color indices of a generated palette.
+	key    color.NRGBA           // The transparent color of a tRNS chunk.
+	hasKey bool
+	err    error
+	header [8]byte
+	footer [4]byte
+	tmp    [4 * 256]byte
+	cr     [nFilter][]uint8
+
+	// frames are all images of the file, which share its color type. The
+	// image data of m is written to fdAT chunks rather than IDAT chunks if
+	// fdAT is true.
+	frames        []image.Image
+	width, height int
+	seq           uint32
+	fdAT          bool
+}
+
+type opaquer interface {
+	Opaque() bool
+}
+
+// Returns whether or not the image is fully opaque.
+func opaque(m image.Image) bool {
+	if o, ok := m.(opaquer); ok {
+		return o.Opaque()
+	}
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			_, _, _, a := m.At(x, y).RGBA()
+			if a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// The absolute value of a byte interpreted as a signed int8.
+func abs8(d uint8) int {
+	if d < 128 {
+		return int(d)
+	}
+	return 256 - int(d)
+}
+
+func writeUint32(b []uint8, u uint32) {
+	b[0] = uint8(u >> 24)
+	b[1] = uint8(u >> 16)
+	b[2] = uint8(u >> 8)
+	b[3] = uint8(u >> 0)
+}
+
+// toNRGBA converts c to a non-alpha-premultiplied color, without the
+// rounding errors of a round trip through premultiplied alpha for the
+// color types that are already non-alpha-premultiplied.
+func toNRGBA(c color.Color) color.NRGBA {
+	switch c := c.(type) {
+	case color.NRGBA:
+		return c
+	case color.NRGBA64:
+		return color.NRGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), uint8(c.A >> 8)}
+	}
+	return color.NRGBAModel.Convert(c).(color.NRGBA)
+}
+
+// toNRGBA64 is like toNRGBA, with 16 bits per sample.
+func toNRGBA64(c color.Color) color.NRGBA64 {
+	if c, ok := c.(color.NRGBA); ok {
+		return color.NRGBA64{uint16(c.R) * 0x101, uint16(c.G) * 0x101, uint16(c.B) * 0x101, uint16(c.A) * 0x101}
+	}
+	return color.NRGBA64Model.Convert(c).(color.NRGBA64)
+}
+
+// nrgbaAt returns the color of the pixel at (x, y) of m.
+func nrgbaAt(m image.Image, x, y int) color.NRGBA {
+	switch m := m.(type) {
+	case *image.NRGBA:
+		i := m.PixOffset(x, y)
+		return color.NRGBA{m.Pix[i+0], m.Pix[i+1], m.Pix[i+2], m.Pix[i+3]}
+	case *image.RGBA:
+		i := m.PixOffset(x, y)
+		if m.Pix[i+3] == 0xff {
+			return color.NRGBA{m.Pix[i+0], m.Pix[i+1], m.Pix[i+2], 0xff}
+		}
+		return color.NRGBAModel.Convert(m.RGBAAt(x, y)).(color.NRGBA)
+	}
+	return toNRGBA(m.At(x, y))
+}
+
+// paletteColorAt is like nrgbaAt, but returns all fully transparent
+// pixels as transparent black, so that they share a palette entry.
+func paletteColorAt(m image.Image, x, y int) color.NRGBA {
+	if c := nrgbaAt(m, x, y); c.A != 0 {
+		return c
+	}
+	return color.NRGBA{}
+}
+
+// reduceBitDepth returns the cb with the fewest bits per sample that
+// represents all pixels of e.frames exactly.
+func (e *encoder) reduceBitDepth() int {
+	cb := e.cb
+	switch cb {
+	case cbG16, cbGA16, cbTC16, cbTCA16:
+		for _, m := range e.frames {
+			b := m.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					c := toNRGBA64(m.At(x, y))
+					if c.R>>8 != c.R&0xff || c.G>>8 != c.G&0xff || c.B>>8 != c.B&0xff || c.A>>8 != c.A&0xff {
+						return cb
+					}
+				}
+			}
+		}
+		cb = map[int]int{cbG16: cbG8, cbGA16: cbGA8, cbTC16: cbTC8, cbTCA16: cbTCA8}[cb]
+	}
+	if cb != cbG8 {
+		return cb
+	}
+
+	var used [256]bool
+	for _, m := range e.frames {
+		b := m.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				used[color.GrayModel.Convert(m.At(x, y)).(color.Gray).Y] = true
+			}
+		}
+	}
+	for _, gcb := range []int{cbG1, cbG2, cbG4} {
+		depth, _ := cbFormat(gcb)
+		step := 255 / (1<<depth - 1)
+		ok := true
+		for v := range used {
+			if used[v] && v%step != 0 {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return gcb
+		}
+	}
+	return cb
+}
+
+// buildPalette returns the colors of e.frames and their indices, or nil if
+// there are more than 256 colors. Transparent colors come first, so that
+// the tRNS chunk is as short as possible.
+func (e *encoder) buildPalette() (color.Palette, map[color.NRGBA]uint8) {
+	var transparent, opaque []color.NRGBA
+	seen := make(map[color.NRGBA]bool)
+	for _, m := range e.frames {
+		b := m.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := paletteColorAt(m, x, y)
+				if seen[c] {
+					continue
+				}
+				if len(seen) == 256 {
+					return nil, nil
+				}
+				seen[c] = true
+				if c.A == 0xff {
+					opaque = append(opaque, c)
+				} else {
+					transparent = append(transparent, c)
+				}
+			}
+		}
+	}
+	pal := make(color.Palette, 0, len(seen))
+	index := make(map[color.NRGBA]uint8, len(seen))
+	for _, c := range append(transparent, opaque...) {
+		index[c] = uint8(len(pal))
+		pal = append(pal, c)
+	}
+	return pal, index
+}
+
+// findColorKey returns a color that no opaque pixel of e.frames uses, if
+// all of their pixels are either fully opaque or fully transparent.
+func (e *encoder) findColorKey() (color.NRGBA, bool) {
+	used := make(map[color.NRGBA]bool)
+	for _, m := range e.frames {
+		b := m.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := nrgbaAt(m, x, y)
+				switch c.A {
+				case 0:
+				case 0xff:
+					used[c] = true
+				default:
+					return color.NRGBA{}, false
+				}
+			}
+		}
+	}
+	for i := 0; i < 1<<24; i++ {
+		c := color.NRGBA{uint8(i), uint8(i >> 8), uint8(i >> 16), 0xff}
+		if !used[c] {
+			return c, true
+		}
+	}
+	return color.NRGBA{}, false
+}
+
+// commonPalette returns the palette of the images, or nil if they are not
+// all paletted images with the same palette.
+func commonPalette(images []image.Image) color.Palette {
+	var pal color.Palette
+	for i, m := range images {
+		// cbP8 encoding needs PalettedImage's ColorIndexAt method.
+		if _, ok := m.(image.PalettedImage); !ok {
+			return nil
+		}
+		p, _ := m.ColorModel().(color.Palette)
+		if i == 0 {
+			pal = p
+			continue
+		}
+		if len(p) != len(pal) {
+			return nil
+		}
+		for j := range p {
+			r0, g0, b0, a0 := p[j].RGBA()
+			r1, g1, b1, a1 := pal[j].RGBA()
+			if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+				return nil
+			}
+		}
+	}
+	return pal
+}
+
+// withoutAlpha maps the cbs with an alpha channel to those without.
+var withoutAlpha = map[int]int{cbGA8: cbG8, cbGA16: cbG16, cbTCA8: cbTC8, cbTCA16: cbTC16}
+
+// interleave returns an interleaved copy of m if it is a planar image, so
+// that its samples are encoded from its Pix at their own depth, and m
+// otherwise.
+func interleave(m image.Image) image.Image {
+	if imageExt.IsPlanar(m) {
+		return m.(*imageExt.Planar).Interleave()
+	}
+	return m
+}
+
+// typedCB returns the cb whose samples have the layout of the Pix of a
+// typed image of the image package, or cbInvalid.
+func typedCB(p imageExt.Image) int {
+	if imageExt.IsPlanar(p) {
+		return cbInvalid
+	}
+	switch p.Depth() {
+	case reflect.Uint8:
+		return map[int]int{1: cbG8, 2: cbGA8, 3: cbTC8, 4: cbTCA8}[p.Channels()]
+	case reflect.Uint16:
+		return map[int]int{1: cbG16, 2: cbGA16, 3: cbTC16, 4: cbTCA16}[p.Channels()]
+	}
+	return cbInvalid
+}
+
+// imageCB returns the cb without a palette that holds the pixels of m.
+func imageCB(m image.Image) int {
+	if p, ok := m.(imageExt.Image); ok {
+		if cb := typedCB(p); cb != cbInvalid {
+			// The alpha channel of opaque images is dropped.
+			if cb1, ok := withoutAlpha[cb]; ok && opaque(m) {
+				return cb1
+			}
+			return cb
+		}
+	}
+	switch m.ColorModel() {
+	case color.GrayModel:
+		return cbG8
+	case color.Gray16Model:
+		return cbG16
+	case color.RGBAModel, color.NRGBAModel, color.AlphaModel:
+		if opaque(m) {
+			return cbTC8
+		}
+		return cbTCA8
+	}
+	if _, ok := m.ColorModel().(color.Palette); ok {
+		if opaque(m) {
+			return cbTC8
+		}
+		return cbTCA8
+	}
+	if opaque(m) {
+		return cbTC16
+	}
+	return cbTCA16
+}
+
+// mergeCB returns the cb that holds the pixels of images of both cb0 and
+// cb1, which are returned by imageCB.
+func mergeCB(cb0, cb1 int) int {
+	if cb0 == cbInvalid || cb0 == cb1 {
+		return cb1
+	}
+	depth0, ct0 := cbFormat(cb0)
+	depth1, ct1 := cbFormat(cb1)
+	gray := (ct0 == ctGrayscale || ct0 == ctGrayscaleAlpha) && (ct1 == ctGrayscale || ct1 == ctGrayscaleAlpha)
+	alpha := ct0 == ctGrayscaleAlpha || ct0 == ctTrueColorAlpha || ct1 == ctGrayscaleAlpha || ct1 == ctTrueColorAlpha
+	cb := cbTC8
+	switch {
+	case gray && alpha:
+		cb = cbGA8
+	case gray:
+		cb = cbG8
+	case alpha:
+		cb = cbTCA8
+	}
+	if depth0 == 16 || depth1 == 16 {
+		cb = map[int]int{cbG8: cbG16, cbGA8: cbGA16, cbTC8: cbTC16, cbTCA8: cbTCA16}[cb]
+	}
+	return cb
+}
+
+// chooseFormat sets the cb of e, and the palette or the color key that it
+// needs.
+func (e *encoder) chooseFormat() {
+	opt := e.opt
+	if e.pal = commonPalette(e.frames); e.pal != nil {
+		e.cb = palettedCB(len(e.pal))
+		return
+	}
+	e.cb = cbInvalid
+	for _, m := range e.frames {
+		e.cb = mergeCB(e.cb, imageCB(m))
+	}
+	if opt.ReduceBitDepth {
+		e.cb = e.reduceBitDepth()
+	}
+	if opt.Palette {
+		if depth, _ := cbFormat(e.cb); depth <= 8 {
+			pal, index := e.buildPalette()
+			if pal != nil && cbBitsPerPixel(palettedCB(len(pal))) < cbBitsPerPixel(e.cb) {
+				e.cb, e.pal, e.index = palettedCB(len(pal)), pal, index
+				return
+			}
+		}
+	}
+	if opt.ColorKey && e.cb == cbTCA8 {
+		if key, ok := e.findColorKey(); ok {
+			e.cb, e.key, e.hasKey = cbTC8, key, true
+		}
+	}
+}
+
+func (e *encoder) writeChunk(b []byte, name string) {
+	if e.err != nil {
+		return
+	}
+	n := uint32(len(b))
+	if int(n) != len(b) {
+		e.err = UnsupportedError(name + " chunk is too large: " + strconv.Itoa(len(b)))
+		return
+	}
+	writeUint32(e.header[:4], n)
+	e.header[4] = name[0]
+	e.header[5] = name[1]
+	e.header[6] = name[2]
+	e.header[7] = name[3]
+	crc := crc32.NewIEEE()
+	crc.Write(e.header[4:8])
+	crc.Write(b)
+	writeUint32(e.footer[:4], crc.Sum32())
+
+	_, e.err = e.w.Write(e.header[:8])
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(b)
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(e.footer[:4])
+}
+
+func (e *encoder) writeIHDR() {
+	writeUint32(e.tmp[0:4], uint32(e.width))
+	writeUint32(e.tmp[4:8], uint32(e.height))
+	// Set bit depth and color type.
+	e.tmp[8], e.tmp[9] = cbFormat(e.cb)
+	e.tmp[10] = 0 // default compression method
+	e.tmp[11] = 0 // default filter method
+	e.tmp[12] = itNone
+	if e.opt.Interlace {
+		e.tmp[12] = itAdam7
+	}
+	e.writeChunk(e.tmp[:13], "IHDR")
+}
+
+// writePLTEAndTRNS writes the palette, and the tRNS chunk of the
+// transparent palette entries or of the color key, if they are needed.
+func (e *encoder) writePLTEAndTRNS() {
+	if e.hasKey {
+		e.writeTRNSKey()
+	}
+	p := e.pal
+	if p == nil {
+		return
+	}
+	if len(p) < 1 || len(p) > 256 {
+		e.err = FormatError("bad palette length: " + strconv.Itoa(len(p)))
+		return
+	}
+	last := -1
+	for i, c := range p {
+		c1 := color.NRGBAModel.Convert(c).(color.NRGBA)
+		e.tmp[3*i+0] = c1.R
+		e.tmp[3*i+1] = c1.G
+		e.tmp[3*i+2] = c1.B
+		if c1.A != 0xff {
+			last = i
+		}
+		e.tmp[3*256+i] = c1.A
+	}
+	e.writeChunk(e.tmp[:3*len(p)], "PLTE")
+	if last != -1 {
+		e.writeChunk(e.tmp[3*256:3*256+1+last], "tRNS")
+	}
+}
+
+// writeTRNSKey writes the tRNS chunk of a truecolor image, which holds the
+// 16 bit samples of the transparent color.
+func (e *encoder) writeTRNSKey() {
+	e.tmp[0], e.tmp[1] = 0, e.key.R
+	e.tmp[2], e.tmp[3] = 0, e.key.G
+	e.tmp[4], e.tmp[5] = 0, e.key.B
+	e.writeChunk(e.tmp[:6], "tRNS")
+}
+
+// An encoder is an io.Writer that satisfies writes by writing PNG IDAT chunks,
+// including an 8-byte header and 4-byte CRC checksum per Write call. Such calls
+// should be relatively infrequent, since writeIDATs uses a bufio.Writer.
+//
+// This method should only be called from writeIDATs (via writeImage).
+// No other code should treat an encoder as an io.Writer.
+func (e *encoder) Write(b []byte) (int, error) {
+	if e.fdAT {
+		// Each fdAT chunk starts with a sequence number.
+		data := make([]byte, 4+len(b))
+		writeUint32(data, e.seq)
+		copy(data[4:], b)
+		e.seq++
+		e.writeChunk(data, "fdAT")
+	} else {
+		e.writeChunk(b, "IDAT")
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+	return len(b), nil
+}
+
+// Chooses the filter to use for encoding the current row, and applies it.
+// The return value is the index of the filter and also of the row in cr that has had it applied.
+func filter(cr *[nFilter][]byte, pr []byte, bpp int) int {
+	// We try all five filter types, and pick the one that minimizes the sum of absolute differences.
+	// This is the same heuristic that libpng uses, although the filters are attempted in order of
+	// estimated most likely to be minimal (ftUp, ftPaeth, ftNone, ftSub, ftAverage), rather than
+	// in their enumeration order (ftNone, ftSub, ftUp, ftAverage, ftPaeth).
+	cdat0 := cr[0][1:]
+	cdat1 := cr[1][1:]
+	cdat2 := cr[2][1:]
+	cdat3 := cr[3][1:]
+	cdat4 := cr[4][1:]
+	pdat := pr[1:]
+	n := len(cdat0)
+
+	// The up filter.
+	sum := 0
+	for i := 0; i < n; i++ {
+		cdat2[i] = cdat0[i] - pdat[i]
+		sum += abs8(cdat2[i])
+	}
+	best := sum
+	filter := ftUp
+
+	// The Paeth filter.
+	sum = 0
+	for i := 0; i < bpp; i++ {
+		cdat4[i] = cdat0[i] - pdat[i]
+		sum += abs8(cdat4[i])
+	}
+	for i := bpp; i < n; i++ {
+		cdat4[i] = cdat0[i] - paeth(cdat0[i-bpp], pdat[i], pdat[i-bpp])
+		sum += abs8(cdat4[i])
+		if sum >= best {
+			break
+		}
+	}
+	if sum < best {
+		best = sum
+		filter = ftPaeth
+	}
+
+	// The none filter.
+	sum = 0
+	for i := 0; i < n; i++ {
+		sum += abs8(cdat0[i])
+		if sum >= best {
+			break
+		}
+	}
+	if sum < best {
+		best = sum
+		filter = ftNone
+	}
+
+	// The sub filter.
+	sum = 0
+	for i := 0; i < bpp; i++ {
+		cdat1[i] = cdat0[i]
+		sum += abs8(cdat1[i])
+	}
+	for i := bpp; i < n; i++ {
+		cdat1[i] = cdat0[i] - cdat0[i-bpp]
+		sum += abs8(cdat1[i])
+		if sum >= best {
+			break
+		}
+	}
+	if sum < best {
+		best = sum
+		filter = ftSub
+	}
+
+	// The average filter.
+	sum = 0
+	for i := 0; i < bpp; i++ {
+		cdat3[i] = cdat0[i] - pdat[i]/2
+		sum += abs8(cdat3[i])
+	}
+	for i := bpp; i < n; i++ {
+		cdat3[i] = cdat0[i] - uint8((int(cdat0[i-bpp])+int(pdat[i]))/2)
+		sum += abs8(cdat3[i])
+		if sum >= best {
+			break
+		}
+	}
+	if sum < best {
+		filter = ftAverage
+	}
+
+	return filter
+}
+
+// applyFilter applies the filter f to the current row cr[0], and stores
+// the result in cr[f].
+func applyFilter(cr *[nFilter][]byte, pr []byte, bpp, f int) {
+	cdat := cr[0][1:]
+	fdat := cr[f][1:]
+	pdat := pr[1:]
+	for i := range cdat {
+		var a, c uint8
+		if i >= bpp {
+			a, c = cdat[i-bpp], pdat[i-bpp]
+		}
+		switch f {
+		case ftSub:
+			fdat[i] = cdat[i] - a
+		case ftUp:
+			fdat[i] = cdat[i] - pdat[i]
+		case ftAverage:
+			fdat[i] = cdat[i] - uint8((int(a)+int(pdat[i]))/2)
+		case ftPaeth:
+			fdat[i] = cdat[i] - paeth(a, pdat[i], c)
+		}
+	}
+}
+
+// putSample stores the i-th sample of a row with depth bits per sample.
+// Samples of less than 8 bits are packed into the zeroed row, most
+// significant bits first.
+func putSample(row []byte, i int, v uint8, depth uint) {
+	if depth == 8 {
+		row[i] = v
+		return
+	}
+	bit := uint(i) * depth
+	row[bit/8] |= v << (8 - depth - bit%8)
+}
+
+// unpremultiply converts the alpha-premultiplied samples of a pixel, whose
+// last sample is the alpha, to non-alpha-premultiplied samples.
+func unpremultiply(px []byte, size int) {
+	n := len(px) - size
+	if size == 1 {
+		a := uint32(px[n])
+		if a == 0xff {
+			return
+		}
+		for i := 0; i < n; i++ {
+			v := uint32(0)
+			if a != 0 {
+				v = uint32(px[i]) * 0xff / a
+			}
+			px[i] = uint8(minInt(int(v), 0xff))
+		}
+		return
+	}
+	a := uint32(px[n])<<8 | uint32(px[n+1])
+	if a == 0xffff {
+		return
+	}
+	for i := 0; i < n; i += 2 {
+		v := uint32(0)
+		if a != 0 {
+			v = (uint32(px[i])<<8 | uint32(px[i+1])) * 0xffff / a
+		}
+		v = uint32(minInt(int(v), 0xffff))
+		px[i], px[i+1] = uint8(v>>8), uint8(v)
+	}
+}
+
+// encodeTypedRow is like encodeRow for the typed images of the image
+// package, whose big-endian Pix has the layout of the samples of e.cb,
+// possibly with the alpha channel of an opaque image. It reports whether
+// e.m is such an image.
+func (e *encoder) encodeTypedRow(row []byte, y, x0, dx int) bool {
+	p, ok := e.m.(imageExt.Image)
+	if !ok || e.hasKey {
+		return false
+	}
+	cb := typedCB(p)
+	if cb != e.cb && withoutAlpha[cb] != e.cb {
+		return false
+	}
+	depth, ct := cbFormat(e.cb)
+	size := int(depth) / 8
+	n := map[uint8]int{ctGrayscale: 1, ctTrueColor: 3, ctGrayscaleAlpha: 2, ctTrueColorAlpha: 4}[ct] * size
+	pixSize := p.Channels() * size
+
+	r := p.Rect()
+	pix := p.Pix()[(y-r.Min.Y)*p.Stride():]
+	if cb == e.cb && dx == 1 && (ct == ctGrayscale || ct == ctTrueColor) {
+		i := (x0 - r.Min.X) * pixSize
+		copy(row, pix[i:i+len(row)])
+		return true
+	}
+	for i, x := 0, x0; x < r.Max.X; i, x = i+n, x+dx {
+		copy(row[i:i+n], pix[(x-r.Min.X)*pixSize:])
+		if ct == ctGrayscaleAlpha || ct == ctTrueColorAlpha {
+			// PNG stores non-alpha-premultiplied samples.
+			unpremultiply(row[i:i+n], size)
+		}
+	}
+	return true
+}
+
+// encodeRow converts the pixels (x0, y), (x0+dx, y), ... of e.m to bytes.
+func (e *encoder) encodeRow(row []byte, y, x0, dx int) {
+	if e.encodeTypedRow(row, y, x0, dx) {
+		return
+	}
+	m := e.m
+	x1 := m.Bounds().Max.X
+	depth, _ := cbFormat(e.cb)
+	if depth < 8 {
+		for i := range row {
+			row[i] = 0
+		}
+	}
+
+	switch e.cb {
+	case cbG1, cbG2, cbG4, cbG8:
+		gray, _ := m.(*image.Gray)
+		shift := 8 - depth
+		for i, x := 0, x0; x < x1; i, x = i+1, x+dx {
+			var v uint8
+			if gray != nil {
+				v = gray.Pix[gray.PixOffset(x, y)]
+			} else {
+				v = color.GrayModel.Convert(m.At(x, y)).(color.Gray).Y
+			}
+			putSample(row, i, v>>shift, uint(depth))
+		}
+	case cbG16:
+		for i, x := 0, x0; x < x1; i, x = i+2, x+dx {
+			c := color.Gray16Model.Convert(m.At(x, y)).(color.Gray16)
+			row[i+0] = uint8(c.Y >> 8)
+			row[i+1] = uint8(c.Y)
+		}
+	case cbGA8:
+		for i, x := 0, x0; x < x1; i, x = i+2, x+dx {
+			c := toNRGBA(m.At(x, y))
+			row[i+0] = color.GrayModel.Convert(color.NRGBA{c.R, c.G, c.B, 0xff}).(color.Gray).Y
+			row[i+1] = c.A
+		}
+	case cbGA16:
+		for i, x := 0, x0; x < x1; i, x = i+4, x+dx {
+			c := toNRGBA64(m.At(x, y))
+			v := color.Gray16Model.Convert(color.NRGBA64{c.R, c.G, c.B, 0xffff}).(color.Gray16).Y
+			row[i+0] = uint8(v >> 8)
+			row[i+1] = uint8(v)
+			row[i+2] = uint8(c.A >> 8)
+			row[i+3] = uint8(c.A)
+		}
+	case cbTC8:
+		// We have previously verified that the alpha value is fully
+		// opaque, or that the transparent pixels use the color key.
+		for i, x := 0, x0; x < x1; i, x = i+3, x+dx {
+			c := nrgbaAt(m, x, y)
+			if c.A == 0 {
+				c = e.key
+			}
+			row[i+0] = c.R
+			row[i+1] = c.G
+			row[i+2] = c.B
+		}
+	case cbTCA8:
+		if nrgba, ok := m.(*image.NRGBA); ok && dx == 1 {
+			offset := nrgba.PixOffset(x0, y)
+			copy(row, nrgba.Pix[offset:offset+len(row)])
+			break
+		}
+		// Convert from image.Image (which is alpha-premultiplied) to PNG's non-alpha-premultiplied.
+		for i, x := 0, x0; x < x1; i, x = i+4, x+dx {
+			c := nrgbaAt(m, x, y)
+			row[i+0] = c.R
+			row[i+1] = c.G
+			row[i+2] = c.B
+			row[i+3] = c.A
+		}
+	case cbTC16:
+		// We have previously verified that the alpha value is fully opaque.
+		for i, x := 0, x0; x < x1; i, x = i+6, x+dx {
+			r, g, b, _ := m.At(x, y).RGBA()
+			row[i+0] = uint8(r >> 8)
+			row[i+1] = uint8(r)
+			row[i+2] = uint8(g >> 8)
+			row[i+3] = uint8(g)
+			row[i+4] = uint8(b >> 8)
+			row[i+5] = uint8(b)
+		}
+	case cbTCA16:
+		// Convert from image.Image (which is alpha-premultiplied) to PNG's non-alpha-premultiplied.
+		for i, x := 0, x0; x < x1; i, x = i+8, x+dx {
+			c := toNRGBA64(m.At(x, y))
+			row[i+0] = uint8(c.R >> 8)
+			row[i+1] = uint8(c.R)
+			row[i+2] = uint8(c.G >> 8)
+			row[i+3] = uint8(c.G)
+			row[i+4] = uint8(c.B >> 8)
+			row[i+5] = uint8(c.B)
+			row[i+6] = uint8(c.A >> 8)
+			row[i+7] = uint8(c.A)
+		}
+	case cbP1, cbP2, cbP4, cbP8:
+		if e.index != nil {
+			for i, x := 0, x0; x < x1; i, x = i+1, x+dx {
+				putSample(row, i, e.index[paletteColorAt(m, x, y)], uint(depth))
+			}
+			break
+		}
+		if paletted, ok := m.(*image.Paletted); ok && dx == 1 && depth == 8 {
+			offset := paletted.PixOffset(x0, y)
+			copy(row, paletted.Pix[offset:offset+len(row)])
+			break
+		}
+		pi := m.(image.PalettedImage)
+		for i, x := 0, x0; x < x1; i, x = i+1, x+dx {
+			putSample(row, i, pi.ColorIndexAt(x, y), uint(depth))
+		}
+	}
+}
+
+func (e *encoder) writeImage(w io.Writer) error {
+	zw, err := zlib.NewWriterLevel(w, levelToZlib(e.opt.CompressionLevel))
+	if err != nil {
+		return err
+	}
+
+	// Filters work on bytes. For images with less than 8 bits per pixel,
+	// they compare a byte with the previous one.
+	bitsPerPixel := cbBitsPerPixel(e.cb)
+	bpp := (bitsPerPixel + 7) / 8
+
+	// ft is the filter type of all rows, or -1 to choose it for each row.
+	ft := -1
+	switch e.opt.Filter {
+	case FilterDefault:
+		if e.opt.CompressionLevel == NoCompression || bitsPerPixel < 8 || cbPaletted(e.cb) {
+			ft = ftNone
+		}
+	case FilterAdaptive:
+	default:
+		ft = int(e.opt.Filter - FilterNone)
+	}
+
+	passes := []interlaceScan{{1, 1, 0, 0}}
+	if e.opt.Interlace {
+		passes = interlacing
+	}
+	b := e.m.Bounds()
+	for _, p := range passes {
+		width := (b.Dx() - p.xOffset + p.xFactor - 1) / p.xFactor
+		height := (b.Dy() - p.yOffset + p.yFactor - 1) / p.yFactor
+		if width <= 0 || height <= 0 {
+			continue
+		}
+
+		// cr[*] and pr are the bytes for the current and previous row.
+		// cr[0] is unfiltered (or equivalently, filtered with the ftNone filter).
+		// cr[ft], for non-zero filter types ft, are buffers for transforming cr[0] under the
+		// other PNG filter types. The +1 is for the per-row filter type, which is at cr[*][0].
+		// Each pass starts with a previous row of zeros.
+		sz := 1 + (bitsPerPixel*width+7)/8
+		for i := range e.cr {
+			e.cr[i] = make([]uint8, sz)
+			e.cr[i][0] = uint8(i)
+		}
+		cr := e.cr
+		pr := make([]uint8, sz)
+
+		for y := b.Min.Y + p.yOffset; y < b.Max.Y; y += p.yFactor {
+			e.encodeRow(cr[0][1:], y, b.Min.X+p.xOffset, p.xFactor)
+
+			// Apply the filter.
+			f := ft
+			if f < 0 {
+				f = filter(&cr, pr, bpp)
+			} else if f != ftNone {
+				applyFilter(&cr, pr, bpp, f)
+			}
+
+			// Write the compressed bytes.
+			if _, err := zw.Write(cr[f]); err != nil {
+				return err
+			}
+
+			// The current row for y is the previous row for y+1.
+			pr, cr[0] = cr[0], pr
+		}
+	}
+	return zw.Close()
+}
+
+// Write the actual image data to one or more IDAT chunks.
+func (e *encoder) writeIDATs() {
+	if e.err != nil {
+		return
+	}
+	bw := bufio.NewWriterSize(e, 1<<15)
+	e.err = e.writeImage(bw)
+	if e.err != nil {
+		return
+	}
+	e.err = bw.Flush()
+}
+
+// This function is required because we want the zero value of
+// Options.CompressionLevel to map to zlib.DefaultCompression.
+func levelToZlib(l CompressionLevel) int {
+	switch l {
+	case DefaultCompression:
+		return zlib.DefaultCompression
+	case NoCompression:
+		return zlib.NoCompression
+	case BestSpeed:
+		return zlib.BestSpeed
+	case BestCompression:
+		return zlib.BestCompression
+	}
+	if l > 0 && l <= zlib.BestCompression {
+		return int(l)
+	}
+	return zlib.DefaultCompression
+}
+
+func (e *encoder) writeIEND() { e.writeChunk(nil, "IEND") }
+
+// checkOptions reports whether the options are valid.
+func checkOptions(opt *Options) error {
+	if opt.CompressionLevel < BestCompression || opt.CompressionLevel > zlib.BestCompression {
+		return UnsupportedError("compression level " + strconv.Itoa(int(opt.CompressionLevel)))
+	}
+	if opt.Filter < FilterDefault || opt.Filter > FilterAdaptive {
+		return UnsupportedError("filter " + strconv.Itoa(int(opt.Filter)))
+	}
+	return nil
+}
+
+// checkSize reports whether an image of width x height pixels is valid.
+func checkSize(width, height int) error {
+	// Obviously, negative widths and heights are invalid. Furthermore, the PNG
+	// spec section 11.2.2 says that zero is invalid. Excessively large images are
+	// also rejected.
+	mw, mh := int64(width), int64(height)
+	if mw <= 0 || mh <= 0 || mw >= 1<<32 || mh >= 1<<32 {
+		return FormatError("invalid image size: " + strconv.FormatInt(mw, 10) + "x" + strconv.FormatInt(mh, 10))
+	}
+	return nil
+}
+
+// Encode writes the Image m to w in PNG format. Any Image may be encoded,
+// but images that are not image.NRGBA might be encoded lossily. The 8 and
+// 16 bit typed images of the image package, such as imageExt.RGB48, are
+// written with the color type of their channels, straight from their Pix.
+func Encode(w io.Writer, m image.Image) error {
+	return EncodeOptions(w, m, nil)
+}
+
+// EncodeOptions writes the Image m to w in PNG format with the given
+// options, as Encode does. Default parameters are used if a nil *Options
+// is passed.
+func EncodeOptions(w io.Writer, m image.Image, opt *Options) error {
+	if opt == nil {
+		opt = new(Options)
+	}
+	m = interleave(m)
+	if opt.Quantize != nil {
+		if _, ok := m.(image.PalettedImage); !ok {
+			m = quantize.Paletted(m, opt.Quantize)
+		}
+	}
+	if err := checkSize(m.Bounds().Dx(), m.Bounds().Dy()); err != nil {
+		return err
+	}
+	if err := checkOptions(opt); err != nil {
+		return err
+	}
+
+	e := &encoder{
+		opt:    opt,
+		w:      w,
+		m:      m,
+		frames: []image.Image{m},
+		width:  m.Bounds().Dx(),
+		height: m.Bounds().Dy(),
+	}
+	e.chooseFormat()
+
+	_, e.err = io.WriteString(w, pngHeader)
+	e.writeIHDR()
+	e.writeMetadataBeforePLTE()
+	e.writePLTEAndTRNS()
+	e.writeMetadata()
+	e.writeIDATs()
+	e.writeIEND()
+	return e.err
+}
@@ -0,0 +1,414 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+	"github.com/chai2010/image/quantize"
+)
+
+const testdataDir = "../testdata/"
+
+func diff(m0, m1 image.Image) error {
+	b0, b1 := m0.Bounds(), m1.Bounds()
+	if !b0.Size().Eq(b1.Size()) {
+		return fmt.Errorf("dimensions differ: %v vs %v", b0, b1)
+	}
+	dx := b1.Min.X - b0.Min.X
+	dy := b1.Min.Y - b0.Min.Y
+	for y := b0.Min.Y; y < b0.Max.Y; y++ {
+		for x := b0.Min.X; x < b0.Max.X; x++ {
+			c0 := m0.At(x, y)
+			c1 := m1.At(x+dx, y+dy)
+			r0, g0, b0, a0 := c0.RGBA()
+			r1, g1, b1, a1 := c1.RGBA()
+			if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+				return fmt.Errorf("colors differ at (%d, %d): %v vs %v", x, y, c0, c1)
+			}
+		}
+	}
+	return nil
+}
+
+func encodeDecode(m image.Image, opt *Options) (image.Image, []byte, error) {
+	var b bytes.Buffer
+	if err := EncodeOptions(&b, m, opt); err != nil {
+		return nil, nil, err
+	}
+	m1, err := Decode(bytes.NewReader(b.Bytes()))
+	return m1, b.Bytes(), err
+}
+
+// ihdr returns the bit depth, color type and interlace method of an
+// encoded image.
+func ihdr(data []byte) (depth, colorType, interlace uint8) {
+	return data[24], data[25], data[28]
+}
+
+func openImage(filename string) (image.Image, error) {
+	f, err := os.Open(testdataDir + filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+func testImages(t *testing.T) []image.Image {
+	m, err := openImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := m.Bounds()
+	gray := image.NewGray(b)
+	nrgba := image.NewNRGBA(b)
+	gray16 := image.NewGray16(b)
+	nrgba64 := image.NewNRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := m.At(x, y)
+			gray.Set(x, y, c)
+			gray16.Set(x, y, c)
+			r, g, bb, _ := c.RGBA()
+			nrgba.Set(x, y, color.NRGBA{uint8(r >> 8), uint8(g >> 8), uint8(bb >> 8), uint8(x * y)})
+			nrgba64.Set(x, y, color.NRGBA64{uint16(r), uint16(g), uint16(bb), uint16(x * y * 0x10)})
+		}
+	}
+	paletted := image.NewPaletted(image.Rect(0, 0, 13, 7), color.Palette{
+		color.NRGBA{0xff, 0, 0, 0xff},
+		color.NRGBA{0, 0xff, 0, 0x80},
+		color.NRGBA{0, 0, 0xff, 0},
+	})
+	for i := range paletted.Pix {
+		paletted.Pix[i] = uint8(i % 3)
+	}
+	return []image.Image{m, gray, nrgba, gray16, nrgba64, paletted}
+}
+
+func TestWriterFilters(t *testing.T) {
+	for _, m := range testImages(t) {
+		for f := FilterDefault; f <= FilterAdaptive; f++ {
+			for _, level := range []CompressionLevel{DefaultCompression, NoCompression, 1, 9} {
+				opt := &Options{CompressionLevel: level, Filter: f}
+				m1, _, err := encodeDecode(m, opt)
+				if err != nil {
+					t.Fatalf("%T, %+v: %v", m, opt, err)
+				}
+				if err := diff(m, m1); err != nil {
+					t.Fatalf("%T, %+v: %v", m, opt, err)
+				}
+			}
+		}
+	}
+}
+
+func TestWriterInterlace(t *testing.T) {
+	images := testImages(t)
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 3, 5),
+		image.Rect(2, 1, 19, 10),
+	} {
+		for _, m := range images {
+			m := m.(interface {
+				SubImage(image.Rectangle) image.Image
+			}).SubImage(r)
+			m1, data, err := encodeDecode(m, &Options{Interlace: true})
+			if err != nil {
+				t.Fatalf("%T, %v: %v", m, r, err)
+			}
+			if _, _, interlace := ihdr(data); interlace != itAdam7 {
+				t.Fatalf("%T, %v: got interlace method %d", m, r, interlace)
+			}
+			if err := diff(m, m1); err != nil {
+				t.Fatalf("%T, %v: %v", m, r, err)
+			}
+		}
+	}
+}
+
+func TestWriterPalette(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 9, 4))
+	colors := []color.NRGBA{
+		{0x10, 0x20, 0x30, 0xff},
+		{0x40, 0x50, 0x60, 0xff},
+		{0x70, 0x80, 0x90, 0x80},
+		{0, 0, 0, 0},
+		{0xff, 0xff, 0xff, 0}, // The same palette entry as the transparent black.
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 9; x++ {
+			m.SetNRGBA(x, y, colors[(x+y)%len(colors)])
+		}
+	}
+	m1, data, err := encodeDecode(m, &Options{Palette: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ct, _ := ihdr(data); depth != 2 || ct != ctPaletted {
+		t.Fatalf("got bit depth %d and color type %d", depth, ct)
+	}
+	p, ok := m1.(*image.Paletted)
+	if !ok {
+		t.Fatalf("got %T, want *image.Paletted", m1)
+	}
+	// The transparent colors come first.
+	if _, _, _, a := p.Palette[0].RGBA(); a == 0xffff {
+		t.Fatalf("got opaque first palette entry %v", p.Palette[0])
+	}
+	if err := diff(m, m1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Images with more colors than the palette holds are written as they are.
+	m2 := image.NewGray(image.Rect(0, 0, 256, 2))
+	for i := range m2.Pix {
+		m2.Pix[i] = uint8(i / 2)
+	}
+	m1, data, err = encodeDecode(m2, &Options{Palette: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ct, _ := ihdr(data); depth != 8 || ct != ctGrayscale {
+		t.Fatalf("got bit depth %d and color type %d", depth, ct)
+	}
+	if err := diff(m2, m1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterQuantize(t *testing.T) {
+	images := testImages(t)
+	nrgba := images[2]
+	m1, data, err := encodeDecode(nrgba, &Options{Quantize: &quantize.Options{Method: quantize.Octree, NumColors: 16}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ct, _ := ihdr(data); depth != 4 || ct != ctPaletted {
+		t.Fatalf("got bit depth %d and color type %d", depth, ct)
+	}
+	p, ok := m1.(*image.Paletted)
+	if !ok || len(p.Palette) > 16 {
+		t.Fatalf("got %T with %d colors", m1, len(p.Palette))
+	}
+
+	// Paletted images are written as they are.
+	paletted := images[len(images)-1]
+	m1, _, err = encodeDecode(paletted, &Options{Quantize: &quantize.Options{NumColors: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(paletted, m1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterReduceBitDepth(t *testing.T) {
+	for _, tc := range []struct {
+		levels []uint8
+		depth  uint8
+	}{
+		{[]uint8{0, 255}, 1},
+		{[]uint8{0, 85, 170, 255}, 2},
+		{[]uint8{0, 17, 34, 255}, 4},
+		{[]uint8{0, 1, 255}, 8},
+	} {
+		m := image.NewGray(image.Rect(0, 0, 11, 3))
+		for i := range m.Pix {
+			m.Pix[i] = tc.levels[i%len(tc.levels)]
+		}
+		m1, data, err := encodeDecode(m, &Options{ReduceBitDepth: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if depth, ct, _ := ihdr(data); depth != tc.depth || ct != ctGrayscale {
+			t.Fatalf("levels %v: got bit depth %d and color type %d", tc.levels, depth, ct)
+		}
+		if err := diff(m, m1); err != nil {
+			t.Fatalf("levels %v: %v", tc.levels, err)
+		}
+	}
+
+	m := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i / 2)
+	}
+	m1, data, err := encodeDecode(m, &Options{ReduceBitDepth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ct, _ := ihdr(data); depth != 8 || ct != ctTrueColorAlpha {
+		t.Fatalf("got bit depth %d and color type %d", depth, ct)
+	}
+	if err := diff(m, m1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterColorKey(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 5, 5))
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			if x != y {
+				m.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 0, 0xff})
+			}
+		}
+	}
+	m1, data, err := encodeDecode(m, &Options{ColorKey: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth, ct, _ := ihdr(data); depth != 8 || ct != ctTrueColor {
+		t.Fatalf("got bit depth %d and color type %d", depth, ct)
+	}
+	if !bytes.Contains(data, []byte("tRNS")) {
+		t.Fatal("no tRNS chunk")
+	}
+	if err := diff(m, m1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Images with partial transparency keep their alpha channel.
+	m.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 0x80})
+	_, data, err = encodeDecode(m, &Options{ColorKey: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ct, _ := ihdr(data); ct != ctTrueColorAlpha {
+		t.Fatalf("got color type %d", ct)
+	}
+}
+
+func TestWriterTyped(t *testing.T) {
+	r := image.Rect(1, 2, 12, 9)
+	for _, tc := range []struct {
+		m           imageExt.Image
+		depth, ct   uint8
+		want        image.Image
+		opaqueAlpha bool
+	}{
+		{imageExt.NewGray(r), 8, ctGrayscale, &image.Gray{}, false},
+		{imageExt.NewGray16(r), 16, ctGrayscale, &image.Gray16{}, false},
+		{imageExt.NewGrayA(r), 8, ctGrayscaleAlpha, &imageExt.GrayA{}, false},
+		{imageExt.NewGrayA32(r), 16, ctGrayscaleAlpha, &imageExt.GrayA32{}, false},
+		{imageExt.NewRGB(r), 8, ctTrueColor, &imageExt.RGB{}, false},
+		{imageExt.NewRGB48(r), 16, ctTrueColor, &imageExt.RGB48{}, false},
+		{imageExt.NewRGBA(r), 8, ctTrueColorAlpha, &image.NRGBA{}, false},
+		{imageExt.NewRGBA64(r), 16, ctTrueColorAlpha, &image.NRGBA64{}, false},
+		// The alpha channel of opaque images is dropped.
+		{imageExt.NewGrayA(r), 8, ctGrayscale, &image.Gray{}, true},
+		{imageExt.NewRGBA64(r), 16, ctTrueColor, &imageExt.RGB48{}, true},
+	} {
+		pix, n := tc.m.Pix(), tc.m.Channels()
+		if tc.m.Depth() == reflect.Uint16 {
+			n *= 2
+		}
+		for i := range pix {
+			pix[i] = uint8(i * 7)
+			if tc.m.Channels()%2 == 0 && i%n >= n-n/tc.m.Channels() {
+				// The colors are alpha-premultiplied.
+				pix[i] = 0xff
+				if !tc.opaqueAlpha && i/n%3 == 0 {
+					pix[i] = 0
+				}
+			}
+		}
+		if tc.m.Channels()%2 == 0 && !tc.opaqueAlpha {
+			for i := 0; i < len(pix); i += n {
+				if pix[i+n-1] == 0 {
+					for j := 0; j < n; j++ {
+						pix[i+j] = 0
+					}
+				}
+			}
+		}
+		for _, opt := range []*Options{nil, {Interlace: true}} {
+			m1, data, err := encodeDecode(tc.m, opt)
+			if err != nil {
+				t.Fatalf("%T: %v", tc.m, err)
+			}
+			if depth, ct, _ := ihdr(data); depth != tc.depth || ct != tc.ct {
+				t.Fatalf("%T: got bit depth %d and color type %d", tc.m, depth, ct)
+			}
+			if reflect.TypeOf(m1) != reflect.TypeOf(tc.want) {
+				t.Fatalf("%T: got %T, want %T", tc.m, m1, tc.want)
+			}
+			if err := diff(tc.m, m1); err != nil {
+				t.Fatalf("%T, %+v: %v", tc.m, opt, err)
+			}
+
+			// Planar images are encoded as the interleaved images.
+			if m1, data, err = encodeDecode(imageExt.AsPlanar(tc.m), opt); err != nil {
+				t.Fatalf("%T: %v", tc.m, err)
+			}
+			if depth, ct, _ := ihdr(data); depth != tc.depth || ct != tc.ct {
+				t.Fatalf("planar %T: got bit depth %d and color type %d", tc.m, depth, ct)
+			}
+			if reflect.TypeOf(m1) != reflect.TypeOf(tc.want) {
+				t.Fatalf("planar %T: got %T, want %T", tc.m, m1, tc.want)
+			}
+			if err := diff(tc.m, m1); err != nil {
+				t.Fatalf("planar %T, %+v: %v", tc.m, opt, err)
+			}
+		}
+	}
+
+	// Translucent pixels are converted to and from PNG's
+	// non-alpha-premultiplied samples.
+	m := imageExt.NewGrayA(image.Rect(0, 0, 1, 1))
+	m.SetGrayA(0, 0, colorExt.GrayA{Y: 0x40, A: 0x80})
+	m1, _, err := encodeDecode(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m1.(*imageExt.GrayA).GrayAAt(0, 0); c != (colorExt.GrayA{Y: 0x40, A: 0x80}) {
+		t.Fatalf("got %v", c)
+	}
+}
+
+func TestWriterOptions(t *testing.T) {
+	m := image.NewGray(image.Rect(0, 0, 4, 4))
+	for _, opt := range []*Options{
+		{Filter: FilterAdaptive + 1},
+		{Filter: -1},
+		{CompressionLevel: 10},
+		{CompressionLevel: BestCompression - 1},
+	} {
+		if err := EncodeOptions(ioutil.Discard, m, opt); err == nil {
+			t.Fatalf("%+v: got no error", opt)
+		}
+	}
+
+	// The options are passed through the image package.
+	var buf bytes.Buffer
+	if err := imageExt.Encode("png", &buf, m, &Options{Interlace: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, interlace := ihdr(buf.Bytes()); interlace != itAdam7 {
+		t.Fatalf("got interlace method %d", interlace)
+	}
+}
+
+func BenchmarkEncodeNRGBA(b *testing.B) {
+	m := image.NewNRGBA(image.Rect(0, 0, 640, 480))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i)
+	}
+	b.SetBytes(int64(len(m.Pix)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Encode(ioutil.Discard, m)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pnm implements a Netpbm image decoder and encoder.
+//
+// It reads and writes the plain (ASCII) and raw (binary) PBM, PGM and PPM
+// formats (P1 to P6), the PAM format (P7) and the PFM format (PF and Pf).
+// The images are decoded to the typed images of the image package:
+//
+//	PBM                     *image.Gray
+//	PGM                     *image.Gray or *image.Gray16
+//	PPM                     *image.RGB or *image.RGB48
+//	PAM, GRAYSCALE_ALPHA    *image.GrayA or *image.GrayA32
+//	PAM, RGB_ALPHA          *image.RGBA or *image.RGBA64
+//	PFM, Pf                 *image.Gray32f
+//	PFM, PF                 *image.RGB96f
+//
+// The images with at most 255 levels have 8-bit samples, and the others have
+// 16-bit samples. The samples are scaled from the maximum value of the file
+// to the full range of the image, and back when they are encoded. The colors
+// of the images with an alpha channel are alpha-premultiplied. The PFM
+// samples of the float typed images are written as they are, and those of
+// the other images are scaled from 0 to 1.
+//
+// DecodeHeader returns the format and the maximum value of a file, which can
+// be passed back in the Options to write the samples as they were read.
+//
+// The Netpbm specification is at http://netpbm.sourceforge.net/doc/.
+package pnm
+
+import (
+	"image"
+	"io"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// Format is a Netpbm format.
+type Format int
+
+const (
+	// Auto selects the format from the image: PGM for gray images, PPM for
+	// color images, PAM for images with an alpha channel and PFM for the
+	// Gray32f and RGB96f images.
+	Auto Format = iota
+	PBM
+	PGM
+	PPM
+	PAM
+	PFM
+)
+
+// Header is the header of a Netpbm image.
+type Header struct {
+	// Format is PBM, PGM, PPM, PAM or PFM.
+	Format Format
+	// Plain reports whether the samples are written in ASCII, as in the
+	// P1, P2 and P3 formats.
+	Plain bool
+	// Width and Height are the dimensions of the image.
+	Width, Height int
+	// Depth is the number of samples per pixel.
+	Depth int
+	// MaxValue is the maximum value of the samples. It is 1 for PBM and 0
+	// for PFM.
+	MaxValue int
+	// TupleType is the TUPLTYPE of a PAM image, or "" if there is none.
+	TupleType string
+}
+
+// Options are the encoding parameters.
+type Options struct {
+	// Format is the written format. Images are converted to gray for PBM
+	// and PGM, and to RGB for PPM and PFM. PBM pixels are black below the
+	// middle gray level.
+	Format Format
+	// Plain writes the ASCII formats P1, P2 and P3 instead of the binary
+	// ones. It cannot be used with PAM and PFM.
+	Plain bool
+	// MaxValue is the maximum value of the samples, from 1 to 65535. If it
+	// is 0, it is 255 for images with 8-bit samples and 65535 for images
+	// with 16-bit samples. It is ignored for PBM and PFM.
+	MaxValue int
+}
+
+func (opt *Options) Lossless() bool {
+	return true
+}
+
+func (opt *Options) Quality() float32 {
+	return 0
+}
+
+func toOptions(opt imageExt.Options) *Options {
+	if opt, ok := opt.(*Options); ok {
+		return opt
+	}
+	return nil
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt imageExt.Options) error {
+	return Encode(w, m, toOptions(opt))
+}
+
+func init() {
+	imageExt.RegisterFormat(imageExt.Format{
+		Name:         "pnm",
+		Extensions:   []string{".pbm", ".pgm", ".ppm", ".pnm", ".pam", ".pfm"},
+		Magics:       []string{"P1", "P2", "P3", "P4", "P5", "P6", "P7", "PF", "Pf"},
+		DecodeConfig: DecodeConfig,
+		Decode:       Decode,
+		Encode:       imageExtEncode,
+	})
+}
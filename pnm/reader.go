@@ -0,0 +1,426 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pnm
+
+import (
+	"bufio"
+	"image"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// A FormatError reports that the input is not a valid Netpbm image.
+type FormatError string
+
+func (e FormatError) Error() string { return "pnm: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// Netpbm feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "pnm: unsupported feature: " + string(e) }
+
+// maxPixels limits the size of the decoded images.
+const maxPixels = 1 << 28
+
+// header is the header of a Netpbm image.
+type header struct {
+	magic         byte // '1' to '7', 'F' or 'f'.
+	width, height int
+	depth         int  // The number of samples per pixel.
+	maxval        int  // 0 for PFM.
+	littleEndian  bool // PFM only.
+	tupleType     string
+}
+
+func (h *header) float() bool {
+	return h.magic == 'F' || h.magic == 'f'
+}
+
+// imageDepth returns the sample type of the decoded image.
+func (h *header) imageDepth() reflect.Kind {
+	switch {
+	case h.float():
+		return reflect.Float32
+	case h.maxval > 0xff:
+		return reflect.Uint16
+	}
+	return reflect.Uint8
+}
+
+type decoder struct {
+	r   *bufio.Reader
+	h   header
+	buf []byte
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// readToken returns the next token of a PBM, PGM, PPM or PFM header, which
+// is separated by white space and comments. The white space character after
+// the token is consumed.
+func (d *decoder) readToken() (string, error) {
+	var tok []byte
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(tok) > 0 {
+				return string(tok), nil
+			}
+			return "", unexpectedEOF(err)
+		}
+		switch {
+		case c == '#' && len(tok) == 0:
+			if _, err := d.r.ReadSlice('\n'); err != nil && err != bufio.ErrBufferFull {
+				return "", unexpectedEOF(err)
+			}
+		case c == '#':
+			return string(tok), d.r.UnreadByte()
+		case isSpace(c):
+			if len(tok) > 0 {
+				return string(tok), nil
+			}
+		default:
+			tok = append(tok, c)
+		}
+	}
+}
+
+// readInt reads a token that is a decimal integer no greater than max.
+func (d *decoder) readInt(max int) (int, error) {
+	tok, err := d.readToken()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(tok)
+	if err != nil || n < 0 || n > max {
+		return 0, FormatError("bad number " + strconv.Quote(tok))
+	}
+	return n, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (d *decoder) readHeader() error {
+	var magic [2]byte
+	if _, err := io.ReadFull(d.r, magic[:]); err != nil {
+		return err
+	}
+	if magic[0] != 'P' || !strings.ContainsRune("1234567Ff", rune(magic[1])) {
+		return FormatError("bad magic number")
+	}
+	h := &d.h
+	h.magic = magic[1]
+	if h.magic == '7' {
+		return d.readPAMHeader()
+	}
+
+	var err error
+	if h.width, err = d.readInt(maxPixels); err != nil {
+		return err
+	}
+	if h.height, err = d.readInt(maxPixels); err != nil {
+		return err
+	}
+	switch h.magic {
+	case '1', '4':
+		h.depth, h.maxval = 1, 1
+	case '2', '5':
+		h.depth = 1
+	case '3', '6':
+		h.depth = 3
+	case 'f':
+		h.depth = 1
+	case 'F':
+		h.depth = 3
+	}
+	switch h.magic {
+	case '2', '3', '5', '6':
+		if h.maxval, err = d.readInt(0xffff); err != nil {
+			return err
+		}
+	case 'F', 'f':
+		tok, err := d.readToken()
+		if err != nil {
+			return err
+		}
+		scale, err := strconv.ParseFloat(tok, 64)
+		if err != nil || scale == 0 {
+			return FormatError("bad scale " + strconv.Quote(tok))
+		}
+		h.littleEndian = scale < 0
+	}
+	return d.checkHeader()
+}
+
+// readPAMHeader reads the header lines of a PAM image, up to ENDHDR.
+func (d *decoder) readPAMHeader() error {
+	h := &d.h
+	h.width, h.height, h.depth, h.maxval = -1, -1, -1, -1
+	for {
+		line, err := d.r.ReadString('\n')
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "ENDHDR" {
+			break
+		}
+		if len(fields) < 2 {
+			return FormatError("bad header line " + strconv.Quote(line))
+		}
+		if fields[0] == "TUPLTYPE" {
+			// The depth and the maximum value select the image type.
+			// The values of several TUPLTYPE lines are concatenated.
+			if h.tupleType != "" {
+				h.tupleType += " "
+			}
+			h.tupleType += strings.Join(fields[1:], " ")
+			continue
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 {
+			return FormatError("bad header line " + strconv.Quote(line))
+		}
+		switch fields[0] {
+		case "WIDTH":
+			h.width = n
+		case "HEIGHT":
+			h.height = n
+		case "DEPTH":
+			h.depth = n
+		case "MAXVAL":
+			h.maxval = n
+		default:
+			return FormatError("bad header line " + strconv.Quote(line))
+		}
+	}
+	if h.width < 0 || h.height < 0 || h.depth < 0 || h.maxval < 0 {
+		return FormatError("missing header line")
+	}
+	if h.depth < 1 || h.depth > 4 {
+		return UnsupportedError("depth " + strconv.Itoa(h.depth))
+	}
+	return d.checkHeader()
+}
+
+func (d *decoder) checkHeader() error {
+	h := &d.h
+	if !h.float() && (h.maxval < 1 || h.maxval > 0xffff) {
+		return FormatError("bad maximum value")
+	}
+	if h.height > 0 && h.width > maxPixels/h.height {
+		return UnsupportedError("image is too large")
+	}
+	return nil
+}
+
+func (d *decoder) config() image.Config {
+	m, _ := imageExt.NewImage(image.Rectangle{}, d.h.depth, d.h.imageDepth())
+	return image.Config{
+		ColorModel: m.ColorModel(),
+		Width:      d.h.width,
+		Height:     d.h.height,
+	}
+}
+
+// readRow reads the samples of the next row. The PBM samples are inverted,
+// so that they are 1 for white like the other formats.
+func (d *decoder) readRow(row []uint32) error {
+	switch d.h.magic {
+	case '1':
+		for i := range row {
+			c, err := d.r.ReadByte()
+			for err == nil && isSpace(c) {
+				c, err = d.r.ReadByte()
+			}
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			if c != '0' && c != '1' {
+				return FormatError("bad PBM sample")
+			}
+			row[i] = uint32('1' - c)
+		}
+	case '2', '3':
+		for i := range row {
+			n, err := d.readInt(d.h.maxval)
+			if err != nil {
+				return err
+			}
+			row[i] = uint32(n)
+		}
+	case '4':
+		b := d.buf[:(len(row)+7)/8]
+		if _, err := io.ReadFull(d.r, b); err != nil {
+			return unexpectedEOF(err)
+		}
+		for i := range row {
+			row[i] = uint32(^b[i/8]>>uint(7-i%8)) & 1
+		}
+	default:
+		if d.h.maxval <= 0xff {
+			b := d.buf[:len(row)]
+			if _, err := io.ReadFull(d.r, b); err != nil {
+				return unexpectedEOF(err)
+			}
+			for i := range row {
+				row[i] = uint32(b[i])
+			}
+		} else {
+			b := d.buf[:2*len(row)]
+			if _, err := io.ReadFull(d.r, b); err != nil {
+				return unexpectedEOF(err)
+			}
+			for i := range row {
+				row[i] = uint32(b[2*i])<<8 | uint32(b[2*i+1])
+			}
+		}
+		for _, v := range row {
+			if v > uint32(d.h.maxval) {
+				return FormatError("sample exceeds the maximum value")
+			}
+		}
+	}
+	return nil
+}
+
+// decodeFloat decodes the rows of a PFM image, which are stored from bottom
+// to top.
+func (d *decoder) decodeFloat(m imageExt.Image) error {
+	pix, stride := m.Pix(), m.Stride()
+	n := 4 * d.h.width * d.h.depth
+	for y := d.h.height - 1; y >= 0; y-- {
+		b := pix[y*stride : y*stride+n]
+		if _, err := io.ReadFull(d.r, b); err != nil {
+			return unexpectedEOF(err)
+		}
+		if d.h.littleEndian {
+			for i := 0; i < n; i += 4 {
+				b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+			}
+		}
+	}
+	return nil
+}
+
+// decodeInt decodes the rows of the other images, whose samples it scales
+// to the full range of the image and premultiplies by the alpha channel.
+func (d *decoder) decodeInt(m imageExt.Image) error {
+	h := &d.h
+	max, size := uint32(0xff), 1
+	if h.maxval > 0xff {
+		max, size = 0xffff, 2
+	}
+	maxval := uint32(h.maxval)
+	alpha := h.depth == 2 || h.depth == 4
+	d.buf = make([]byte, size*h.width*h.depth)
+	row := make([]uint32, h.width*h.depth)
+	pix, stride := m.Pix(), m.Stride()
+	for y := 0; y < h.height; y++ {
+		if err := d.readRow(row); err != nil {
+			return err
+		}
+		if maxval != max {
+			for i, v := range row {
+				row[i] = (v*max + maxval/2) / maxval
+			}
+		}
+		if alpha {
+			for i := 0; i < len(row); i += h.depth {
+				a := row[i+h.depth-1]
+				for j := i; j < i+h.depth-1; j++ {
+					row[j] = (row[j]*a + max/2) / max
+				}
+			}
+		}
+		p := pix[y*stride:]
+		if size == 1 {
+			for i, v := range row {
+				p[i] = uint8(v)
+			}
+		} else {
+			for i, v := range row {
+				p[2*i] = uint8(v >> 8)
+				p[2*i+1] = uint8(v)
+			}
+		}
+	}
+	return nil
+}
+
+// Decode reads a Netpbm image from r and returns it as an image.Image.
+func Decode(r io.Reader) (image.Image, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	m, err := imageExt.NewImage(image.Rect(0, 0, d.h.width, d.h.height), d.h.depth, d.h.imageDepth())
+	if err != nil {
+		return nil, err
+	}
+	if d.h.float() {
+		err = d.decodeFloat(m)
+	} else {
+		err = d.decodeInt(m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DecodeHeader reads the header of a Netpbm image from r.
+func DecodeHeader(r io.Reader) (*Header, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	h := &Header{
+		Plain:     d.h.magic >= '1' && d.h.magic <= '3',
+		Width:     d.h.width,
+		Height:    d.h.height,
+		Depth:     d.h.depth,
+		MaxValue:  d.h.maxval,
+		TupleType: d.h.tupleType,
+	}
+	switch d.h.magic {
+	case '1', '4':
+		h.Format = PBM
+	case '2', '5':
+		h.Format = PGM
+	case '3', '6':
+		h.Format = PPM
+	case '7':
+		h.Format = PAM
+	default:
+		h.Format = PFM
+	}
+	return h, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a Netpbm image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.readHeader(); err != nil {
+		return image.Config{}, err
+	}
+	return d.config(), nil
+}
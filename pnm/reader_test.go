@@ -0,0 +1,136 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pnm
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want image.Image
+	}{
+		{
+			"P1\n# comment\n3 2\n0 1 0\n110\n",
+			&imageExt.Gray{M: struct {
+				Pix    []uint8
+				Stride int
+				Rect   image.Rectangle
+			}{[]uint8{0xff, 0x00, 0xff, 0x00, 0x00, 0xff}, 3, image.Rect(0, 0, 3, 2)}},
+		},
+		{
+			"P4 3 2\n\x40\xc0",
+			&imageExt.Gray{M: struct {
+				Pix    []uint8
+				Stride int
+				Rect   image.Rectangle
+			}{[]uint8{0xff, 0x00, 0xff, 0x00, 0x00, 0xff}, 3, image.Rect(0, 0, 3, 2)}},
+		},
+		{
+			"P2\n2 1 # comment\n15\n0 15\n",
+			&imageExt.Gray{M: struct {
+				Pix    []uint8
+				Stride int
+				Rect   image.Rectangle
+			}{[]uint8{0x00, 0xff}, 2, image.Rect(0, 0, 2, 1)}},
+		},
+		{
+			"P5 2 1 1000\n\x01\xf4\x03\xe8",
+			&imageExt.Gray16{M: struct {
+				Pix    []uint8
+				Stride int
+				Rect   image.Rectangle
+			}{[]uint8{0x80, 0x00, 0xff, 0xff}, 4, image.Rect(0, 0, 2, 1)}},
+		},
+		{
+			"P7\nWIDTH 2\n# comment\nHEIGHT 1\nDEPTH 2\nMAXVAL 255\nTUPLTYPE GRAYSCALE_ALPHA\nENDHDR\n\xff\x80\x40\x00",
+			&imageExt.GrayA{M: struct {
+				Pix    []uint8
+				Stride int
+				Rect   image.Rectangle
+			}{[]uint8{0x80, 0x80, 0x00, 0x00}, 4, image.Rect(0, 0, 2, 1)}},
+		},
+		{
+			// A big-endian PFM image, whose rows are stored from bottom to top.
+			"Pf\n1 2\n1.0\n\x3f\x80\x00\x00\x40\x00\x00\x00",
+			&imageExt.Gray32f{M: struct {
+				Pix    []uint8
+				Stride int
+				Rect   image.Rectangle
+			}{[]uint8{0x40, 0x00, 0x00, 0x00, 0x3f, 0x80, 0x00, 0x00}, 4, image.Rect(0, 0, 1, 2)}},
+		},
+	} {
+		m, err := Decode(strings.NewReader(tc.data))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.data, err)
+		}
+		want := tc.want.(imageExt.Image)
+		got, ok := m.(imageExt.Image)
+		if !ok || got.Rect() != want.Rect() || !bytes.Equal(got.Pix(), want.Pix()) {
+			t.Fatalf("%q: got %#v, want %#v", tc.data, m, tc.want)
+		}
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	c, err := DecodeConfig(strings.NewReader("P7\nWIDTH 3\nHEIGHT 4\nDEPTH 4\nMAXVAL 4095\nTUPLTYPE RGB_ALPHA\nENDHDR\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Width != 3 || c.Height != 4 || c.ColorModel != colorExt.RGBA64Model {
+		t.Fatalf("got config %+v", c)
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want Header
+	}{
+		{"P1 3 2\n", Header{Format: PBM, Plain: true, Width: 3, Height: 2, Depth: 1, MaxValue: 1}},
+		{"P5 3 2 1023\n", Header{Format: PGM, Width: 3, Height: 2, Depth: 1, MaxValue: 1023}},
+		{"P3 3 2 15\n", Header{Format: PPM, Plain: true, Width: 3, Height: 2, Depth: 3, MaxValue: 15}},
+		{"Pf 3 2 -1\n", Header{Format: PFM, Width: 3, Height: 2, Depth: 1}},
+		{
+			"P7\nWIDTH 3\nHEIGHT 2\nDEPTH 4\nMAXVAL 4095\nTUPLTYPE RGB_ALPHA\nTUPLTYPE extra\nENDHDR\n",
+			Header{Format: PAM, Width: 3, Height: 2, Depth: 4, MaxValue: 4095, TupleType: "RGB_ALPHA extra"},
+		},
+	} {
+		h, err := DecodeHeader(strings.NewReader(tc.data))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.data, err)
+		}
+		if *h != tc.want {
+			t.Fatalf("%q: got %+v, want %+v", tc.data, *h, tc.want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"P8 1 1 255\n\x00",
+		"P5 1 1 0\n\x00",
+		"P5 1 1 65536\n\x00",
+		"P5 2 1 255\n\x00",
+		"P2 2 1 15\n0 16\n",
+		"P1 2 1\n02\n",
+		"P7\nWIDTH 1\nHEIGHT 1\nMAXVAL 255\nENDHDR\n\x00",
+		"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 5\nMAXVAL 255\nENDHDR\n\x00\x00\x00\x00\x00",
+		"PF 1 1 0\n\x00\x00\x00\x00",
+		"P5 100000 100000 255\n",
+	} {
+		if _, err := Decode(strings.NewReader(data)); err == nil {
+			t.Fatalf("%q: got no error", data)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pnm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// layout returns the number of channels of the samples that represent m
+// exactly, and whether they have 16 bits.
+func layout(m image.Image) (channels int, wide bool) {
+	switch m := m.(type) {
+	case *imageExt.Gray, *image.Gray:
+		return 1, false
+	case *imageExt.Gray16, *image.Gray16:
+		return 1, true
+	case *imageExt.GrayA:
+		return 2, false
+	case *imageExt.GrayA32:
+		return 2, true
+	case *imageExt.RGB:
+		return 3, false
+	case *imageExt.RGB48:
+		return 3, true
+	case *imageExt.RGBA:
+		return 4, false
+	case *imageExt.RGBA64:
+		return 4, true
+	case *image.RGBA64, *image.NRGBA64:
+		if m.(interface {
+			Opaque() bool
+		}).Opaque() {
+			return 3, true
+		}
+		return 4, true
+	}
+	if m, ok := m.(interface {
+		Opaque() bool
+	}); ok && m.Opaque() {
+		return 3, false
+	}
+	return 4, false
+}
+
+type encoder struct {
+	w        *bufio.Writer
+	m        image.Image
+	format   Format
+	plain    bool
+	channels int
+	wide     bool
+	maxval   uint32
+}
+
+// sample writes the samples of the pixel at (x, y) to s. They are not
+// alpha-premultiplied, and range from 0 to the maximum value.
+func (e *encoder) sample(s []uint32, x, y int) {
+	r, g, b, a := e.m.At(x, y).RGBA()
+	if e.channels <= 2 && (r != g || g != b) {
+		r = (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+	}
+	max := uint32(0xffff)
+	if !e.wide {
+		r, g, b, a, max = r>>8, g>>8, b>>8, a>>8, 0xff
+	}
+	switch e.channels {
+	case 1:
+		s[0] = r
+	case 2:
+		s[0], s[1] = r, a
+	case 3:
+		s[0], s[1], s[2] = r, g, b
+	case 4:
+		s[0], s[1], s[2], s[3] = r, g, b, a
+	}
+	if e.channels == 2 || e.channels == 4 {
+		for i := 0; i < e.channels-1; i++ {
+			if a == 0 {
+				s[i] = 0
+			} else if a != max {
+				s[i] = (s[i]*max + a/2) / a
+			}
+		}
+	}
+	if e.maxval != max {
+		for i := 0; i < e.channels; i++ {
+			s[i] = (s[i]*e.maxval + max/2) / max
+		}
+	}
+}
+
+func (e *encoder) writeHeader() error {
+	b := e.m.Bounds()
+	var err error
+	switch {
+	case e.format == PAM:
+		tupleType := [...]string{"", "GRAYSCALE", "GRAYSCALE_ALPHA", "RGB", "RGB_ALPHA"}[e.channels]
+		if e.maxval == 1 && e.channels <= 2 {
+			tupleType = "BLACKANDWHITE" + tupleType[len("GRAYSCALE"):]
+		}
+		_, err = fmt.Fprintf(e.w, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH %d\nMAXVAL %d\nTUPLTYPE %s\nENDHDR\n",
+			b.Dx(), b.Dy(), e.channels, e.maxval, tupleType)
+	case e.format == PFM && e.channels == 1:
+		_, err = fmt.Fprintf(e.w, "Pf\n%d %d\n-1\n", b.Dx(), b.Dy())
+	case e.format == PFM:
+		_, err = fmt.Fprintf(e.w, "PF\n%d %d\n-1\n", b.Dx(), b.Dy())
+	default:
+		magic := 1 + int(e.format-PBM)
+		if !e.plain {
+			magic += 3
+		}
+		_, err = fmt.Fprintf(e.w, "P%d\n%d %d\n", magic, b.Dx(), b.Dy())
+		if err == nil && e.format != PBM {
+			_, err = fmt.Fprintf(e.w, "%d\n", e.maxval)
+		}
+	}
+	return err
+}
+
+// writeInt writes the rows of the integer formats.
+func (e *encoder) writeInt() error {
+	b := e.m.Bounds()
+	s := make([]uint32, e.channels)
+	var buf []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		buf = buf[:0]
+		switch {
+		case e.format == PBM && e.plain:
+			for x := b.Min.X; x < b.Max.X; x++ {
+				e.sample(s, x, y)
+				buf = append(buf, byte('1'-s[0]))
+				if n := x - b.Min.X + 1; n%70 == 0 || x+1 == b.Max.X {
+					buf = append(buf, '\n')
+				}
+			}
+		case e.format == PBM:
+			for x := b.Min.X; x < b.Max.X; x++ {
+				i := x - b.Min.X
+				if i%8 == 0 {
+					buf = append(buf, 0)
+				}
+				e.sample(s, x, y)
+				buf[i/8] |= byte(1-s[0]) << uint(7-i%8)
+			}
+		case e.plain:
+			n := 0
+			for x := b.Min.X; x < b.Max.X; x++ {
+				e.sample(s, x, y)
+				for _, v := range s {
+					// Lines are at most 70 characters long.
+					if n > 0 && n+6 > 70 {
+						buf = append(buf, '\n')
+						n = 0
+					} else if n > 0 {
+						buf = append(buf, ' ')
+						n++
+					}
+					l := len(buf)
+					buf = strconv.AppendUint(buf, uint64(v), 10)
+					n += len(buf) - l
+				}
+			}
+			buf = append(buf, '\n')
+		default:
+			for x := b.Min.X; x < b.Max.X; x++ {
+				e.sample(s, x, y)
+				for _, v := range s {
+					if e.maxval > 0xff {
+						buf = append(buf, uint8(v>>8))
+					}
+					buf = append(buf, uint8(v))
+				}
+			}
+		}
+		if _, err := e.w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// floatAt returns the samples of the pixel of m at (x, y). The samples of
+// the float typed images are returned as they are, and those of the other
+// images are scaled from 0 to 1.
+func (e *encoder) floatAt(x, y int) (r, g, b float32) {
+	switch m := e.m.(type) {
+	case *imageExt.Gray32f:
+		v := m.Gray32fAt(x, y).Y
+		return v, v, v
+	case *imageExt.RGB96f:
+		c := m.RGB96fAt(x, y)
+		return c.R, c.G, c.B
+	case *imageExt.RGBA128f:
+		c := m.RGBA128fAt(x, y)
+		return c.R, c.G, c.B
+	}
+	c := e.m.At(x, y)
+	if e.channels == 1 {
+		v := float32(color.Gray16Model.Convert(c).(color.Gray16).Y) / 0xffff
+		return v, v, v
+	}
+	r0, g0, b0, _ := c.RGBA()
+	return float32(r0) / 0xffff, float32(g0) / 0xffff, float32(b0) / 0xffff
+}
+
+// writeFloat writes the rows of a PFM image from bottom to top, with
+// little-endian samples.
+func (e *encoder) writeFloat() error {
+	b := e.m.Bounds()
+	buf := make([]byte, 4*e.channels*b.Dx())
+	for y := b.Max.Y - 1; y >= b.Min.Y; y-- {
+		i := 0
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, b := e.floatAt(x, y)
+			if e.channels == 1 {
+				binary.LittleEndian.PutUint32(buf[i:], math.Float32bits(r))
+				i += 4
+				continue
+			}
+			binary.LittleEndian.PutUint32(buf[i+0:], math.Float32bits(r))
+			binary.LittleEndian.PutUint32(buf[i+4:], math.Float32bits(g))
+			binary.LittleEndian.PutUint32(buf[i+8:], math.Float32bits(b))
+			i += 12
+		}
+		if _, err := e.w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode writes the image m to w in a Netpbm format. The default parameters
+// are used if opt is nil.
+func Encode(w io.Writer, m image.Image, opt *Options) error {
+	if opt == nil {
+		opt = new(Options)
+	}
+	b := m.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return errors.New("pnm: invalid image size: " + strconv.Itoa(b.Dx()) + "x" + strconv.Itoa(b.Dy()))
+	}
+	if opt.MaxValue < 0 || opt.MaxValue > 0xffff {
+		return errors.New("pnm: invalid maximum value: " + strconv.Itoa(opt.MaxValue))
+	}
+
+	e := &encoder{m: m, format: opt.Format, plain: opt.Plain}
+	e.channels, e.wide = layout(m)
+	if e.format == Auto {
+		switch m.(type) {
+		case *imageExt.Gray32f, *imageExt.RGB96f:
+			e.format = PFM
+		default:
+			e.format = [...]Format{PGM, PAM, PPM, PAM}[e.channels-1]
+		}
+	}
+	switch e.format {
+	case PBM:
+		e.channels, e.wide = 1, false
+	case PGM:
+		e.channels = 1
+	case PPM:
+		e.channels = 3
+	case PAM:
+	case PFM:
+		if _, ok := m.(*imageExt.Gray32f); ok || e.channels == 1 {
+			e.channels = 1
+		} else {
+			e.channels = 3
+		}
+	default:
+		return errors.New("pnm: invalid format: " + strconv.Itoa(int(e.format)))
+	}
+	if e.plain && (e.format == PAM || e.format == PFM) {
+		return errors.New("pnm: PAM and PFM images have no plain format")
+	}
+	switch {
+	case e.format == PBM:
+		e.maxval = 1
+	case opt.MaxValue != 0:
+		e.maxval = uint32(opt.MaxValue)
+	case e.wide:
+		e.maxval = 0xffff
+	default:
+		e.maxval = 0xff
+	}
+
+	e.w = bufio.NewWriter(w)
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	var err error
+	if e.format == PFM {
+		err = e.writeFloat()
+	} else {
+		err = e.writeInt()
+	}
+	if err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
@@ -0,0 +1,300 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pnm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// testImage returns a typed image with random pixels, whose colors are no
+// greater than their alpha when it has an alpha channel.
+func testImage(channels int, depth reflect.Kind) imageExt.Image {
+	m, err := imageExt.NewImage(image.Rect(0, 0, 23, 11), channels, depth)
+	if err != nil {
+		panic(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	pix := m.Pix()
+	switch depth {
+	case reflect.Float32:
+		for i := 0; i < len(pix); i += 4 {
+			binary.BigEndian.PutUint32(pix[i:], math.Float32bits(float32(rnd.NormFloat64()*1000)))
+		}
+	case reflect.Uint8:
+		for i := range pix {
+			pix[i] = uint8(rnd.Intn(0x100))
+		}
+		if channels == 2 || channels == 4 {
+			for i := 0; i < len(pix); i += channels {
+				a := pix[i+channels-1]
+				for j := i; j < i+channels-1; j++ {
+					pix[j] = uint8(rnd.Intn(int(a) + 1))
+				}
+			}
+		}
+	case reflect.Uint16:
+		s := make([]uint16, len(pix)/2)
+		for i := range s {
+			s[i] = uint16(rnd.Intn(0x10000))
+		}
+		if channels == 2 || channels == 4 {
+			for i := 0; i < len(s); i += channels {
+				a := s[i+channels-1]
+				for j := i; j < i+channels-1; j++ {
+					s[j] = uint16(rnd.Intn(int(a) + 1))
+				}
+			}
+		}
+		for i, v := range s {
+			binary.BigEndian.PutUint16(pix[2*i:], v)
+		}
+	}
+	return m
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		channels int
+		depth    reflect.Kind
+		magic    string
+	}{
+		{1, reflect.Uint8, "P5"},
+		{1, reflect.Uint16, "P5"},
+		{2, reflect.Uint8, "P7"},
+		{2, reflect.Uint16, "P7"},
+		{3, reflect.Uint8, "P6"},
+		{3, reflect.Uint16, "P6"},
+		{4, reflect.Uint8, "P7"},
+		{4, reflect.Uint16, "P7"},
+		{1, reflect.Float32, "Pf"},
+		{3, reflect.Float32, "PF"},
+	} {
+		m0 := testImage(tc.channels, tc.depth)
+		for _, plain := range []bool{false, true} {
+			if plain && (tc.magic == "P7" || tc.magic[1] == 'F' || tc.magic[1] == 'f') {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := Encode(&buf, m0, &Options{Plain: plain}); err != nil {
+				t.Fatalf("%T: %v", m0, err)
+			}
+			magic := tc.magic
+			if plain {
+				magic = "P" + string(magic[1]-3)
+			}
+			if got := buf.String()[:2]; got != magic {
+				t.Fatalf("%T, plain %v: got magic %q, want %q", m0, plain, got, magic)
+			}
+			m1, err := Decode(&buf)
+			if err != nil {
+				t.Fatalf("%T, plain %v: %v", m0, plain, err)
+			}
+			if reflect.TypeOf(m1) != reflect.TypeOf(m0) {
+				t.Fatalf("%T, plain %v: got %T", m0, plain, m1)
+			}
+			if !bytes.Equal(m1.(imageExt.Image).Pix(), m0.Pix()) {
+				t.Fatalf("%T, plain %v: the pixels differ", m0, plain)
+			}
+		}
+	}
+}
+
+func TestMaxValue(t *testing.T) {
+	m0 := imageExt.NewRGB(image.Rect(0, 0, 16, 3))
+	for x := 0; x < 16; x++ {
+		m0.Set(x, 1, color.Gray{uint8(17 * x)})
+	}
+	for _, plain := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, &Options{Plain: plain, MaxValue: 15}); err != nil {
+			t.Fatal(err)
+		}
+		m1, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(m1.(*imageExt.RGB).Pix(), m0.Pix()) {
+			t.Fatalf("plain %v: the pixels differ", plain)
+		}
+	}
+
+	// 8-bit images with more than 255 levels are decoded to 16 bits.
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, &Options{Format: PGM, MaxValue: 510}); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 16; x++ {
+		if c := m1.(*imageExt.Gray16).Gray16At(x, 1); c.Y != uint16(17*x)*0x101 {
+			t.Fatalf("(%d, 1): got %v", x, c)
+		}
+	}
+}
+
+func TestMaxValueRoundTrip(t *testing.T) {
+	// The files are written as the encoder writes them, with samples up to
+	// a maximum value of 1023.
+	rnd := rand.New(rand.NewSource(1))
+	for _, header := range []string{
+		"P5\n5 3\n1023\n",
+		"P6\n5 3\n1023\n",
+		"P7\nWIDTH 5\nHEIGHT 3\nDEPTH 1\nMAXVAL 1023\nTUPLTYPE GRAYSCALE\nENDHDR\n",
+		"P7\nWIDTH 5\nHEIGHT 3\nDEPTH 3\nMAXVAL 1023\nTUPLTYPE RGB\nENDHDR\n",
+	} {
+		channels := 1
+		if strings.HasPrefix(header, "P6") || strings.Contains(header, "DEPTH 3") {
+			channels = 3
+		}
+		data := []byte(header)
+		for i := 0; i < 5*3*channels; i++ {
+			data = append(data, 0, 0)
+			binary.BigEndian.PutUint16(data[len(data)-2:], uint16(rnd.Intn(1024)))
+		}
+		h, err := DecodeHeader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, &Options{Format: h.Format, Plain: h.Plain, MaxValue: h.MaxValue}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("%q: the encoded file differs", header)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	m0 := image.NewNRGBA(image.Rect(0, 0, 19, 5))
+	for x := 0; x < 19; x++ {
+		m0.Set(x, 2, color.NRGBA{uint8(14 * x), uint8(14 * x), uint8(14 * x), 0xff})
+	}
+	for _, tc := range []struct {
+		format Format
+		plain  bool
+		magic  string
+		want   reflect.Type
+	}{
+		{PBM, true, "P1", reflect.TypeOf(imageExt.NewGray(image.Rectangle{}))},
+		{PBM, false, "P4", reflect.TypeOf(imageExt.NewGray(image.Rectangle{}))},
+		{PGM, true, "P2", reflect.TypeOf(imageExt.NewGray(image.Rectangle{}))},
+		{PPM, false, "P6", reflect.TypeOf(imageExt.NewRGB(image.Rectangle{}))},
+		{PAM, false, "P7", reflect.TypeOf(imageExt.NewRGBA(image.Rectangle{}))},
+		{PFM, false, "PF", reflect.TypeOf(imageExt.NewRGB96f(image.Rectangle{}))},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, &Options{Format: tc.format, Plain: tc.plain}); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String()[:2]; got != tc.magic {
+			t.Fatalf("got magic %q, want %q", got, tc.magic)
+		}
+		m1, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.magic, err)
+		}
+		if reflect.TypeOf(m1) != tc.want {
+			t.Fatalf("%s: got %T, want %v", tc.magic, m1, tc.want)
+		}
+		if m1.Bounds() != m0.Bounds() {
+			t.Fatalf("%s: got bounds %v", tc.magic, m1.Bounds())
+		}
+		if tc.format == PBM {
+			for x := 0; x < 19; x++ {
+				if y := m1.(*imageExt.Gray).GrayAt(x, 2).Y; (y == 0) != (x < 10) || y != 0 && y != 0xff {
+					t.Fatalf("%s: (%d, 2): got %d", tc.magic, x, y)
+				}
+			}
+		}
+	}
+
+	if err := Encode(new(bytes.Buffer), m0, &Options{Format: PAM, Plain: true}); err == nil {
+		t.Fatal("plain PAM: got no error")
+	}
+}
+
+func TestFloat(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	rgba.SetRGBA(0, 0, color.RGBA{0xff, 0x80, 0, 0xff})
+	gray := image.NewGray(image.Rect(0, 0, 1, 1))
+	gray.SetGray(0, 0, color.Gray{0x80})
+	for _, tc := range []struct {
+		m    image.Image
+		want []float32
+	}{
+		// The samples of the images that are not float typed are scaled
+		// from 0 to 1.
+		{rgba, []float32{1, float32(0x8080) / 0xffff, 0}},
+		{gray, []float32{float32(0x8080) / 0xffff}},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tc.m, &Options{Format: PFM}); err != nil {
+			t.Fatal(err)
+		}
+		m, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("%T: %v", tc.m, err)
+		}
+		var got []float32
+		switch m := m.(type) {
+		case *imageExt.Gray32f:
+			got = []float32{m.Gray32fAt(0, 0).Y}
+		case *imageExt.RGB96f:
+			c := m.RGB96fAt(0, 0)
+			got = []float32{c.R, c.G, c.B}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%T: got %v, want %v", tc.m, got, tc.want)
+		}
+	}
+
+	// Those of the float typed images are written as they are.
+	m := imageExt.NewRGB96f(image.Rect(0, 0, 1, 1))
+	m.SetRGB96f(0, 0, colorExt.RGB96f{R: -2, G: 0.5, B: 1000})
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m1.(*imageExt.RGB96f).RGB96fAt(0, 0); c != m.RGB96fAt(0, 0) {
+		t.Fatalf("got %v, want %v", c, m.RGB96fAt(0, 0))
+	}
+}
+
+func TestImageExt(t *testing.T) {
+	m0 := testImage(4, reflect.Uint16)
+	var buf bytes.Buffer
+	if err := imageExt.Encode("pnm", &buf, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	m1, format, err := imageExt.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "pnm" || !bytes.Equal(m1.(imageExt.Image).Pix(), m0.Pix()) {
+		t.Fatalf("got format %q and different pixels", format)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qoi implements a QOI (Quite OK Image) decoder and encoder.
+//
+// The images of 3 channels are decoded to *image.RGB images, and those of 4
+// channels to *image.RGBA images, whose pixels are read and written in
+// place. The colors of the RGBA images are alpha-premultiplied, as in the
+// other images, while QOI stores them without premultiplication: the colors
+// of the translucent pixels are converted, and rounded.
+//
+// The QOI specification is at https://qoiformat.org/qoi-specification.pdf.
+package qoi
+
+import (
+	"image"
+	"io"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// Colorspaces of the header.
+const (
+	SRGB   = 0 // sRGB samples, with a linear alpha channel.
+	Linear = 1 // Linear samples.
+)
+
+// Header is the header of a QOI image.
+type Header struct {
+	// Width and Height are the dimensions of the image.
+	Width, Height int
+	// Channels is 3 for RGB images and 4 for RGBA images.
+	Channels int
+	// Colorspace is SRGB or Linear. It does not change the samples.
+	Colorspace int
+}
+
+// Options are the encoding parameters.
+type Options struct {
+	// Colorspace is written to the header, SRGB or Linear.
+	Colorspace int
+}
+
+func (opt *Options) Lossless() bool {
+	return true
+}
+
+func (opt *Options) Quality() float32 {
+	return 0
+}
+
+func toOptions(opt imageExt.Options) *Options {
+	if opt, ok := opt.(*Options); ok {
+		return opt
+	}
+	return nil
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt imageExt.Options) error {
+	return Encode(w, m, toOptions(opt))
+}
+
+func init() {
+	imageExt.RegisterFormat(imageExt.Format{
+		Name:         "qoi",
+		Extensions:   []string{".qoi"},
+		Magics:       []string{"qoif"},
+		DecodeConfig: DecodeConfig,
+		Decode:       Decode,
+		Encode:       imageExtEncode,
+	})
+}
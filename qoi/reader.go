@@ -0,0 +1,204 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qoi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"io"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// A FormatError reports that the input is not a valid QOI image.
+type FormatError string
+
+func (e FormatError) Error() string { return "qoi: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// QOI feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "qoi: unsupported feature: " + string(e) }
+
+const (
+	qoiMagic   = "qoif"
+	headerSize = 14
+	// maxPixels limits the size of the images, as in the reference
+	// implementation.
+	maxPixels = 400000000
+)
+
+// The chunks of the pixels. The 2-bit tags of the first four are followed by
+// 6 bits of data; the 8-bit tags of the last two are followed by the samples.
+const (
+	opIndex = 0x00
+	opDiff  = 0x40
+	opLuma  = 0x80
+	opRun   = 0xc0
+	opRGB   = 0xfe
+	opRGBA  = 0xff
+	opMask  = 0xc0
+)
+
+// endMarker follows the chunks of the pixels.
+const endMarker = "\x00\x00\x00\x00\x00\x00\x00\x01"
+
+// hash returns the position of a pixel in the index of the previously seen
+// pixels.
+func hash(px [4]byte) int {
+	return (int(px[0])*3 + int(px[1])*5 + int(px[2])*7 + int(px[3])*11) % 64
+}
+
+type decoder struct {
+	r *bufio.Reader
+	h Header
+}
+
+func (d *decoder) readHeader() error {
+	var b [headerSize]byte
+	if _, err := io.ReadFull(d.r, b[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if string(b[:4]) != qoiMagic {
+		return FormatError("not a QOI file")
+	}
+	w, h := binary.BigEndian.Uint32(b[4:]), binary.BigEndian.Uint32(b[8:])
+	if w > maxPixels || h > maxPixels || uint64(w)*uint64(h) > maxPixels {
+		return UnsupportedError("image is too large")
+	}
+	d.h = Header{
+		Width:      int(w),
+		Height:     int(h),
+		Channels:   int(b[12]),
+		Colorspace: int(b[13]),
+	}
+	if d.h.Channels != 3 && d.h.Channels != 4 {
+		return FormatError("bad number of channels")
+	}
+	if d.h.Colorspace != SRGB && d.h.Colorspace != Linear {
+		return FormatError("bad colorspace")
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (d *decoder) decode() (image.Image, error) {
+	var (
+		m   image.Image
+		pix []byte
+		r   = image.Rect(0, 0, d.h.Width, d.h.Height)
+	)
+	if d.h.Channels == 3 {
+		rgb := imageExt.NewRGB(r)
+		m, pix = rgb, rgb.M.Pix
+	} else {
+		rgba := imageExt.NewRGBA(r)
+		m, pix = rgba, rgba.M.Pix
+	}
+
+	var (
+		index    [64][4]byte
+		px       = [4]byte{0, 0, 0, 0xff}
+		run      int
+		channels = d.h.Channels
+	)
+	for i := 0; i < len(pix); i += channels {
+		if run > 0 {
+			run--
+		} else {
+			b, err := d.r.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			switch {
+			case b == opRGB:
+				if _, err := io.ReadFull(d.r, px[:3]); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+			case b == opRGBA:
+				if _, err := io.ReadFull(d.r, px[:]); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+			case b&opMask == opIndex:
+				px = index[b]
+			case b&opMask == opDiff:
+				px[0] += (b>>4)&3 - 2
+				px[1] += (b>>2)&3 - 2
+				px[2] += b&3 - 2
+			case b&opMask == opLuma:
+				b2, err := d.r.ReadByte()
+				if err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				dg := b&0x3f - 32
+				px[0] += dg - 8 + b2>>4
+				px[1] += dg
+				px[2] += dg - 8 + b2&0xf
+			default:
+				run = int(b & 0x3f)
+			}
+			index[hash(px)] = px
+		}
+		copy(pix[i:i+channels], px[:channels])
+		if channels == 4 && px[3] != 0xff {
+			// Convert from QOI's non-alpha-premultiplied to RGBA's alpha-premultiplied.
+			a := uint32(px[3])
+			for c := 0; c < 3; c++ {
+				pix[i+c] = uint8((uint32(px[c])*a + 0x7f) / 0xff)
+			}
+		}
+	}
+
+	var end [len(endMarker)]byte
+	if _, err := io.ReadFull(d.r, end[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if string(end[:]) != endMarker {
+		return nil, FormatError("bad end marker")
+	}
+	return m, nil
+}
+
+// Decode reads a QOI image from r and returns it as an *image.RGB or an
+// *image.RGBA.
+func Decode(r io.Reader) (image.Image, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return d.decode()
+}
+
+// DecodeHeader reads the header of a QOI image from r.
+func DecodeHeader(r io.Reader) (*Header, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return &d.h, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a QOI image without
+// decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := DecodeHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	model := colorExt.RGBModel
+	if h.Channels == 4 {
+		model = colorExt.RGBAModel
+	}
+	return image.Config{ColorModel: model, Width: h.Width, Height: h.Height}, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qoi
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// qoiFile returns a QOI file of the header fields and chunks.
+func qoiFile(w, h, channels, colorspace byte, chunks ...byte) []byte {
+	b := []byte{'q', 'o', 'i', 'f', 0, 0, 0, w, 0, 0, 0, h, channels, colorspace}
+	return append(append(b, chunks...), endMarker...)
+}
+
+func TestDecode(t *testing.T) {
+	file := qoiFile(4, 2, 3, Linear,
+		opRGB, 10, 20, 30,
+		0x76,       // DIFF +1, -1, 0.
+		0xaa, 0x5d, // LUMA +7, +10, +15.
+		0xc1, // RUN 2.
+		0x09, // INDEX of the first pixel.
+		opRGBA, 1, 2, 3, 128,
+		0x4b, // DIFF -2, 0, +1, which wraps around.
+	)
+	m, err := Decode(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgb := m.(*imageExt.RGB)
+	if rgb.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("got bounds %v", rgb.Bounds())
+	}
+	want := []byte{
+		10, 20, 30, 11, 19, 30, 18, 29, 45, 18, 29, 45,
+		18, 29, 45, 10, 20, 30, 1, 2, 3, 255, 2, 4,
+	}
+	if !bytes.Equal(rgb.Pix(), want) {
+		t.Fatalf("got %v, want %v", rgb.Pix(), want)
+	}
+
+	h, err := DecodeHeader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *h != (Header{Width: 4, Height: 2, Channels: 3, Colorspace: Linear}) {
+		t.Fatalf("got header %+v", *h)
+	}
+
+	// The colors of the RGBA images are alpha-premultiplied.
+	m, err = Decode(bytes.NewReader(qoiFile(2, 1, 4, SRGB, opRGBA, 200, 100, 50, 128, opRGBA, 1, 2, 3, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgba := m.(*imageExt.RGBA)
+	if c := rgba.RGBAAt(0, 0); c != (colorExt.RGBA{R: 100, G: 50, B: 25, A: 128}) {
+		t.Fatalf("got %v", c)
+	}
+	if c := rgba.RGBAAt(1, 0); c != (colorExt.RGBA{}) {
+		t.Fatalf("got %v", c)
+	}
+	c, err := DecodeConfig(bytes.NewReader(qoiFile(2, 1, 4, SRGB)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ColorModel != colorExt.RGBAModel || c.Width != 2 || c.Height != 1 {
+		t.Fatalf("got config %+v", c)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		file []byte
+		err  error
+	}{
+		{[]byte("qoif\x00\x00"), io.ErrUnexpectedEOF},
+		{[]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x00\x00\x00"), FormatError("not a QOI file")},
+		{qoiFile(1, 1, 2, SRGB, opRGB, 1, 2, 3), FormatError("bad number of channels")},
+		{qoiFile(1, 1, 3, 2, opRGB, 1, 2, 3), FormatError("bad colorspace")},
+		{[]byte("qoif\x00\x00\x80\x00\x00\x00\x80\x00\x03\x00"), UnsupportedError("image is too large")},
+		{qoiFile(2, 1, 3, SRGB, opRGB, 1, 2, 3)[:18], io.ErrUnexpectedEOF},
+		{qoiFile(2, 1, 3, SRGB, opLuma), io.ErrUnexpectedEOF},
+		{append(qoiFile(1, 1, 3, SRGB, opRGB, 1, 2, 3)[:18], 0, 0, 0, 0, 0, 0, 0, 2), FormatError("bad end marker")},
+		{qoiFile(1, 1, 3, SRGB, opRGB, 1, 2, 3)[:20], io.ErrUnexpectedEOF},
+	} {
+		if _, err := Decode(bytes.NewReader(tt.file)); err != tt.err {
+			t.Fatalf("%q: got error %v, want %v", tt.file, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qoi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// readRow reads the non-alpha-premultiplied RGBA samples of the row y of m
+// to row.
+func readRow(m image.Image, y int, row []byte) {
+	b := m.Bounds()
+	switch m := m.(type) {
+	case *imageExt.RGB:
+		pix := m.M.Pix[m.PixOffset(b.Min.X, y):]
+		for x := 0; x < b.Dx(); x++ {
+			copy(row[4*x:4*x+3], pix[3*x:])
+			row[4*x+3] = 0xff
+		}
+	case *imageExt.RGBA:
+		copy(row, m.M.Pix[m.PixOffset(b.Min.X, y):])
+		for x := 0; x < b.Dx(); x++ {
+			// Convert from RGBA's alpha-premultiplied to QOI's non-alpha-premultiplied.
+			if a := uint32(row[4*x+3]); a == 0 {
+				row[4*x], row[4*x+1], row[4*x+2] = 0, 0, 0
+			} else if a != 0xff {
+				for c := 4 * x; c < 4*x+3; c++ {
+					if v := (uint32(row[c])*0xff + a/2) / a; v < 0xff {
+						row[c] = uint8(v)
+					} else {
+						row[c] = 0xff
+					}
+				}
+			}
+		}
+	case *image.NRGBA:
+		copy(row, m.Pix[m.PixOffset(b.Min.X, y):])
+	default:
+		for x := 0; x < b.Dx(); x++ {
+			c := color.NRGBAModel.Convert(m.At(b.Min.X+x, y)).(color.NRGBA)
+			row[4*x], row[4*x+1], row[4*x+2], row[4*x+3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
+
+type encoder struct {
+	w     *bufio.Writer
+	index [64][4]byte
+	prev  [4]byte
+	run   int
+	buf   [5]byte
+}
+
+// writePixel writes the chunk of the pixel px, unless it extends the run of
+// the previous pixel.
+func (e *encoder) writePixel(px [4]byte) {
+	if px == e.prev {
+		if e.run++; e.run == 62 {
+			e.flushRun()
+		}
+		return
+	}
+	e.flushRun()
+	b := e.buf[:0]
+	if i := hash(px); e.index[i] == px {
+		b = append(b, opIndex|byte(i))
+	} else {
+		e.index[i] = px
+		dr := int8(px[0] - e.prev[0])
+		dg := int8(px[1] - e.prev[1])
+		db := int8(px[2] - e.prev[2])
+		dgr, dgb := dr-dg, db-dg
+		switch {
+		case px[3] != e.prev[3]:
+			b = append(b, opRGBA, px[0], px[1], px[2], px[3])
+		case -2 <= dr && dr < 2 && -2 <= dg && dg < 2 && -2 <= db && db < 2:
+			b = append(b, opDiff|byte(dr+2)<<4|byte(dg+2)<<2|byte(db+2))
+		case -8 <= dgr && dgr < 8 && -32 <= dg && dg < 32 && -8 <= dgb && dgb < 8:
+			b = append(b, opLuma|byte(dg+32), byte(dgr+8)<<4|byte(dgb+8))
+		default:
+			b = append(b, opRGB, px[0], px[1], px[2])
+		}
+	}
+	e.w.Write(b)
+	e.prev = px
+}
+
+// flushRun writes the run of the previous pixel, if any.
+func (e *encoder) flushRun() {
+	if e.run > 0 {
+		e.w.WriteByte(opRun | byte(e.run-1))
+		e.run = 0
+	}
+}
+
+// Encode writes the image m to w in the QOI format. The *image.RGB images
+// are written with 3 channels and the *image.RGBA images with 4 channels,
+// from their pixels. Other images are written with 3 channels if they are
+// opaque, and with 4 channels otherwise.
+func Encode(w io.Writer, m image.Image, opt *Options) error {
+	colorspace := SRGB
+	if opt != nil {
+		colorspace = opt.Colorspace
+	}
+	if colorspace != SRGB && colorspace != Linear {
+		return fmt.Errorf("qoi: Encode, invalid colorspace %d", colorspace)
+	}
+	b := m.Bounds()
+	if b.Dx() > maxPixels || b.Dy() > maxPixels || uint64(b.Dx())*uint64(b.Dy()) > maxPixels {
+		return fmt.Errorf("qoi: Encode, image is too large: %v", b)
+	}
+	channels := 4
+	switch m := m.(type) {
+	case *imageExt.RGB:
+		channels = 3
+	case *imageExt.RGBA:
+	default:
+		if m, ok := m.(interface {
+			Opaque() bool
+		}); ok && m.Opaque() {
+			channels = 3
+		}
+	}
+
+	var header [headerSize]byte
+	copy(header[:], qoiMagic)
+	binary.BigEndian.PutUint32(header[4:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(header[8:], uint32(b.Dy()))
+	header[12], header[13] = byte(channels), byte(colorspace)
+
+	e := &encoder{w: bufio.NewWriter(w), prev: [4]byte{0, 0, 0, 0xff}}
+	e.w.Write(header[:])
+	row := make([]byte, 4*b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		readRow(m, y, row)
+		for x := 0; x < b.Dx(); x++ {
+			var px [4]byte
+			copy(px[:], row[4*x:])
+			e.writePixel(px)
+		}
+	}
+	e.flushRun()
+	e.w.WriteString(endMarker)
+	return e.w.Flush()
+}
@@ -0,0 +1,141 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qoi
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+func TestEncode(t *testing.T) {
+	m := imageExt.NewRGB(image.Rect(3, 5, 7, 7))
+	for i, c := range []colorExt.RGB{
+		{R: 10, G: 20, B: 30}, {R: 11, G: 19, B: 30}, {R: 18, G: 29, B: 45}, {R: 18, G: 29, B: 45},
+		{R: 18, G: 29, B: 45}, {R: 10, G: 20, B: 30}, {R: 255, G: 2, B: 4}, {R: 0, G: 0, B: 0},
+	} {
+		m.SetRGB(3+i%4, 5+i/4, c)
+	}
+	want := qoiFile(4, 2, 3, Linear,
+		opRGB, 10, 20, 30,
+		0x76,       // DIFF +1, -1, 0.
+		0xaa, 0x5d, // LUMA +7, +10, +15.
+		0xc1,       // RUN 2.
+		0x09,       // INDEX of the first pixel.
+		0x8e, 0xf0, // LUMA -11, -18, -26.
+		0x9e, 0xb6, // LUMA +1, -2, -4, which wrap around.
+	)
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{Colorspace: Linear}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %x, want %x", buf.Bytes(), want)
+	}
+
+	// The runs are at most 62 pixels long.
+	buf.Reset()
+	if err := Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 10)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := qoiFile(10, 10, 3, SRGB, opRun|61, opRun|37); !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %x, want %x", buf.Bytes(), want)
+	}
+
+	if err := Encode(&buf, m, &Options{Colorspace: 2}); err == nil {
+		t.Fatal("colorspace 2: got no error")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	r := image.Rect(-3, 2, 60, 40)
+	rgb := imageExt.NewRGB(r)
+	rgba := imageExt.NewRGBA(r)
+	nrgba := image.NewNRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			// Small steps between the pixels, for all the kinds of chunks.
+			v := uint8(rnd.Intn(4))
+			if rnd.Intn(8) == 0 {
+				v = uint8(rnd.Intn(256))
+			}
+			c := colorExt.RGB{R: uint8(x) + v, G: uint8(y) * v, B: uint8(x + y)}
+			rgb.SetRGB(x, y, c)
+			a := uint8(0xff)
+			if rnd.Intn(4) == 0 {
+				a = uint8(rnd.Intn(256))
+			}
+			nrgba.SetNRGBA(x, y, color.NRGBA{R: c.R, G: c.G, B: c.B, A: a})
+			// As the decoder premultiplies the colors.
+			premul := func(v uint8) uint8 { return uint8((uint32(v)*uint32(a) + 0x7f) / 0xff) }
+			rgba.SetRGBA(x, y, colorExt.RGBA{R: premul(c.R), G: premul(c.G), B: premul(c.B), A: a})
+		}
+	}
+
+	for _, tt := range []struct {
+		m, want image.Image
+	}{
+		{rgb, rgb},
+		{rgb.SubImage(image.Rect(0, 10, 20, 20)), rgb.SubImage(image.Rect(0, 10, 20, 20))},
+		{rgba, rgba},
+		{nrgba, rgba},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tt.m, nil); err != nil {
+			t.Fatal(err)
+		}
+		m, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := tt.want.Bounds()
+		if m.Bounds() != b.Sub(b.Min) {
+			t.Fatalf("%T %v: got bounds %v", tt.m, b, m.Bounds())
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if c0, c1 := tt.want.At(x, y), m.At(x-b.Min.X, y-b.Min.Y); c0 != c1 {
+					t.Fatalf("%T %v: (%d, %d): got %v, want %v", tt.m, b, x, y, c1, c0)
+				}
+			}
+		}
+	}
+}
+
+func TestImageExt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qoi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "probe.qoi")
+
+	m0 := imageExt.NewRGBA(image.Rect(0, 0, 20, 10))
+	for i := range m0.M.Pix {
+		m0.M.Pix[i] = uint8(i % 7 * 40)
+	}
+	for i := 3; i < len(m0.M.Pix); i += 4 {
+		m0.M.Pix[i] = 0xff
+	}
+	if err := imageExt.Save(name, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	m1, format, err := imageExt.Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "qoi" || !bytes.Equal(m1.(*imageExt.RGBA).Pix(), m0.Pix()) {
+		t.Fatalf("got format %q and different pixels", format)
+	}
+}
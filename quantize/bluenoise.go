@@ -0,0 +1,145 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quantize
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+)
+
+const (
+	blueNoiseSize  = 64  // The width and height of the blue noise mask.
+	blueNoiseSigma = 1.5 // The deviation of the Gaussian filter of the mask.
+)
+
+var (
+	blueNoiseOnce       sync.Once
+	blueNoiseThresholds []float64
+)
+
+// blueNoise returns the thresholds of a blue noise mask, which it makes with
+// Ulichney's void-and-cluster method on first use.
+func blueNoise() []float64 {
+	blueNoiseOnce.Do(func() {
+		blueNoiseThresholds = ranksToThresholds(voidAndCluster(blueNoiseSize, blueNoiseSigma))
+	})
+	return blueNoiseThresholds
+}
+
+// pattern is a binary pattern on a torus, with the energy of each of its
+// pixels: the sum of a Gaussian of its distances to the set pixels.
+type pattern struct {
+	size   int
+	set    []bool
+	energy []float64
+	kernel []float64
+}
+
+func newPattern(size int, sigma float64) *pattern {
+	p := &pattern{
+		size:   size,
+		set:    make([]bool, size*size),
+		energy: make([]float64, size*size),
+		kernel: make([]float64, size*size),
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := x, y
+			if dx > size/2 {
+				dx -= size
+			}
+			if dy > size/2 {
+				dy -= size
+			}
+			p.kernel[y*size+x] = math.Exp(-float64(dx*dx+dy*dy) / (2 * sigma * sigma))
+		}
+	}
+	return p
+}
+
+func (p *pattern) toggle(i int) {
+	p.set[i] = !p.set[i]
+	sign := 1.0
+	if !p.set[i] {
+		sign = -1
+	}
+	n := p.size
+	x0, y0 := i%n, i/n
+	for y := 0; y < n; y++ {
+		krow := p.kernel[((y-y0+n)%n)*n:]
+		erow := p.energy[y*n:]
+		for x := 0; x < n; x++ {
+			erow[x] += sign * krow[(x-x0+n)%n]
+		}
+	}
+}
+
+// tightestCluster returns the set pixel with the highest energy.
+func (p *pattern) tightestCluster() int {
+	best := -1
+	for i, set := range p.set {
+		if set && (best < 0 || p.energy[i] > p.energy[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// largestVoid returns the unset pixel with the lowest energy.
+func (p *pattern) largestVoid() int {
+	best := -1
+	for i, set := range p.set {
+		if !set && (best < 0 || p.energy[i] < p.energy[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (p *pattern) clone() *pattern {
+	q := *p
+	q.set = append([]bool(nil), p.set...)
+	q.energy = append([]float64(nil), p.energy...)
+	return &q
+}
+
+// voidAndCluster returns the ranks of the pixels of a size×size blue noise
+// mask.
+func voidAndCluster(size int, sigma float64) []int {
+	n := size * size
+	p := newPattern(size, sigma)
+	r := rand.New(rand.NewSource(1))
+	ones := n / 10
+	for _, i := range r.Perm(n)[:ones] {
+		p.toggle(i)
+	}
+	// Move the pixels of the tightest clusters to the largest voids until
+	// the pattern is homogeneous, with a bound on the moves in case they
+	// cycle.
+	for iter := 0; iter < n; iter++ {
+		c := p.tightestCluster()
+		p.toggle(c)
+		v := p.largestVoid()
+		p.toggle(v)
+		if v == c {
+			break
+		}
+	}
+
+	ranks := make([]int, n)
+	q := p.clone()
+	for rank := ones - 1; rank >= 0; rank-- {
+		c := q.tightestCluster()
+		q.toggle(c)
+		ranks[c] = rank
+	}
+	for rank := ones; rank < n; rank++ {
+		v := p.largestVoid()
+		p.toggle(v)
+		ranks[v] = rank
+	}
+	return ranks
+}
@@ -0,0 +1,167 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quantize
+
+import (
+	"sort"
+)
+
+// box is a box of the color space, with the histogram entries within it.
+type box struct {
+	hist []entry
+	n    int64    // The number of pixels.
+	sum  [4]int64 // The sum of the pixels per channel.
+	sum2 int64    // The sum of the squared norms of the pixels.
+}
+
+func newBox(hist []entry) *box {
+	b := &box{hist: hist}
+	for _, e := range hist {
+		n := int64(e.n)
+		b.n += n
+		for i, x := range e.c {
+			b.sum[i] += n * int64(x)
+			b.sum2 += n * int64(x) * int64(x)
+		}
+	}
+	return b
+}
+
+// mean returns the mean color of the pixels of b.
+func (b *box) mean() rgba {
+	var c rgba
+	for i, s := range b.sum {
+		c[i] = int32((s + b.n/2) / b.n)
+	}
+	return c
+}
+
+// sse returns the sum of the squared distances of the pixels of b to their
+// mean.
+func (b *box) sse() float64 {
+	s := float64(b.sum2)
+	for _, x := range b.sum {
+		s -= float64(x) * float64(x) / float64(b.n)
+	}
+	return s
+}
+
+// longest returns the channel along which b is the longest, and its length.
+func (b *box) longest() (axis int, length int32) {
+	for i := 0; i < 4; i++ {
+		lo, hi := b.hist[0].c[i], b.hist[0].c[i]
+		for _, e := range b.hist[1:] {
+			if e.c[i] < lo {
+				lo = e.c[i]
+			}
+			if e.c[i] > hi {
+				hi = e.c[i]
+			}
+		}
+		if hi-lo > length {
+			axis, length = i, hi-lo
+		}
+	}
+	return axis, length
+}
+
+type byAxis struct {
+	hist []entry
+	axis int
+}
+
+func (s byAxis) Len() int           { return len(s.hist) }
+func (s byAxis) Less(i, j int) bool { return s.hist[i].c[s.axis] < s.hist[j].c[s.axis] }
+func (s byAxis) Swap(i, j int)      { s.hist[i], s.hist[j] = s.hist[j], s.hist[i] }
+
+// splitMedian splits b across its longest channel, at the median pixel.
+func (b *box) splitMedian() (*box, *box) {
+	axis, _ := b.longest()
+	sort.Sort(byAxis{b.hist, axis})
+	i, acc := 0, int64(0)
+	for ; i < len(b.hist)-2; i++ {
+		if acc += int64(b.hist[i].n); 2*acc >= b.n {
+			break
+		}
+	}
+	return newBox(b.hist[:i+1]), newBox(b.hist[i+1:])
+}
+
+// splitVariance splits b where that most reduces the sum of the squared
+// errors of the two halves, as Wu does.
+func (b *box) splitVariance() (*box, *box) {
+	bestAxis, bestIndex, best := 0, 0, -1.0
+	for axis := 0; axis < 4; axis++ {
+		sort.Sort(byAxis{b.hist, axis})
+		var n int64
+		var sum [4]int64
+		for i, e := range b.hist[:len(b.hist)-1] {
+			n += int64(e.n)
+			for j, x := range e.c {
+				sum[j] += int64(e.n) * int64(x)
+			}
+			if e.c[axis] == b.hist[i+1].c[axis] {
+				continue
+			}
+			// The sum of the squared errors of a set of pixels is the
+			// sum of their squared norms, which is the same for all
+			// splits, less the squared norm of their sum divided by
+			// their number.
+			var s0, s1 float64
+			for j := range sum {
+				x0, x1 := float64(sum[j]), float64(b.sum[j]-sum[j])
+				s0 += x0 * x0
+				s1 += x1 * x1
+			}
+			if s := s0/float64(n) + s1/float64(b.n-n); s > best {
+				bestAxis, bestIndex, best = axis, i+1, s
+			}
+		}
+	}
+	sort.Sort(byAxis{b.hist, bestAxis})
+	return newBox(b.hist[:bestIndex]), newBox(b.hist[bestIndex:])
+}
+
+// cut returns the mean colors of k boxes into which it cuts the color space
+// of hist. Median cut splits the box with the largest product of its number
+// of pixels and its length, and Wu's method the box with the largest squared
+// error.
+func cut(hist []entry, k int, wu bool) []rgba {
+	boxes := []*box{newBox(append([]entry(nil), hist...))}
+	for len(boxes) < k {
+		best, bestScore := -1, 0.0
+		for i, b := range boxes {
+			if len(b.hist) < 2 {
+				continue
+			}
+			var score float64
+			if wu {
+				score = b.sse()
+			} else {
+				_, length := b.longest()
+				score = float64(b.n) * float64(length)
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		var b0, b1 *box
+		if wu {
+			b0, b1 = boxes[best].splitVariance()
+		} else {
+			b0, b1 = boxes[best].splitMedian()
+		}
+		boxes[best] = b0
+		boxes = append(boxes, b1)
+	}
+	colors := make([]rgba, len(boxes))
+	for i, b := range boxes {
+		colors[i] = b.mean()
+	}
+	return colors
+}
@@ -0,0 +1,199 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quantize
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Dither is a dithering method, which maps the pixels of an image to the
+// colors of a palette. It implements draw.Drawer.
+type Dither int
+
+const (
+	NoDither       Dither = iota // The nearest color of each pixel.
+	FloydSteinberg               // Floyd-Steinberg error diffusion.
+	Atkinson                     // Atkinson error diffusion, which diffuses 3/4 of the error.
+	Bayer2                       // Ordered dithering with a 2x2 Bayer matrix.
+	Bayer4                       // Ordered dithering with a 4x4 Bayer matrix.
+	Bayer8                       // Ordered dithering with an 8x8 Bayer matrix.
+	BlueNoise                    // Ordered dithering with a 64x64 blue noise mask.
+)
+
+// diffusion is a share of the error of a pixel, that is diffused to the pixel
+// at an offset of (dx, dy).
+type diffusion struct {
+	dx, dy int
+	w      int32
+}
+
+// errorDiffusion is an error diffusion kernel, whose weights are in units of
+// 1<<shift.
+type errorDiffusion struct {
+	shift  uint
+	kernel []diffusion
+}
+
+var errorDiffusions = map[Dither]*errorDiffusion{
+	FloydSteinberg: {4, []diffusion{{1, 0, 7}, {-1, 1, 3}, {0, 1, 5}, {1, 1, 1}}},
+	Atkinson:       {3, []diffusion{{1, 0, 1}, {2, 0, 1}, {-1, 1, 1}, {0, 1, 1}, {1, 1, 1}, {0, 2, 1}}},
+}
+
+// mapper maps colors to the index of the nearest color of a palette.
+type mapper struct {
+	palette []rgba
+	cache   map[rgba]uint8
+}
+
+func newMapper(p *image.Paletted) *mapper {
+	m := &mapper{
+		palette: make([]rgba, len(p.Palette)),
+		cache:   make(map[rgba]uint8),
+	}
+	for i, c := range p.Palette {
+		m.palette[i] = toRGBA(c)
+	}
+	return m
+}
+
+func (m *mapper) index(c rgba) uint8 {
+	i, ok := m.cache[c]
+	if !ok {
+		i = uint8(nearest(m.palette, c))
+		m.cache[c] = i
+	}
+	return i
+}
+
+// clampPremultiplied clips the channels of c to [0, 255], and then its color
+// channels to its alpha.
+func clampPremultiplied(c rgba) rgba {
+	for i := 3; i >= 0; i-- {
+		hi := int32(255)
+		if i < 3 {
+			hi = c[3]
+		}
+		if c[i] < 0 {
+			c[i] = 0
+		} else if c[i] > hi {
+			c[i] = hi
+		}
+	}
+	return c
+}
+
+// Draw maps the pixels of src to the palette of dst, which must be an
+// *image.Paletted with a palette of at most 256 colors. Other images are
+// drawn with draw.Src, without dithering.
+func (d Dither) Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	pm, ok := dst.(*image.Paletted)
+	if !ok || len(pm.Palette) == 0 || len(pm.Palette) > 256 {
+		draw.Draw(dst, r, src, sp, draw.Src)
+		return
+	}
+	// Clip r to the bounds of dst and src, as draw.Draw does.
+	orig := r.Min
+	r = r.Intersect(dst.Bounds())
+	r = r.Intersect(src.Bounds().Add(orig.Sub(sp)))
+	if r.Empty() {
+		return
+	}
+	sp = sp.Add(r.Min.Sub(orig))
+
+	m := newMapper(pm)
+	w, h := r.Dx(), r.Dy()
+	ed := errorDiffusions[d]
+	var thresholds []float64
+	size := 0
+	switch d {
+	case Bayer2, Bayer4, Bayer8:
+		size = 2 << uint(d-Bayer2)
+		thresholds = bayer(size)
+	case BlueNoise:
+		size = blueNoiseSize
+		thresholds = blueNoise()
+	}
+	spread := 255 / math.Cbrt(float64(len(pm.Palette)))
+
+	// errs holds the weighted errors diffused to the next 3 rows, with a
+	// margin of 2 pixels on each side.
+	var errs [3][]rgba
+	for i := range errs {
+		errs[i] = make([]rgba, w+4)
+	}
+	for y := 0; y < h; y++ {
+		row := pm.Pix[pm.PixOffset(r.Min.X, r.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			c := toRGBA(src.At(sp.X+x, sp.Y+y))
+			if c[3] == 0 {
+				// Fully transparent pixels neither receive nor diffuse
+				// errors.
+				row[x] = m.index(c)
+				continue
+			}
+			switch {
+			case ed != nil:
+				e := errs[0][x+2]
+				for i := range c {
+					c[i] += (e[i] + 1<<ed.shift>>1) >> ed.shift
+				}
+			case thresholds != nil:
+				t := int32(math.Floor(thresholds[(y%size)*size+x%size]*spread + 0.5))
+				for i := 0; i < 3; i++ {
+					c[i] += t
+				}
+			}
+			c = clampPremultiplied(c)
+			i := m.index(c)
+			row[x] = i
+			if ed != nil {
+				p := m.palette[i]
+				for _, k := range ed.kernel {
+					e := &errs[k.dy][x+2+k.dx]
+					for j := range e {
+						e[j] += k.w * (c[j] - p[j])
+					}
+				}
+			}
+		}
+		if ed != nil {
+			errs[0], errs[1], errs[2] = errs[1], errs[2], errs[0]
+			for i := range errs[2] {
+				errs[2][i] = rgba{}
+			}
+		}
+	}
+}
+
+// bayer returns the thresholds of the n×n Bayer matrix, in [-1/2, 1/2).
+func bayer(n int) []float64 {
+	m := []int{0}
+	for size := 1; size < n; size *= 2 {
+		next := make([]int, 4*size*size)
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				v := 4 * m[y*size+x]
+				next[y*2*size+x] = v
+				next[y*2*size+x+size] = v + 2
+				next[(y+size)*2*size+x] = v + 3
+				next[(y+size)*2*size+x+size] = v + 1
+			}
+		}
+		m = next
+	}
+	return ranksToThresholds(m)
+}
+
+// ranksToThresholds maps the ranks 0 to len(ranks)-1 to thresholds in
+// [-1/2, 1/2).
+func ranksToThresholds(ranks []int) []float64 {
+	t := make([]float64, len(ranks))
+	for i, r := range ranks {
+		t[i] = (float64(r)+0.5)/float64(len(ranks)) - 0.5
+	}
+	return t
+}
@@ -0,0 +1,53 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quantize
+
+// maxKMeansIterations bounds the iterations of kmeans, which converges
+// slowly once few colors change their cluster.
+const maxKMeansIterations = 16
+
+// kmeans refines colors with Lloyd's algorithm, which moves each color to the
+// mean of the pixels to which it is the nearest, until no pixel changes its
+// nearest color.
+func kmeans(hist []entry, colors []rgba) []rgba {
+	assign := make([]int, len(hist))
+	for i := range assign {
+		assign[i] = -1
+	}
+	n := make([]int64, len(colors))
+	sum := make([][4]int64, len(colors))
+	for iter := 0; iter < maxKMeansIterations; iter++ {
+		changed := false
+		for i, e := range hist {
+			if j := nearest(colors, e.c); j != assign[i] {
+				assign[i] = j
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		for j := range n {
+			n[j], sum[j] = 0, [4]int64{}
+		}
+		for i, e := range hist {
+			j := assign[i]
+			n[j] += int64(e.n)
+			for c, x := range e.c {
+				sum[j][c] += int64(e.n) * int64(x)
+			}
+		}
+		// A color without pixels keeps its value.
+		for j := range colors {
+			if n[j] == 0 {
+				continue
+			}
+			for c, s := range sum[j] {
+				colors[j][c] = int32((s + n[j]/2) / n[j])
+			}
+		}
+	}
+	return colors
+}
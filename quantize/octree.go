@@ -0,0 +1,96 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quantize
+
+import (
+	"sort"
+)
+
+// octreeNode is a node of an octree of the RGBA color space, which has 16
+// children per node, indexed by one bit of each channel.
+type octreeNode struct {
+	n        int64    // The number of pixels within the node.
+	sum      [4]int64 // The sum of the pixels per channel.
+	children *[16]*octreeNode
+}
+
+type byCount []*octreeNode
+
+func (s byCount) Len() int           { return len(s) }
+func (s byCount) Less(i, j int) bool { return s[i].n < s[j].n }
+func (s byCount) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// octree returns the mean colors of the leaves of an octree of the colors of
+// hist, which it reduces to at most k leaves by merging the children of the
+// deepest nodes with the fewest pixels.
+func octree(hist []entry, k int) []rgba {
+	root := new(octreeNode)
+	var levels [8][]*octreeNode
+	levels[0] = []*octreeNode{root}
+	for _, e := range hist {
+		node := root
+		for level := 0; ; level++ {
+			node.n += int64(e.n)
+			for i, x := range e.c {
+				node.sum[i] += int64(e.n) * int64(x)
+			}
+			if level == 8 {
+				break
+			}
+			if node.children == nil {
+				node.children = new([16]*octreeNode)
+			}
+			shift := uint(7 - level)
+			i := (e.c[0]>>shift&1)<<3 | (e.c[1]>>shift&1)<<2 | (e.c[2]>>shift&1)<<1 | e.c[3]>>shift&1
+			child := node.children[i]
+			if child == nil {
+				child = new(octreeNode)
+				node.children[i] = child
+				if level < 7 {
+					levels[level+1] = append(levels[level+1], child)
+				}
+			}
+			node = child
+		}
+	}
+
+	leaves := len(hist)
+	for level := 7; level >= 0 && leaves > k; level-- {
+		nodes := levels[level]
+		sort.Sort(byCount(nodes))
+		for _, node := range nodes {
+			if leaves <= k {
+				break
+			}
+			for _, child := range node.children {
+				if child != nil {
+					leaves--
+				}
+			}
+			node.children = nil
+			leaves++
+		}
+	}
+
+	var colors []rgba
+	var walk func(node *octreeNode)
+	walk = func(node *octreeNode) {
+		if node.children == nil {
+			var c rgba
+			for i, s := range node.sum {
+				c[i] = int32((s + node.n/2) / node.n)
+			}
+			colors = append(colors, c)
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+	return colors
+}
@@ -0,0 +1,170 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package quantize implements color quantizers, which choose a palette for an
+// image, and dithering methods, which map the pixels of an image to a palette.
+//
+// Method implements draw.Quantizer and Dither implements draw.Drawer, so that
+// they can be passed to the GIF encoder. Paletted uses both to convert an image
+// to a paletted image, which the PNG and BMP encoders write with a palette.
+//
+// Fully transparent pixels are kept transparent: the palette of an image with
+// such pixels has a transparent color, to which they are mapped.
+package quantize
+
+import (
+	"image"
+	"image/color"
+)
+
+// Method is a quantization method. It implements draw.Quantizer.
+type Method int
+
+const (
+	MedianCut Method = iota // Heckbert's median cut.
+	Octree                  // Gervautz and Purgathofer's octree.
+	Wu                      // Wu's greedy variance-minimizing bipartition.
+	KMeans                  // K-means clustering, starting from Wu's palette.
+)
+
+// Options are the parameters of Paletted.
+type Options struct {
+	Method Method // The quantization method.
+	Dither Dither // The dithering method.
+	// NumColors is the maximum number of colors of the palette, from 1 to
+	// 256. Zero means 256.
+	NumColors int
+}
+
+// Paletted returns m converted to a paletted image, with a palette that the
+// Method of opt chooses and pixels that its Dither maps. Default parameters
+// are used if a nil *Options is passed.
+func Paletted(m image.Image, opt *Options) *image.Paletted {
+	if opt == nil {
+		opt = new(Options)
+	}
+	n := opt.NumColors
+	if n < 1 || n > 256 {
+		n = 256
+	}
+	b := m.Bounds()
+	p := opt.Method.Quantize(make(color.Palette, 0, n), m)
+	dst := image.NewPaletted(b, p)
+	opt.Dither.Draw(dst, b, m, b.Min)
+	return dst
+}
+
+// rgba is a premultiplied color with 8 bits per channel, in the order red,
+// green, blue and alpha.
+type rgba [4]int32
+
+func toRGBA(c color.Color) rgba {
+	r, g, b, a := c.RGBA()
+	return rgba{int32(r >> 8), int32(g >> 8), int32(b >> 8), int32(a >> 8)}
+}
+
+func (c rgba) color() color.RGBA {
+	return color.RGBA{uint8(c[0]), uint8(c[1]), uint8(c[2]), uint8(c[3])}
+}
+
+// entry is a color of an image histogram.
+type entry struct {
+	c rgba
+	n int // The number of pixels of the color.
+}
+
+// histogram returns the colors of the pixels of m that are not fully
+// transparent, and whether m has fully transparent pixels.
+func histogram(m image.Image) (hist []entry, transparent bool) {
+	index := make(map[rgba]int)
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := toRGBA(m.At(x, y))
+			if c[3] == 0 {
+				transparent = true
+				continue
+			}
+			if i, ok := index[c]; ok {
+				hist[i].n++
+			} else {
+				index[c] = len(hist)
+				hist = append(hist, entry{c, 1})
+			}
+		}
+	}
+	return hist, transparent
+}
+
+// hasTransparent reports whether p has a fully transparent color.
+func hasTransparent(p color.Palette) bool {
+	for _, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Quantize appends up to cap(p)-len(p) colors to p, or up to 256-len(p)
+// colors if p is full, and returns the updated palette. A transparent color is
+// added first if m has fully transparent pixels and p has no such color.
+func (q Method) Quantize(p color.Palette, m image.Image) color.Palette {
+	k := cap(p) - len(p)
+	if k <= 0 || k > 256-len(p) {
+		k = 256 - len(p)
+	}
+	hist, transparent := histogram(m)
+	if transparent && k > 0 && !hasTransparent(p) {
+		p = append(p, color.RGBA{})
+		k--
+	}
+	if k <= 0 || len(hist) == 0 {
+		return p
+	}
+
+	var colors []rgba
+	switch {
+	case len(hist) <= k:
+		for _, e := range hist {
+			colors = append(colors, e.c)
+		}
+	case q == Octree:
+		colors = octree(hist, k)
+	case q == Wu:
+		colors = cut(hist, k, true)
+	case q == KMeans:
+		colors = kmeans(hist, cut(hist, k, true))
+	default:
+		colors = cut(hist, k, false)
+	}
+	for _, c := range colors {
+		p = append(p, c.color())
+	}
+	return p
+}
+
+// sqDist returns the squared distance between two colors.
+func sqDist(c0, c1 rgba) int32 {
+	var d int32
+	for i := range c0 {
+		x := c0[i] - c1[i]
+		d += x * x
+	}
+	return d
+}
+
+// nearest returns the index of the color of p that is the nearest to c.
+func nearest(p []rgba, c rgba) int {
+	best, bestDist := 0, int32(1<<31-1)
+	for i, pc := range p {
+		if d := sqDist(c, pc); d < bestDist {
+			best, bestDist = i, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return best
+}
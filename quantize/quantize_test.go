@@ -0,0 +1,203 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quantize
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+)
+
+const testdataDir = "../testdata/"
+
+var (
+	methods = []Method{MedianCut, Octree, Wu, KMeans}
+	dithers = []Dither{NoDither, FloydSteinberg, Atkinson, Bayer2, Bayer4, Bayer8, BlueNoise}
+)
+
+func readPNG(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// averageDelta returns the average delta in RGBA space between m0 and m1.
+func averageDelta(m0, m1 image.Image) int64 {
+	b := m0.Bounds()
+	var sum, n int64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c0 := m0.At(x, y)
+			c1 := m1.At(x, y)
+			r0, g0, b0, a0 := c0.RGBA()
+			r1, g1, b1, a1 := c1.RGBA()
+			sum += delta(r0, r1)
+			sum += delta(g0, g1)
+			sum += delta(b0, b1)
+			sum += delta(a0, a1)
+			n += 4
+		}
+	}
+	return sum / n
+}
+
+func delta(u0, u1 uint32) int64 {
+	d := int64(u0) - int64(u1)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func TestQuantize(t *testing.T) {
+	m0, err := readPNG(testdataDir + "video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range methods {
+		for _, n := range []int{0, 16} {
+			m1 := Paletted(m0, &Options{Method: method, NumColors: n})
+			if n == 0 {
+				n = 256
+			}
+			if len(m1.Palette) < n/2 || len(m1.Palette) > n {
+				t.Fatalf("method %d: got %d colors, want at most %d", method, len(m1.Palette), n)
+			}
+			if m1.Bounds() != m0.Bounds() {
+				t.Fatalf("method %d: got bounds %v", method, m1.Bounds())
+			}
+			// The octree merges whole subtrees, so it may choose fewer
+			// colors than it can.
+			want := int64(3 << 8)
+			if n == 16 {
+				want = 12 << 8
+			}
+			if d := averageDelta(m0, m1); d > want {
+				t.Fatalf("method %d, %d colors: average delta is too high: %d", method, n, d)
+			}
+		}
+	}
+}
+
+func TestQuantizeExact(t *testing.T) {
+	m0 := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	colors := []color.RGBA{
+		{0xff, 0x00, 0x00, 0xff},
+		{0x00, 0xff, 0x00, 0xff},
+		{0x10, 0x20, 0x40, 0x80},
+		{0x10, 0x10, 0x10, 0xff},
+	}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			m0.SetRGBA(x, y, colors[(x+y)%len(colors)])
+		}
+	}
+	for _, method := range methods {
+		for _, dither := range []Dither{NoDither, FloydSteinberg, Atkinson} {
+			m1 := Paletted(m0, &Options{Method: method, Dither: dither})
+			if len(m1.Palette) != len(colors) {
+				t.Fatalf("method %d: got %d colors", method, len(m1.Palette))
+			}
+			if d := averageDelta(m0, m1); d != 0 {
+				t.Fatalf("method %d, dither %d: average delta %d", method, dither, d)
+			}
+		}
+	}
+
+	// The colors are appended to the given palette.
+	p := color.Palette{color.White}
+	if p = Wu.Quantize(p, m0); len(p) != 1+len(colors) || p[0] != color.White {
+		t.Fatalf("got palette %v", p)
+	}
+}
+
+func TestTransparency(t *testing.T) {
+	m0, err := readPNG(testdataDir + "video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := m0.Bounds()
+	m := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if x < b.Dx()/2 {
+				m.Set(x, y, m0.At(x, y))
+			}
+		}
+	}
+	for _, method := range methods {
+		for _, dither := range dithers {
+			m1 := Paletted(m, &Options{Method: method, Dither: dither, NumColors: 32})
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					_, _, _, a := m1.At(x, y).RGBA()
+					if (a == 0) != (x >= b.Dx()/2) {
+						t.Fatalf("method %d, dither %d: (%d, %d): got alpha %d", method, dither, x, y, a)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDither(t *testing.T) {
+	// Dithering a gradient with black and white keeps its average level in
+	// every block of 8x8 pixels, unlike mapping it to the nearest color.
+	m0 := image.NewGray(image.Rect(0, 0, 256, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 256; x++ {
+			m0.SetGray(x, y, color.Gray{uint8(x)})
+		}
+	}
+	for _, dither := range dithers {
+		m1 := image.NewPaletted(m0.Bounds(), color.Palette{color.Black, color.White})
+		dither.Draw(m1, m1.Bounds(), m0, image.ZP)
+		var worst int
+		for by := 0; by < 64; by += 8 {
+			for bx := 0; bx < 256; bx += 8 {
+				var sum0, sum1 int
+				for y := by; y < by+8; y++ {
+					for x := bx; x < bx+8; x++ {
+						sum0 += int(m0.GrayAt(x, y).Y)
+						sum1 += 255 * int(m1.ColorIndexAt(x, y))
+					}
+				}
+				d := (sum1 - sum0) / 64
+				if d < 0 {
+					d = -d
+				}
+				if d > worst {
+					worst = d
+				}
+			}
+		}
+		if dither == NoDither {
+			if worst < 64 {
+				t.Fatalf("dither %d: worst block delta is too low: %d", dither, worst)
+			}
+		} else if worst > 48 {
+			t.Fatalf("dither %d: worst block delta is too high: %d", dither, worst)
+		}
+	}
+}
+
+func TestBlueNoise(t *testing.T) {
+	ranks := voidAndCluster(16, blueNoiseSigma)
+	seen := make([]bool, len(ranks))
+	for _, r := range ranks {
+		if r < 0 || r >= len(ranks) || seen[r] {
+			t.Fatalf("ranks are not a permutation: %v", ranks)
+		}
+		seen[r] = true
+	}
+	if len(blueNoise()) != blueNoiseSize*blueNoiseSize {
+		t.Fatalf("got %d thresholds", len(blueNoise()))
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tensor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// A FormatError reports that the input is not a valid NumPy file.
+type FormatError string
+
+func (e FormatError) Error() string { return "tensor: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// NumPy feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "tensor: unsupported feature: " + string(e) }
+
+const npyMagic = "\x93NUMPY"
+
+// Limits of the headers and the number of elements of the arrays that are
+// read.
+const (
+	maxHeaderSize = 1 << 20
+	maxElements   = 1 << 30
+)
+
+// Array is an n-dimensional array of a NumPy file.
+type Array struct {
+	// Shape is the length of each axis; it is empty for a scalar.
+	Shape []int
+	// Data holds the elements in C order, as a []bool, []uint8, []int8,
+	// []uint16, []int16, []uint32, []int32, []uint64, []int64, []float32
+	// or []float64.
+	Data interface{}
+}
+
+// dtype returns the little-endian NumPy type of the elements of data, and
+// their number.
+func dtype(data interface{}) (descr string, n int, ok bool) {
+	switch data := data.(type) {
+	case []bool:
+		return "|b1", len(data), true
+	case []uint8:
+		return "|u1", len(data), true
+	case []int8:
+		return "|i1", len(data), true
+	case []uint16:
+		return "<u2", len(data), true
+	case []int16:
+		return "<i2", len(data), true
+	case []uint32:
+		return "<u4", len(data), true
+	case []int32:
+		return "<i4", len(data), true
+	case []uint64:
+		return "<u8", len(data), true
+	case []int64:
+		return "<i8", len(data), true
+	case []float32:
+		return "<f4", len(data), true
+	case []float64:
+		return "<f8", len(data), true
+	}
+	return "", 0, false
+}
+
+// makeData returns a slice of n elements of the NumPy type, without its byte
+// order, and the size of an element.
+func makeData(kind string, n int) (interface{}, int, bool) {
+	switch kind {
+	case "b1":
+		return make([]bool, n), 1, true
+	case "u1":
+		return make([]uint8, n), 1, true
+	case "i1":
+		return make([]int8, n), 1, true
+	case "u2":
+		return make([]uint16, n), 2, true
+	case "i2":
+		return make([]int16, n), 2, true
+	case "u4":
+		return make([]uint32, n), 4, true
+	case "i4":
+		return make([]int32, n), 4, true
+	case "u8":
+		return make([]uint64, n), 8, true
+	case "i8":
+		return make([]int64, n), 8, true
+	case "f4":
+		return make([]float32, n), 4, true
+	case "f8":
+		return make([]float64, n), 8, true
+	}
+	return nil, 0, false
+}
+
+// ReadNPY reads an array of a NumPy .npy file. Arrays in Fortran order are
+// returned in C order.
+func ReadNPY(r io.Reader) (*Array, error) {
+	var magic [8]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if string(magic[:6]) != npyMagic {
+		return nil, FormatError("not a NumPy file")
+	}
+	var size int
+	switch magic[6] {
+	case 1:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		size = int(binary.LittleEndian.Uint16(b[:]))
+	case 2, 3:
+		var b [4]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if n := binary.LittleEndian.Uint32(b[:]); n <= maxHeaderSize {
+			size = int(n)
+		} else {
+			return nil, UnsupportedError(fmt.Sprintf("header of %d bytes", n))
+		}
+	default:
+		return nil, UnsupportedError(fmt.Sprintf("version %d.%d", magic[6], magic[7]))
+	}
+	header := make([]byte, size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	descr, fortran, shape, err := parseHeader(string(header))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(descr) != 3 || !strings.ContainsRune("<>|=", rune(descr[0])) {
+		return nil, UnsupportedError("data type " + descr)
+	}
+	n := 1
+	for _, d := range shape {
+		if d < 0 || d != 0 && n > maxElements/d {
+			return nil, UnsupportedError(fmt.Sprintf("shape %v", shape))
+		}
+		n *= d
+	}
+	_, elemSize, ok := makeData(descr[1:], 0)
+	if !ok {
+		return nil, UnsupportedError("data type " + descr)
+	}
+	// The elements are read before the array is allocated, for a truncated
+	// file not to allocate the size of its shape.
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(n*elemSize)))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != n*elemSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if fortran && len(shape) > 1 {
+		b = cOrder(b, shape, elemSize)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if descr[0] == '>' {
+		order = binary.BigEndian
+	}
+	data, _, _ := makeData(descr[1:], n)
+	if err := binary.Read(bytes.NewReader(b), order, data); err != nil {
+		return nil, err
+	}
+	return &Array{Shape: shape, Data: data}, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// cOrder returns the elements of the size of an array of the shape in
+// Fortran order (the first axis varies fastest) in C order.
+func cOrder(b []byte, shape []int, size int) []byte {
+	out := make([]byte, len(b))
+	index := make([]int, len(shape))
+	for i := 0; i < len(b)/size; i++ {
+		j, stride := 0, 1
+		for d, n := range shape {
+			j += index[d] * stride
+			stride *= n
+		}
+		copy(out[i*size:(i+1)*size], b[j*size:])
+		for d := len(shape) - 1; d >= 0; d-- {
+			if index[d]++; index[d] < shape[d] {
+				break
+			}
+			index[d] = 0
+		}
+	}
+	return out
+}
+
+// WriteNPY writes the array as a NumPy .npy file, in C order with
+// little-endian elements.
+func WriteNPY(w io.Writer, a *Array) error {
+	descr, n, ok := dtype(a.Data)
+	if !ok {
+		return fmt.Errorf("tensor: WriteNPY, unsupported data type %T", a.Data)
+	}
+	length := 1
+	shape := make([]string, len(a.Shape))
+	for i, d := range a.Shape {
+		if d < 0 {
+			return fmt.Errorf("tensor: WriteNPY, invalid shape %v", a.Shape)
+		}
+		length *= d
+		shape[i] = strconv.Itoa(d)
+	}
+	if length != n {
+		return fmt.Errorf("tensor: WriteNPY, invalid shape %v for %d elements", a.Shape, n)
+	}
+	// The shape is a Python tuple, which has a trailing comma if it has a
+	// single element.
+	tuple := "(" + strings.Join(shape, ", ") + ")"
+	if len(shape) == 1 {
+		tuple = "(" + shape[0] + ",)"
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': %s, }", descr, tuple)
+
+	// The header is padded with spaces and ends with a newline, for the
+	// elements to be aligned on 64 bytes.
+	prefix := []byte(npyMagic + "\x01\x00\x00\x00")
+	if len(header) >= 0xffff-64 {
+		prefix = []byte(npyMagic + "\x02\x00\x00\x00\x00\x00")
+	}
+	size := len(header) + 1
+	if pad := (len(prefix) + size) % 64; pad != 0 {
+		size += 64 - pad
+	}
+	header += strings.Repeat(" ", size-len(header)-1) + "\n"
+	if prefix[6] == 1 {
+		binary.LittleEndian.PutUint16(prefix[8:], uint16(size))
+	} else {
+		binary.LittleEndian.PutUint32(prefix[8:], uint32(size))
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, a.Data)
+}
+
+// parseHeader parses the Python dictionary of the header of a .npy file.
+func parseHeader(s string) (descr string, fortran bool, shape []int, err error) {
+	p := &headerParser{s: s}
+	if !p.consume('{') {
+		return "", false, nil, FormatError("invalid header")
+	}
+	seen := make(map[string]bool)
+	for !p.consume('}') {
+		key, ok := p.str()
+		if !ok || seen[key] || !p.consume(':') {
+			return "", false, nil, FormatError("invalid header")
+		}
+		seen[key] = true
+		switch key {
+		case "descr":
+			if p.peek('[') {
+				return "", false, nil, UnsupportedError("structured arrays")
+			}
+			descr, ok = p.str()
+		case "fortran_order":
+			fortran, ok = p.boolean()
+		case "shape":
+			shape, ok = p.tuple()
+		default:
+			return "", false, nil, FormatError("invalid header key " + strconv.Quote(key))
+		}
+		if !ok {
+			return "", false, nil, FormatError("invalid header value of " + strconv.Quote(key))
+		}
+		if !p.consume(',') && !p.peek('}') {
+			return "", false, nil, FormatError("invalid header")
+		}
+	}
+	if !seen["descr"] || !seen["fortran_order"] || !seen["shape"] {
+		return "", false, nil, FormatError("missing header key")
+	}
+	return descr, fortran, shape, nil
+}
+
+// headerParser parses the literals of a Python dictionary.
+type headerParser struct {
+	s string
+}
+
+func (p *headerParser) skipSpace() {
+	p.s = strings.TrimLeft(p.s, " \t\r\n")
+}
+
+// peek reports whether the next character is c.
+func (p *headerParser) peek(c byte) bool {
+	p.skipSpace()
+	return len(p.s) > 0 && p.s[0] == c
+}
+
+// consume skips the next character if it is c.
+func (p *headerParser) consume(c byte) bool {
+	if !p.peek(c) {
+		return false
+	}
+	p.s = p.s[1:]
+	return true
+}
+
+// str parses a string in single or double quotes, without escapes.
+func (p *headerParser) str() (string, bool) {
+	p.skipSpace()
+	if len(p.s) == 0 || p.s[0] != '\'' && p.s[0] != '"' {
+		return "", false
+	}
+	i := strings.IndexByte(p.s[1:], p.s[0])
+	if i < 0 {
+		return "", false
+	}
+	v := p.s[1 : i+1]
+	p.s = p.s[i+2:]
+	return v, true
+}
+
+func (p *headerParser) boolean() (bool, bool) {
+	p.skipSpace()
+	for _, s := range []string{"False", "True"} {
+		if strings.HasPrefix(p.s, s) {
+			p.s = p.s[len(s):]
+			return s == "True", true
+		}
+	}
+	return false, false
+}
+
+// tuple parses a tuple of integers, which may have the L suffix of the long
+// integers of Python 2.
+func (p *headerParser) tuple() ([]int, bool) {
+	if !p.consume('(') {
+		return nil, false
+	}
+	v := []int{}
+	for !p.consume(')') {
+		p.skipSpace()
+		i := 0
+		for i < len(p.s) && '0' <= p.s[i] && p.s[i] <= '9' {
+			i++
+		}
+		n, err := strconv.Atoi(p.s[:i])
+		if err != nil {
+			return nil, false
+		}
+		v = append(v, n)
+		p.s = strings.TrimPrefix(p.s[i:], "L")
+		if !p.consume(',') && !p.peek(')') {
+			return nil, false
+		}
+	}
+	return v, true
+}
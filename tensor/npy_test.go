@@ -0,0 +1,157 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tensor
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// npyFile returns a .npy file of version 1.0 with the header and elements.
+func npyFile(header string, data string) []byte {
+	header += strings.Repeat(" ", 63-(10+len(header))%64) + "\n"
+	return []byte(npyMagic + "\x01\x00" + string([]byte{byte(len(header))}) + "\x00" + header + data)
+}
+
+func TestWriteNPY(t *testing.T) {
+	// As written by numpy.save(f, numpy.arange(6, dtype='<f4').reshape(2, 3)).
+	want := npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }",
+		"\x00\x00\x00\x00\x00\x00\x80\x3f\x00\x00\x00\x40\x00\x00\x40\x40\x00\x00\x80\x40\x00\x00\xa0\x40")
+	var buf bytes.Buffer
+	if err := WriteNPY(&buf, &Array{Shape: []int{2, 3}, Data: []float32{0, 1, 2, 3, 4, 5}}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %q, want %q", buf.Bytes(), want)
+	}
+
+	for _, a := range []*Array{
+		{Shape: []int{}, Data: []float64{3.5}},
+		{Shape: []int{4}, Data: []uint8{1, 2, 3, 4}},
+		{Shape: []int{2, 2}, Data: []bool{true, false, false, true}},
+		{Shape: []int{2, 0, 3}, Data: []int16{}},
+		{Shape: []int{1, 2, 1}, Data: []int8{-1, 1}},
+		{Shape: []int{3}, Data: []uint16{1, 2, 0xffff}},
+		{Shape: []int{2}, Data: []uint32{1, 0xffffffff}},
+		{Shape: []int{2}, Data: []int32{-1, 1}},
+		{Shape: []int{2}, Data: []uint64{1, 1 << 63}},
+		{Shape: []int{2}, Data: []int64{-1, 1}},
+		{Shape: make([]int, 30000), Data: []float32{}},
+	} {
+		buf.Reset()
+		if err := WriteNPY(&buf, a); err != nil {
+			t.Fatal(err)
+		}
+		if version, size := buf.Bytes()[6], buf.Len()-reflect.ValueOf(a.Data).Len()*int(reflect.TypeOf(a.Data).Elem().Size()); size%64 != 0 || (version == 2) != (len(a.Shape) > 1000) {
+			t.Fatalf("%T: got version %d and a header of %d bytes", a.Data, version, size)
+		}
+		got, err := ReadNPY(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, a) {
+			t.Fatalf("got %v, want %v", got, a)
+		}
+	}
+
+	for _, a := range []*Array{
+		{Shape: []int{3}, Data: []float32{1, 2}},
+		{Shape: []int{-1}, Data: []float32{}},
+		{Shape: []int{2}, Data: []string{"a", "b"}},
+	} {
+		if err := WriteNPY(&buf, a); err == nil {
+			t.Fatalf("%v: got no error", a)
+		}
+	}
+}
+
+func TestReadNPY(t *testing.T) {
+	for _, tt := range []struct {
+		file []byte
+		want *Array
+	}{
+		// Fortran order, of [[1, 2, 3], [4, 5, 6]].
+		{
+			npyFile("{'descr': '|u1', 'fortran_order': True, 'shape': (2, 3), }", "\x01\x04\x02\x05\x03\x06"),
+			&Array{Shape: []int{2, 3}, Data: []uint8{1, 2, 3, 4, 5, 6}},
+		},
+		// Big-endian elements, and the long integers of Python 2.
+		{
+			npyFile("{'descr': '>i2', 'fortran_order': False, 'shape': (2L,), }", "\xff\xfe\x01\x02"),
+			&Array{Shape: []int{2}, Data: []int16{-2, 0x102}},
+		},
+		// Other orders of the keys and spacing.
+		{
+			npyFile(`{"shape":(1,1),"fortran_order":False,"descr":"<f8"}`, "\x00\x00\x00\x00\x00\x00\xf0\x3f"),
+			&Array{Shape: []int{1, 1}, Data: []float64{1}},
+		},
+		// As written by numpy.save(f, numpy.array([True, False, True])).
+		{
+			npyFile("{'descr': '|b1', 'fortran_order': False, 'shape': (3,), }", "\x01\x00\x01"),
+			&Array{Shape: []int{3}, Data: []bool{true, false, true}},
+		},
+		// A version 2.0 header.
+		{
+			[]byte(npyMagic + "\x02\x00\x3a\x00\x00\x00{'descr': '<u4', 'fortran_order': False, 'shape': (1,), }\n\x01\x00\x00\x00"),
+			&Array{Shape: []int{1}, Data: []uint32{1}},
+		},
+	} {
+		got, err := ReadNPY(bytes.NewReader(tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("got %v, want %v", got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		file []byte
+		err  error
+	}{
+		{[]byte("\x93NUMPY\x01"), io.ErrUnexpectedEOF},
+		{[]byte("\x89PNG\r\n\x1a\n\x00\x00"), FormatError("not a NumPy file")},
+		{[]byte(npyMagic + "\x04\x00\x00\x00"), UnsupportedError("version 4.0")},
+		{npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }", "\x00\x00"), io.ErrUnexpectedEOF},
+		{npyFile("{'descr': '<c8', 'fortran_order': False, 'shape': (), }", ""), UnsupportedError("data type <c8")},
+		{npyFile("{'descr': [('x', '<f4')], 'fortran_order': False, 'shape': (), }", ""), UnsupportedError("structured arrays")},
+		{npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (65536, 65536), }", ""), UnsupportedError("shape [65536 65536]")},
+		{npyFile("{'descr': '<f4', 'fortran_order': False}", ""), FormatError("missing header key")},
+		{npyFile("{'descr': '<f4', 'fortran_order': 0, 'shape': ()}", ""), FormatError(`invalid header value of "fortran_order"`)},
+		{npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (1 2)}", ""), FormatError(`invalid header value of "shape"`)},
+		{npyFile("{'descr': '<f4', 'order': False, 'shape': ()}", ""), FormatError(`invalid header key "order"`)},
+		{npyFile("{'descr': '<f4' 'shape': ()}", ""), FormatError("invalid header")},
+	} {
+		if _, err := ReadNPY(bytes.NewReader(tt.file)); err != tt.err {
+			t.Fatalf("%q: got error %v, want %v", tt.file, err, tt.err)
+		}
+	}
+}
+
+func TestNPZ(t *testing.T) {
+	arrays := map[string]*Array{
+		"image": {Shape: []int{1, 2, 2, 1}, Data: []float32{0, 0.25, 0.5, 1}},
+		"label": {Shape: []int{}, Data: []int64{7}},
+	}
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := WriteNPZ(&buf, arrays, compress); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadNPZ(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, arrays) {
+			t.Fatalf("compress %v: got %v, want %v", compress, got, arrays)
+		}
+	}
+	if _, err := ReadNPZ(strings.NewReader("not a zip file"), 14); err == nil {
+		t.Fatal("got no error")
+	}
+}
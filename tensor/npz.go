@@ -0,0 +1,63 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tensor
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ReadNPZ reads the arrays of a NumPy .npz file of the size, which is a zip
+// archive of .npy files, by name without the .npy extension.
+func ReadNPZ(r io.ReaderAt, size int64) (map[string]*Array, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	arrays := make(map[string]*Array, len(z.File))
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		a, err := ReadNPY(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%v, in %s", err, f.Name)
+		}
+		arrays[strings.TrimSuffix(f.Name, ".npy")] = a
+	}
+	return arrays, nil
+}
+
+// WriteNPZ writes the arrays as a NumPy .npz file, in the order of their
+// names. The arrays are deflated if compress is true, as
+// numpy.savez_compressed does, and stored otherwise, as numpy.savez does.
+func WriteNPZ(w io.Writer, arrays map[string]*Array, compress bool) error {
+	names := make([]string, 0, len(arrays))
+	for name := range arrays {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	method := zip.Store
+	if compress {
+		method = zip.Deflate
+	}
+	z := zip.NewWriter(w)
+	for _, name := range names {
+		f, err := z.CreateHeader(&zip.FileHeader{Name: name + ".npy", Method: method})
+		if err != nil {
+			return err
+		}
+		if err := WriteNPY(f, arrays[name]); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
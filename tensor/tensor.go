@@ -0,0 +1,363 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tensor converts images to and from the float tensors of machine
+// learning models, and reads and writes arrays as NumPy .npy and .npz files.
+//
+// A tensor is a contiguous slice of samples in C order (the last axis varies
+// fastest), of the shape N, H, W, C in the NHWC layout and N, C, H, W in the
+// NCHW layout, for a batch of N images of H rows of W pixels of C channels.
+//
+// The samples of the images are read as they are stored: from 0 to 255 in
+// Uint8 images, from 0 to 65535 in Uint16 images, and as they are in the
+// other ones. Images that are not an image.Image of the root package are
+// converted with image.AsImage first.
+//
+// The NumPy format is documented at
+// https://numpy.org/doc/stable/reference/generated/numpy.lib.format.html.
+package tensor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"reflect"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+// Layout is the order of the axes of a tensor.
+type Layout int
+
+const (
+	NHWC Layout = iota // Images, rows, columns and channels.
+	NCHW               // Images, channels, rows and columns.
+)
+
+func (l Layout) String() string {
+	switch l {
+	case NHWC:
+		return "NHWC"
+	case NCHW:
+		return "NCHW"
+	}
+	return fmt.Sprintf("Layout(%d)", int(l))
+}
+
+// Channel orders of Options.Channels for RGB and RGBA images.
+var (
+	RGB = []int{0, 1, 2}
+	BGR = []int{2, 1, 0}
+)
+
+// Options are the conversion parameters. A nil *Options converts all the
+// channels in their order to an NHWC tensor, without normalization.
+type Options struct {
+	// Layout is the order of the axes of the tensor.
+	Layout Layout
+	// Channels lists the channel of the images for each channel of the
+	// tensor: BGR reverses the channels of RGB images, and RGB drops the
+	// alpha channel of RGBA images. All the channels are kept in their order
+	// if it is empty.
+	Channels []int
+	// Scale multiplies the samples, as 1.0/255 does to scale Uint8 samples
+	// from 0 to 1. The samples are not scaled if it is 0.
+	Scale float64
+	// Mean and Std normalize the scaled samples of the c-th channel of the
+	// tensor to (v - Mean[c]) / Std[c]. They are either empty, for a mean
+	// of 0 and a standard deviation of 1, or have a single value for all
+	// the channels, or one value per channel of the tensor.
+	Mean, Std []float64
+}
+
+// transform is the affine transform of the samples of each channel of a
+// tensor, and the channels of the images that they come from.
+type transform struct {
+	layout   Layout
+	channels []int
+	scale    []float64
+	offset   []float64
+}
+
+// transform returns the transform of the options for images of the channels.
+func (opt *Options) transform(channels int) (*transform, error) {
+	if opt == nil {
+		opt = new(Options)
+	}
+	if opt.Layout != NHWC && opt.Layout != NCHW {
+		return nil, fmt.Errorf("tensor: invalid layout: %v", opt.Layout)
+	}
+	t := &transform{layout: opt.Layout, channels: opt.Channels}
+	if len(t.channels) == 0 {
+		t.channels = make([]int, channels)
+		for c := range t.channels {
+			t.channels[c] = c
+		}
+	}
+	for _, c := range t.channels {
+		if c < 0 || c >= channels {
+			return nil, fmt.Errorf("tensor: invalid channel %d of images of %d channels", c, channels)
+		}
+	}
+	scale := opt.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	param := func(name string, v []float64, c int, def float64) (float64, error) {
+		switch len(v) {
+		case 0:
+			return def, nil
+		case 1:
+			return v[0], nil
+		case len(t.channels):
+			return v[c], nil
+		}
+		return 0, fmt.Errorf("tensor: invalid %s: %d values for %d channels", name, len(v), len(t.channels))
+	}
+	t.scale = make([]float64, len(t.channels))
+	t.offset = make([]float64, len(t.channels))
+	for c := range t.channels {
+		mean, err := param("mean", opt.Mean, c, 0)
+		if err != nil {
+			return nil, err
+		}
+		std, err := param("std", opt.Std, c, 1)
+		if err != nil {
+			return nil, err
+		}
+		if std == 0 {
+			return nil, fmt.Errorf("tensor: invalid std: 0")
+		}
+		t.scale[c] = scale / std
+		t.offset[c] = -mean / std
+	}
+	return t, nil
+}
+
+// shape returns the shape of a tensor of n images of the dimensions.
+func (t *transform) shape(n, h, w int) []int {
+	if t.layout == NCHW {
+		return []int{n, len(t.channels), h, w}
+	}
+	return []int{n, h, w, len(t.channels)}
+}
+
+// index returns the index of the sample of the channel c at (x, y) in an
+// image of the dimensions of a tensor.
+func (t *transform) index(x, y, c, h, w int) int {
+	if t.layout == NCHW {
+		return (c*h+y)*w + x
+	}
+	return (y*w+x)*len(t.channels) + c
+}
+
+// samples reads the samples of an interleaved or planar image.
+type samples struct {
+	pix         []uint8
+	stride      int
+	pixelStep   int // The distance between two pixels of a channel.
+	channelStep int // The distance between two channels of a pixel.
+	get         func([]byte) float64
+	rect        image.Rectangle
+	channels    int
+}
+
+func newSamples(m image.Image) *samples {
+	src := imageExt.AsImage(m)
+	s := &samples{
+		pix:      src.Pix(),
+		stride:   src.Stride(),
+		rect:     src.Bounds(),
+		channels: src.Channels(),
+	}
+	var size int
+	s.get, size = sampleFunc(src.Depth())
+	if p, ok := src.(*imageExt.Planar); ok {
+		s.pixelStep, s.channelStep = size, p.M.PlaneStride
+	} else {
+		s.pixelStep, s.channelStep = size*s.channels, size
+	}
+	return s
+}
+
+// at returns the sample of the channel c at (x, y), relative to the
+// top-left corner of the image.
+func (s *samples) at(x, y, c int) float64 {
+	return s.get(s.pix[y*s.stride+x*s.pixelStep+c*s.channelStep:])
+}
+
+// sampleFunc returns a function that reads a single big-endian sample of the
+// depth, and the size of a sample in bytes.
+func sampleFunc(depth reflect.Kind) (get func([]byte) float64, size int) {
+	switch depth {
+	case reflect.Uint8:
+		return func(p []byte) float64 { return float64(p[0]) }, 1
+	case reflect.Uint16:
+		return func(p []byte) float64 { return float64(binary.BigEndian.Uint16(p)) }, 2
+	case imageExt.Float16:
+		return func(p []byte) float64 { return float64(colorExt.Float16ToFloat32(binary.BigEndian.Uint16(p))) }, 2
+	case reflect.Int32:
+		return func(p []byte) float64 { return float64(int32(binary.BigEndian.Uint32(p))) }, 4
+	case reflect.Float32:
+		return func(p []byte) float64 { return float64(math.Float32frombits(binary.BigEndian.Uint32(p))) }, 4
+	case reflect.Int64:
+		return func(p []byte) float64 { return float64(int64(binary.BigEndian.Uint64(p))) }, 8
+	case reflect.Float64:
+		return func(p []byte) float64 { return math.Float64frombits(binary.BigEndian.Uint64(p)) }, 8
+	}
+	panic(fmt.Errorf("tensor: invalid depth: %v", depth))
+}
+
+// ToFloat32 returns the samples of the images as a float32 tensor, and its
+// shape. The images must have the same size, and the same number of channels
+// unless Options.Channels selects channels that they all have; their depths
+// may differ.
+func ToFloat32(opt *Options, ms ...image.Image) ([]float32, []int, error) {
+	var data []float32
+	shape, err := toTensor(opt, ms,
+		func(n int) { data = make([]float32, n) },
+		func(i int, v float64) { data[i] = float32(v) },
+	)
+	return data, shape, err
+}
+
+// ToFloat64 returns the samples of the images as a float64 tensor, and its
+// shape. The images must have the same size, and the same number of channels
+// unless Options.Channels selects channels that they all have; their depths
+// may differ.
+func ToFloat64(opt *Options, ms ...image.Image) ([]float64, []int, error) {
+	var data []float64
+	shape, err := toTensor(opt, ms,
+		func(n int) { data = make([]float64, n) },
+		func(i int, v float64) { data[i] = v },
+	)
+	return data, shape, err
+}
+
+func toTensor(opt *Options, ms []image.Image, alloc func(n int), set func(i int, v float64)) ([]int, error) {
+	if len(ms) == 0 {
+		return nil, fmt.Errorf("tensor: no images")
+	}
+	src := make([]*samples, len(ms))
+	for i, m := range ms {
+		src[i] = newSamples(m)
+	}
+	t, err := opt.transform(src[0].channels)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range src {
+		if s.rect.Size() != src[0].rect.Size() {
+			return nil, fmt.Errorf("tensor: image %d has size %v, want %v", i, s.rect.Size(), src[0].rect.Size())
+		}
+		ok := s.channels == src[0].channels || opt != nil && len(opt.Channels) != 0
+		for _, c := range t.channels {
+			ok = ok && c < s.channels
+		}
+		if !ok {
+			return nil, fmt.Errorf("tensor: image %d has %d channels, want %d", i, s.channels, src[0].channels)
+		}
+	}
+	h, w := src[0].rect.Dy(), src[0].rect.Dx()
+	size := h * w * len(t.channels)
+	alloc(len(src) * size)
+	for n, s := range src {
+		base := n * size
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				for c, sc := range t.channels {
+					set(base+t.index(x, y, c, h, w), s.at(x, y, sc)*t.scale[c]+t.offset[c])
+				}
+			}
+		}
+	}
+	return t.shape(len(src), h, w), nil
+}
+
+// FromFloat32 returns the n-th image of a float32 tensor of the shape, as a
+// Gray32f, GrayA64f, RGB96f or RGBA128f image of its 1 to 4 channels, as for
+// the masks and depth maps of model outputs. It undoes the options, which
+// must keep all the channels of the image: it is the inverse of ToFloat32
+// for Float32 images.
+//
+// The shape has 4 axes in the layout of the options, or 3 without the first
+// one for a single image, or 2 for the rows and columns of a single image of
+// one channel.
+func FromFloat32(data []float32, shape []int, n int, opt *Options) (imageExt.Image, error) {
+	return fromTensor(len(data), func(i int) float64 { return float64(data[i]) }, shape, n, opt)
+}
+
+// FromFloat64 returns the n-th image of a float64 tensor of the shape, as
+// FromFloat32 does. The samples are rounded to float32.
+func FromFloat64(data []float64, shape []int, n int, opt *Options) (imageExt.Image, error) {
+	return fromTensor(len(data), func(i int) float64 { return data[i] }, shape, n, opt)
+}
+
+func fromTensor(length int, get func(i int) float64, shape []int, n int, opt *Options) (imageExt.Image, error) {
+	layout := NHWC
+	if opt != nil {
+		layout = opt.Layout
+	}
+	var images, h, w, channels int
+	switch dims := append([]int(nil), shape...); len(dims) {
+	case 2:
+		images, h, w, channels = 1, dims[0], dims[1], 1
+	case 3:
+		dims = append([]int{1}, dims...)
+		fallthrough
+	case 4:
+		images, h, w, channels = dims[0], dims[1], dims[2], dims[3]
+		if layout == NCHW {
+			channels, h, w = dims[1], dims[2], dims[3]
+		}
+	default:
+		return nil, fmt.Errorf("tensor: invalid shape: %v", shape)
+	}
+	for _, d := range shape {
+		if d < 0 {
+			return nil, fmt.Errorf("tensor: invalid shape: %v", shape)
+		}
+	}
+	if channels < 1 || channels > 4 {
+		return nil, fmt.Errorf("tensor: invalid shape: %v, %d channels", shape, channels)
+	}
+	if n < 0 || n >= images {
+		return nil, fmt.Errorf("tensor: invalid image %d of %d", n, images)
+	}
+	size := h * w * channels
+	if length != images*size {
+		return nil, fmt.Errorf("tensor: invalid shape: %v, for %d samples", shape, length)
+	}
+	t, err := opt.transform(channels)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.channels) != channels {
+		return nil, fmt.Errorf("tensor: invalid channels: %v, for %d channels", t.channels, channels)
+	}
+	seen := make([]bool, channels)
+	for _, c := range t.channels {
+		if seen[c] {
+			return nil, fmt.Errorf("tensor: invalid channels: %v, channel %d is repeated", t.channels, c)
+		}
+		seen[c] = true
+	}
+
+	m, err := imageExt.NewImage(image.Rect(0, 0, w, h), channels, reflect.Float32)
+	if err != nil {
+		return nil, err
+	}
+	pix, base := m.Pix(), n*size
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for c, mc := range t.channels {
+				v := (get(base+t.index(x, y, c, h, w)) - t.offset[c]) / t.scale[c]
+				binary.BigEndian.PutUint32(pix[y*m.Stride()+(x*channels+mc)*4:], math.Float32bits(float32(v)))
+			}
+		}
+	}
+	return m, nil
+}
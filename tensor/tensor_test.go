@@ -0,0 +1,166 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tensor
+
+import (
+	"image"
+	"math"
+	"reflect"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
+)
+
+func TestToFloat(t *testing.T) {
+	r := image.Rect(4, 5, 7, 7)
+	m := imageExt.NewRGB(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.SetRGB(x, y, colorExt.RGB{R: uint8(x), G: uint8(y), B: uint8(10*x + y)})
+		}
+	}
+	opt := &Options{
+		Layout:   NCHW,
+		Channels: BGR,
+		Scale:    1.0 / 255,
+		Mean:     []float64{0.5},
+		Std:      []float64{0.25, 0.5, 1},
+	}
+	data, shape, err := ToFloat64(opt, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 3, 2, 3}; !reflect.DeepEqual(shape, want) {
+		t.Fatalf("got shape %v, want %v", shape, want)
+	}
+	// The blue, green and red samples at (6, 5).
+	for c, v := range []float64{(65.0/255 - 0.5) / 0.25, (5.0/255 - 0.5) / 0.5, 6.0/255 - 0.5} {
+		if got := data[c*6+2]; math.Abs(got-v) > 1e-12 {
+			t.Fatalf("channel %d: got %v, want %v", c, got, v)
+		}
+	}
+
+	// A batch of images of different types and depths, in the NHWC layout.
+	p := imageExt.AsPlanar(m)
+	n := imageExt.NewRGBA64(image.Rect(0, 0, 3, 2))
+	n.SetRGBA64(1, 1, colorExt.RGBA64{R: 1000, G: 2000, B: 3000, A: 4000})
+	f32, shape, err := ToFloat32(&Options{Channels: RGB}, m, p, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{3, 2, 3, 3}; !reflect.DeepEqual(shape, want) {
+		t.Fatalf("got shape %v, want %v", shape, want)
+	}
+	for i, v := range f32[:18] {
+		if f32[18+i] != v {
+			t.Fatalf("the planar image differs at %d: got %v, want %v", i, f32[18+i], v)
+		}
+	}
+	if got, want := f32[36+(1*3+1)*3:][:3], []float32{1000, 2000, 3000}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	for _, tt := range []struct {
+		opt *Options
+		ms  []image.Image
+	}{
+		{nil, nil},
+		{nil, []image.Image{m, imageExt.NewRGB(image.Rect(0, 0, 3, 3))}},
+		{nil, []image.Image{m, imageExt.NewGray(r)}},
+		{nil, []image.Image{m, n}},
+		{&Options{Channels: []int{0, 3}}, []image.Image{n, m}},
+		{&Options{Channels: []int{3}}, []image.Image{m}},
+		{&Options{Mean: []float64{1, 2}}, []image.Image{m}},
+		{&Options{Std: []float64{0}}, []image.Image{m}},
+		{&Options{Layout: 2}, []image.Image{m}},
+	} {
+		if _, _, err := ToFloat32(tt.opt, tt.ms...); err == nil {
+			t.Fatalf("%+v, %d images: got no error", tt.opt, len(tt.ms))
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	m := imageExt.NewRGB96f(image.Rect(0, 0, 5, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 5; x++ {
+			m.SetRGB96f(x, y, colorExt.RGB96f{R: float32(x) / 3, G: float32(y * 1000), B: float32(x - y)})
+		}
+	}
+	for _, opt := range []*Options{
+		nil,
+		{Layout: NCHW, Channels: BGR, Scale: 2, Mean: []float64{1, 2, 3}, Std: []float64{4}},
+	} {
+		data, shape, err := ToFloat32(opt, m, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, shape := range [][]int{shape, shape[1:]} {
+			data := data
+			if len(shape) == 3 {
+				data = data[:len(data)/2]
+			}
+			got, err := FromFloat32(data, shape, 0, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got64, err := FromFloat64(float32To64(data), shape, 0, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, got64) {
+				t.Fatalf("%+v, shape %v: the float32 and float64 images differ", opt, shape)
+			}
+			g := got.(*imageExt.RGB96f)
+			for y := 0; y < 4; y++ {
+				for x := 0; x < 5; x++ {
+					c0, c1 := m.RGB96fAt(x, y), g.RGB96fAt(x, y)
+					for i, v := range []float32{c0.R, c0.G, c0.B} {
+						if w := []float32{c1.R, c1.G, c1.B}[i]; math.Abs(float64(v-w)) > 1e-4 {
+							t.Fatalf("%+v, shape %v: (%d, %d): got %v, want %v", opt, shape, x, y, c1, c0)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// A mask is returned as a Gray32f image.
+	mask, err := FromFloat32([]float32{0, 1, 0.5, 0.25, 0, 1}, []int{2, 3}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := mask.(*imageExt.Gray32f); g.Bounds() != image.Rect(0, 0, 3, 2) || g.Gray32fAt(0, 1).Y != 0.25 {
+		t.Fatalf("got %v, %v", g.Bounds(), g.Gray32fAt(0, 1))
+	}
+
+	for _, tt := range []struct {
+		n     int
+		shape []int
+		opt   *Options
+	}{
+		{0, []int{6}, nil},
+		{0, []int{1, 2, 3, 1, 1}, nil},
+		{0, []int{1, 1, 6}, nil},
+		{0, []int{1, 2, 4}, nil},
+		{0, []int{2, -3}, nil},
+		{1, []int{1, 2, 3, 1}, nil},
+		{0, []int{1, 1, 2, 3}, &Options{Channels: []int{0, 0}}},
+		{0, []int{1, 2, 1, 3}, &Options{Channels: []int{0, 1}}},
+	} {
+		if _, err := FromFloat32(make([]float32, 6), tt.shape, tt.n, tt.opt); err == nil {
+			t.Fatalf("image %d of shape %v, %+v: got no error", tt.n, tt.shape, tt.opt)
+		}
+	}
+}
+
+func float32To64(data []float32) []float64 {
+	v := make([]float64, len(data))
+	for i := range data {
+		v[i] = float64(data[i])
+	}
+	return v
+}
@@ -13,23 +13,23 @@ type buffer struct {
 }
 
 // fill reads data from b.r until the buffer contains at least end bytes.
+// The buffer grows with the data that is read, so that an end past the end
+// of the data does not allocate its size.
 func (b *buffer) fill(end int) error {
-	m := len(b.buf)
-	if end > m {
-		if end > cap(b.buf) {
-			newcap := 1024
-			for newcap < end {
-				newcap *= 2
-			}
-			newbuf := make([]byte, end, newcap)
+	for len(b.buf) < end {
+		m, next := len(b.buf), end
+		if limit := 2*m + 1024; next > limit {
+			next = limit
+		}
+		if next > cap(b.buf) {
+			newbuf := make([]byte, next, 2*next)
 			copy(newbuf, b.buf)
 			b.buf = newbuf
 		} else {
-			b.buf = b.buf[:end]
+			b.buf = b.buf[:next]
 		}
-		if n, err := io.ReadFull(b.r, b.buf[m:end]); err != nil {
-			end = m + n
-			b.buf = b.buf[:end]
+		if n, err := io.ReadFull(b.r, b.buf[m:next]); err != nil {
+			b.buf = b.buf[:m+n]
 			return err
 		}
 	}
@@ -44,7 +44,10 @@ func (b *buffer) ReadAt(p []byte, off int64) (int, error) {
 	}
 
 	err := b.fill(end)
-	return copy(p, b.buf[o:end]), err
+	if o >= len(b.buf) {
+		return 0, err
+	}
+	return copy(p, b.buf[o:]), err
 }
 
 // Slice returns a slice of the underlying buffer. The slice contains
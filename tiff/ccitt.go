@@ -0,0 +1,423 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+// This file implements the CCITT Group 3 (T.4) and Group 4 (T.6) fax
+// decompression used by TIFF compression schemes 2, 3 and 4. See section
+// 10 (p. 43-48) of the TIFF spec and the TIFF Class F specification.
+//
+// Decoded rows are bilevel, packed 8 pixels per byte with the most
+// significant bit first, and each row starts at a byte boundary. White
+// pixels are 0 and black pixels are 1.
+
+// ccittMode selects the CCITT coding scheme of a strip or tile.
+type ccittMode int
+
+const (
+	ccittRLE ccittMode = iota // Compression 2: Modified Huffman, byte-aligned rows, no EOLs.
+	ccittT4                   // Compression 3: T.4, 1D or 2D coding with EOLs.
+	ccittT6                   // Compression 4: T.6, 2D coding without EOLs.
+)
+
+// Bits of the tT4Options tag.
+const (
+	t4Opt2D           = 1 << 0
+	t4OptUncompressed = 1 << 1
+	t4OptFillBits     = 1 << 2
+)
+
+// A huffNode is a node of a binary code tree. Children with a negative
+// index i are leaves holding the decoded value ^i - 2, so that codeEOL
+// is representable.
+type huffNode [2]int32
+
+// huffTree decodes prefix codes given as strings of '0' and '1'.
+type huffTree []huffNode
+
+// codeEOL is the value decoded for the end-of-line code.
+const codeEOL = -1
+
+func newHuffTree(codes map[string]int) huffTree {
+	t := huffTree{{0, 0}}
+	for code, value := range codes {
+		n := 0
+		for i := 0; i < len(code); i++ {
+			b := code[i] - '0'
+			if i == len(code)-1 {
+				if t[n][b] != 0 {
+					panic("tiff: ambiguous code " + code)
+				}
+				t[n][b] = ^int32(value + 2)
+				break
+			}
+			if t[n][b] < 0 {
+				panic("tiff: ambiguous code " + code)
+			}
+			if t[n][b] == 0 {
+				t = append(t, huffNode{0, 0})
+				t[n][b] = int32(len(t) - 1)
+			}
+			n = int(t[n][b])
+		}
+	}
+	return t
+}
+
+// Modes of the two-dimensional coding scheme (T.4 section 4.2.1.3).
+const (
+	modePass = iota
+	modeHorizontal
+	modeV0
+	modeVR1
+	modeVR2
+	modeVR3
+	modeVL1
+	modeVL2
+	modeVL3
+	modeExtension
+)
+
+var modeTree = newHuffTree(map[string]int{
+	"0001":    modePass,
+	"001":     modeHorizontal,
+	"1":       modeV0,
+	"011":     modeVR1,
+	"000011":  modeVR2,
+	"0000011": modeVR3,
+	"010":     modeVL1,
+	"000010":  modeVL2,
+	"0000010": modeVL3,
+	"0000001": modeExtension,
+})
+
+// Run-length codes shared by white and black runs (T.4 table 3).
+var extendedMakeupCodes = map[string]int{
+	"00000001000":  1792,
+	"00000001100":  1856,
+	"00000001101":  1920,
+	"000000010010": 1984,
+	"000000010011": 2048,
+	"000000010100": 2112,
+	"000000010101": 2176,
+	"000000010110": 2240,
+	"000000010111": 2304,
+	"000000011100": 2368,
+	"000000011101": 2432,
+	"000000011110": 2496,
+	"000000011111": 2560,
+	"000000000001": codeEOL,
+}
+
+var whiteCodes = map[string]int{
+	// Terminating codes.
+	"00110101": 0, "000111": 1, "0111": 2, "1000": 3,
+	"1011": 4, "1100": 5, "1110": 6, "1111": 7,
+	"10011": 8, "10100": 9, "00111": 10, "01000": 11,
+	"001000": 12, "000011": 13, "110100": 14, "110101": 15,
+	"101010": 16, "101011": 17, "0100111": 18, "0001100": 19,
+	"0001000": 20, "0010111": 21, "0000011": 22, "0000100": 23,
+	"0101000": 24, "0101011": 25, "0010011": 26, "0100100": 27,
+	"0011000": 28, "00000010": 29, "00000011": 30, "00011010": 31,
+	"00011011": 32, "00010010": 33, "00010011": 34, "00010100": 35,
+	"00010101": 36, "00010110": 37, "00010111": 38, "00101000": 39,
+	"00101001": 40, "00101010": 41, "00101011": 42, "00101100": 43,
+	"00101101": 44, "00000100": 45, "00000101": 46, "00001010": 47,
+	"00001011": 48, "01010010": 49, "01010011": 50, "01010100": 51,
+	"01010101": 52, "00100100": 53, "00100101": 54, "01011000": 55,
+	"01011001": 56, "01011010": 57, "01011011": 58, "01001010": 59,
+	"01001011": 60, "00110010": 61, "00110011": 62, "00110100": 63,
+	// Make-up codes.
+	"11011": 64, "10010": 128, "010111": 192, "0110111": 256,
+	"00110110": 320, "00110111": 384, "01100100": 448, "01100101": 512,
+	"01101000": 576, "01100111": 640, "011001100": 704, "011001101": 768,
+	"011010010": 832, "011010011": 896, "011010100": 960, "011010101": 1024,
+	"011010110": 1088, "011010111": 1152, "011011000": 1216, "011011001": 1280,
+	"011011010": 1344, "011011011": 1408, "010011000": 1472, "010011001": 1536,
+	"010011010": 1600, "011000": 1664, "010011011": 1728,
+}
+
+var blackCodes = map[string]int{
+	// Terminating codes.
+	"0000110111": 0, "010": 1, "11": 2, "10": 3,
+	"011": 4, "0011": 5, "0010": 6, "00011": 7,
+	"000101": 8, "000100": 9, "0000100": 10, "0000101": 11,
+	"0000111": 12, "00000100": 13, "00000111": 14, "000011000": 15,
+	"0000010111": 16, "0000011000": 17, "0000001000": 18, "00001100111": 19,
+	"00001101000": 20, "00001101100": 21, "00000110111": 22, "00000101000": 23,
+	"00000010111": 24, "00000011000": 25, "000011001010": 26, "000011001011": 27,
+	"000011001100": 28, "000011001101": 29, "000001101000": 30, "000001101001": 31,
+	"000001101010": 32, "000001101011": 33, "000011010010": 34, "000011010011": 35,
+	"000011010100": 36, "000011010101": 37, "000011010110": 38, "000011010111": 39,
+	"000001101100": 40, "000001101101": 41, "000011011010": 42, "000011011011": 43,
+	"000001010100": 44, "000001010101": 45, "000001010110": 46, "000001010111": 47,
+	"000001100100": 48, "000001100101": 49, "000001010010": 50, "000001010011": 51,
+	"000000100100": 52, "000000110111": 53, "000000111000": 54, "000000100111": 55,
+	"000000101000": 56, "000001011000": 57, "000001011001": 58, "000000101011": 59,
+	"000000101100": 60, "000001011010": 61, "000001100110": 62, "000001100111": 63,
+	// Make-up codes.
+	"0000001111": 64, "000011001000": 128, "000011001001": 192, "000001011011": 256,
+	"000000110011": 320, "000000110100": 384, "000000110101": 448, "0000001101100": 512,
+	"0000001101101": 576, "0000001001010": 640, "0000001001011": 704, "0000001001100": 768,
+	"0000001001101": 832, "0000001110010": 896, "0000001110011": 960, "0000001110100": 1024,
+	"0000001110101": 1088, "0000001110110": 1152, "0000001110111": 1216, "0000001010010": 1280,
+	"0000001010011": 1344, "0000001010100": 1408, "0000001010101": 1472, "0000001011010": 1536,
+	"0000001011011": 1600, "0000001100100": 1664, "0000001100101": 1728,
+}
+
+var (
+	whiteTree = newHuffTree(mergeCodes(whiteCodes, extendedMakeupCodes))
+	blackTree = newHuffTree(mergeCodes(blackCodes, extendedMakeupCodes))
+)
+
+func mergeCodes(a, b map[string]int) map[string]int {
+	m := make(map[string]int, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
+
+// ccittDecoder holds the state of the decompression of one strip or tile.
+type ccittDecoder struct {
+	src   []byte
+	pos   int // Position of the next bit in src.
+	width int
+
+	// ref and cur hold the changing elements of the reference line and
+	// the current line, terminated by sentinels at width.
+	ref, cur []int
+}
+
+var errCCITTEOF = FormatError("CCITT data ends unexpectedly")
+
+func (c *ccittDecoder) readBit() (uint, error) {
+	if c.pos >= 8*len(c.src) {
+		return 0, errCCITTEOF
+	}
+	b := uint(c.src[c.pos>>3]>>(7-uint(c.pos&7))) & 1
+	c.pos++
+	return b, nil
+}
+
+// decodeCode reads a code with the tree t and returns its value.
+func (c *ccittDecoder) decodeCode(t huffTree) (int, error) {
+	n := int32(0)
+	for {
+		b, err := c.readBit()
+		if err != nil {
+			return 0, err
+		}
+		n = t[n][b]
+		if n < 0 {
+			return int(^n) - 2, nil
+		}
+		if n == 0 {
+			return 0, FormatError("invalid CCITT code")
+		}
+	}
+}
+
+// decodeRun reads the make-up and terminating codes of a run of the
+// given color (0 for white, 1 for black) and returns the run length.
+func (c *ccittDecoder) decodeRun(color int) (int, error) {
+	t := whiteTree
+	if color != 0 {
+		t = blackTree
+	}
+	run := 0
+	for {
+		v, err := c.decodeCode(t)
+		if err != nil {
+			return 0, err
+		}
+		if v == codeEOL {
+			return 0, FormatError("unexpected CCITT EOL")
+		}
+		run += v
+		if v < 64 {
+			return run, nil
+		}
+	}
+}
+
+// skipEOL consumes fill bits and an end-of-line code at the current
+// position, and reports whether there was one.
+func (c *ccittDecoder) skipEOL() bool {
+	pos, zeros := c.pos, 0
+	for {
+		b, err := c.readBit()
+		if err != nil {
+			break
+		}
+		if b == 1 {
+			if zeros >= 11 {
+				return true
+			}
+			break
+		}
+		zeros++
+	}
+	c.pos = pos
+	return false
+}
+
+func (c *ccittDecoder) alignByte() {
+	c.pos = (c.pos + 7) &^ 7
+}
+
+// decode1D decodes a one-dimensional (Modified Huffman) coded line.
+func (c *ccittDecoder) decode1D() error {
+	c.cur = c.cur[:0]
+	a0, color := 0, 0
+	for a0 < c.width {
+		run, err := c.decodeRun(color)
+		if err != nil {
+			return err
+		}
+		if a0 += run; a0 > c.width {
+			return FormatError("CCITT run exceeds row width")
+		}
+		c.cur = append(c.cur, a0)
+		color ^= 1
+	}
+	c.cur = append(c.cur, c.width, c.width, c.width)
+	return nil
+}
+
+// decode2D decodes a two-dimensional coded line, using c.ref as the
+// reference line.
+func (c *ccittDecoder) decode2D() error {
+	c.cur = c.cur[:0]
+	a0, color := -1, 0
+	i := 0 // Index of the candidate for b1 in c.ref.
+	for a0 < c.width {
+		// b1 is the first changing element on the reference line to the
+		// right of a0 and of opposite color to the color of a0. The color
+		// of the changing element c.ref[i] is black for even i.
+		for i > 0 && c.ref[i-1] > a0 {
+			i--
+		}
+		for c.ref[i] <= a0 || i&1 != color {
+			i++
+		}
+		b1, b2 := c.ref[i], c.ref[i+1]
+
+		mode, err := c.decodeCode(modeTree)
+		if err != nil {
+			return err
+		}
+		switch mode {
+		case modePass:
+			a0 = b2
+		case modeHorizontal:
+			if a0 < 0 {
+				a0 = 0
+			}
+			run1, err := c.decodeRun(color)
+			if err != nil {
+				return err
+			}
+			run2, err := c.decodeRun(color ^ 1)
+			if err != nil {
+				return err
+			}
+			a1 := a0 + run1
+			a2 := a1 + run2
+			if a2 > c.width {
+				return FormatError("CCITT run exceeds row width")
+			}
+			c.cur = append(c.cur, a1, a2)
+			a0 = a2
+		case modeV0, modeVR1, modeVR2, modeVR3, modeVL1, modeVL2, modeVL3:
+			a1 := b1 + [...]int{0, 1, 2, 3, -1, -2, -3}[mode-modeV0]
+			if a1 < 0 || a1 > c.width || a1 < a0 {
+				return FormatError("invalid CCITT vertical mode")
+			}
+			c.cur = append(c.cur, a1)
+			a0 = a1
+			color ^= 1
+		default:
+			return UnsupportedError("CCITT uncompressed mode")
+		}
+	}
+	c.cur = append(c.cur, c.width, c.width, c.width)
+	return nil
+}
+
+// putRow packs the current line into dst, which holds (width+7)/8 bytes.
+func (c *ccittDecoder) putRow(dst []byte) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	// Black runs go from c.cur[i] to c.cur[i+1] for even i.
+	for i := 0; i+1 < len(c.cur); i += 2 {
+		for x := c.cur[i]; x < c.cur[i+1] && x < c.width; x++ {
+			dst[x>>3] |= 0x80 >> uint(x&7)
+		}
+	}
+}
+
+// decodeCCITT decompresses a strip or tile of the given size with the
+// CCITT scheme mode. options holds the T4Options or T6Options value.
+func decodeCCITT(src []byte, width, height int, mode ccittMode, options uint) ([]byte, error) {
+	if options&t4OptUncompressed != 0 {
+		return nil, UnsupportedError("CCITT uncompressed mode")
+	}
+	c := &ccittDecoder{
+		src:   src,
+		width: width,
+		ref:   []int{width, width, width},
+	}
+	rowLen := (width + 7) / 8
+	dst := make([]byte, rowLen*height)
+	for y := 0; y < height; y++ {
+		var err error
+		switch mode {
+		case ccittRLE:
+			err = c.decode1D()
+			c.alignByte()
+		case ccittT4:
+			c.skipEOL()
+			if options&t4Opt2D == 0 {
+				err = c.decode1D()
+				break
+			}
+			// In 2D coded files, a tag bit tells whether the line is
+			// coded one-dimensionally (1) or two-dimensionally (0).
+			var tag uint
+			if tag, err = c.readBit(); err != nil {
+				break
+			}
+			if tag == 1 {
+				err = c.decode1D()
+			} else {
+				err = c.decode2D()
+			}
+		case ccittT6:
+			err = c.decode2D()
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.putRow(dst[y*rowLen : (y+1)*rowLen])
+		c.ref, c.cur = c.cur, c.ref
+	}
+	return dst, nil
+}
+
+// reverseBits reverses the bit order of each byte of p, which converts
+// data with a FillOrder of 2 (least significant bit first) to the default
+// fill order.
+func reverseBits(p []byte) {
+	for i, b := range p {
+		b = b>>4 | b<<4
+		b = (b&0xcc)>>2 | (b&0x33)<<2
+		b = (b&0xaa)>>1 | (b&0x55)<<1
+		p[i] = b
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+// bitWriter packs code strings such as "0011" MSB first.
+type bitWriter struct {
+	buf  []byte
+	nbit int
+}
+
+func (w *bitWriter) writeCode(code string) {
+	for _, c := range code {
+		if w.nbit&7 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if c == '1' {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.nbit&7)
+		}
+		w.nbit++
+	}
+}
+
+func (w *bitWriter) align() {
+	w.nbit = (w.nbit + 7) &^ 7
+}
+
+func invertCodes(m map[string]int) map[int]string {
+	codes := make(map[int]string)
+	for k, v := range m {
+		codes[v] = k
+	}
+	return codes
+}
+
+var (
+	whiteEncodeCodes = invertCodes(mergeCodes(whiteCodes, extendedMakeupCodes))
+	blackEncodeCodes = invertCodes(mergeCodes(blackCodes, extendedMakeupCodes))
+)
+
+func (w *bitWriter) writeRun(color, run int) {
+	codes := whiteEncodeCodes
+	if color != 0 {
+		codes = blackEncodeCodes
+	}
+	for run >= 64 {
+		n := run
+		if n > 2560 {
+			n = 2560
+		}
+		n -= n % 64
+		w.writeCode(codes[n])
+		run -= n
+	}
+	w.writeCode(codes[run])
+}
+
+// changingElement returns the first x >= start where row changes to color,
+// or len(row). The pixel left of the row is white.
+func changingElement(row []int, start, color int) int {
+	if start < 0 {
+		start = 0
+	}
+	for x := start; x < len(row); x++ {
+		prev := 0
+		if x > 0 {
+			prev = row[x-1]
+		}
+		if row[x] == color && prev != color {
+			return x
+		}
+	}
+	return len(row)
+}
+
+func (w *bitWriter) encode1D(row []int) {
+	a0, color := 0, 0
+	for a0 < len(row) {
+		a1 := changingElement(row, a0, color^1)
+		w.writeRun(color, a1-a0)
+		a0, color = a1, color^1
+	}
+}
+
+func (w *bitWriter) encode2D(row, ref []int) {
+	a0, color := -1, 0
+	for a0 < len(row) {
+		a1 := changingElement(row, a0+1, color^1)
+		b1 := changingElement(ref, a0+1, color^1)
+		b2 := changingElement(ref, b1+1, color)
+		switch {
+		case b2 < a1:
+			w.writeCode("0001")
+			a0 = b2
+		case a1-b1 >= -3 && a1-b1 <= 3:
+			w.writeCode(map[int]string{
+				-3: "0000010", -2: "000010", -1: "010", 0: "1",
+				1: "011", 2: "000011", 3: "0000011",
+			}[a1-b1])
+			a0, color = a1, color^1
+		default:
+			if a0 < 0 {
+				a0 = 0
+			}
+			a2 := changingElement(row, a1+1, color)
+			w.writeCode("001")
+			w.writeRun(color, a1-a0)
+			w.writeRun(color^1, a2-a1)
+			a0 = a2
+		}
+	}
+}
+
+// encodeCCITT is the inverse of decodeCCITT. In the T.4 2D scheme, every
+// other line is coded two-dimensionally.
+func encodeCCITT(rows [][]int, mode ccittMode, options uint) []byte {
+	w := new(bitWriter)
+	ref := make([]int, len(rows[0]))
+	for y, row := range rows {
+		switch mode {
+		case ccittRLE:
+			w.encode1D(row)
+			w.align()
+		case ccittT4:
+			w.writeCode("000000000001")
+			if options&t4Opt2D == 0 {
+				w.encode1D(row)
+			} else if y%2 == 0 {
+				w.writeCode("1")
+				w.encode1D(row)
+			} else {
+				w.writeCode("0")
+				w.encode2D(row, ref)
+			}
+		case ccittT6:
+			w.encode2D(row, ref)
+		}
+		ref = row
+	}
+	return w.buf
+}
+
+// buildTIFF returns a single strip TIFF file holding data.
+func buildTIFF(t *testing.T, data []byte, ifd []ifdEntry) []byte {
+	ifd = append(ifd,
+		ifdEntry{tStripOffsets, dtLong, []uint64{8}},
+		ifdEntry{tStripByteCounts, dtLong, []uint64{uint64(len(data))}},
+	)
+	buf := new(bytes.Buffer)
+	ifdOffset := 8 + len(data)
+	if err := writeHeader(buf, false, ifdOffset); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(data)
+	if err := writeIFD(buf, ifdOffset, ifd, false, 0); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeCCITT(t *testing.T) {
+	img, err := load("bw-uncompressed.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := img.Bounds()
+	rows := make([][]int, b.Dy())
+	for y := range rows {
+		rows[y] = make([]int, b.Dx())
+		for x := range rows[y] {
+			if r, _, _, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA(); r < 0x8000 {
+				rows[y][x] = 1
+			}
+		}
+	}
+
+	tests := []struct {
+		compression uint32
+		mode        ccittMode
+		options     uint
+		photometric uint32
+		fillOrder   uint32
+	}{
+		{cCCITT, ccittRLE, 0, pWhiteIsZero, 1},
+		{cG3, ccittT4, 0, pWhiteIsZero, 1},
+		{cG3, ccittT4, t4Opt2D, pWhiteIsZero, 1},
+		{cG4, ccittT6, 0, pWhiteIsZero, 1},
+		{cG4, ccittT6, 0, pBlackIsZero, 1},
+		{cG4, ccittT6, 0, pWhiteIsZero, 2},
+	}
+	for _, tt := range tests {
+		data := encodeCCITT(rows, tt.mode, tt.options)
+		if tt.fillOrder == 2 {
+			reverseBits(data)
+		}
+		ifd := []ifdEntry{
+			{tImageWidth, dtShort, []uint64{uint64(b.Dx())}},
+			{tImageLength, dtShort, []uint64{uint64(b.Dy())}},
+			{tBitsPerSample, dtShort, []uint64{1}},
+			{tCompression, dtShort, []uint64{uint64(tt.compression)}},
+			{tPhotometricInterpretation, dtShort, []uint64{uint64(tt.photometric)}},
+			{tFillOrder, dtShort, []uint64{uint64(tt.fillOrder)}},
+			{tRowsPerStrip, dtShort, []uint64{uint64(b.Dy())}},
+		}
+		switch tt.compression {
+		case cG3:
+			ifd = append(ifd, ifdEntry{tT4Options, dtLong, []uint64{uint64(tt.options)}})
+		case cG4:
+			ifd = append(ifd, ifdEntry{tT6Options, dtLong, []uint64{uint64(tt.options)}})
+		}
+		img1, err := Decode(bytes.NewReader(buildTIFF(t, data, ifd)))
+		if err != nil {
+			t.Fatalf("compression %d, options %d: %v", tt.compression, tt.options, err)
+		}
+		if tt.photometric == pBlackIsZero {
+			// The same bits stand for the opposite colors.
+			inv := img1.(*image.Gray)
+			for i := range inv.Pix {
+				inv.Pix[i] = ^inv.Pix[i]
+			}
+		}
+		compare(t, img, img1)
+	}
+}
+
+func TestDecodeCCITTLibtiff(t *testing.T) {
+	// The strips as written by libtiff 4.5.0 for a 16x4 bitmap, whose set
+	// bits are black.
+	want := []byte{0x0f, 0xf0, 0x3c, 0x3c, 0x00, 0x00, 0xff, 0x81}
+	for _, tt := range []struct {
+		src     string
+		mode    ccittMode
+		options uint
+	}{
+		{"\x00\x1b\x16\xc0\x05\xdd\xb7\x00\x1a\x80\x04\xd4\x4e\x40", ccittT4, 0},
+		{"\x00\x1d\x8b\x60\x02\x08\xbb\x0e\x00\x3a\x80\x04\x4d\x44\x50", ccittT4, t4Opt2D},
+		{"\x36\x2c\x22\xec\x38\x8c\x9a\x88\xa0\x02\x00\x20", ccittT6, 0},
+	} {
+		dst, err := decodeCCITT([]byte(tt.src), 16, 4, tt.mode, tt.options)
+		if err != nil {
+			t.Fatalf("mode %d, options %d: %v", tt.mode, tt.options, err)
+		}
+		if !bytes.Equal(dst, want) {
+			t.Fatalf("mode %d, options %d: got %x, want %x", tt.mode, tt.options, dst, want)
+		}
+	}
+
+	// The same files as bw-uncompressed.tiff, converted by libtiff.
+	img, err := load("bw-uncompressed.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bw-ccitt-rle.tiff", "bw-ccitt-g3-1d.tiff", "bw-ccitt-g3-2d.tiff", "bw-ccitt-g4.tiff"} {
+		img1, err := load(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		compare(t, img, img1)
+	}
+}
+
+func TestDecodeCCITTWhite(t *testing.T) {
+	// Each all-white line of a Group 4 image is a single V0 code.
+	dst, err := decodeCCITT([]byte{0xff}, 8, 8, ccittT6, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst, make([]byte, 8)) {
+		t.Fatalf("got %x, want all white", dst)
+	}
+}
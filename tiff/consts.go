@@ -14,38 +14,63 @@ package tiff
 //  - the data itself or a pointer to it if it is more than 4 bytes.
 //
 // The presence of a length means that each IFD is effectively an array.
+//
+// BigTIFF (version 43) uses the same layout with 64-bit counts and offsets:
+// the header is 16 bytes long, the IFD entry count is a uint64 and each
+// entry is 20 bytes, leaving 8 bytes for the inline data or its offset.
+// See http://www.awaresystems.be/imaging/tiff/bigtiff.html.
 
 const (
 	leHeader = "II\x2A\x00" // Header for little-endian files.
 	beHeader = "MM\x00\x2A" // Header for big-endian files.
 
-	ifdLen = 12 // Length of an IFD entry in bytes.
+	leBigHeader = "II\x2B\x00" // Header for little-endian BigTIFF files.
+	beBigHeader = "MM\x00\x2B" // Header for big-endian BigTIFF files.
+
+	ifdLen    = 12 // Length of an IFD entry in bytes.
+	bigIfdLen = 20 // Length of a BigTIFF IFD entry in bytes.
 )
 
 // Data types (p. 14-16 of the spec).
 const (
-	dtByte     = 1
-	dtASCII    = 2
-	dtShort    = 3
-	dtLong     = 4
-	dtRational = 5
+	dtByte      = 1
+	dtASCII     = 2
+	dtShort     = 3
+	dtLong      = 4
+	dtRational  = 5
+	dtSByte     = 6
+	dtUndefined = 7
+	dtSShort    = 8
+	dtSLong     = 9
+	dtSRational = 10
+	dtFloat     = 11
+	dtDouble    = 12
+	dtIFD       = 13
+	dtLong8     = 16 // BigTIFF only.
+	dtSLong8    = 17 // BigTIFF only.
+	dtIFD8      = 18 // BigTIFF only.
 )
 
 // The length of one instance of each data type in bytes.
-var lengths = [...]uint32{0, 1, 1, 2, 4, 8}
+var lengths = [...]uint32{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8, 4, 0, 0, 8, 8, 8}
 
 // Tags (see p. 28-41 of the spec).
 const (
+	tNewSubfileType            = 254
 	tImageWidth                = 256
 	tImageLength               = 257
 	tBitsPerSample             = 258
 	tCompression               = 259
 	tPhotometricInterpretation = 262
+	tFillOrder                 = 266
 
-	tStripOffsets    = 273
-	tSamplesPerPixel = 277
-	tRowsPerStrip    = 278
-	tStripByteCounts = 279
+	tStripOffsets        = 273
+	tSamplesPerPixel     = 277
+	tRowsPerStrip        = 278
+	tStripByteCounts     = 279
+	tPlanarConfiguration = 284
+	tFreeOffsets         = 288
+	tFreeByteCounts      = 289
 
 	tTileWidth      = 322
 	tTileLength     = 323
@@ -56,10 +81,28 @@ const (
 	tYResolution    = 283
 	tResolutionUnit = 296
 
+	tT4Options = 292
+	tT6Options = 293
+
 	tPredictor    = 317
 	tColorMap     = 320
+	tSubIFDs      = 330
+	tInkSet       = 332
 	tExtraSamples = 338
 	tSampleFormat = 339
+	tJPEGTables   = 347
+
+	tYCbCrCoefficients   = 529
+	tYCbCrSubSampling    = 530
+	tYCbCrPositioning    = 531
+	tReferenceBlackWhite = 532
+)
+
+// Bits of the tNewSubfileType tag (page 36).
+const (
+	sfReducedImage = 1 << 0 // Reduced-resolution version of another image.
+	sfPage         = 1 << 1 // Single page of a multi-page image.
+	sfMask         = 1 << 2 // Transparency mask for another image.
 )
 
 // Compression types (defined in various places in the spec and supplements).
@@ -88,6 +131,12 @@ const (
 	pCIELab      = 8
 )
 
+// Values for the tInkSet tag (page 70).
+const (
+	inkCMYK    = 1
+	inkNotCMYK = 2
+)
+
 // Values for the tPredictor tag (page 64-65 of the spec).
 const (
 	prNone       = 1
@@ -112,6 +161,24 @@ const (
 	mRGB
 	mRGBA
 	mNRGBA
+	mCMYK
+	mYCbCr
+	mCIELab
+)
+
+// BigTIFFMode describes when Encode writes a BigTIFF file instead of a
+// classic TIFF file.
+type BigTIFFMode int
+
+const (
+	// AutoBigTIFF writes a BigTIFF file only when the output would not
+	// be addressable with the 32-bit offsets of a classic TIFF file.
+	AutoBigTIFF BigTIFFMode = iota
+	// NeverBigTIFF always writes a classic TIFF file. Encode fails if
+	// the output would exceed the 32-bit limit.
+	NeverBigTIFF
+	// AlwaysBigTIFF always writes a BigTIFF file.
+	AlwaysBigTIFF
 )
 
 // CompressionType describes the type of compression used in Options.
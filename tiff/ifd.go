@@ -0,0 +1,487 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// A DataType is the type of the values of a field (page 15-16 of the spec).
+type DataType uint16
+
+const (
+	TypeByte      DataType = dtByte
+	TypeASCII     DataType = dtASCII
+	TypeShort     DataType = dtShort
+	TypeLong      DataType = dtLong
+	TypeRational  DataType = dtRational
+	TypeSByte     DataType = dtSByte
+	TypeUndefined DataType = dtUndefined
+	TypeSShort    DataType = dtSShort
+	TypeSLong     DataType = dtSLong
+	TypeSRational DataType = dtSRational
+	TypeFloat     DataType = dtFloat
+	TypeDouble    DataType = dtDouble
+	TypeIFD       DataType = dtIFD
+	TypeLong8     DataType = dtLong8  // BigTIFF only.
+	TypeSLong8    DataType = dtSLong8 // BigTIFF only.
+	TypeIFD8      DataType = dtIFD8   // BigTIFF only.
+)
+
+// Tags of commonly used metadata fields. Any other tag number may be used
+// in a Field as well.
+const (
+	TagImageDescription = 270
+	TagMake             = 271
+	TagModel            = 272
+	TagXResolution      = tXResolution
+	TagYResolution      = tYResolution
+	TagResolutionUnit   = tResolutionUnit
+	TagSoftware         = 305
+	TagDateTime         = 306
+	TagArtist           = 315
+	TagCopyright        = 33432
+
+	// GeoTIFF tags.
+	TagModelPixelScale     = 33550
+	TagModelTiepoint       = 33922
+	TagModelTransformation = 34264
+	TagGeoKeyDirectory     = 34735
+	TagGeoDoubleParams     = 34736
+	TagGeoASCIIParams      = 34737
+)
+
+// A Field is an entry of an IFD: a tag with its values.
+//
+// The Go type of Value depends on Type:
+//
+//	TypeByte, TypeUndefined  []uint8
+//	TypeASCII                string
+//	TypeShort                []uint16
+//	TypeLong, TypeIFD        []uint32
+//	TypeLong8, TypeIFD8      []uint64
+//	TypeSByte                []int8
+//	TypeSShort               []int16
+//	TypeSLong                []int32
+//	TypeSLong8               []int64
+//	TypeRational             [][2]uint32
+//	TypeSRational            [][2]int32
+//	TypeFloat                []float32
+//	TypeDouble               []float64
+//
+// Rational values are stored as numerator and denominator pairs. An ASCII
+// value does not include the terminating NUL byte, but may contain NUL
+// bytes separating several strings.
+type Field struct {
+	Tag   uint16
+	Type  DataType
+	Value interface{}
+}
+
+// Float64s returns the values of a numeric field converted to float64,
+// or nil if f holds ASCII or undefined data.
+func (f Field) Float64s() []float64 {
+	var v []float64
+	switch x := f.Value.(type) {
+	case []uint8:
+		if f.Type == TypeUndefined {
+			return nil
+		}
+		for _, e := range x {
+			v = append(v, float64(e))
+		}
+	case []uint16:
+		for _, e := range x {
+			v = append(v, float64(e))
+		}
+	case []uint32:
+		for _, e := range x {
+			v = append(v, float64(e))
+		}
+	case []uint64:
+		for _, e := range x {
+			v = append(v, float64(e))
+		}
+	case []int8:
+		for _, e := range x {
+			v = append(v, float64(e))
+		}
+	case []int16:
+		for _, e := range x {
+			v = append(v, float64(e))
+		}
+	case []int32:
+		for _, e := range x {
+			v = append(v, float64(e))
+		}
+	case []int64:
+		for _, e := range x {
+			v = append(v, float64(e))
+		}
+	case [][2]uint32:
+		for _, e := range x {
+			v = append(v, float64(e[0])/float64(e[1]))
+		}
+	case [][2]int32:
+		for _, e := range x {
+			v = append(v, float64(e[0])/float64(e[1]))
+		}
+	case []float32:
+		for _, e := range x {
+			v = append(v, float64(e))
+		}
+	case []float64:
+		v = append(v, x...)
+	}
+	return v
+}
+
+// An IFD is an image file directory, the list of fields describing an
+// image, in ascending tag order.
+type IFD []Field
+
+// Lookup returns the field of ifd with the given tag.
+func (ifd IFD) Lookup(tag uint16) (Field, bool) {
+	for _, f := range ifd {
+		if f.Tag == tag {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// ifdField decodes the IFD entry in p. Fields of a data type unknown to
+// the decoder are returned with a nil Value.
+func (d *decoder) ifdField(p []byte) (Field, error) {
+	f := Field{
+		Tag:  d.byteOrder.Uint16(p[0:2]),
+		Type: DataType(d.byteOrder.Uint16(p[2:4])),
+	}
+	datatype, count, raw, err := d.ifdRaw(p)
+	if err != nil {
+		if _, ok := err.(UnsupportedError); ok {
+			return f, nil
+		}
+		return Field{}, err
+	}
+
+	n := int(count)
+	switch datatype {
+	case dtByte, dtUndefined:
+		f.Value = append([]uint8(nil), raw...)
+	case dtASCII:
+		f.Value = strings.TrimSuffix(string(raw), "\x00")
+	case dtShort:
+		v := make([]uint16, n)
+		for i := range v {
+			v[i] = d.byteOrder.Uint16(raw[2*i:])
+		}
+		f.Value = v
+	case dtLong, dtIFD:
+		v := make([]uint32, n)
+		for i := range v {
+			v[i] = d.byteOrder.Uint32(raw[4*i:])
+		}
+		f.Value = v
+	case dtLong8, dtIFD8:
+		v := make([]uint64, n)
+		for i := range v {
+			v[i] = d.byteOrder.Uint64(raw[8*i:])
+		}
+		f.Value = v
+	case dtSByte:
+		v := make([]int8, n)
+		for i := range v {
+			v[i] = int8(raw[i])
+		}
+		f.Value = v
+	case dtSShort:
+		v := make([]int16, n)
+		for i := range v {
+			v[i] = int16(d.byteOrder.Uint16(raw[2*i:]))
+		}
+		f.Value = v
+	case dtSLong:
+		v := make([]int32, n)
+		for i := range v {
+			v[i] = int32(d.byteOrder.Uint32(raw[4*i:]))
+		}
+		f.Value = v
+	case dtSLong8:
+		v := make([]int64, n)
+		for i := range v {
+			v[i] = int64(d.byteOrder.Uint64(raw[8*i:]))
+		}
+		f.Value = v
+	case dtRational:
+		v := make([][2]uint32, n)
+		for i := range v {
+			v[i] = [2]uint32{d.byteOrder.Uint32(raw[8*i:]), d.byteOrder.Uint32(raw[8*i+4:])}
+		}
+		f.Value = v
+	case dtSRational:
+		v := make([][2]int32, n)
+		for i := range v {
+			v[i] = [2]int32{int32(d.byteOrder.Uint32(raw[8*i:])), int32(d.byteOrder.Uint32(raw[8*i+4:]))}
+		}
+		f.Value = v
+	case dtFloat:
+		v := make([]float32, n)
+		for i := range v {
+			v[i] = math.Float32frombits(d.byteOrder.Uint32(raw[4*i:]))
+		}
+		f.Value = v
+	case dtDouble:
+		v := make([]float64, n)
+		for i := range v {
+			v[i] = math.Float64frombits(d.byteOrder.Uint64(raw[8*i:]))
+		}
+		f.Value = v
+	}
+	return f, nil
+}
+
+// readFields reads all fields of the IFD at ifdOffset. It returns the
+// offset of the next IFD, or 0 if it is the last one.
+func (d *decoder) readFields(ifdOffset int64) (IFD, int64, error) {
+	p, next, err := d.ifdEntries(ifdOffset)
+	if err != nil {
+		return nil, 0, err
+	}
+	entryLen := d.ifdEntryLen()
+	ifd := make(IFD, 0, len(p)/entryLen)
+	for i := 0; i < len(p); i += entryLen {
+		f, err := d.ifdField(p[i : i+entryLen])
+		if err != nil {
+			return nil, 0, err
+		}
+		ifd = append(ifd, f)
+	}
+	return ifd, next, nil
+}
+
+// DecodeIFDs reads all IFDs of the chain of IFDs of a TIFF file, in file
+// order. The first IFD describes the image returned by Decode. The IFDs
+// listed in a SubIFDs field are not read.
+func DecodeIFDs(r io.Reader) ([]IFD, error) {
+	d := &decoder{
+		r: newReaderAt(r),
+	}
+	offset, err := d.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	var ifds []IFD
+	seen := make(map[int64]bool)
+	for offset != 0 && !seen[offset] {
+		seen[offset] = true
+		ifd, next, err := d.readFields(offset)
+		if err != nil {
+			return nil, err
+		}
+		ifds = append(ifds, ifd)
+		offset = next
+	}
+	return ifds, nil
+}
+
+// DecodeIFD reads the first IFD of a TIFF file, which describes the image
+// returned by Decode.
+func DecodeIFD(r io.Reader) (IFD, error) {
+	d := &decoder{
+		r: newReaderAt(r),
+	}
+	offset, err := d.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	ifd, _, err := d.readFields(offset)
+	return ifd, err
+}
+
+// layoutTags are the tags describing the layout of the pixel data. The
+// encoder writes them itself and ignores them in Options.Fields.
+var layoutTags = map[uint16]bool{
+	tNewSubfileType:            true,
+	tImageWidth:                true,
+	tImageLength:               true,
+	tBitsPerSample:             true,
+	tCompression:               true,
+	tPhotometricInterpretation: true,
+	tFillOrder:                 true,
+	tStripOffsets:              true,
+	tSamplesPerPixel:           true,
+	tRowsPerStrip:              true,
+	tStripByteCounts:           true,
+	tPlanarConfiguration:       true,
+	tFreeOffsets:               true,
+	tFreeByteCounts:            true,
+	tT4Options:                 true,
+	tT6Options:                 true,
+	tPredictor:                 true,
+	tColorMap:                  true,
+	tTileWidth:                 true,
+	tTileLength:                true,
+	tTileOffsets:               true,
+	tTileByteCounts:            true,
+	tSubIFDs:                   true,
+	tInkSet:                    true,
+	tExtraSamples:              true,
+	tSampleFormat:              true,
+	tJPEGTables:                true,
+	tYCbCrCoefficients:         true,
+	tYCbCrSubSampling:          true,
+	tYCbCrPositioning:          true,
+	tReferenceBlackWhite:       true,
+}
+
+// Tags of the fields holding the offset of another IFD, as in the Exif
+// and GPS metadata.
+const (
+	tagExifIFD    = 34665
+	tagGPSIFD     = 34853
+	tagInteropIFD = 40965
+)
+
+// isPointerField reports whether f holds the offset of another IFD. The
+// offset is only meaningful in the file the field was read from.
+func isPointerField(f Field) bool {
+	switch f.Tag {
+	case tagExifIFD, tagGPSIFD, tagInteropIFD:
+		return true
+	}
+	return f.Type == TypeIFD || f.Type == TypeIFD8
+}
+
+// errFieldValue returns the error for a field whose Value does not match
+// its Type.
+func errFieldValue(f Field) error {
+	return FormatError(fmt.Sprintf("field %d: value of type %T for data type %d", f.Tag, f.Value, f.Type))
+}
+
+// ifdEntry converts f to the IFD entry written by the encoder.
+func (f Field) ifdEntry() (ifdEntry, error) {
+	e := ifdEntry{tag: int(f.Tag), datatype: int(f.Type)}
+	ok := true
+	switch x := f.Value.(type) {
+	case []uint8:
+		ok = f.Type == TypeByte || f.Type == TypeUndefined
+		for _, v := range x {
+			e.data = append(e.data, uint64(v))
+		}
+	case string:
+		ok = f.Type == TypeASCII
+		for i := 0; i < len(x); i++ {
+			e.data = append(e.data, uint64(x[i]))
+		}
+		e.data = append(e.data, 0)
+	case []uint16:
+		ok = f.Type == TypeShort
+		for _, v := range x {
+			e.data = append(e.data, uint64(v))
+		}
+	case []uint32:
+		ok = f.Type == TypeLong || f.Type == TypeIFD
+		for _, v := range x {
+			e.data = append(e.data, uint64(v))
+		}
+	case []uint64:
+		ok = f.Type == TypeLong8 || f.Type == TypeIFD8
+		e.data = append(e.data, x...)
+	case []int8:
+		ok = f.Type == TypeSByte
+		for _, v := range x {
+			e.data = append(e.data, uint64(uint8(v)))
+		}
+	case []int16:
+		ok = f.Type == TypeSShort
+		for _, v := range x {
+			e.data = append(e.data, uint64(uint16(v)))
+		}
+	case []int32:
+		ok = f.Type == TypeSLong
+		for _, v := range x {
+			e.data = append(e.data, uint64(uint32(v)))
+		}
+	case []int64:
+		ok = f.Type == TypeSLong8
+		for _, v := range x {
+			e.data = append(e.data, uint64(v))
+		}
+	case [][2]uint32:
+		ok = f.Type == TypeRational
+		for _, v := range x {
+			e.data = append(e.data, uint64(v[0]), uint64(v[1]))
+		}
+	case [][2]int32:
+		ok = f.Type == TypeSRational
+		for _, v := range x {
+			e.data = append(e.data, uint64(uint32(v[0])), uint64(uint32(v[1])))
+		}
+	case []float32:
+		ok = f.Type == TypeFloat
+		for _, v := range x {
+			e.data = append(e.data, uint64(math.Float32bits(v)))
+		}
+	case []float64:
+		ok = f.Type == TypeDouble
+		for _, v := range x {
+			e.data = append(e.data, math.Float64bits(v))
+		}
+	default:
+		ok = false
+	}
+	if !ok {
+		return ifdEntry{}, errFieldValue(f)
+	}
+	return e, nil
+}
+
+// addFields returns ifd with the entries of fields added. A field replaces
+// an entry of ifd with the same tag, except for the layout tags, the
+// pointers to other IFDs and the fields of an unknown data type, which are
+// skipped. BigTIFF data types are only allowed if bigTIFF is set.
+func addFields(ifd []ifdEntry, fields IFD, bigTIFF bool) ([]ifdEntry, error) {
+	for _, f := range fields {
+		if layoutTags[f.Tag] || isPointerField(f) || f.Value == nil {
+			continue
+		}
+		switch f.Type {
+		case TypeLong8, TypeSLong8, TypeIFD8:
+			if !bigTIFF {
+				return nil, UnsupportedError(fmt.Sprintf("field %d: BigTIFF data type in a classic TIFF file", f.Tag))
+			}
+		}
+		e, err := f.ifdEntry()
+		if err != nil {
+			return nil, err
+		}
+		replaced := false
+		for i := range ifd {
+			if ifd[i].tag == e.tag {
+				ifd[i], replaced = e, true
+			}
+		}
+		if !replaced {
+			ifd = append(ifd, e)
+		}
+	}
+	return ifd, nil
+}
+
+// fieldsLength returns an upper bound of the number of bytes added to an
+// IFD by addFields.
+func fieldsLength(fields IFD) int {
+	n := 0
+	for _, f := range fields {
+		if e, err := f.ifdEntry(); err == nil {
+			n += bigIfdLen + e.count()*int(lengths[e.datatype])
+		}
+	}
+	return n
+}
@@ -0,0 +1,172 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+var testFields = IFD{
+	{TagImageDescription, TypeASCII, "test image"},
+	{TagXResolution, TypeRational, [][2]uint32{{300, 1}}},
+	{TagYResolution, TypeRational, [][2]uint32{{300, 1}}},
+	{TagSoftware, TypeASCII, "tiff\x00test"},
+	{TagDateTime, TypeASCII, "2014:01:02 03:04:05"},
+	{TagModelPixelScale, TypeDouble, []float64{0.5, 0.5, 0}},
+	{TagModelTiepoint, TypeDouble, []float64{0, 0, 0, 440720, 3751320, 0}},
+	{TagGeoKeyDirectory, TypeShort, []uint16{1, 1, 0, 1, 1024, 0, 1, 1}},
+	{TagGeoASCIIParams, TypeASCII, "WGS 84|"},
+	{40000, TypeSByte, []int8{-1, 2}},
+	{40001, TypeUndefined, []uint8{1, 2, 3, 4, 5}},
+	{40002, TypeSShort, []int16{-300}},
+	{40003, TypeSLong, []int32{-70000, 70000}},
+	{40004, TypeSRational, [][2]int32{{-1, 3}}},
+	{40005, TypeFloat, []float32{1.5, -2.25}},
+	{40006, TypeLong, []uint32{1 << 20}},
+	{40007, TypeByte, []uint8{7}},
+}
+
+func TestEncodeFields(t *testing.T) {
+	img, err := openImage("video-001.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := append(testFields, Field{tImageWidth, TypeShort, []uint16{1}})
+	for _, mode := range []BigTIFFMode{NeverBigTIFF, AlwaysBigTIFF} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img, &Options{Fields: fields, BigTIFF: mode}); err != nil {
+			t.Fatal(err)
+		}
+		ifd, err := DecodeIFD(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range testFields {
+			got, ok := ifd.Lookup(want.Tag)
+			if !ok {
+				t.Fatalf("field %d is missing", want.Tag)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("field %d: got %v, want %v", want.Tag, got, want)
+			}
+		}
+		// Layout fields are written by the encoder.
+		if f, _ := ifd.Lookup(tImageWidth); f.Float64s()[0] != float64(img.Bounds().Dx()) {
+			t.Fatalf("got ImageWidth %v, want %d", f.Value, img.Bounds().Dx())
+		}
+
+		// The decoded IFD passes through the encoder.
+		img0, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf2 bytes.Buffer
+		if err := Encode(&buf2, img0, &Options{Fields: ifd, BigTIFF: mode}); err != nil {
+			t.Fatal(err)
+		}
+		ifd2, err := DecodeIFD(bytes.NewReader(buf2.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ifd, ifd2) {
+			t.Fatalf("got %v, want %v", ifd2, ifd)
+		}
+	}
+}
+
+func TestEncodeFieldsExif(t *testing.T) {
+	// A file written by libtiff 4.5.0 with an Exif IFD.
+	data, err := ioutil.ReadFile(testdataDir + "gray-exif.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifd, err := DecodeIFD(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := ifd.Lookup(tagExifIFD); !ok || f.Type != TypeIFD {
+		t.Fatalf("got ExifIFD field %v", f)
+	}
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A field of an unknown data type is decoded with a nil Value.
+	fields := append(ifd, Field{40000, 99, nil})
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, &Options{Fields: fields}); err != nil {
+		t.Fatal(err)
+	}
+	ifd2, err := DecodeIFD(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []uint16{tagExifIFD, 40000} {
+		if f, ok := ifd2.Lookup(tag); ok {
+			t.Fatalf("got field %v", f)
+		}
+	}
+	for _, tag := range []uint16{TagImageDescription, TagSoftware} {
+		f, _ := ifd.Lookup(tag)
+		if f2, _ := ifd2.Lookup(tag); !reflect.DeepEqual(f, f2) {
+			t.Fatalf("got %v, want %v", f2, f)
+		}
+	}
+	img2, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, img, img2)
+}
+
+func TestEncodeFieldsErrors(t *testing.T) {
+	img, err := openImage("video-001-gray.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []Field{
+		{TagSoftware, TypeShort, "test"},
+		{TagSoftware, TypeASCII, 1},
+		{40000, TypeLong8, []uint64{1}},
+	} {
+		err := Encode(new(bytes.Buffer), img, &Options{Fields: IFD{f}, BigTIFF: NeverBigTIFF})
+		if err == nil {
+			t.Fatalf("encoding field %v succeeded", f)
+		}
+	}
+	err = Encode(new(bytes.Buffer), img, &Options{
+		Fields:  IFD{{40000, TypeLong8, []uint64{1}}},
+		BigTIFF: AlwaysBigTIFF,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeIFDs(t *testing.T) {
+	img, err := openImage("video-001.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := EncodePyramid(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	ifds, err := DecodeIFDs(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reduced-resolution levels are SubIFDs of the first IFD.
+	if len(ifds) != 1 {
+		t.Fatalf("got %d IFDs, want 1", len(ifds))
+	}
+	f, ok := ifds[0].Lookup(tSubIFDs)
+	if !ok || f.Type != TypeIFD {
+		t.Fatalf("got SubIFDs field %v", f)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+
+	"github.com/chai2010/image/jpeg"
+)
+
+// JPEG markers used to splice JPEGTables into a strip or tile.
+const (
+	jpegSOI = "\xff\xd8"
+	jpegEOI = "\xff\xd9"
+)
+
+// mergeJPEGTables returns the JPEG stream of a strip or tile that uses the
+// quantization and Huffman tables stored in the JPEGTables tag.
+//
+// JPEGTables holds an abbreviated JPEG stream made of SOI, the table
+// segments and EOI (TIFF Technical Note 2). Inserting the tables between
+// the SOI of the strip and its remaining segments gives a complete stream.
+func mergeJPEGTables(tables, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(tables, []byte(jpegSOI)) || !bytes.HasPrefix(data, []byte(jpegSOI)) {
+		return nil, FormatError("missing JPEG SOI marker")
+	}
+	tables = bytes.TrimSuffix(tables, []byte(jpegEOI))
+	buf := make([]byte, 0, len(tables)+len(data)-2)
+	buf = append(buf, tables...)
+	buf = append(buf, data[2:]...)
+	return buf, nil
+}
+
+// decodeJPEG decodes a JPEG compressed strip or tile and draws it into
+// dst with its top-left corner at (xmin, ymin).
+func (d *decoder) decodeJPEG(dst draw.Image, data []byte, xmin, ymin int) error {
+	if len(d.jpegTables) != 0 {
+		var err error
+		if data, err = mergeJPEGTables(d.jpegTables, data); err != nil {
+			return err
+		}
+	}
+	m, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	b := m.Bounds()
+	draw.Draw(dst, image.Rect(xmin, ymin, xmin+b.Dx(), ymin+b.Dy()), m, b.Min, draw.Src)
+	return nil
+}
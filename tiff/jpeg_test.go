@@ -0,0 +1,84 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io/ioutil"
+	"testing"
+)
+
+// splitJPEGTables moves the quantization and Huffman tables of a JPEG
+// stream to an abbreviated table specification stream.
+func splitJPEGTables(t *testing.T, data []byte) (tables, strip []byte) {
+	tables = []byte(jpegSOI)
+	strip = []byte(jpegSOI)
+	p := 2
+	for {
+		if p+4 > len(data) || data[p] != 0xff {
+			t.Fatalf("invalid JPEG segment at %d", p)
+		}
+		n := 2 + (int(data[p+2])<<8 | int(data[p+3]))
+		if data[p+1] == 0xda {
+			strip = append(strip, data[p:]...)
+			break
+		}
+		if data[p+1] == 0xdb || data[p+1] == 0xc4 {
+			tables = append(tables, data[p:p+n]...)
+		} else {
+			strip = append(strip, data[p:p+n]...)
+		}
+		p += n
+	}
+	return append(tables, jpegEOI...), strip
+}
+
+func TestDecodeJPEG(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "video-001.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := m.Bounds()
+	want := image.NewRGBA(b)
+	draw.Draw(want, b, m, b.Min, draw.Src)
+
+	ifd := []ifdEntry{
+		{tImageWidth, dtShort, []uint64{uint64(b.Dx())}},
+		{tImageLength, dtShort, []uint64{uint64(b.Dy())}},
+		{tBitsPerSample, dtShort, []uint64{8, 8, 8}},
+		{tSamplesPerPixel, dtShort, []uint64{3}},
+		{tCompression, dtShort, []uint64{cJPEG}},
+		{tPhotometricInterpretation, dtShort, []uint64{pYCbCr}},
+		{tRowsPerStrip, dtShort, []uint64{uint64(b.Dy())}},
+	}
+	img, err := Decode(bytes.NewReader(buildTIFF(t, data, ifd)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, want, img)
+
+	tables, strip := splitJPEGTables(t, data)
+	ifd = append(ifd[:len(ifd):len(ifd)], ifdEntry{tJPEGTables, dtByte, bytesToUint64s(tables)})
+	img, err = Decode(bytes.NewReader(buildTIFF(t, strip, ifd)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, want, img)
+}
+
+func bytesToUint64s(p []byte) []uint64 {
+	v := make([]uint64, len(p))
+	for i, b := range p {
+		v[i] = uint64(b)
+	}
+	return v
+}
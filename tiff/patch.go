@@ -46,7 +46,7 @@ func init() {
 	imageExt.RegisterFormat(imageExt.Format{
 		Name:         "tiff",
 		Extensions:   []string{".tiff", ".tif"},
-		Magics:       []string{leHeader, beHeader},
+		Magics:       []string{leHeader, beHeader, leBigHeader, beBigHeader},
 		DecodeConfig: DecodeConfig,
 		Decode:       Decode,
 		Encode:       imageExtEncode,
@@ -0,0 +1,182 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// A pyramidal TIFF file stores a full-resolution image together with
+// reduced-resolution copies of it. The reduced images are either listed
+// in the SubIFDs tag of the full-resolution IFD, or stored as further
+// IFDs of the file that have the reduced-image bit of NewSubfileType set.
+
+// levelOffsets returns the IFD offsets of the resolution levels of the
+// file, starting with the full-resolution image.
+func (d *decoder) levelOffsets() ([]int64, error) {
+	first, err := d.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	next, err := d.readIFD(first)
+	if err != nil {
+		return nil, err
+	}
+	offsets := []int64{first}
+	for _, v := range d.features[tSubIFDs] {
+		offsets = append(offsets, int64(v))
+	}
+
+	// Guard against IFD chains that loop back on themselves.
+	seen := map[int64]bool{first: true}
+	for next != 0 && !seen[next] {
+		seen[next] = true
+		offset := next
+		if next, err = d.readIFD(offset); err != nil {
+			return nil, err
+		}
+		if d.firstVal(tNewSubfileType)&sfReducedImage != 0 {
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets, nil
+}
+
+// levels returns the decoders of all resolution levels of the file,
+// ordered from the largest to the smallest image.
+func levels(r io.Reader) ([]*decoder, error) {
+	ra := newReaderAt(r)
+	offsets, err := (&decoder{r: ra}).levelOffsets()
+	if err != nil {
+		return nil, err
+	}
+	ds := make([]*decoder, len(offsets))
+	for i, offset := range offsets {
+		d := &decoder{r: ra}
+		if _, err := d.readHeader(); err != nil {
+			return nil, err
+		}
+		if _, err := d.readIFD(offset); err != nil {
+			return nil, err
+		}
+		if err := d.parseConfig(); err != nil {
+			return nil, err
+		}
+		ds[i] = d
+	}
+	sort.Stable(byArea(ds[1:]))
+	return ds, nil
+}
+
+type byArea []*decoder
+
+func (d byArea) Len() int { return len(d) }
+func (d byArea) Less(i, j int) bool {
+	return d[i].config.Width*d[i].config.Height > d[j].config.Width*d[j].config.Height
+}
+func (d byArea) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+
+// DecodeLevels returns the color model and dimensions of every resolution
+// level of a TIFF image without decoding the images. Level 0 is the
+// full-resolution image; the reduced-resolution levels follow, ordered
+// from the largest to the smallest one.
+func DecodeLevels(r io.Reader) ([]image.Config, error) {
+	ds, err := levels(r)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]image.Config, len(ds))
+	for i, d := range ds {
+		configs[i] = d.config
+	}
+	return configs, nil
+}
+
+// DecodeLevel reads the given resolution level of a TIFF image from r and
+// returns it as an image.Image. Levels are numbered as by DecodeLevels.
+func DecodeLevel(r io.Reader, level int) (image.Image, error) {
+	ds, err := levels(r)
+	if err != nil {
+		return nil, err
+	}
+	if level < 0 || level >= len(ds) {
+		return nil, FormatError("resolution level out of range")
+	}
+	return ds[level].decodeImage()
+}
+
+// EncodePyramid writes the image m to w together with a power-of-two
+// pyramid of reduced-resolution copies of it. Each level is half the width
+// and height of the previous one, down to a single pixel, and is stored as
+// a SubIFD of the full-resolution image. opt is used as in Encode.
+//
+// All levels are written in the same format. Gray, Gray16, RGBA, RGBA64,
+// NRGBA and NRGBA64 images keep their format; other images, including
+// Paletted images, are converted to NRGBA or RGBA first.
+func EncodePyramid(w io.Writer, m image.Image, opt *Options) error {
+	m = pyramidBase(m)
+	var reduced []image.Image
+	for level := m; level.Bounds().Dx() > 1 || level.Bounds().Dy() > 1; {
+		level = downsample(level)
+		reduced = append(reduced, level)
+	}
+	return encodeLevels(w, m, reduced, opt)
+}
+
+// pyramidBase returns m converted to an image whose samples are written
+// directly by encodePixels and can be downsampled in the same format.
+func pyramidBase(m image.Image) image.Image {
+	switch m.(type) {
+	case *image.Gray, *image.Gray16, *image.RGBA, *image.RGBA64, *image.NRGBA, *image.NRGBA64:
+		return m
+	}
+	b := m.Bounds()
+	var dst draw.Image
+	if _, ok := m.(*image.Paletted); ok {
+		dst = image.NewNRGBA(b)
+	} else {
+		// The other images are written as RGBA by encodePixels.
+		dst = image.NewRGBA(b)
+	}
+	draw.Draw(dst, b, m, b.Min, draw.Src)
+	return dst
+}
+
+// downsample returns imageExt.Downsample(m) in the format of m, which is
+// one of the formats returned by pyramidBase. The samples of NRGBA and
+// NRGBA64 images are averaged without premultiplying them.
+func downsample(m image.Image) image.Image {
+	var src imageExt.Image
+	switch m := m.(type) {
+	case *image.NRGBA:
+		src = new(imageExt.RGBA).Init(m.Pix, m.Stride, m.Rect)
+	case *image.NRGBA64:
+		src = new(imageExt.RGBA64).Init(m.Pix, m.Stride, m.Rect)
+	default:
+		src = imageExt.AsImage(m)
+	}
+	d := imageExt.Downsample(src)
+	pix, stride, r := d.Pix(), d.Stride(), d.Rect()
+	switch m.(type) {
+	case *image.Gray:
+		return &image.Gray{Pix: pix, Stride: stride, Rect: r}
+	case *image.Gray16:
+		return &image.Gray16{Pix: pix, Stride: stride, Rect: r}
+	case *image.RGBA:
+		return &image.RGBA{Pix: pix, Stride: stride, Rect: r}
+	case *image.RGBA64:
+		return &image.RGBA64{Pix: pix, Stride: stride, Rect: r}
+	case *image.NRGBA:
+		return &image.NRGBA{Pix: pix, Stride: stride, Rect: r}
+	case *image.NRGBA64:
+		return &image.NRGBA64{Pix: pix, Stride: stride, Rect: r}
+	}
+	panic("tiff: downsample of an unexpected image type")
+}
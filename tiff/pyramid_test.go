@@ -0,0 +1,106 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+)
+
+func TestPyramid(t *testing.T) {
+	img, err := openImage("video-001.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opt := range []*Options{nil, {Compression: Deflate}, {BigTIFF: AlwaysBigTIFF}} {
+		out := new(bytes.Buffer)
+		if err := EncodePyramid(out, img, opt); err != nil {
+			t.Fatal(err)
+		}
+
+		configs, err := DecodeLevels(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, h := img.Bounds().Dx(), img.Bounds().Dy()
+		for i, c := range configs {
+			if c.Width != w || c.Height != h {
+				t.Fatalf("level %d: got %dx%d, want %dx%d", i, c.Width, c.Height, w, h)
+			}
+			w, h = (w+1)/2, (h+1)/2
+		}
+		if c := configs[len(configs)-1]; c.Width != 1 || c.Height != 1 {
+			t.Fatalf("smallest level: got %dx%d, want 1x1", c.Width, c.Height)
+		}
+
+		// Decode ignores the reduced-resolution levels.
+		img0, err := Decode(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare(t, img, img0)
+
+		img2, err := DecodeLevel(bytes.NewReader(out.Bytes()), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare(t, imageExt.Downsample(imageExt.Downsample(img)), img2)
+	}
+}
+
+func TestPyramidFormats(t *testing.T) {
+	r := image.Rect(0, 0, 5, 3)
+	nrgba := image.NewNRGBA(r)
+	for i := range nrgba.Pix {
+		nrgba.Pix[i] = uint8(i * 7)
+	}
+	pal := image.NewPaletted(r, color.Palette{color.Black, color.NRGBA{0xff, 0, 0, 0x80}})
+	pal.Pix[3] = 1
+	cmyk := image.NewCMYK(r)
+	for i := range cmyk.Pix {
+		cmyk.Pix[i] = uint8(i * 5)
+	}
+	for _, tc := range []struct {
+		m     image.Image
+		model color.Model
+	}{
+		{nrgba, color.NRGBAModel},
+		{image.NewGray16(r), color.Gray16Model},
+		{pal, color.NRGBAModel},
+		{cmyk, color.RGBAModel},
+	} {
+		var buf bytes.Buffer
+		if err := EncodePyramid(&buf, tc.m, nil); err != nil {
+			t.Fatal(err)
+		}
+		configs, err := DecodeLevels(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, c := range configs {
+			if c.ColorModel != tc.model {
+				t.Fatalf("%T: level %d: got color model %v", tc.m, i, c.ColorModel)
+			}
+		}
+	}
+
+	// The samples of NRGBA images are averaged as they are.
+	var buf bytes.Buffer
+	if err := EncodePyramid(&buf, nrgba, nil); err != nil {
+		t.Fatal(err)
+	}
+	m, err := DecodeLevel(bytes.NewReader(buf.Bytes()), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := imageExt.Downsample(new(imageExt.RGBA).Init(nrgba.Pix, nrgba.Stride, nrgba.Rect))
+	if got := m.(*image.NRGBA).Pix; !bytes.Equal(got, want.Pix()) {
+		t.Fatalf("got level 1 % x, want % x", got, want.Pix())
+	}
+}
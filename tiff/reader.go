@@ -13,9 +13,12 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"io"
 	"io/ioutil"
 
+	imageExt "github.com/chai2010/image"
+	colorExt "github.com/chai2010/image/color"
 	"github.com/chai2010/image/tiff/lzw"
 )
 
@@ -44,11 +47,18 @@ func (e InternalError) Error() string {
 type decoder struct {
 	r         io.ReaderAt
 	byteOrder binary.ByteOrder
+	bigTIFF   bool
 	config    image.Config
 	mode      imageMode
 	bpp       uint
 	features  map[int][]uint
 	palette   []color.Color
+	// jpegTables holds the JPEGTables tag, an abbreviated JPEG stream
+	// with the tables shared by all strips or tiles.
+	jpegTables []byte
+	// rationals holds the values of the YCbCrCoefficients and
+	// ReferenceBlackWhite tags.
+	rationals map[int][]float64
 
 	buf   []byte
 	off   int    // Current offset in buf.
@@ -66,19 +76,63 @@ func (d *decoder) firstVal(tag int) uint {
 	return f[0]
 }
 
-// ifdUint decodes the IFD entry in p, which must be of the Byte, Short
-// or Long type, and returns the decoded uint values.
-func (d *decoder) ifdUint(p []byte) (u []uint, err error) {
-	var raw []byte
-	datatype := d.byteOrder.Uint16(p[2:4])
-	count := d.byteOrder.Uint32(p[4:8])
-	if datalen := lengths[datatype] * count; datalen > 4 {
+// ifdEntryLen returns the length in bytes of an IFD entry.
+func (d *decoder) ifdEntryLen() int {
+	if d.bigTIFF {
+		return bigIfdLen
+	}
+	return ifdLen
+}
+
+// ifdRaw returns the raw data of the IFD entry in p, reading it from the
+// pointer area of the file if it does not fit into the entry itself.
+func (d *decoder) ifdRaw(p []byte) (datatype uint16, count uint64, raw []byte, err error) {
+	datatype = d.byteOrder.Uint16(p[2:4])
+	if int(datatype) >= len(lengths) || lengths[datatype] == 0 {
+		return 0, 0, nil, UnsupportedError("data type")
+	}
+
+	var offset uint64
+	inline := p[8:12]
+	if d.bigTIFF {
+		count = d.byteOrder.Uint64(p[4:12])
+		offset = d.byteOrder.Uint64(p[12:20])
+		inline = p[12:20]
+	} else {
+		count = uint64(d.byteOrder.Uint32(p[4:8]))
+		offset = uint64(d.byteOrder.Uint32(p[8:12]))
+	}
+	if count > uint64(maxInt)/uint64(lengths[datatype]) {
+		return 0, 0, nil, FormatError("IFD entry too large")
+	}
+	if datalen := uint64(lengths[datatype]) * count; datalen > uint64(len(inline)) {
 		// The IFD contains a pointer to the real value.
+		if offset > uint64(maxInt)-datalen {
+			return 0, 0, nil, FormatError("IFD entry offset out of range")
+		}
+		// The last byte is read first, so that a count larger than the
+		// rest of the file is rejected before its values are allocated.
+		var last [1]byte
+		if _, err = d.r.ReadAt(last[:], int64(offset+datalen-1)); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = FormatError("IFD entry past the end of the file")
+			}
+			return 0, 0, nil, err
+		}
 		raw = make([]byte, datalen)
-		_, err = d.r.ReadAt(raw, int64(d.byteOrder.Uint32(p[8:12])))
+		if _, err = d.r.ReadAt(raw, int64(offset)); err != nil {
+			return 0, 0, nil, err
+		}
 	} else {
-		raw = p[8 : 8+datalen]
+		raw = inline[:datalen]
 	}
+	return datatype, count, raw, nil
+}
+
+// ifdUint decodes the IFD entry in p, which must be of the Byte, Short,
+// Long, Long8 or IFD type, and returns the decoded uint values.
+func (d *decoder) ifdUint(p []byte) (u []uint, err error) {
+	datatype, count, raw, err := d.ifdRaw(p)
 	if err != nil {
 		return nil, err
 	}
@@ -86,32 +140,76 @@ func (d *decoder) ifdUint(p []byte) (u []uint, err error) {
 	u = make([]uint, count)
 	switch datatype {
 	case dtByte:
-		for i := uint32(0); i < count; i++ {
+		for i := uint64(0); i < count; i++ {
 			u[i] = uint(raw[i])
 		}
 	case dtShort:
-		for i := uint32(0); i < count; i++ {
+		for i := uint64(0); i < count; i++ {
 			u[i] = uint(d.byteOrder.Uint16(raw[2*i : 2*(i+1)]))
 		}
-	case dtLong:
-		for i := uint32(0); i < count; i++ {
+	case dtLong, dtIFD:
+		for i := uint64(0); i < count; i++ {
 			u[i] = uint(d.byteOrder.Uint32(raw[4*i : 4*(i+1)]))
 		}
+	case dtLong8, dtIFD8:
+		for i := uint64(0); i < count; i++ {
+			u[i] = uint(d.byteOrder.Uint64(raw[8*i : 8*(i+1)]))
+		}
 	default:
 		return nil, UnsupportedError("data type")
 	}
 	return u, nil
 }
 
+// ifdRational decodes the IFD entry in p, which must be of the Rational
+// type or of one of the types accepted by ifdUint, and returns the decoded
+// values.
+func (d *decoder) ifdRational(p []byte) ([]float64, error) {
+	datatype, count, raw, err := d.ifdRaw(p)
+	if err != nil {
+		return nil, err
+	}
+	if datatype != dtRational {
+		u, err := d.ifdUint(p)
+		if err != nil {
+			return nil, err
+		}
+		f := make([]float64, len(u))
+		for i, v := range u {
+			f[i] = float64(v)
+		}
+		return f, nil
+	}
+
+	f := make([]float64, count)
+	for i := range f {
+		num := d.byteOrder.Uint32(raw[8*i : 8*i+4])
+		den := d.byteOrder.Uint32(raw[8*i+4 : 8*i+8])
+		if den == 0 {
+			return nil, FormatError("zero denominator in rational value")
+		}
+		f[i] = float64(num) / float64(den)
+	}
+	return f, nil
+}
+
 // parseIFD decides whether the the IFD entry in p is "interesting" and
 // stows away the data in the decoder.
 func (d *decoder) parseIFD(p []byte) error {
 	tag := d.byteOrder.Uint16(p[0:2])
 	switch tag {
-	case tBitsPerSample,
+	case tNewSubfileType,
+		tSubIFDs,
+		tBitsPerSample,
 		tExtraSamples,
 		tPhotometricInterpretation,
 		tCompression,
+		tFillOrder,
+		tT4Options,
+		tT6Options,
+		tInkSet,
+		tYCbCrSubSampling,
+		tYCbCrPositioning,
 		tPredictor,
 		tStripOffsets,
 		tStripByteCounts,
@@ -127,6 +225,18 @@ func (d *decoder) parseIFD(p []byte) error {
 			return err
 		}
 		d.features[int(tag)] = val
+	case tJPEGTables:
+		_, _, raw, err := d.ifdRaw(p)
+		if err != nil {
+			return err
+		}
+		d.jpegTables = append([]byte(nil), raw...)
+	case tYCbCrCoefficients, tReferenceBlackWhite:
+		val, err := d.ifdRational(p)
+		if err != nil {
+			return err
+		}
+		d.rationals[int(tag)] = val
 	case tColorMap:
 		val, err := d.ifdUint(p)
 		if err != nil {
@@ -184,6 +294,9 @@ func (d *decoder) flushBits() {
 	d.nbits = 0
 }
 
+// maxInt is the largest value of type int.
+const maxInt = int(^uint(0) >> 1)
+
 // minInt returns the smaller of x or y.
 func minInt(a, b int) int {
 	if a <= b {
@@ -230,6 +343,26 @@ func (d *decoder) decode(dst image.Image, xmin, ymin, xmax, ymax int) error {
 	rMaxX := minInt(xmax, dst.Bounds().Max.X)
 	rMaxY := minInt(ymax, dst.Bounds().Max.Y)
 	switch d.mode {
+	case mBilevel:
+		img := dst.(*image.Gray)
+		// A set bit is white for BlackIsZero and black for WhiteIsZero.
+		var on, off uint8 = 0xff, 0x00
+		if d.firstVal(tPhotometricInterpretation) == pWhiteIsZero {
+			on, off = off, on
+		}
+		for y := ymin; y < rMaxY; y++ {
+			row := img.Pix[img.PixOffset(xmin, y):img.PixOffset(rMaxX, y)]
+			for i := range row {
+				if d.readBits(1) != 0 {
+					row[i] = on
+				} else {
+					row[i] = off
+				}
+			}
+			d.flushBits()
+			// Skip the padding bytes of the block.
+			d.off = (y - ymin + 1) * ((xmax - xmin + 7) / 8)
+		}
 	case mGray, mGrayInvert:
 		if d.bpp == 16 {
 			img := dst.(*image.Gray16)
@@ -314,6 +447,59 @@ func (d *decoder) decode(dst image.Image, xmin, ymin, xmax, ymax int) error {
 				copy(img.Pix[min:max], buf)
 			}
 		}
+	case mCMYK:
+		if len(d.buf) < (rMaxY-ymin)*(xmax-xmin)*4*int(d.bpp/8) {
+			return FormatError("not enough pixel data")
+		}
+		img := dst.(*image.CMYK)
+		for y := ymin; y < rMaxY; y++ {
+			min := img.PixOffset(xmin, y)
+			max := img.PixOffset(rMaxX, y)
+			if d.bpp == 16 {
+				// image.CMYK has 8 bits per sample.
+				d.off = (y - ymin) * (xmax - xmin) * 8
+				for i := min; i < max; i++ {
+					img.Pix[i] = uint8(d.byteOrder.Uint16(d.buf[d.off:]) >> 8)
+					d.off += 2
+				}
+			} else {
+				buf := d.buf[(y-ymin)*(xmax-xmin)*4 : (y-ymin+1)*(xmax-xmin)*4]
+				copy(img.Pix[min:max], buf)
+			}
+		}
+	case mYCbCr:
+		return d.decodeYCbCr(dst.(*image.YCbCr), xmin, ymin, xmax, ymax)
+	case mCIELab:
+		if len(d.buf) < (rMaxY-ymin)*(xmax-xmin)*3*int(d.bpp/8) {
+			return FormatError("not enough pixel data")
+		}
+		// L* is unsigned and scaled to the full sample range, a* and b*
+		// are signed (page 110-111 of the spec). They are converted to
+		// RGB samples from 0 to 0xffff.
+		img := dst.(*imageExt.RGB96f)
+		for y := ymin; y < rMaxY; y++ {
+			d.off = (y - ymin) * (xmax - xmin) * 3 * int(d.bpp/8)
+			for x := xmin; x < rMaxX; x++ {
+				var l, a, b float64
+				if d.bpp == 16 {
+					l = float64(d.byteOrder.Uint16(d.buf[d.off:])) * 100 / 0xffff
+					a = float64(int16(d.byteOrder.Uint16(d.buf[d.off+2:]))) / 256
+					b = float64(int16(d.byteOrder.Uint16(d.buf[d.off+4:]))) / 256
+					d.off += 6
+				} else {
+					l = float64(d.buf[d.off]) * 100 / 0xff
+					a = float64(int8(d.buf[d.off+1]))
+					b = float64(int8(d.buf[d.off+2]))
+					d.off += 3
+				}
+				r, g, bl := labToRGB(l, a, b)
+				img.SetRGB96f(x, y, colorExt.RGB96f{
+					R: float32(r * 0xffff),
+					G: float32(g * 0xffff),
+					B: float32(bl * 0xffff),
+				})
+			}
+		}
 	case mRGBA:
 		if d.bpp == 16 {
 			img := dst.(*image.RGBA64)
@@ -341,50 +527,149 @@ func (d *decoder) decode(dst image.Image, xmin, ymin, xmax, ymax int) error {
 	return nil
 }
 
-func newDecoder(r io.Reader) (*decoder, error) {
-	d := &decoder{
-		r:        newReaderAt(r),
-		features: make(map[int][]uint),
-	}
-
-	p := make([]byte, 8)
-	if _, err := d.r.ReadAt(p, 0); err != nil {
-		return nil, err
+// readHeader reads the file header, which determines the byte order and
+// the TIFF variant, and returns the offset of the first IFD.
+func (d *decoder) readHeader() (int64, error) {
+	p := make([]byte, 16)
+	if _, err := d.r.ReadAt(p[0:8], 0); err != nil {
+		return 0, err
 	}
 	switch string(p[0:4]) {
 	case leHeader:
 		d.byteOrder = binary.LittleEndian
 	case beHeader:
 		d.byteOrder = binary.BigEndian
+	case leBigHeader:
+		d.byteOrder = binary.LittleEndian
+		d.bigTIFF = true
+	case beBigHeader:
+		d.byteOrder = binary.BigEndian
+		d.bigTIFF = true
 	default:
-		return nil, FormatError("malformed header")
+		return 0, FormatError("malformed header")
 	}
 
-	ifdOffset := int64(d.byteOrder.Uint32(p[4:8]))
+	if !d.bigTIFF {
+		return int64(d.byteOrder.Uint32(p[4:8])), nil
+	}
+	// The BigTIFF header continues with the size of offsets (always 8),
+	// a reserved zero and the 64-bit offset of the first IFD.
+	if _, err := d.r.ReadAt(p[8:16], 8); err != nil {
+		return 0, err
+	}
+	if d.byteOrder.Uint16(p[4:6]) != 8 || d.byteOrder.Uint16(p[6:8]) != 0 {
+		return 0, FormatError("malformed BigTIFF header")
+	}
+	off := d.byteOrder.Uint64(p[8:16])
+	if off > uint64(maxInt) {
+		return 0, FormatError("IFD offset out of range")
+	}
+	return int64(off), nil
+}
 
-	// The first two bytes contain the number of entries (12 bytes each).
-	if _, err := d.r.ReadAt(p[0:2], ifdOffset); err != nil {
-		return nil, err
+// readIFD reads the IFD at ifdOffset, replacing the features and palette
+// of the previously read one. It returns the offset of the next IFD,
+// or 0 if it is the last one.
+func (d *decoder) readIFD(ifdOffset int64) (next int64, err error) {
+	d.features = make(map[int][]uint)
+	d.palette = nil
+	d.jpegTables = nil
+	d.rationals = make(map[int][]float64)
+
+	p, next, err := d.ifdEntries(ifdOffset)
+	if err != nil {
+		return 0, err
+	}
+	entryLen := d.ifdEntryLen()
+	for i := 0; i < len(p); i += entryLen {
+		if err := d.parseIFD(p[i : i+entryLen]); err != nil {
+			return 0, err
+		}
+	}
+	return next, nil
+}
+
+// ifdEntries reads the IFD at ifdOffset and returns its entries, each
+// ifdEntryLen bytes long, and the offset of the next IFD.
+func (d *decoder) ifdEntries(ifdOffset int64) (p []byte, next int64, err error) {
+	// The IFD starts with the number of entries, which is a uint16
+	// in classic TIFF files and a uint64 in BigTIFF files.
+	var numItems int
+	p = make([]byte, 8)
+	if d.bigTIFF {
+		if _, err := d.r.ReadAt(p[0:8], ifdOffset); err != nil {
+			return nil, 0, err
+		}
+		n := d.byteOrder.Uint64(p[0:8])
+		if n > 0xffff {
+			return nil, 0, FormatError("too many IFD entries")
+		}
+		numItems = int(n)
+		ifdOffset += 8
+	} else {
+		if _, err := d.r.ReadAt(p[0:2], ifdOffset); err != nil {
+			return nil, 0, err
+		}
+		numItems = int(d.byteOrder.Uint16(p[0:2]))
+		ifdOffset += 2
 	}
-	numItems := int(d.byteOrder.Uint16(p[0:2]))
 
 	// All IFD entries are read in one chunk.
-	p = make([]byte, ifdLen*numItems)
-	if _, err := d.r.ReadAt(p, ifdOffset+2); err != nil {
-		return nil, err
+	entryLen := d.ifdEntryLen()
+	p = make([]byte, entryLen*numItems)
+	if _, err := d.r.ReadAt(p, ifdOffset); err != nil {
+		return nil, 0, err
 	}
 
-	for i := 0; i < len(p); i += ifdLen {
-		if err := d.parseIFD(p[i : i+ifdLen]); err != nil {
-			return nil, err
+	// The offset of the next IFD follows the entries. Some writers end the
+	// file before it after the last IFD, which is then the last one.
+	nextLen := 4
+	if d.bigTIFF {
+		nextLen = 8
+	}
+	q := make([]byte, nextLen)
+	if _, err := d.r.ReadAt(q, ifdOffset+int64(len(p))); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return p, 0, nil
 		}
+		return nil, 0, err
 	}
+	if d.bigTIFF {
+		off := d.byteOrder.Uint64(q)
+		if off > uint64(maxInt) {
+			return nil, 0, FormatError("IFD offset out of range")
+		}
+		return p, int64(off), nil
+	}
+	return p, int64(d.byteOrder.Uint32(q)), nil
+}
 
+func newDecoder(r io.Reader) (*decoder, error) {
+	d := &decoder{
+		r: newReaderAt(r),
+	}
+	ifdOffset, err := d.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.readIFD(ifdOffset); err != nil {
+		return nil, err
+	}
+	if err := d.parseConfig(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// parseConfig determines the configuration and the mode of the image
+// described by the current IFD.
+func (d *decoder) parseConfig() error {
+	d.config = image.Config{}
 	d.config.Width = int(d.firstVal(tImageWidth))
 	d.config.Height = int(d.firstVal(tImageLength))
 
 	if _, ok := d.features[tBitsPerSample]; !ok {
-		return nil, FormatError("BitsPerSample tag missing")
+		return FormatError("BitsPerSample tag missing")
 	}
 	d.bpp = d.firstVal(tBitsPerSample)
 
@@ -394,13 +679,13 @@ func newDecoder(r io.Reader) (*decoder, error) {
 		if d.bpp == 16 {
 			for _, b := range d.features[tBitsPerSample] {
 				if b != 16 {
-					return nil, FormatError("wrong number of samples for 16bit RGB")
+					return FormatError("wrong number of samples for 16bit RGB")
 				}
 			}
 		} else {
 			for _, b := range d.features[tBitsPerSample] {
 				if b != 8 {
-					return nil, FormatError("wrong number of samples for 8bit RGB")
+					return FormatError("wrong number of samples for 8bit RGB")
 				}
 			}
 		}
@@ -435,33 +720,88 @@ func newDecoder(r io.Reader) (*decoder, error) {
 					d.config.ColorModel = color.NRGBAModel
 				}
 			default:
-				return nil, FormatError("wrong number of samples for RGB")
+				return FormatError("wrong number of samples for RGB")
 			}
 		default:
-			return nil, FormatError("wrong number of samples for RGB")
+			return FormatError("wrong number of samples for RGB")
 		}
 	case pPaletted:
 		d.mode = mPaletted
 		d.config.ColorModel = color.Palette(d.palette)
-	case pWhiteIsZero:
-		d.mode = mGrayInvert
+	case pWhiteIsZero, pBlackIsZero:
+		switch {
+		case d.bpp == 1:
+			d.mode = mBilevel
+		case d.firstVal(tPhotometricInterpretation) == pWhiteIsZero:
+			d.mode = mGrayInvert
+		default:
+			d.mode = mGray
+		}
 		if d.bpp == 16 {
 			d.config.ColorModel = color.Gray16Model
 		} else {
 			d.config.ColorModel = color.GrayModel
 		}
-	case pBlackIsZero:
-		d.mode = mGray
-		if d.bpp == 16 {
-			d.config.ColorModel = color.Gray16Model
+	case pCMYK:
+		if d.firstVal(tInkSet) == inkNotCMYK {
+			return UnsupportedError("ink set")
+		}
+		// image.CMYK has no alpha channel to hold extra samples.
+		if len(d.features[tBitsPerSample]) > 4 && len(d.features[tExtraSamples]) > 0 {
+			return UnsupportedError("extra samples of CMYK")
+		}
+		if !d.sameBitsPerSample(4) || d.bpp != 8 && d.bpp != 16 {
+			return FormatError("wrong number of samples for CMYK")
+		}
+		d.mode = mCMYK
+		d.config.ColorModel = color.CMYKModel
+	case pYCbCr:
+		if d.bpp != 8 {
+			return UnsupportedError("YCbCr bit depth")
+		}
+		// JPEG compressed data is converted to RGB by the JPEG decoder.
+		if d.firstVal(tCompression) == cJPEG {
+			d.mode = mRGB
+			d.config.ColorModel = color.RGBAModel
+			break
+		}
+		if !d.sameBitsPerSample(3) {
+			return FormatError("wrong number of samples for YCbCr")
+		}
+		if _, err := d.ycbcrSubsampleRatio(); err != nil {
+			return err
+		}
+		d.mode = mYCbCr
+		if d.isJFIFYCbCr() {
+			d.config.ColorModel = color.YCbCrModel
 		} else {
-			d.config.ColorModel = color.GrayModel
+			d.config.ColorModel = color.RGBAModel
 		}
+	case pCIELab:
+		if !d.sameBitsPerSample(3) || d.bpp != 8 && d.bpp != 16 {
+			return FormatError("wrong number of samples for CIELab")
+		}
+		d.mode = mCIELab
+		d.config.ColorModel = colorExt.RGB96fModel
 	default:
-		return nil, UnsupportedError("color model")
+		return UnsupportedError("color model")
 	}
 
-	return d, nil
+	return nil
+}
+
+// sameBitsPerSample reports whether the image has n samples per pixel,
+// all of them d.bpp bits wide.
+func (d *decoder) sameBitsPerSample(n int) bool {
+	if len(d.features[tBitsPerSample]) != n {
+		return false
+	}
+	for _, b := range d.features[tBitsPerSample] {
+		if b != d.bpp {
+			return false
+		}
+	}
+	return true
 }
 
 // DecodeConfig returns the color model and dimensions of a TIFF image without
@@ -476,12 +816,22 @@ func DecodeConfig(r io.Reader) (image.Config, error) {
 
 // Decode reads a TIFF image from r and returns it as an image.Image.
 // The type of Image returned depends on the contents of the TIFF.
+//
+// Separated (CMYK) images are returned as an *image.CMYK and YCbCr images
+// as an *image.YCbCr, or as an *image.RGBA if they do not use the JFIF
+// conversion; their YCbCrPositioning tag is ignored. CMYK images with extra
+// samples are not supported. CIELab images are converted to sRGB and
+// returned as an *imageExt.RGB96f.
 func Decode(r io.Reader) (img image.Image, err error) {
 	d, err := newDecoder(r)
 	if err != nil {
 		return
 	}
+	return d.decodeImage()
+}
 
+// decodeImage decodes the image described by the current IFD.
+func (d *decoder) decodeImage() (img image.Image, err error) {
 	blockPadding := false
 	blockWidth := d.config.Width
 	blockHeight := d.config.Height
@@ -520,6 +870,8 @@ func Decode(r io.Reader) (img image.Image, err error) {
 
 	imgRect := image.Rect(0, 0, d.config.Width, d.config.Height)
 	switch d.mode {
+	case mBilevel:
+		img = image.NewGray(imgRect)
 	case mGray, mGrayInvert:
 		if d.bpp == 16 {
 			img = image.NewGray16(imgRect)
@@ -540,6 +892,13 @@ func Decode(r io.Reader) (img image.Image, err error) {
 		} else {
 			img = image.NewRGBA(imgRect)
 		}
+	case mCMYK:
+		img = image.NewCMYK(imgRect)
+	case mYCbCr:
+		ratio, _ := d.ycbcrSubsampleRatio()
+		img = image.NewYCbCr(imgRect, ratio)
+	case mCIELab:
+		img = imageExt.NewRGB96f(imgRect)
 	}
 
 	for i := 0; i < blocksAcross; i++ {
@@ -552,6 +911,11 @@ func Decode(r io.Reader) (img image.Image, err error) {
 			if !blockPadding && j == blocksDown-1 && d.config.Height%blockHeight != 0 {
 				blkH = d.config.Height % blockHeight
 			}
+			xmin := i * blockWidth
+			ymin := j * blockHeight
+			xmax := xmin + blkW
+			ymax := ymin + blkH
+
 			offset := int64(blockOffsets[j*blocksAcross+i])
 			n := int64(blockCounts[j*blocksAcross+i])
 			switch d.firstVal(tCompression) {
@@ -579,6 +943,36 @@ func Decode(r io.Reader) (img image.Image, err error) {
 				r.Close()
 			case cPackBits:
 				d.buf, err = unpackBits(io.NewSectionReader(d.r, offset, n))
+			case cCCITT, cG3, cG4:
+				if d.mode != mBilevel {
+					return nil, FormatError("CCITT compression of a non-bilevel image")
+				}
+				raw := make([]byte, n)
+				if _, err = d.r.ReadAt(raw, offset); err != nil && err != io.EOF {
+					return nil, err
+				}
+				if d.firstVal(tFillOrder) == 2 {
+					reverseBits(raw)
+				}
+				mode, options := ccittRLE, uint(0)
+				switch d.firstVal(tCompression) {
+				case cG3:
+					mode, options = ccittT4, d.firstVal(tT4Options)
+				case cG4:
+					mode, options = ccittT6, d.firstVal(tT6Options)
+				}
+				// Like other bilevel data, the decoded bits are interpreted
+				// with the PhotometricInterpretation tag.
+				d.buf, err = decodeCCITT(raw, blkW, blkH, mode, options)
+			case cJPEG:
+				raw := make([]byte, n)
+				if _, err = d.r.ReadAt(raw, offset); err != nil && err != io.EOF {
+					return nil, err
+				}
+				if err = d.decodeJPEG(img.(draw.Image), raw, xmin, ymin); err != nil {
+					return nil, err
+				}
+				continue
 			default:
 				err = UnsupportedError(fmt.Sprintf("compression value %d", d.firstVal(tCompression)))
 			}
@@ -586,20 +980,21 @@ func Decode(r io.Reader) (img image.Image, err error) {
 				return nil, err
 			}
 
-			xmin := i * blockWidth
-			ymin := j * blockHeight
-			xmax := xmin + blkW
-			ymax := ymin + blkH
 			err = d.decode(img, xmin, ymin, xmax, ymax)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
+	if d.mode == mYCbCr && !d.isJFIFYCbCr() {
+		img = d.ycbcrToRGBA(img.(*image.YCbCr))
+	}
 	return
 }
 
 func init() {
 	image.RegisterFormat("tiff", leHeader, Decode, DecodeConfig)
 	image.RegisterFormat("tiff", beHeader, Decode, DecodeConfig)
+	image.RegisterFormat("tiff", leBigHeader, Decode, DecodeConfig)
+	image.RegisterFormat("tiff", beBigHeader, Decode, DecodeConfig)
 }
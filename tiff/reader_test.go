@@ -5,7 +5,11 @@
 package tiff
 
 import (
+	"bytes"
+	"encoding/binary"
 	"image"
+	"image/color"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -162,6 +166,49 @@ func TestDecompress(t *testing.T) {
 	}
 }
 
+// TestDecodeNoNextIFD tests that a file that ends before the offset of the
+// next IFD is decoded.
+func TestDecodeNoNextIFD(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("II\x2a\x00\x0a\x00\x00\x00\x7f\x00")
+	binary.Write(&buf, binary.LittleEndian, uint16(8))
+	for _, e := range [][3]uint32{
+		{tImageWidth, dtShort, 1},
+		{tImageLength, dtShort, 1},
+		{tBitsPerSample, dtShort, 8},
+		{tCompression, dtShort, cNone},
+		{tPhotometricInterpretation, dtShort, pBlackIsZero},
+		{tStripOffsets, dtLong, 8},
+		{tRowsPerStrip, dtShort, 1},
+		{tStripByteCounts, dtLong, 1},
+	} {
+		binary.Write(&buf, binary.LittleEndian, []uint16{uint16(e[0]), uint16(e[1])})
+		binary.Write(&buf, binary.LittleEndian, []uint32{1, e[2]})
+	}
+	m, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m.At(0, 0).(color.Gray); c.Y != 0x7f {
+		t.Fatalf("got %v", c)
+	}
+}
+
+// TestDecodeLargeCount tests that the values of an IFD entry whose count is
+// larger than the file are not allocated.
+func TestDecodeLargeCount(t *testing.T) {
+	// A BigTIFF file with an ImageWidth entry of 1<<40 Long8 values.
+	file := "II\x2b\x00\x08\x00\x00\x00\x10\x00\x00\x00\x00\x00\x00\x00" +
+		"\x01\x00\x00\x00\x00\x00\x00\x00" +
+		"\x00\x01\x10\x00\x00\x00\x00\x00\x00\x01\x00\x00\x40\x00\x00\x00\x00\x00\x00\x00" +
+		"\x00\x00\x00\x00\x00\x00\x00\x00"
+	for _, r := range []io.Reader{strings.NewReader(file), struct{ io.Reader }{strings.NewReader(file)}} {
+		if _, err := Decode(r); err != FormatError("IFD entry past the end of the file") {
+			t.Errorf("%T: got error %v", r, err)
+		}
+	}
+}
+
 // benchmarkDecode benchmarks the decoding of an image.
 func benchmarkDecode(b *testing.B, filename string) {
 	b.StopTimer()
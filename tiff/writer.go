@@ -30,25 +30,37 @@ var enc = binary.LittleEndian
 type ifdEntry struct {
 	tag      int
 	datatype int
-	data     []uint32
+	data     []uint64
 }
 
 func (e ifdEntry) putData(p []byte) {
 	for _, d := range e.data {
 		switch e.datatype {
-		case dtByte, dtASCII:
+		case dtByte, dtASCII, dtSByte, dtUndefined:
 			p[0] = byte(d)
 			p = p[1:]
-		case dtShort:
+		case dtShort, dtSShort:
 			enc.PutUint16(p, uint16(d))
 			p = p[2:]
-		case dtLong, dtRational:
+		case dtLong, dtRational, dtIFD, dtSLong, dtSRational, dtFloat:
 			enc.PutUint32(p, uint32(d))
 			p = p[4:]
+		case dtLong8, dtIFD8, dtSLong8, dtDouble:
+			enc.PutUint64(p, d)
+			p = p[8:]
 		}
 	}
 }
 
+// count returns the number of values of e. The numerator and denominator
+// of a rational value are stored as two elements of e.data.
+func (e ifdEntry) count() int {
+	if e.datatype == dtRational || e.datatype == dtSRational {
+		return len(e.data) / 2
+	}
+	return len(e.data)
+}
+
 type byTag []ifdEntry
 
 func (d byTag) Len() int           { return len(d) }
@@ -220,32 +232,86 @@ func writePix(w io.Writer, pix []byte, nrows, length, stride int) error {
 	return nil
 }
 
-func writeIFD(w io.Writer, ifdOffset int, d []ifdEntry) error {
-	var buf [ifdLen]byte
+// writeHeader writes the TIFF or BigTIFF file header, which contains the
+// offset of the first IFD.
+func writeHeader(w io.Writer, bigTIFF bool, ifdOffset int) error {
+	if !bigTIFF {
+		if _, err := io.WriteString(w, leHeader); err != nil {
+			return err
+		}
+		return binary.Write(w, enc, uint32(ifdOffset))
+	}
+	if _, err := io.WriteString(w, leBigHeader); err != nil {
+		return err
+	}
+	// Bytesize of offsets, followed by a reserved zero.
+	if err := binary.Write(w, enc, [2]uint16{8, 0}); err != nil {
+		return err
+	}
+	return binary.Write(w, enc, uint64(ifdOffset))
+}
+
+// ifdLength returns the number of bytes written by writeIFD for d.
+func ifdLength(d []ifdEntry, bigTIFF bool) int {
+	entryLen, countLen, inlineLen := ifdLen, 2, 4
+	if bigTIFF {
+		entryLen, countLen, inlineLen = bigIfdLen, 8, 8
+	}
+	n := countLen + entryLen*len(d) + inlineLen
+	for _, ent := range d {
+		if datalen := ent.count() * int(lengths[ent.datatype]); datalen > inlineLen {
+			n += datalen
+		}
+	}
+	return n
+}
+
+// writeIFD writes the IFD d, which starts at ifdOffset in the file.
+// nextOffset is the offset of the next IFD, or zero if d is the last one.
+func writeIFD(w io.Writer, ifdOffset int, d []ifdEntry, bigTIFF bool, nextOffset int) error {
+	// In BigTIFF files, the entry count and the next IFD offset are
+	// 64-bit values and entries keep up to 8 bytes of data inline.
+	entryLen, countLen, inlineLen := ifdLen, 2, 4
+	if bigTIFF {
+		entryLen, countLen, inlineLen = bigIfdLen, 8, 8
+	}
+	buf := make([]byte, entryLen)
 	// Make space for "pointer area" containing IFD entry data
-	// longer than 4 bytes.
+	// longer than the inline data.
 	parea := make([]byte, 1024)
-	pstart := ifdOffset + ifdLen*len(d) + 6
+	pstart := ifdOffset + countLen + entryLen*len(d) + inlineLen
 	var o int // Current offset in parea.
 
 	// The IFD has to be written with the tags in ascending order.
 	sort.Sort(byTag(d))
 
 	// Write the number of entries in this IFD.
-	if err := binary.Write(w, enc, uint16(len(d))); err != nil {
+	var err error
+	if bigTIFF {
+		err = binary.Write(w, enc, uint64(len(d)))
+	} else {
+		err = binary.Write(w, enc, uint16(len(d)))
+	}
+	if err != nil {
 		return err
 	}
 	for _, ent := range d {
+		for i := range buf {
+			buf[i] = 0
+		}
 		enc.PutUint16(buf[0:2], uint16(ent.tag))
 		enc.PutUint16(buf[2:4], uint16(ent.datatype))
-		count := uint32(len(ent.data))
-		if ent.datatype == dtRational {
-			count /= 2
-		}
-		enc.PutUint32(buf[4:8], count)
-		datalen := int(count * lengths[ent.datatype])
-		if datalen <= 4 {
-			ent.putData(buf[8:12])
+		count := uint64(ent.count())
+		inline := buf[8:12]
+		if bigTIFF {
+			enc.PutUint64(buf[4:12], count)
+			inline = buf[12:20]
+		} else {
+			enc.PutUint32(buf[4:8], uint32(count))
+		}
+		datalen := int(count * uint64(lengths[ent.datatype]))
+		if datalen <= inlineLen {
+			ent.putData(inline)
 		} else {
 			if (o + datalen) > len(parea) {
 				newlen := len(parea) + 1024
@@ -257,22 +323,60 @@ func writeIFD(w io.Writer, ifdOffset int, d []ifdEntry) error {
 				parea = newarea
 			}
 			ent.putData(parea[o : o+datalen])
-			enc.PutUint32(buf[8:12], uint32(pstart+o))
+			if bigTIFF {
+				enc.PutUint64(inline, uint64(pstart+o))
+			} else {
+				enc.PutUint32(inline, uint32(pstart+o))
+			}
 			o += datalen
 		}
-		if _, err := w.Write(buf[:]); err != nil {
+		if _, err := w.Write(buf); err != nil {
 			return err
 		}
 	}
 	// The IFD ends with the offset of the next IFD in the file,
 	// or zero if it is the last one (page 14).
-	if err := binary.Write(w, enc, uint32(0)); err != nil {
+	if bigTIFF {
+		err = binary.Write(w, enc, uint64(nextOffset))
+	} else {
+		err = binary.Write(w, enc, uint32(nextOffset))
+	}
+	if err != nil {
 		return err
 	}
-	_, err := w.Write(parea[:o])
+	_, err = w.Write(parea[:o])
 	return err
 }
 
+// maxIFDLen is an upper bound of the length of the IFDs and their pointer
+// areas as written by Encode and EncodePyramid.
+const maxIFDLen = 1 << 20
+
+// useBigTIFF reports whether a file holding imageLen bytes of image data
+// is written as a BigTIFF file.
+func (mode BigTIFFMode) useBigTIFF(imageLen int) (bool, error) {
+	fits := uint64(imageLen)+8+maxIFDLen <= 1<<32-1
+	switch mode {
+	case AlwaysBigTIFF:
+		return true, nil
+	case NeverBigTIFF:
+		if !fits {
+			return false, UnsupportedError("image data too large for a classic TIFF file")
+		}
+		return false, nil
+	}
+	return !fits, nil
+}
+
+// shortOrLong returns an IFD entry with a single value, using the Short
+// data type if the value fits and the Long type otherwise.
+func shortOrLong(tag int, v int) ifdEntry {
+	if v <= 0xffff {
+		return ifdEntry{tag, dtShort, []uint64{uint64(v)}}
+	}
+	return ifdEntry{tag, dtLong, []uint64{uint64(v)}}
+}
+
 // Options are the encoding parameters.
 type Options struct {
 	// Compression is the type of compression used.
@@ -283,156 +387,297 @@ type Options struct {
 	// types of images and compressors. For example, it works well for
 	// photos with Deflate compression.
 	Predictor bool
+	// BigTIFF determines whether a BigTIFF file with 64-bit offsets is
+	// written. By default, BigTIFF is only used when the file would
+	// exceed the 4 GB limit of classic TIFF.
+	BigTIFF BigTIFFMode
+	// Fields holds extra fields written to the IFD of the image, such as
+	// an ImageDescription, the resolution or GeoTIFF keys. They replace
+	// the fields the encoder would write with the same tags. Some fields
+	// are ignored: those describing the layout of the pixel data, such as
+	// the image size or the strip offsets, those pointing to other IFDs,
+	// such as the Exif and GPS IFDs or any field of type TypeIFD or
+	// TypeIFD8, and those with a nil Value. So the IFD returned by
+	// DecodeIFD can be passed in, but its Exif and GPS metadata are lost.
+	Fields IFD
 }
 
-// Encode writes the image m to w. opt determines the options used for
-// encoding, such as the compression type. If opt is nil, an uncompressed
-// image is written.
-func Encode(w io.Writer, m image.Image, opt *Options) error {
+// pixelDataLen returns the length of the uncompressed pixel data written
+// for m by encodePixels.
+func pixelDataLen(m image.Image) int {
 	d := m.Bounds().Size()
-
-	compression := uint32(cNone)
-	predictor := false
-	if opt != nil {
-		compression = opt.Compression.specValue()
-		// The predictor field is only used with LZW. See page 64 of the spec.
-		predictor = opt.Predictor && compression == cLZW
-	}
-
-	_, err := io.WriteString(w, leHeader)
-	if err != nil {
-		return err
+	switch m.(type) {
+	case *image.Paletted:
+		return d.X * d.Y * 1
+	case *image.Gray:
+		return d.X * d.Y * 1
+	case *image.Gray16:
+		return d.X * d.Y * 2
+	case *image.RGBA64:
+		return d.X * d.Y * 8
+	case *image.NRGBA64:
+		return d.X * d.Y * 8
 	}
+	return d.X * d.Y * 4
+}
 
-	// Compressed data is written into a buffer first, so that we
-	// know the compressed size.
-	var buf bytes.Buffer
-	// dst holds the destination for the pixel data of the image --
-	// either w or a writer to buf.
-	var dst io.Writer
-	// imageLen is the length of the pixel data in bytes.
-	// The offset of the IFD is imageLen + 8 header bytes.
-	var imageLen int
-
-	switch compression {
-	case cNone:
-		dst = w
-		// Write IFD offset before outputting pixel data.
-		switch m.(type) {
-		case *image.Paletted:
-			imageLen = d.X * d.Y * 1
-		case *image.Gray:
-			imageLen = d.X * d.Y * 1
-		case *image.Gray16:
-			imageLen = d.X * d.Y * 2
-		case *image.RGBA64:
-			imageLen = d.X * d.Y * 8
-		case *image.NRGBA64:
-			imageLen = d.X * d.Y * 8
-		default:
-			imageLen = d.X * d.Y * 4
-		}
-		err = binary.Write(w, enc, uint32(imageLen+8))
-		if err != nil {
-			return err
-		}
-	case cDeflate:
-		dst = zlib.NewWriter(&buf)
-	}
+// encodePixels writes the pixel data of m to dst as a single strip and
+// returns the IFD entries that describe it, except for the strip offsets
+// and byte counts, which depend on the layout of the file.
+func encodePixels(dst io.Writer, m image.Image, compression uint32, predictor bool) ([]ifdEntry, error) {
+	d := m.Bounds().Size()
 
-	pr := uint32(prNone)
-	photometricInterpretation := uint32(pRGB)
-	samplesPerPixel := uint32(4)
-	bitsPerSample := []uint32{8, 8, 8, 8}
-	extraSamples := uint32(0)
-	colorMap := []uint32{}
+	pr := uint64(prNone)
+	photometricInterpretation := uint64(pRGB)
+	samplesPerPixel := uint64(4)
+	bitsPerSample := []uint64{8, 8, 8, 8}
+	extraSamples := uint64(0)
+	colorMap := []uint64{}
 
 	if predictor {
 		pr = prHorizontal
 	}
+	var err error
 	switch m := m.(type) {
 	case *image.Paletted:
 		photometricInterpretation = pPaletted
 		samplesPerPixel = 1
-		bitsPerSample = []uint32{8}
-		colorMap = make([]uint32, 256*3)
+		bitsPerSample = []uint64{8}
+		colorMap = make([]uint64, 256*3)
 		for i := 0; i < 256 && i < len(m.Palette); i++ {
 			r, g, b, _ := m.Palette[i].RGBA()
-			colorMap[i+0*256] = uint32(r)
-			colorMap[i+1*256] = uint32(g)
-			colorMap[i+2*256] = uint32(b)
+			colorMap[i+0*256] = uint64(r)
+			colorMap[i+1*256] = uint64(g)
+			colorMap[i+2*256] = uint64(b)
 		}
 		err = encodeGray(dst, m.Pix, d.X, d.Y, m.Stride, predictor)
 	case *image.Gray:
 		photometricInterpretation = pBlackIsZero
 		samplesPerPixel = 1
-		bitsPerSample = []uint32{8}
+		bitsPerSample = []uint64{8}
 		err = encodeGray(dst, m.Pix, d.X, d.Y, m.Stride, predictor)
 	case *image.Gray16:
 		photometricInterpretation = pBlackIsZero
 		samplesPerPixel = 1
-		bitsPerSample = []uint32{16}
+		bitsPerSample = []uint64{16}
 		err = encodeGray16(dst, m.Pix, d.X, d.Y, m.Stride, predictor)
 	case *image.NRGBA:
 		extraSamples = 2 // Unassociated alpha.
 		err = encodeRGBA(dst, m.Pix, d.X, d.Y, m.Stride, predictor)
 	case *image.NRGBA64:
 		extraSamples = 2 // Unassociated alpha.
-		bitsPerSample = []uint32{16, 16, 16, 16}
+		bitsPerSample = []uint64{16, 16, 16, 16}
 		err = encodeRGBA64(dst, m.Pix, d.X, d.Y, m.Stride, predictor)
 	case *image.RGBA:
 		extraSamples = 1 // Associated alpha.
 		err = encodeRGBA(dst, m.Pix, d.X, d.Y, m.Stride, predictor)
 	case *image.RGBA64:
 		extraSamples = 1 // Associated alpha.
-		bitsPerSample = []uint32{16, 16, 16, 16}
+		bitsPerSample = []uint64{16, 16, 16, 16}
 		err = encodeRGBA64(dst, m.Pix, d.X, d.Y, m.Stride, predictor)
 	default:
 		extraSamples = 1 // Associated alpha.
 		err = encode(dst, m, predictor)
 	}
 	if err != nil {
-		return err
-	}
-
-	if compression != cNone {
-		if err = dst.(io.Closer).Close(); err != nil {
-			return err
-		}
-		imageLen = buf.Len()
-		if err = binary.Write(w, enc, uint32(imageLen+8)); err != nil {
-			return err
-		}
-		if _, err = buf.WriteTo(w); err != nil {
-			return err
-		}
+		return nil, err
 	}
 
 	ifd := []ifdEntry{
-		{tImageWidth, dtShort, []uint32{uint32(d.X)}},
-		{tImageLength, dtShort, []uint32{uint32(d.Y)}},
+		shortOrLong(tImageWidth, d.X),
+		shortOrLong(tImageLength, d.Y),
 		{tBitsPerSample, dtShort, bitsPerSample},
-		{tCompression, dtShort, []uint32{compression}},
-		{tPhotometricInterpretation, dtShort, []uint32{photometricInterpretation}},
-		{tStripOffsets, dtLong, []uint32{8}},
-		{tSamplesPerPixel, dtShort, []uint32{samplesPerPixel}},
-		{tRowsPerStrip, dtShort, []uint32{uint32(d.Y)}},
-		{tStripByteCounts, dtLong, []uint32{uint32(imageLen)}},
+		{tCompression, dtShort, []uint64{uint64(compression)}},
+		{tPhotometricInterpretation, dtShort, []uint64{photometricInterpretation}},
+		{tSamplesPerPixel, dtShort, []uint64{samplesPerPixel}},
+		shortOrLong(tRowsPerStrip, d.Y),
 		// There is currently no support for storing the image
 		// resolution, so give a bogus value of 72x72 dpi.
-		{tXResolution, dtRational, []uint32{72, 1}},
-		{tYResolution, dtRational, []uint32{72, 1}},
-		{tResolutionUnit, dtShort, []uint32{resPerInch}},
+		{tXResolution, dtRational, []uint64{72, 1}},
+		{tYResolution, dtRational, []uint64{72, 1}},
+		{tResolutionUnit, dtShort, []uint64{resPerInch}},
 	}
 	if pr != prNone {
-		ifd = append(ifd, ifdEntry{tPredictor, dtShort, []uint32{pr}})
+		ifd = append(ifd, ifdEntry{tPredictor, dtShort, []uint64{pr}})
 	}
 	if len(colorMap) != 0 {
 		ifd = append(ifd, ifdEntry{tColorMap, dtShort, colorMap})
 	}
 	if extraSamples > 0 {
-		ifd = append(ifd, ifdEntry{tExtraSamples, dtShort, []uint32{extraSamples}})
+		ifd = append(ifd, ifdEntry{tExtraSamples, dtShort, []uint64{extraSamples}})
+	}
+	return ifd, nil
+}
+
+// encodeCompressed returns the pixel data of m compressed with the given
+// compression scheme, along with the IFD entries returned by encodePixels.
+func encodeCompressed(m image.Image, compression uint32, predictor bool) ([]byte, []ifdEntry, error) {
+	var buf bytes.Buffer
+	var dst io.WriteCloser
+	switch compression {
+	case cDeflate:
+		dst = zlib.NewWriter(&buf)
+	default:
+		return nil, nil, InternalError("unknown compression")
+	}
+	ifd, err := encodePixels(dst, m, compression, predictor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = dst.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), ifd, nil
+}
+
+// Encode writes the image m to w. opt determines the options used for
+// encoding, such as the compression type. If opt is nil, an uncompressed
+// image is written.
+func Encode(w io.Writer, m image.Image, opt *Options) error {
+	return encodeLevels(w, m, nil, opt)
+}
+
+// encodeLevels writes m to w, followed by the reduced-resolution images
+// in reduced, which are stored as SubIFDs of m.
+//
+// The basic structure of the file is:
+//
+//  1. Header.
+//  2. Image data of m, then of each reduced image.
+//  3. IFD of m, then the IFD of each reduced image.
+func encodeLevels(w io.Writer, m image.Image, reduced []image.Image, opt *Options) error {
+	compression := uint32(cNone)
+	predictor := false
+	bigTIFFMode := AutoBigTIFF
+	var fields IFD
+	if opt != nil {
+		compression = opt.Compression.specValue()
+		// The predictor field is only used with LZW. See page 64 of the spec.
+		predictor = opt.Predictor && compression == cLZW
+		bigTIFFMode = opt.BigTIFF
+		fields = opt.Fields
 	}
 
-	return writeIFD(w, imageLen+8, ifd)
+	// The reduced images are small compared to m, so their pixel data is
+	// always buffered.
+	subData := make([][]byte, len(reduced))
+	subIFDs := make([][]ifdEntry, len(reduced))
+	var subLen int
+	for i, r := range reduced {
+		var err error
+		if compression == cNone {
+			var buf bytes.Buffer
+			subIFDs[i], err = encodePixels(&buf, r, compression, predictor)
+			subData[i] = buf.Bytes()
+		} else {
+			subData[i], subIFDs[i], err = encodeCompressed(r, compression, predictor)
+		}
+		if err != nil {
+			return err
+		}
+		subIFDs[i] = append(subIFDs[i], ifdEntry{tNewSubfileType, dtLong, []uint64{sfReducedImage}})
+		subLen += len(subData[i])
+	}
+	// The extra fields count as data for the choice of BigTIFF, since
+	// maxIFDLen does not account for them.
+	fieldsLen := fieldsLength(fields)
+
+	// imageLen is the length of the pixel data of m in bytes.
+	// The offset of the first IFD is headerLen + imageLen + subLen.
+	var imageLen int
+	var headerLen int
+	var bigTIFF bool
+	var ifd []ifdEntry
+	var err error
+
+	if compression == cNone {
+		// Write the header and IFD offset before outputting pixel data.
+		imageLen = pixelDataLen(m)
+		if bigTIFF, err = bigTIFFMode.useBigTIFF(imageLen + subLen + fieldsLen); err != nil {
+			return err
+		}
+		if headerLen = 8; bigTIFF {
+			headerLen = 16
+		}
+		if err = writeHeader(w, bigTIFF, headerLen+imageLen+subLen); err != nil {
+			return err
+		}
+		if ifd, err = encodePixels(w, m, compression, predictor); err != nil {
+			return err
+		}
+	} else {
+		// Compressed data is written into a buffer first, so that we
+		// know the compressed size.
+		var data []byte
+		if data, ifd, err = encodeCompressed(m, compression, predictor); err != nil {
+			return err
+		}
+		imageLen = len(data)
+		if bigTIFF, err = bigTIFFMode.useBigTIFF(imageLen + subLen + fieldsLen); err != nil {
+			return err
+		}
+		if headerLen = 8; bigTIFF {
+			headerLen = 16
+		}
+		if err = writeHeader(w, bigTIFF, headerLen+imageLen+subLen); err != nil {
+			return err
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+	}
+	for _, data := range subData {
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	// Strip offsets, byte counts and IFD offsets need 64-bit values in
+	// BigTIFF files.
+	offsetType, ifdType := dtLong, dtIFD
+	if bigTIFF {
+		offsetType, ifdType = dtLong8, dtIFD8
+	}
+	ifd = append(ifd,
+		ifdEntry{tStripOffsets, offsetType, []uint64{uint64(headerLen)}},
+		ifdEntry{tStripByteCounts, offsetType, []uint64{uint64(imageLen)}},
+	)
+	if ifd, err = addFields(ifd, fields, bigTIFF); err != nil {
+		return err
+	}
+	dataOffset := headerLen + imageLen
+	for i := range subIFDs {
+		subIFDs[i] = append(subIFDs[i],
+			ifdEntry{tStripOffsets, offsetType, []uint64{uint64(dataOffset)}},
+			ifdEntry{tStripByteCounts, offsetType, []uint64{uint64(len(subData[i]))}},
+		)
+		dataOffset += len(subData[i])
+	}
+	if len(subIFDs) > 0 {
+		ifd = append(ifd, ifdEntry{tSubIFDs, ifdType, make([]uint64, len(subIFDs))})
+	}
+
+	ifdOffset := dataOffset
+	off := ifdOffset + ifdLength(ifd, bigTIFF)
+	subOffsets := make([]int, len(subIFDs))
+	for i := range subIFDs {
+		subOffsets[i] = off
+		off += ifdLength(subIFDs[i], bigTIFF)
+	}
+	if len(subIFDs) > 0 {
+		ent := ifd[len(ifd)-1]
+		for i, o := range subOffsets {
+			ent.data[i] = uint64(o)
+		}
+	}
+
+	if err = writeIFD(w, ifdOffset, ifd, bigTIFF, 0); err != nil {
+		return err
+	}
+	for i := range subIFDs {
+		if err = writeIFD(w, subOffsets[i], subIFDs[i], bigTIFF, 0); err != nil {
+			return err
+		}
+	}
+	return nil
 }
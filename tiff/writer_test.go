@@ -25,6 +25,9 @@ var roundtripTests = []struct {
 	{"video-001.tiff", &Options{Predictor: true}},
 	{"video-001.tiff", &Options{Compression: Deflate}},
 	{"video-001.tiff", &Options{Predictor: true, Compression: Deflate}},
+	{"video-001.tiff", &Options{BigTIFF: AlwaysBigTIFF}},
+	{"video-001-paletted.tiff", &Options{BigTIFF: AlwaysBigTIFF}},
+	{"video-001.tiff", &Options{Compression: Deflate, BigTIFF: AlwaysBigTIFF}},
 }
 
 func openImage(filename string) (image.Image, error) {
@@ -74,6 +77,32 @@ func TestRoundtrip2(t *testing.T) {
 	compare(t, m0, m1)
 }
 
+// TestBigTIFFMode tests when Encode switches to BigTIFF.
+func TestBigTIFFMode(t *testing.T) {
+	m := image.NewGray(image.Rect(0, 0, 4, 4))
+	for _, mode := range []BigTIFFMode{AutoBigTIFF, NeverBigTIFF, AlwaysBigTIFF} {
+		out := new(bytes.Buffer)
+		if err := Encode(out, m, &Options{BigTIFF: mode}); err != nil {
+			t.Fatal(err)
+		}
+		want := leHeader
+		if mode == AlwaysBigTIFF {
+			want = leBigHeader
+		}
+		if got := string(out.Bytes()[:4]); got != want {
+			t.Errorf("mode %d: header %q, want %q", mode, got, want)
+		}
+	}
+
+	const huge = 1 << 32
+	if big, err := AutoBigTIFF.useBigTIFF(huge); err != nil || !big {
+		t.Errorf("AutoBigTIFF: got %v, %v, want true, nil", big, err)
+	}
+	if _, err := NeverBigTIFF.useBigTIFF(huge); err == nil {
+		t.Errorf("NeverBigTIFF: want error for %d bytes of image data", huge)
+	}
+}
+
 func benchmarkEncode(b *testing.B, name string, pixelSize int) {
 	img, err := openImage(name)
 	if err != nil {
@@ -0,0 +1,190 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"image"
+	"math"
+)
+
+// Uncompressed YCbCr data is stored in data units of h*v luma samples
+// followed by one Cb and one Cr sample, where h and v are the horizontal
+// and vertical YCbCrSubSampling factors (page 91-93 of the spec).
+//
+// The YCbCrPositioning tag, which tells where a chroma sample is sited
+// within its h*v block, is ignored: each chroma sample applies to its whole
+// block, as in an image.YCbCr, whether it is centered or cosited.
+
+// ycbcrSubsampleRatio returns the image.YCbCr subsample ratio described by
+// the YCbCrSubSampling tag, which defaults to 2, 2.
+func (d *decoder) ycbcrSubsampleRatio() (image.YCbCrSubsampleRatio, error) {
+	h, v := uint(2), uint(2)
+	if f := d.features[tYCbCrSubSampling]; len(f) == 2 {
+		h, v = f[0], f[1]
+	}
+	switch [2]uint{h, v} {
+	case [2]uint{1, 1}:
+		return image.YCbCrSubsampleRatio444, nil
+	case [2]uint{2, 1}:
+		return image.YCbCrSubsampleRatio422, nil
+	case [2]uint{2, 2}:
+		return image.YCbCrSubsampleRatio420, nil
+	case [2]uint{1, 2}:
+		return image.YCbCrSubsampleRatio440, nil
+	case [2]uint{4, 1}:
+		return image.YCbCrSubsampleRatio411, nil
+	case [2]uint{4, 2}:
+		return image.YCbCrSubsampleRatio410, nil
+	}
+	return 0, UnsupportedError("YCbCr subsampling")
+}
+
+// Default values of the YCbCrCoefficients and ReferenceBlackWhite tags
+// for the JFIF conversion implemented by image.YCbCr.
+var (
+	jfifCoefficients   = []float64{0.299, 0.587, 0.114}
+	jfifReferenceRange = []float64{0, 255, 128, 255, 128, 255}
+)
+
+// isJFIFYCbCr reports whether the YCbCr to RGB conversion of the image is
+// the one of image.YCbCr.
+func (d *decoder) isJFIFYCbCr() bool {
+	return approxEqual(d.rationals[tYCbCrCoefficients], jfifCoefficients) &&
+		approxEqual(d.rationals[tReferenceBlackWhite], jfifReferenceRange)
+}
+
+// approxEqual reports whether v is missing or close to want.
+func approxEqual(v, want []float64) bool {
+	if v == nil {
+		return true
+	}
+	if len(v) != len(want) {
+		return false
+	}
+	for i := range v {
+		if math.Abs(v[i]-want[i]) > 1e-3 {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeYCbCr decodes the data units of a strip or tile into dst.
+func (d *decoder) decodeYCbCr(dst *image.YCbCr, xmin, ymin, xmax, ymax int) error {
+	h, v := 2, 2
+	if f := d.features[tYCbCrSubSampling]; len(f) == 2 {
+		h, v = int(f[0]), int(f[1])
+	}
+	rMaxX := minInt(xmax, dst.Rect.Max.X)
+	rMaxY := minInt(ymax, dst.Rect.Max.Y)
+	unitsAcross := (xmax - xmin + h - 1) / h
+	unitsDown := (rMaxY - ymin + v - 1) / v
+	if len(d.buf) < unitsAcross*unitsDown*(h*v+2) {
+		return FormatError("not enough pixel data")
+	}
+
+	d.off = 0
+	for uy := ymin; uy < rMaxY; uy += v {
+		for ux := xmin; ux < xmin+unitsAcross*h; ux += h {
+			for y := uy; y < uy+v; y++ {
+				for x := ux; x < ux+h; x++ {
+					if x < rMaxX && y < rMaxY {
+						dst.Y[dst.YOffset(x, y)] = d.buf[d.off]
+					}
+					d.off++
+				}
+			}
+			if ux < rMaxX {
+				i := dst.COffset(ux, uy)
+				dst.Cb[i] = d.buf[d.off]
+				dst.Cr[i] = d.buf[d.off+1]
+			}
+			d.off += 2
+		}
+	}
+	return nil
+}
+
+// ycbcrToRGBA converts m to RGB with the YCbCrCoefficients and
+// ReferenceBlackWhite tags (page 90-94 of the spec).
+func (d *decoder) ycbcrToRGBA(m *image.YCbCr) *image.RGBA {
+	coeffs := d.rationals[tYCbCrCoefficients]
+	if len(coeffs) != 3 {
+		coeffs = jfifCoefficients
+	}
+	ref := d.rationals[tReferenceBlackWhite]
+	if len(ref) != 6 {
+		ref = jfifReferenceRange
+	}
+	lumaRed, lumaGreen, lumaBlue := coeffs[0], coeffs[1], coeffs[2]
+
+	// code maps a sample to its value in the coding range.
+	code := func(v uint8, black, white, codingRange float64) float64 {
+		if white == black {
+			return 0
+		}
+		return (float64(v) - black) * codingRange / (white - black)
+	}
+	clamp := func(v float64) uint8 {
+		switch {
+		case v <= 0:
+			return 0
+		case v >= 255:
+			return 255
+		}
+		return uint8(v + 0.5)
+	}
+
+	b := m.Bounds()
+	rgba := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			ci := m.COffset(x, y)
+			yy := code(m.Y[m.YOffset(x, y)], ref[0], ref[1], 255)
+			cb := code(m.Cb[ci], ref[2], ref[3], 127)
+			cr := code(m.Cr[ci], ref[4], ref[5], 127)
+
+			r := cr*(2-2*lumaRed) + yy
+			bl := cb*(2-2*lumaBlue) + yy
+			g := (yy - lumaBlue*bl - lumaRed*r) / lumaGreen
+
+			i := rgba.PixOffset(x, y)
+			rgba.Pix[i+0] = clamp(r)
+			rgba.Pix[i+1] = clamp(g)
+			rgba.Pix[i+2] = clamp(bl)
+			rgba.Pix[i+3] = 0xff
+		}
+	}
+	return rgba
+}
+
+// CIELab images use the D50 white point (page 110 of the spec). labToRGB
+// converts L*, a* and b* to sRGB values from 0 to 1, adapting D50 to the
+// D65 white point of sRGB with the Bradford transform. Colors outside the
+// sRGB gamut are clipped.
+func labToRGB(l, a, b float64) (r, g, bl float64) {
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	fy := (l + 16) / 116
+	x := 0.96422 * finv(fy+a/500)
+	y := finv(fy)
+	z := 0.82521 * finv(fy-b/200)
+	encode := func(v float64) float64 {
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		return math.Max(0, math.Min(1, v))
+	}
+	r = encode(3.1338561*x - 1.6168667*y - 0.4906146*z)
+	g = encode(-0.9787684*x + 1.9161415*y + 0.0334540*z)
+	bl = encode(0.0719453*x - 0.2289914*y + 1.4052427*z)
+	return
+}
@@ -0,0 +1,234 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	imageExt "github.com/chai2010/image"
+)
+
+// ycbcrDataUnits returns the pixels of m as uncompressed TIFF YCbCr data
+// units. Luma samples outside of m repeat the last row or column.
+func ycbcrDataUnits(m *image.YCbCr, h, v int) []byte {
+	var buf []byte
+	b := m.Bounds()
+	for uy := b.Min.Y; uy < b.Max.Y; uy += v {
+		for ux := b.Min.X; ux < b.Max.X; ux += h {
+			for y := uy; y < uy+v; y++ {
+				for x := ux; x < ux+h; x++ {
+					buf = append(buf, m.Y[m.YOffset(minInt(x, b.Max.X-1), minInt(y, b.Max.Y-1))])
+				}
+			}
+			i := m.COffset(ux, uy)
+			buf = append(buf, m.Cb[i], m.Cr[i])
+		}
+	}
+	return buf
+}
+
+func TestDecodeYCbCr(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		h, v     int
+	}{
+		{"video-001.q50.420.jpeg", 2, 2},
+		{"video-001.q50.422.jpeg", 2, 1},
+		{"video-001.q50.440.jpeg", 1, 2},
+		{"video-001.q50.444.jpeg", 1, 1},
+	} {
+		f, err := os.Open(testdataDir + tc.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := jpeg.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := m.(*image.YCbCr)
+		b := want.Bounds()
+
+		ifd := []ifdEntry{
+			{tImageWidth, dtShort, []uint64{uint64(b.Dx())}},
+			{tImageLength, dtShort, []uint64{uint64(b.Dy())}},
+			{tBitsPerSample, dtShort, []uint64{8, 8, 8}},
+			{tSamplesPerPixel, dtShort, []uint64{3}},
+			{tCompression, dtShort, []uint64{cNone}},
+			{tPhotometricInterpretation, dtShort, []uint64{pYCbCr}},
+			{tRowsPerStrip, dtShort, []uint64{uint64(b.Dy())}},
+			{tYCbCrSubSampling, dtShort, []uint64{uint64(tc.h), uint64(tc.v)}},
+			{tYCbCrPositioning, dtShort, []uint64{1}},
+		}
+		img, err := Decode(bytes.NewReader(buildTIFF(t, ycbcrDataUnits(want, tc.h, tc.v), ifd)))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.filename, err)
+		}
+		got, ok := img.(*image.YCbCr)
+		if !ok {
+			t.Fatalf("%s: got %T, want *image.YCbCr", tc.filename, img)
+		}
+		if got.SubsampleRatio != want.SubsampleRatio {
+			t.Fatalf("%s: got subsample ratio %v, want %v", tc.filename, got.SubsampleRatio, want.SubsampleRatio)
+		}
+		compare(t, want, got)
+	}
+}
+
+func TestDecodeYCbCrReferenceBlackWhite(t *testing.T) {
+	// Studio range samples: Y is in [16, 235] and Cb, Cr in [16, 240].
+	data := []byte{
+		16, 235, 128, 128,
+		235, 235, 128, 128,
+	}
+	ifd := []ifdEntry{
+		{tImageWidth, dtShort, []uint64{2}},
+		{tImageLength, dtShort, []uint64{2}},
+		{tBitsPerSample, dtShort, []uint64{8, 8, 8}},
+		{tSamplesPerPixel, dtShort, []uint64{3}},
+		{tPhotometricInterpretation, dtShort, []uint64{pYCbCr}},
+		{tYCbCrSubSampling, dtShort, []uint64{1, 2}},
+		{tReferenceBlackWhite, dtRational, []uint64{16, 1, 235, 1, 128, 1, 240, 1, 128, 1, 240, 1}},
+	}
+	img, err := Decode(bytes.NewReader(buildTIFF(t, data, ifd)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := img.(*image.RGBA)
+	if !ok {
+		t.Fatalf("got %T, want *image.RGBA", img)
+	}
+	want := []uint8{0, 255, 255, 255}
+	for i, p := 0, 0; i < len(m.Pix); i += 4 {
+		if m.Pix[i] != want[p] || m.Pix[i+1] != want[p] || m.Pix[i+2] != want[p] {
+			t.Fatalf("pixel %d: got %v, want gray %d", p, m.Pix[i:i+4], want[p])
+		}
+		p++
+	}
+}
+
+func TestDecodeCMYK(t *testing.T) {
+	want := image.NewCMYK(image.Rect(0, 0, 3, 2))
+	for i := range want.Pix {
+		want.Pix[i] = uint8(i * 10)
+	}
+	// The file is little-endian and the decoder keeps the high byte.
+	data16 := make([]byte, 0, 2*len(want.Pix))
+	for _, v := range want.Pix {
+		data16 = append(data16, 0x7f, v)
+	}
+
+	for _, tc := range []struct {
+		bits uint64
+		data []byte
+	}{
+		{8, want.Pix},
+		{16, data16},
+	} {
+		ifd := []ifdEntry{
+			{tImageWidth, dtShort, []uint64{3}},
+			{tImageLength, dtShort, []uint64{2}},
+			{tBitsPerSample, dtShort, []uint64{tc.bits, tc.bits, tc.bits, tc.bits}},
+			{tSamplesPerPixel, dtShort, []uint64{4}},
+			{tPhotometricInterpretation, dtShort, []uint64{pCMYK}},
+			{tInkSet, dtShort, []uint64{inkCMYK}},
+		}
+		img, err := Decode(bytes.NewReader(buildTIFF(t, tc.data, ifd)))
+		if err != nil {
+			t.Fatalf("%d bits: %v", tc.bits, err)
+		}
+		got, ok := img.(*image.CMYK)
+		if !ok {
+			t.Fatalf("%d bits: got %T, want *image.CMYK", tc.bits, img)
+		}
+		if !bytes.Equal(got.Pix, want.Pix) {
+			t.Fatalf("%d bits: got %v, want %v", tc.bits, got.Pix, want.Pix)
+		}
+	}
+
+	ifd := []ifdEntry{
+		{tImageWidth, dtShort, []uint64{3}},
+		{tImageLength, dtShort, []uint64{2}},
+		{tBitsPerSample, dtShort, []uint64{8, 8, 8, 8}},
+		{tSamplesPerPixel, dtShort, []uint64{4}},
+		{tPhotometricInterpretation, dtShort, []uint64{pCMYK}},
+		{tInkSet, dtShort, []uint64{inkNotCMYK}},
+	}
+	if _, err := Decode(bytes.NewReader(buildTIFF(t, want.Pix, ifd))); err == nil {
+		t.Fatal("decoding a non-CMYK ink set succeeded")
+	}
+
+	// CMYK with an alpha channel.
+	ifd = []ifdEntry{
+		{tImageWidth, dtShort, []uint64{3}},
+		{tImageLength, dtShort, []uint64{2}},
+		{tBitsPerSample, dtShort, []uint64{8, 8, 8, 8, 8}},
+		{tSamplesPerPixel, dtShort, []uint64{5}},
+		{tPhotometricInterpretation, dtShort, []uint64{pCMYK}},
+		{tExtraSamples, dtShort, []uint64{2}},
+	}
+	data := make([]byte, 5*6)
+	if _, err := Decode(bytes.NewReader(buildTIFF(t, data, ifd))); err != UnsupportedError("extra samples of CMYK") {
+		t.Fatalf("CMYK with extra samples: got error %v", err)
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestDecodeCIELab(t *testing.T) {
+	// The pixels are white, black, mid gray, and the sRGB red of L* 54.29,
+	// a* 80.80 and b* 69.89, which is only representable with 16 bits.
+	for _, tc := range []struct {
+		bits  uint64
+		data  []byte
+		width int
+	}{
+		{8, []byte{0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00}, 3},
+		{16, []byte{
+			0xff, 0xff, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x80, 0x00, 0x00, 0x00, 0x00,
+			0xfb, 0x8a, 0xcd, 0x50, 0xe4, 0x45,
+		}, 4},
+	} {
+		ifd := []ifdEntry{
+			{tImageWidth, dtShort, []uint64{uint64(tc.width)}},
+			{tImageLength, dtShort, []uint64{1}},
+			{tBitsPerSample, dtShort, []uint64{tc.bits, tc.bits, tc.bits}},
+			{tSamplesPerPixel, dtShort, []uint64{3}},
+			{tPhotometricInterpretation, dtShort, []uint64{pCIELab}},
+		}
+		img, err := Decode(bytes.NewReader(buildTIFF(t, tc.data, ifd)))
+		if err != nil {
+			t.Fatalf("%d bits: %v", tc.bits, err)
+		}
+		if _, ok := img.(*imageExt.RGB96f); !ok {
+			t.Fatalf("%d bits: got %T, want *imageExt.RGB96f", tc.bits, img)
+		}
+		want := []color.RGBA64{
+			{0xffff, 0xffff, 0xffff, 0xffff},
+			{0, 0, 0, 0xffff},
+			{0x7760, 0x7760, 0x7760, 0xffff},
+			{0xffff, 0, 0, 0xffff},
+		}
+		for x := 0; x < tc.width; x++ {
+			r, g, b, a := img.At(x, 0).RGBA()
+			c := want[x]
+			if absDiff(r, uint32(c.R)) > 0x100 || absDiff(g, uint32(c.G)) > 0x100 || absDiff(b, uint32(c.B)) > 0x100 || a != 0xffff {
+				t.Fatalf("%d bits: pixel %d: got %#x, %#x, %#x, %#x, want %v", tc.bits, x, r, g, b, a, c)
+			}
+		}
+	}
+}
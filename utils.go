@@ -29,6 +29,15 @@ func pSetGray16(pix []byte, c colorExt.Gray16) {
 	binary.BigEndian.PutUint16(pix[2*0:], c.Y)
 }
 
+func pGray16fAt(pix []byte) colorExt.Gray16f {
+	return colorExt.Gray16f{
+		Y: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*0:])),
+	}
+}
+func pSetGray16f(pix []byte, c colorExt.Gray16f) {
+	binary.BigEndian.PutUint16(pix[2*0:], colorExt.Float32ToFloat16(c.Y))
+}
+
 func pGray32iAt(pix []byte) colorExt.Gray32i {
 	return colorExt.Gray32i{
 		Y: int32(binary.BigEndian.Uint32(pix[4*0:])),
@@ -87,6 +96,17 @@ func pSetGrayA32(pix []byte, c colorExt.GrayA32) {
 	binary.BigEndian.PutUint16(pix[2*1:], c.A)
 }
 
+func pGrayA32fAt(pix []byte) colorExt.GrayA32f {
+	return colorExt.GrayA32f{
+		Y: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*0:])),
+		A: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*1:])),
+	}
+}
+func pSetGrayA32f(pix []byte, c colorExt.GrayA32f) {
+	binary.BigEndian.PutUint16(pix[2*0:], colorExt.Float32ToFloat16(c.Y))
+	binary.BigEndian.PutUint16(pix[2*1:], colorExt.Float32ToFloat16(c.A))
+}
+
 func pGrayA64iAt(pix []byte) colorExt.GrayA64i {
 	return colorExt.GrayA64i{
 		Y: int32(binary.BigEndian.Uint32(pix[4*0:])),
@@ -157,6 +177,19 @@ func pSetRGB48(pix []byte, c colorExt.RGB48) {
 	binary.BigEndian.PutUint16(pix[2*2:], c.B)
 }
 
+func pRGB48fAt(pix []byte) colorExt.RGB48f {
+	return colorExt.RGB48f{
+		R: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*0:])),
+		G: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*1:])),
+		B: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*2:])),
+	}
+}
+func pSetRGB48f(pix []byte, c colorExt.RGB48f) {
+	binary.BigEndian.PutUint16(pix[2*0:], colorExt.Float32ToFloat16(c.R))
+	binary.BigEndian.PutUint16(pix[2*1:], colorExt.Float32ToFloat16(c.G))
+	binary.BigEndian.PutUint16(pix[2*2:], colorExt.Float32ToFloat16(c.B))
+}
+
 func pRGB96iAt(pix []byte) colorExt.RGB96i {
 	return colorExt.RGB96i{
 		R: int32(binary.BigEndian.Uint32(pix[4*0:])),
@@ -239,6 +272,21 @@ func pSetRGBA64(pix []byte, c colorExt.RGBA64) {
 	binary.BigEndian.PutUint16(pix[2*3:], c.A)
 }
 
+func pRGBA64fAt(pix []byte) colorExt.RGBA64f {
+	return colorExt.RGBA64f{
+		R: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*0:])),
+		G: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*1:])),
+		B: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*2:])),
+		A: colorExt.Float16ToFloat32(binary.BigEndian.Uint16(pix[2*3:])),
+	}
+}
+func pSetRGBA64f(pix []byte, c colorExt.RGBA64f) {
+	binary.BigEndian.PutUint16(pix[2*0:], colorExt.Float32ToFloat16(c.R))
+	binary.BigEndian.PutUint16(pix[2*1:], colorExt.Float32ToFloat16(c.G))
+	binary.BigEndian.PutUint16(pix[2*2:], colorExt.Float32ToFloat16(c.B))
+	binary.BigEndian.PutUint16(pix[2*3:], colorExt.Float32ToFloat16(c.A))
+}
+
 func pRGBA128iAt(pix []byte) colorExt.RGBA128i {
 	return colorExt.RGBA128i{
 		R: int32(binary.BigEndian.Uint32(pix[4*0:])),
@@ -8,6 +8,8 @@ import (
 	"image"
 	"image/color"
 	"reflect"
+
+	imageExt "github.com/chai2010/image"
 )
 
 var (
@@ -29,9 +31,9 @@ func (p *_RGB) Init(pix []uint8, stride int, rect image.Rectangle) *_RGB {
 			Stride int
 			Rect   image.Rectangle
 		}{
-			Pix:    p.M.Pix,
-			Stride: p.M.Stride,
-			Rect:   p.M.Rect,
+			Pix:    pix,
+			Stride: stride,
+			Rect:   rect,
 		},
 	}
 	return p
@@ -146,6 +148,9 @@ func newRGB(r image.Rectangle) *_RGB {
 }
 
 func newRGBFromImage(m image.Image) *_RGB {
+	if p, ok := m.(*imageExt.Planar); ok {
+		m = p.Interleave()
+	}
 	if m, ok := m.(*_RGB); ok {
 		return m
 	}
@@ -5,6 +5,8 @@
 package webp
 
 import (
+	"image"
+	"image/color"
 	"io/ioutil"
 	"testing"
 )
@@ -47,3 +49,14 @@ var tGetInfoTesterList = []tGetInfoTester{
 		HasAlpha: true,
 	},
 }
+
+func TestRGBInit(t *testing.T) {
+	pix := []uint8{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	m := new(_RGB).Init(pix, 6, image.Rect(1, 1, 3, 3))
+	if &m.Pix()[0] != &pix[0] || m.Stride() != 6 || m.Bounds() != image.Rect(1, 1, 3, 3) {
+		t.Fatalf("got stride %d and bounds %v", m.Stride(), m.Bounds())
+	}
+	if c := m.At(2, 2); c != (color.RGBA{R: 10, G: 11, B: 12, A: 0xff}) {
+		t.Fatalf("got %v", c)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"image/color"
 	"io"
 	"reflect"
+
+	imageExt "github.com/chai2010/image"
 )
 
 const DefaulQuality = 90
@@ -66,6 +68,9 @@ func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
 }
 
 func adjustImage(m image.Image) image.Image {
+	if p, ok := m.(*imageExt.Planar); ok {
+		m = p.Interleave()
+	}
 	switch m := m.(type) {
 	case *image.Gray, *image.RGBA, *_RGB:
 		return m